@@ -28,14 +28,29 @@ type Event struct {
 	ReturnValue         int        `json:"returnValue"`
 	StackAddresses      []uint64   `json:"stackAddresses"`
 	Args                []Argument `json:"args"` //Arguments are ordered according their appearance in the original event
+	MatchedScopes       []string   `json:"matchedScopes,omitempty"`
 }
 
 type Stats struct {
-	EventCount  int
-	ErrorCount  int
-	LostEvCount int
-	LostWrCount int
-	LostNtCount int
+	EventCount   int
+	ErrorCount   int
+	LostEvCount  int
+	LostWrCount  int
+	LostNtCount  int
+	EvictedCount int
+	// NetStats are the stats of the traced network interfaces, by interface name
+	NetStats          map[string]NetIfaceStats
+	PcapErrorCount    int // packets that failed to be written to a pcap file
+	UnknownIfaceCount int // packets that were dropped, since they were captured on an unknown interface
+	ScanDroppedCount  int // artifact scans that were dropped, since the scan queue was full
+}
+
+// NetIfaceStats counts the packets captured on a network interface, per direction
+type NetIfaceStats struct {
+	IngressPackets int
+	IngressBytes   int
+	EgressPackets  int
+	EgressBytes    int
 }
 
 // ToUnstructured returns a JSON compatible map with string, float, int, bool,
@@ -69,7 +84,7 @@ func (e Event) ToUnstructured() (map[string]interface{}, error) {
 		stackAddressesRef = make([]interface{}, len(e.StackAddresses))
 	}
 
-	return map[string]interface{}{
+	unstructured := map[string]interface{}{
 		"timestamp":           json.Number(strconv.Itoa(e.Timestamp)),
 		"processId":           json.Number(strconv.Itoa(e.ProcessID)),
 		"threadId":            json.Number(strconv.Itoa(e.ThreadID)),
@@ -89,7 +104,18 @@ func (e Event) ToUnstructured() (map[string]interface{}, error) {
 		"returnValue":         json.Number(strconv.Itoa(e.ReturnValue)),
 		"args":                argsRef,
 		"stackAddresses":      stackAddressesRef,
-	}, nil
+	}
+
+	// matchedScopes is omitted from the JSON representation when empty
+	if len(e.MatchedScopes) > 0 {
+		matchedScopes := make([]interface{}, len(e.MatchedScopes))
+		for i, s := range e.MatchedScopes {
+			matchedScopes[i] = s
+		}
+		unstructured["matchedScopes"] = matchedScopes
+	}
+
+	return unstructured, nil
 }
 
 func jsonRoundTripArgumentValue(v interface{}) (interface{}, error) {
@@ -188,6 +188,14 @@ func TestEvent_ToUnstructured(t *testing.T) {
 				ReturnValue:         14,
 			},
 		},
+		{
+			name: "Should unstructure Event with matched scopes",
+			event: Event{
+				EventID:       257,
+				EventName:     "openat",
+				MatchedScopes: []string{"nginx", "all-containers"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aquasecurity/libbpfgo/helpers"
 	"github.com/aquasecurity/tracee/tracee-ebpf/external"
@@ -70,14 +72,31 @@ func main() {
 				printFilterHelp()
 				return nil
 			}
-			filter, err := prepareFilter(c.StringSlice("trace"))
+			traceFilters, scopes, err := prepareScopes(c.StringSlice("trace"))
 			if err != nil {
 				return err
 			}
+			filter, err := prepareFilter(traceFilters)
+			if err != nil {
+				return err
+			}
+			if len(scopes) > 0 {
+				for _, f := range traceFilters {
+					if isEventSelection(f) {
+						return fmt.Errorf("events must be selected per scope when scopes are used: %s", f)
+					}
+				}
+				// The kernel traces the union of the scopes events, and drops the events of each scope that it didn't select
+				filter.EventsToTrace = scopesEventsUnion(scopes)
+			}
 			cfg.Filter = &filter
+			cfg.Scopes = scopes
 
 			containerMode := (cfg.Filter.ContFilter.Enabled && cfg.Filter.ContFilter.Value) ||
 				(cfg.Filter.NewContFilter.Enabled && cfg.Filter.NewContFilter.Value)
+			for _, s := range scopes {
+				containerMode = containerMode || (s.Filter.ContFilter.Enabled && s.Filter.ContFilter.Value)
+			}
 
 			if checkCommandIsHelp(c.StringSlice("output")) {
 				printOutputHelp()
@@ -243,6 +262,16 @@ func main() {
 			if err != nil {
 				return fmt.Errorf("error creating Tracee: %v", err)
 			}
+			if c.Bool("metrics") {
+				go func() {
+					addr := c.String("metrics-addr")
+					fmt.Fprintf(os.Stdout, "Serving metrics endpoint at %s\n", addr)
+					if err := http.ListenAndServe(addr, metricsHandler(t.GetStats)); err != http.ErrServerClosed {
+						fmt.Fprintf(os.Stderr, "Error serving metrics endpoint: %v\n", err)
+					}
+				}()
+			}
+
 			err = t.Run()
 
 			stats := t.GetStats()
@@ -286,6 +315,15 @@ func main() {
 				Value: 1024,
 				Usage: "size, in pages, of the internal perf ring buffer used to send blobs from the kernel",
 			},
+			&cli.BoolFlag{
+				Name:  "metrics",
+				Usage: "serve the stats of the run, e.g. the network capture stats, in the prometheus format at /metrics",
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "listening address of the metrics endpoint server",
+				Value: ":3366",
+			},
 			&cli.BoolFlag{
 				Name:        "debug",
 				Value:       false,
@@ -461,10 +499,21 @@ Possible options:
 [artifact:]module                  capture loaded kernel modules.
 [artifact:]mem                     capture memory regions that had write+execute (w+x) protection, and then changed to execute (x) only.
 [artifact:]net=interface           capture network traffic of the given interface. Only TCP/UDP protocols are currently supported.
+                                   packets are written to capture.pcap, with a comment of the process that sent or received them, and their flows are summarized in flows.json.
 
 dir:/path/to/dir        path where tracee will save produced artifacts. the artifact will be saved into an 'out' subdirectory. (default: /tmp/tracee).
 profile                 creates a runtime profile of program executions and their metadata for forensics use.
 clear-dir               clear the captured artifacts output dir before starting (default: false).
+store                   store captured files once per SHA256 under the 'sha256' subdirectory, and record them in 'manifest.json'.
+max-size=SIZE           evict the least recently written artifacts when the captured artifacts exceed SIZE bytes. K, M and G suffixes are supported.
+max-mntns-size=SIZE     evict the least recently written artifacts of a mount namespace (container) when its artifacts exceed SIZE bytes.
+max-age=DURATION        evict artifacts that were not written for DURATION (e.g. 30m, 24h).
+pcap:container          split captured network traffic into a pcap file per container, under the 'pcap' subdirectory.
+pcap:process            split captured network traffic into a pcap file per process, under the 'pcap/<container>' subdirectory.
+pcap-rotate-size=SIZE   start a new pcap file once the current one exceeds SIZE bytes. K, M and G suffixes are supported.
+pcap-rotate-interval=DURATION start a new pcap file once the current one is older than DURATION (e.g. 1h).
+scan:/path/to/rules     scan captured artifacts with the YARA rules (*.yar, *.yara) in the given directory, and emit an 'artifact_scan_match' event for every matching rule.
+                        written files are scanned once they were not written to for a few seconds. only a subset of the YARA language is supported, see the documentation.
 
 Examples:
   --capture exec                                           | capture executed files into the default output directory
@@ -472,7 +521,11 @@ Examples:
   --capture write=/usr/bin/* --capture write=/etc/*        | capture files that were written into anywhere under /usr/bin/ or /etc/
   --capture profile                                        | capture executed files and create a runtime profile in the output directory
   --capture net=eth0                                       | capture network traffic of eth0
+  --capture net=eth0 --capture pcap:container --capture pcap-rotate-size=100M | capture network traffic of eth0 into a pcap file per container, starting a new file every 100MB
   --capture exec --output none                             | capture executed files into the default output directory not printing the stream of events
+  --capture exec --capture store                           | capture executed files, storing identical files once, and add their sha256 to the exec events
+  --capture exec --capture max-size=1G --capture max-age=24h | capture executed files, keeping up to 1GB of files that were captured in the last 24 hours
+  --capture exec --capture mem --capture scan:/etc/yara    | capture executed files and memory regions, and scan them with the rules in /etc/yara
 
 Use this flag multiple times to choose multiple capture options
 `
@@ -535,11 +588,55 @@ func prepareCapture(captureSlice []string) (tracee.CaptureConfig, error) {
 		} else if cap == "profile" {
 			capture.Exec = true
 			capture.Profile = true
+		} else if cap == "store" {
+			capture.Store = true
+		} else if strings.HasPrefix(cap, "max-size=") {
+			size, err := parseSize(strings.TrimPrefix(cap, "max-size="))
+			if err != nil {
+				return tracee.CaptureConfig{}, fmt.Errorf("invalid capture max-size: %v", err)
+			}
+			capture.Retention.MaxTotalSize = size
+		} else if strings.HasPrefix(cap, "max-mntns-size=") {
+			size, err := parseSize(strings.TrimPrefix(cap, "max-mntns-size="))
+			if err != nil {
+				return tracee.CaptureConfig{}, fmt.Errorf("invalid capture max-mntns-size: %v", err)
+			}
+			capture.Retention.MaxMntNsSize = size
+		} else if strings.HasPrefix(cap, "max-age=") {
+			age, err := time.ParseDuration(strings.TrimPrefix(cap, "max-age="))
+			if err != nil || age <= 0 {
+				return tracee.CaptureConfig{}, fmt.Errorf("invalid capture max-age: %s", strings.TrimPrefix(cap, "max-age="))
+			}
+			capture.Retention.MaxAge = age
+		} else if cap == "pcap:container" {
+			capture.Pcap.Split = tracee.PcapSplitContainer
+		} else if cap == "pcap:process" {
+			capture.Pcap.Split = tracee.PcapSplitProcess
+		} else if strings.HasPrefix(cap, "pcap-rotate-size=") {
+			size, err := parseSize(strings.TrimPrefix(cap, "pcap-rotate-size="))
+			if err != nil {
+				return tracee.CaptureConfig{}, fmt.Errorf("invalid capture pcap-rotate-size: %v", err)
+			}
+			capture.Pcap.RotateSize = size
+		} else if strings.HasPrefix(cap, "pcap-rotate-interval=") {
+			interval, err := time.ParseDuration(strings.TrimPrefix(cap, "pcap-rotate-interval="))
+			if err != nil || interval <= 0 {
+				return tracee.CaptureConfig{}, fmt.Errorf("invalid capture pcap-rotate-interval: %s", strings.TrimPrefix(cap, "pcap-rotate-interval="))
+			}
+			capture.Pcap.RotateInterval = interval
+		} else if strings.HasPrefix(cap, "scan:") {
+			capture.ScanRulesDir = strings.TrimPrefix(cap, "scan:")
+			if len(capture.ScanRulesDir) == 0 {
+				return tracee.CaptureConfig{}, fmt.Errorf("capture scan rules dir cannot be empty")
+			}
 		} else {
 			return tracee.CaptureConfig{}, fmt.Errorf("invalid capture option specified, use '--capture help' for more info")
 		}
 	}
 	capture.FilterFileWrite = filterFileWrite
+	if capture.Pcap != (tracee.PcapConfig{}) && len(capture.NetIfaces) == 0 {
+		return tracee.CaptureConfig{}, fmt.Errorf("pcap capture options require capturing network traffic (net=interface)")
+	}
 
 	capture.OutputPath = filepath.Join(outDir, "out")
 	if clearDir {
@@ -549,6 +646,27 @@ func prepareCapture(captureSlice []string) (tracee.CaptureConfig, error) {
 	return capture, nil
 }
 
+// parseSize parses a size in bytes, with an optional K, M or G suffix (powers of 1024)
+func parseSize(sizeString string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(sizeString, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(sizeString, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(sizeString, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		sizeString = sizeString[:len(sizeString)-1]
+	}
+	size, err := strconv.ParseInt(sizeString, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", sizeString)
+	}
+	return size * multiplier, nil
+}
+
 func printFilterHelp() {
 	filterHelp := `Select which events to trace by defining trace expressions that operate on events or process metadata.
 Only events that match all trace expressions will be traced (trace flags are ANDed).
@@ -559,6 +677,8 @@ Available numerical expressions: uid, pid, mntns, pidns.
 
 String expressions which compares text and allow the following operators: '=', '!='.
 Available string expressions: event, set, uts, comm.
+The uts and comm values are matched as a prefix if ending with '*', as a suffix if starting with '*', or as a glob if they contain other '*' or '?' wildcards.
+Suffix and glob patterns are evaluated in userspace and can't be used with 'follow'.
 
 Boolean expressions that check if a boolean is true and allow the following operator: '!'.
 Available boolean expressions: container.
@@ -566,6 +686,8 @@ Available boolean expressions: container.
 Event arguments can be accessed using 'event_name.event_arg' and provide a way to filter an event by its arguments.
 Event arguments allow the following operators: '=', '!='.
 Strings can be compared as a prefix if ending with '*'.
+Integer arguments also allow the operators '<', '>', and the bitmask operators '&' (all the given bits are set) and '!&' (not all the given bits are set).
+Their values can be given as decimal, hex or octal numbers, or as the constants that are used when printing the argument (e.g. O_CREAT), and can be ORed using '|'.
 
 Event return value can be accessed using 'event_name.retval' and provide a way to filter an event by its return value.
 Event return value expression has the same syntax as a numerical expression.
@@ -579,6 +701,16 @@ The field 'set' selects a set of events to trace according to predefined sets, w
 
 The special 'follow' expression declares that not only processes that match the criteria will be traced, but also their descendants.
 
+The special 'net' expression selects the network interfaces whose packets are aggregated into flows, and emitted as the
+'net_flow_start' and 'net_flow_end' events, whose DNS messages are emitted as the 'net_dns_request' and 'net_dns_response'
+events, and whose plain HTTP/1.x requests are emitted as 'net_http_request' events (e.g. 'net=eth0').
+These events require at least one interface to trace.
+
+Expressions can be given to a named scope by prefixing them with the scope name, e.g. 'web:comm=nginx'.
+Each scope selects its own events and is matched independently of other scopes (scopes are ORed),
+while expressions without a scope prefix apply to all scopes. Every event is tagged with the scopes it matched.
+When scopes are used, events must be selected per scope, and the expressions 'follow', 'net', 'pid=new' and 'container=new' are not supported in scopes.
+
 Examples:
   --trace pid=new                                              | only trace events from new processes
   --trace pid=510,1709                                         | only trace events from pid 510 or pid 1709
@@ -603,10 +735,21 @@ Examples:
   --trace s=fs --trace e!=open,openat                          | trace all file-system related events, but not open(at)
   --trace uts!=ab356bc4dd554                                   | don't trace events from uts name ab356bc4dd554
   --trace comm=ls                                              | only trace events from ls command
+  --trace 'comm=kworker*'                                      | only trace events from commands prefixed by "kworker"
+  --trace 'comm!=*.sh'                                         | don't trace events from commands suffixed by ".sh"
   --trace close.fd=5                                           | only trace 'close' events that have 'fd' equals 5
   --trace openat.pathname=/tmp*                                | only trace 'openat' events that have 'pathname' prefixed by "/tmp"
   --trace openat.pathname!=/tmp/1,/bin/ls                      | don't trace 'openat' events that have 'pathname' equals /tmp/1 or /bin/ls
+  --trace 'close.fd>2' --trace 'close.fd<10'                   | only trace 'close' events that have 'fd' between 2 and 10
+  --trace 'openat.flags&O_CREAT'                               | only trace 'openat' events that have the O_CREAT bit set in 'flags'
+  --trace 'mmap.prot&PROT_EXEC' --trace 'mmap.prot!&PROT_WRITE' | only trace 'mmap' events that map executable memory which is not also writable
   --trace comm=bash --trace follow                             | trace all events that originated from bash or from one of the processes spawned by bash
+  --trace net=eth0 --trace event=net_flow_start,net_flow_end   | trace the network flows of processes that go through eth0
+  --trace net=eth0 --trace 'net_flow_start.dstPort!=80,443'   | trace network flows through eth0 to ports other than 80 and 443
+  --trace net=eth0 --trace event=net_dns_request               | trace the DNS queries of processes that go through eth0
+  --trace net=eth0 --trace net_http_request.dstPort=10250      | trace the HTTP requests of processes to the kubelet API through eth0
+  --trace all:e=execve --trace web:e=openat --trace web:comm=nginx | trace execve from all processes, and openat only from nginx
+  --trace c --trace a:e=execve --trace b:e=openat --trace b:tree=1234 | in containers: trace execve, and openat only from the process tree of 1234
 
 
 Note: some of the above operators have special meanings in different shells.
@@ -663,6 +806,7 @@ func prepareFilter(filters []string) (tracee.Filter, error) {
 		ProcessTreeFilter: &tracee.ProcessTreeFilter{
 			PIDs: make(map[uint32]bool),
 		},
+		NetFilter:     &tracee.NetIfaces{},
 		EventsToTrace: []int32{},
 	}
 
@@ -677,7 +821,7 @@ func prepareFilter(filters []string) (tracee.Filter, error) {
 	for _, f := range filters {
 		filterName := f
 		operatorAndValues := ""
-		operatorIndex := strings.IndexAny(f, "=!<>")
+		operatorIndex := strings.IndexAny(f, "=!<>&")
 		if operatorIndex > 0 {
 			filterName = f[0:operatorIndex]
 			operatorAndValues = f[operatorIndex:]
@@ -771,6 +915,14 @@ func prepareFilter(filters []string) (tracee.Filter, error) {
 			continue
 		}
 
+		if filterName == "net" {
+			err := filter.NetFilter.Parse(operatorAndValues)
+			if err != nil {
+				return tracee.Filter{}, err
+			}
+			continue
+		}
+
 		if strings.HasPrefix("pid", filterName) {
 			if operatorAndValues == "=new" {
 				filter.NewPidFilter.Enabled = true
@@ -830,6 +982,88 @@ func prepareFilter(filters []string) (tracee.Filter, error) {
 	return filter, nil
 }
 
+var scopeNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// prepareScopes separates the trace expressions given to a named scope ("scope:expression") from the global ones,
+// and parses the expressions of every scope into a filter. Scopes are returned in order of appearance.
+func prepareScopes(filters []string) ([]string, []*tracee.Scope, error) {
+	var globalFilters []string
+	var scopeNames []string
+	scopeFilters := make(map[string][]string)
+
+	for _, f := range filters {
+		sepIndex := strings.Index(f, ":")
+		operatorIndex := strings.IndexAny(f, "=!<>&")
+		if sepIndex <= 0 || (operatorIndex >= 0 && operatorIndex < sepIndex) || !scopeNameRegexp.MatchString(f[:sepIndex]) {
+			globalFilters = append(globalFilters, f)
+			continue
+		}
+		name := f[:sepIndex]
+		if _, ok := scopeFilters[name]; !ok {
+			scopeNames = append(scopeNames, name)
+		}
+		scopeFilters[name] = append(scopeFilters[name], f[sepIndex+1:])
+	}
+
+	scopes := make([]*tracee.Scope, 0, len(scopeNames))
+	for _, name := range scopeNames {
+		// the container expression sets the new pid filter too, so pid=new is rejected by its expression
+		for _, f := range scopeFilters[name] {
+			if isNewPidExpression(f) {
+				return nil, nil, fmt.Errorf("scope %s: pid=new is not supported in scopes", name)
+			}
+		}
+		filter, err := prepareFilter(scopeFilters[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("scope %s: %v", name, err)
+		}
+		scope := &tracee.Scope{Name: name, Filter: &filter}
+		if err := scope.Validate(); err != nil {
+			return nil, nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return globalFilters, scopes, nil
+}
+
+// isNewPidExpression returns true if the given trace expression is pid=new or pid!=new
+func isNewPidExpression(f string) bool {
+	operatorIndex := strings.IndexAny(f, "=!<>&")
+	if operatorIndex <= 0 {
+		return false
+	}
+	operatorAndValues := f[operatorIndex:]
+	return strings.HasPrefix("pid", f[:operatorIndex]) && (operatorAndValues == "=new" || operatorAndValues == "!=new")
+}
+
+// isEventSelection returns true if the given trace expression selects events (event or set)
+func isEventSelection(f string) bool {
+	filterName := f
+	operatorIndex := strings.IndexAny(f, "=!<>&")
+	if operatorIndex > 0 {
+		filterName = f[0:operatorIndex]
+	}
+	if strings.Contains(filterName, ".") || filterName == "" {
+		return false
+	}
+	return strings.HasPrefix("event", filterName) || strings.HasPrefix("set", filterName)
+}
+
+func scopesEventsUnion(scopes []*tracee.Scope) []int32 {
+	var res []int32
+	added := make(map[int32]bool)
+	for _, s := range scopes {
+		for _, e := range s.Filter.EventsToTrace {
+			if !added[e] {
+				added[e] = true
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
 func prepareEventsToTrace(eventFilter *tracee.StringFilter, setFilter *tracee.StringFilter, eventsNameToID map[string]int32) ([]int32, error) {
 	eventFilter.Enabled = true
 	eventsToTrace := eventFilter.Equal
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/syndtr/gocapability/capability"
 
@@ -1060,6 +1061,90 @@ func TestPrepareFilter(t *testing.T) {
 	}
 }
 
+func TestPrepareScopes(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		filters        []string
+		expectedGlobal []string
+		expectedScopes []string
+		expectedEvents map[string][]int32
+		expectedComms  map[string][]string
+		expectedError  error
+	}{
+		{
+			testName:       "no scopes",
+			filters:        []string{"comm=ls", "openat.pathname=/tmp:x"},
+			expectedGlobal: []string{"comm=ls", "openat.pathname=/tmp:x"},
+			expectedScopes: []string{},
+		},
+		{
+			testName:       "scopes and global expressions",
+			filters:        []string{"container", "all:e=execve", "web:event=openat", "web:comm=nginx"},
+			expectedGlobal: []string{"container"},
+			expectedScopes: []string{"all", "web"},
+			expectedEvents: map[string][]int32{
+				"all": {tracee.ExecveEventID},
+				"web": {tracee.OpenatEventID},
+			},
+			expectedComms: map[string][]string{
+				"all": {},
+				"web": {"nginx"},
+			},
+		},
+		{
+			testName:      "invalid scoped expression",
+			filters:       []string{"web:comm=nginx", "web:foo=bar"},
+			expectedError: errors.New("scope web: invalid filter option specified, use '--trace help' for more info"),
+		},
+		{
+			testName:      "follow in scope",
+			filters:       []string{"web:follow"},
+			expectedError: errors.New("scope web: follow is not supported in scopes"),
+		},
+		{
+			testName:      "new pids in scope",
+			filters:       []string{"web:pid=new"},
+			expectedError: errors.New("scope web: pid=new is not supported in scopes"),
+		},
+		{
+			testName:      "new pids in scope with a container expression",
+			filters:       []string{"web:container", "web:pid!=new"},
+			expectedError: errors.New("scope web: pid=new is not supported in scopes"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			global, scopes, err := prepareScopes(tc.filters)
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedGlobal, global)
+			names := []string{}
+			for _, s := range scopes {
+				names = append(names, s.Name)
+				if tc.expectedEvents != nil {
+					assert.Equal(t, tc.expectedEvents[s.Name], s.Filter.EventsToTrace)
+				}
+				if tc.expectedComms != nil {
+					assert.Equal(t, tc.expectedComms[s.Name], s.Filter.CommFilter.Equal)
+				}
+			}
+			assert.Equal(t, tc.expectedScopes, names)
+		})
+	}
+}
+
+func TestIsEventSelection(t *testing.T) {
+	assert.True(t, isEventSelection("e=execve"))
+	assert.True(t, isEventSelection("event!=open*"))
+	assert.True(t, isEventSelection("s=fs"))
+	assert.False(t, isEventSelection("comm=ls"))
+	assert.False(t, isEventSelection("openat.pathname=/tmp"))
+	assert.False(t, isEventSelection("container"))
+}
+
 func TestPrepareCapture(t *testing.T) {
 	t.Run("various capture options", func(t *testing.T) {
 		testCases := []struct {
@@ -1180,6 +1265,52 @@ func TestPrepareCapture(t *testing.T) {
 				},
 				expectedError: nil,
 			},
+			{
+				testName:     "capture exec into the store",
+				captureSlice: []string{"exec", "store"},
+				expectedCapture: tracee.CaptureConfig{
+					OutputPath: "/tmp/tracee/out",
+					Exec:       true,
+					Store:      true,
+				},
+			},
+			{
+				testName:     "capture retention",
+				captureSlice: []string{"exec", "max-size=1G", "max-mntns-size=100M", "max-age=24h"},
+				expectedCapture: tracee.CaptureConfig{
+					OutputPath: "/tmp/tracee/out",
+					Exec:       true,
+					Retention: tracee.RetentionConfig{
+						MaxTotalSize: 1024 * 1024 * 1024,
+						MaxMntNsSize: 100 * 1024 * 1024,
+						MaxAge:       24 * time.Hour,
+					},
+				},
+			},
+			{
+				testName:     "capture exec and scan",
+				captureSlice: []string{"exec", "scan:/etc/yara"},
+				expectedCapture: tracee.CaptureConfig{
+					OutputPath:   "/tmp/tracee/out",
+					Exec:         true,
+					ScanRulesDir: "/etc/yara",
+				},
+			},
+			{
+				testName:      "empty capture scan rules dir",
+				captureSlice:  []string{"scan:"},
+				expectedError: errors.New("capture scan rules dir cannot be empty"),
+			},
+			{
+				testName:      "invalid capture max size",
+				captureSlice:  []string{"max-size=1T"},
+				expectedError: errors.New("invalid capture max-size: invalid size: 1T"),
+			},
+			{
+				testName:      "invalid capture max age",
+				captureSlice:  []string{"max-age=-1h"},
+				expectedError: errors.New("invalid capture max-age: -1h"),
+			},
 			{
 				testName:     "network interface",
 				captureSlice: []string{"net=lo"},
@@ -1188,6 +1319,24 @@ func TestPrepareCapture(t *testing.T) {
 					NetIfaces:  []string{"lo"},
 				},
 			},
+			{
+				testName:     "network interface split by container and rotated",
+				captureSlice: []string{"net=lo", "pcap:container", "pcap-rotate-size=100M", "pcap-rotate-interval=1h"},
+				expectedCapture: tracee.CaptureConfig{
+					OutputPath: "/tmp/tracee/out",
+					NetIfaces:  []string{"lo"},
+					Pcap: tracee.PcapConfig{
+						Split:          tracee.PcapSplitContainer,
+						RotateSize:     100 * 1024 * 1024,
+						RotateInterval: time.Hour,
+					},
+				},
+			},
+			{
+				testName:      "pcap options without network interface",
+				captureSlice:  []string{"pcap:process"},
+				expectedError: errors.New("pcap capture options require capturing network traffic (net=interface)"),
+			},
 			{
 				testName:     "network interface, but repeated",
 				captureSlice: []string{"net=lo", "net=lo"},
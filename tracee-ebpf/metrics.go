@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+)
+
+// writeMetrics writes stats in the prometheus text exposition format
+func writeMetrics(w io.Writer, stats external.Stats) {
+	counters := []struct {
+		name  string
+		help  string
+		value int
+	}{
+		{"tracee_ebpf_events_total", "Events that were emitted.", stats.EventCount},
+		{"tracee_ebpf_errors_total", "Errors that occurred while processing events.", stats.ErrorCount},
+		{"tracee_ebpf_lost_events_total", "Events that were lost in the events perf buffer.", stats.LostEvCount},
+		{"tracee_ebpf_lost_writes_total", "Captured writes that were lost in the file writes perf buffer.", stats.LostWrCount},
+		{"tracee_ebpf_lost_net_events_total", "Network events that were lost in the network perf buffer.", stats.LostNtCount},
+		{"tracee_ebpf_evicted_artifacts_total", "Captured artifacts that were evicted by the capture retention limits.", stats.EvictedCount},
+		{"tracee_ebpf_pcap_errors_total", "Packets that failed to be written to a pcap file.", stats.PcapErrorCount},
+		{"tracee_ebpf_unknown_iface_packets_total", "Packets that were dropped, since they were captured on an unknown interface.", stats.UnknownIfaceCount},
+		{"tracee_ebpf_dropped_scans_total", "Artifact scans that were dropped, since the scan queue was full.", stats.ScanDroppedCount},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+	}
+
+	ifaces := make([]string, 0, len(stats.NetStats))
+	for iface := range stats.NetStats {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	fmt.Fprintf(w, "# HELP tracee_ebpf_net_packets_total Packets that were captured on a traced network interface.\n# TYPE tracee_ebpf_net_packets_total counter\n")
+	for _, iface := range ifaces {
+		fmt.Fprintf(w, "tracee_ebpf_net_packets_total{interface=%q,direction=\"ingress\"} %d\n", iface, stats.NetStats[iface].IngressPackets)
+		fmt.Fprintf(w, "tracee_ebpf_net_packets_total{interface=%q,direction=\"egress\"} %d\n", iface, stats.NetStats[iface].EgressPackets)
+	}
+	fmt.Fprintf(w, "# HELP tracee_ebpf_net_bytes_total Bytes of the packets that were captured on a traced network interface.\n# TYPE tracee_ebpf_net_bytes_total counter\n")
+	for _, iface := range ifaces {
+		fmt.Fprintf(w, "tracee_ebpf_net_bytes_total{interface=%q,direction=\"ingress\"} %d\n", iface, stats.NetStats[iface].IngressBytes)
+		fmt.Fprintf(w, "tracee_ebpf_net_bytes_total{interface=%q,direction=\"egress\"} %d\n", iface, stats.NetStats[iface].EgressBytes)
+	}
+}
+
+// metricsHandler serves the stats of a running tracee at /metrics
+func metricsHandler(getStats func() external.Stats) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, getStats())
+	})
+	return mux
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	stats := external.Stats{
+		EventCount:     10,
+		LostNtCount:    2,
+		PcapErrorCount: 1,
+		NetStats: map[string]external.NetIfaceStats{
+			"lo":   {IngressPackets: 1, IngressBytes: 10},
+			"eth0": {IngressPackets: 3, IngressBytes: 300, EgressPackets: 2, EgressBytes: 120},
+		},
+	}
+	server := httptest.NewServer(metricsHandler(func() external.Stats { return stats }))
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	var samples []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			samples = append(samples, line)
+		}
+	}
+	assert.Equal(t, []string{
+		"tracee_ebpf_events_total 10",
+		"tracee_ebpf_errors_total 0",
+		"tracee_ebpf_lost_events_total 0",
+		"tracee_ebpf_lost_writes_total 0",
+		"tracee_ebpf_lost_net_events_total 2",
+		"tracee_ebpf_evicted_artifacts_total 0",
+		"tracee_ebpf_pcap_errors_total 1",
+		"tracee_ebpf_unknown_iface_packets_total 0",
+		"tracee_ebpf_dropped_scans_total 0",
+		`tracee_ebpf_net_packets_total{interface="eth0",direction="ingress"} 3`,
+		`tracee_ebpf_net_packets_total{interface="eth0",direction="egress"} 2`,
+		`tracee_ebpf_net_packets_total{interface="lo",direction="ingress"} 1`,
+		`tracee_ebpf_net_packets_total{interface="lo",direction="egress"} 0`,
+		`tracee_ebpf_net_bytes_total{interface="eth0",direction="ingress"} 300`,
+		`tracee_ebpf_net_bytes_total{interface="eth0",direction="egress"} 120`,
+		`tracee_ebpf_net_bytes_total{interface="lo",direction="ingress"} 10`,
+		`tracee_ebpf_net_bytes_total{interface="lo",direction="egress"} 0`,
+	}, samples)
+	assert.Contains(t, string(body), "# TYPE tracee_ebpf_net_bytes_total counter\n")
+}
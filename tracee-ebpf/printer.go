@@ -18,7 +18,8 @@ type eventPrinter interface {
 	Init() error
 	// Preamble prints something before event printing begins (one time)
 	Preamble()
-	// Epilogue prints something after event printing ends (one time)
+	// Epilogue prints the stats after event printing ends (one time).
+	// Printers of machine readable events print them to the errors stream, to keep the events stream parsable.
 	Epilogue(stats external.Stats)
 	// Print prints a single event
 	Print(event external.Event)
@@ -191,7 +192,9 @@ func (p templateEventPrinter) Print(event external.Event) {
 	}
 }
 
-func (p templateEventPrinter) Epilogue(stats external.Stats) {}
+func (p templateEventPrinter) Epilogue(stats external.Stats) {
+	fmt.Fprintf(p.err, "Stats: %+v\n", stats)
+}
 
 func (p templateEventPrinter) Close() {
 }
@@ -217,7 +220,9 @@ func (p jsonEventPrinter) Error(err error) {
 	fmt.Fprintf(p.err, "%v\n", err)
 }
 
-func (p jsonEventPrinter) Epilogue(stats external.Stats) {}
+func (p jsonEventPrinter) Epilogue(stats external.Stats) {
+	fmt.Fprintf(p.err, "Stats: %+v\n", stats)
+}
 
 func (p jsonEventPrinter) Close() {
 }
@@ -250,7 +255,9 @@ func (p *gobEventPrinter) Error(err error) {
 	fmt.Fprintf(p.err, "%v\n", err)
 }
 
-func (p *gobEventPrinter) Epilogue(stats external.Stats) {}
+func (p *gobEventPrinter) Epilogue(stats external.Stats) {
+	fmt.Fprintf(p.err, "Stats: %+v\n", stats)
+}
 
 func (p gobEventPrinter) Close() {
 }
@@ -272,6 +279,8 @@ func (p *ignoreEventPrinter) Error(err error) {
 	fmt.Fprintf(p.err, "%v\n", err)
 }
 
-func (p *ignoreEventPrinter) Epilogue(stats external.Stats) {}
+func (p *ignoreEventPrinter) Epilogue(stats external.Stats) {
+	fmt.Fprintf(p.err, "Stats: %+v\n", stats)
+}
 
 func (p ignoreEventPrinter) Close() {}
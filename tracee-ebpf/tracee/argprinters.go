@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/aquasecurity/libbpfgo/helpers"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/aquasecurity/tracee/tracee-ebpf/external"
 )
@@ -176,3 +178,108 @@ func ParseKernelReadFileId(id int32) (string, error) {
 	}
 	return kernelReadFileIdStr, nil
 }
+
+// argSymbols returns the symbolic constants that parseArgs uses to print the given event argument, mapped to their values.
+// It returns nil if the argument isn't printed using symbolic constants.
+func argSymbols(eventID int32, argName string) map[string]uint64 {
+	switch eventID {
+	case SysEnterEventID, SysExitEventID, CapCapableEventID, CommitCredsEventID, SecurityFileOpenEventID:
+		switch {
+		case argName == "syscall":
+			symbols := make(map[string]uint64)
+			for id, event := range EventsIDToEvent {
+				if len(event.Probes) > 0 && event.Probes[0].attach == sysCall {
+					symbols[event.Probes[0].event] = uint64(id)
+				}
+			}
+			return symbols
+		case eventID == CapCapableEventID && argName == "cap":
+			return invertArgParser(func(v uint64) string { return helpers.ParseCapability(int32(v)) }, probeRange(0, 64))
+		case eventID == SecurityFileOpenEventID && argName == "flags":
+			return invertArgParser(func(v uint64) string { return helpers.ParseOpenFlags(uint32(v)) }, probeBits(32))
+		}
+	case MmapEventID, MprotectEventID, PkeyMprotectEventID:
+		if argName == "prot" {
+			return invertArgParser(func(v uint64) string { return helpers.ParseMemProt(uint32(v)) }, probeBits(32))
+		}
+	case PtraceEventID:
+		if argName == "request" {
+			return invertArgParser(func(v uint64) string { return helpers.ParsePtraceRequest(int64(v)) }, append(probeRange(0, 32), probeRange(0x4200, 0x4220)...))
+		}
+	case PrctlEventID:
+		if argName == "option" {
+			return invertArgParser(func(v uint64) string { return helpers.ParsePrctlOption(int32(v)) }, probeRange(0, 64))
+		}
+	case SocketEventID, SecuritySocketCreateEventID:
+		switch argName {
+		case "domain", "family":
+			return invertArgParser(func(v uint64) string { return helpers.ParseSocketDomain(uint32(v)) }, probeRange(0, 64))
+		case "type":
+			return invertArgParser(func(v uint64) string { return helpers.ParseSocketType(uint32(v)) }, append(probeRange(0, 16), probeBits(32)...))
+		}
+	case AccessEventID, FaccessatEventID:
+		if argName == "mode" {
+			return invertArgParser(func(v uint64) string { return helpers.ParseAccessMode(uint32(v)) }, probeBits(32))
+		}
+	case ExecveatEventID:
+		if argName == "flags" {
+			return invertArgParser(func(v uint64) string { return helpers.ParseExecFlags(uint32(v)) }, probeBits(32))
+		}
+	case OpenEventID, OpenatEventID:
+		if argName == "flags" {
+			return invertArgParser(func(v uint64) string { return helpers.ParseOpenFlags(uint32(v)) }, probeBits(32))
+		}
+	case MknodEventID, MknodatEventID, ChmodEventID, FchmodEventID, FchmodatEventID, SecurityInodeMknodEventID:
+		if argName == "mode" {
+			// file types and rwx permission groups span more than a single bit
+			multiBits := []uint64{0140000, 0120000, 060000, 0700, 070, 07}
+			return invertArgParser(func(v uint64) string { return helpers.ParseInodeMode(uint32(v)) }, append(probeBits(32), multiBits...))
+		}
+	case CloneEventID:
+		if argName == "flags" {
+			return invertArgParser(helpers.ParseCloneFlags, probeBits(64))
+		}
+	case BpfEventID, SecurityBPFEventID:
+		if argName == "cmd" {
+			return invertArgParser(func(v uint64) string { return helpers.ParseBPFCmd(int32(v)) }, probeRange(0, 64))
+		}
+	}
+
+	return nil
+}
+
+// invertArgParser builds a symbolic constants table from an argument parser, by parsing each of the given values.
+// Symbols that the parser already prints for 0 (e.g. O_RDONLY) are mapped to 0, and the other symbols are mapped to the
+// first value they are printed for.
+func invertArgParser(parse func(uint64) string, values []uint64) map[string]uint64 {
+	symbols := make(map[string]uint64)
+	for _, v := range append([]uint64{0}, values...) {
+		for _, symbol := range strings.Split(parse(v), "|") {
+			if _, err := strconv.ParseInt(symbol, 10, 64); err == nil || symbol == "" {
+				continue
+			}
+			if _, ok := symbols[symbol]; !ok {
+				symbols[symbol] = v
+			}
+		}
+	}
+	return symbols
+}
+
+// probeBits returns the values of the first n bits
+func probeBits(n uint) []uint64 {
+	values := make([]uint64, 0, n)
+	for i := uint(0); i < n; i++ {
+		values = append(values, 1<<i)
+	}
+	return values
+}
+
+// probeRange returns the values in the range [from, to)
+func probeRange(from, to uint64) []uint64 {
+	values := make([]uint64, 0, to-from)
+	for v := from; v < to; v++ {
+		values = append(values, v)
+	}
+	return values
+}
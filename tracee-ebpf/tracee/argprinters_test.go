@@ -21,3 +21,36 @@ func TestPrint16BytesSliceIP(t *testing.T) {
 	expectedIP := "2001:db8:85a3::8a2e:370:7334"
 	assert.Equal(t, expectedIP, ip)
 }
+
+func TestArgSymbols(t *testing.T) {
+	testCases := []struct {
+		eventID  int32
+		argName  string
+		symbol   string
+		expected uint64
+	}{
+		{eventID: OpenatEventID, argName: "flags", symbol: "O_RDONLY", expected: 0},
+		{eventID: OpenatEventID, argName: "flags", symbol: "O_WRONLY", expected: 01},
+		{eventID: OpenatEventID, argName: "flags", symbol: "O_CREAT", expected: 0100},
+		{eventID: MmapEventID, argName: "prot", symbol: "PROT_EXEC", expected: 0x4},
+		{eventID: FchmodatEventID, argName: "mode", symbol: "S_IXUSR", expected: 0100},
+		{eventID: FchmodatEventID, argName: "mode", symbol: "S_IRWXU", expected: 0700},
+		{eventID: FchmodatEventID, argName: "mode", symbol: "S_IFSOCK", expected: 0140000},
+		{eventID: SocketEventID, argName: "type", symbol: "SOCK_RAW", expected: 3},
+		{eventID: SocketEventID, argName: "type", symbol: "SOCK_CLOEXEC", expected: 02000000},
+		{eventID: PtraceEventID, argName: "request", symbol: "PTRACE_SEIZE", expected: 0x4206},
+		{eventID: CloneEventID, argName: "flags", symbol: "CLONE_NEWNS", expected: 0x00020000},
+		{eventID: CapCapableEventID, argName: "cap", symbol: "CAP_SYS_ADMIN", expected: 21},
+		{eventID: SysEnterEventID, argName: "syscall", symbol: "execve", expected: uint64(ExecveEventID)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.symbol, func(t *testing.T) {
+			symbols := argSymbols(tc.eventID, tc.argName)
+			val, ok := symbols[tc.symbol]
+			assert.True(t, ok)
+			assert.Equal(t, tc.expected, val)
+		})
+	}
+
+	assert.Nil(t, argSymbols(OpenatEventID, "dirfd"))
+}
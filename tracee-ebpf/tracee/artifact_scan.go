@@ -0,0 +1,201 @@
+package tracee
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-ebpf/yara"
+)
+
+const (
+	artifactScanMaxSize    = 64 * 1024 * 1024 // artifacts larger than this are not scanned
+	artifactScanWriteDelay = 2 * time.Second  // written files are scanned once they weren't written to for this long
+	artifactScanQueueSize  = 100
+)
+
+// artifactScanRequest is a captured artifact waiting to be scanned
+type artifactScanRequest struct {
+	view     string // relative to the capture output path
+	producer artifactProducer
+}
+
+// artifactScanner scans captured artifacts with yara rules, and emits an artifact_scan_match event for every match
+type artifactScanner struct {
+	rules      *yara.Ruleset
+	outputPath string
+	requests   chan artifactScanRequest
+	mu         sync.Mutex
+	delayed    map[string]*time.Timer // view -> timer of a written file which is scanned when it is no longer written to
+	producers  map[string]artifactProducer
+	dropped    counter // scans that were dropped since the queue was full
+}
+
+func newArtifactScanner(rulesDir string, outputPath string) (*artifactScanner, error) {
+	rules, err := yara.LoadRules(rulesDir)
+	if err != nil {
+		return nil, err
+	}
+	return &artifactScanner{
+		rules:      rules,
+		outputPath: outputPath,
+		requests:   make(chan artifactScanRequest, artifactScanQueueSize),
+		delayed:    make(map[string]*time.Timer),
+		producers:  make(map[string]artifactProducer),
+	}, nil
+}
+
+// scan queues a captured artifact for scanning
+func (s *artifactScanner) scan(view string, producer artifactProducer) {
+	s.enqueue(artifactScanRequest{view: view, producer: producer})
+}
+
+// enqueue queues a scan, or drops and counts it if the queue is full, so that slow scans don't stall the processing
+// of events
+func (s *artifactScanner) enqueue(req artifactScanRequest) {
+	select {
+	case s.requests <- req:
+	default:
+		s.dropped.Increment()
+	}
+}
+
+// scanDelayed queues a captured artifact for scanning once it wasn't written to for artifactScanWriteDelay
+func (s *artifactScanner) scanDelayed(view string, producer artifactProducer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.producers[view]; !ok || producer.ProcessName != "" {
+		s.producers[view] = producer
+	}
+	if timer, ok := s.delayed[view]; ok {
+		timer.Reset(artifactScanWriteDelay)
+		return
+	}
+	s.delayed[view] = time.AfterFunc(artifactScanWriteDelay, func() {
+		s.mu.Lock()
+		delete(s.delayed, view)
+		req := artifactScanRequest{view: view, producer: s.producers[view]}
+		delete(s.producers, view)
+		s.mu.Unlock()
+		s.enqueue(req)
+	})
+}
+
+// cancel drops a delayed scan, e.g. of an artifact which was evicted
+func (s *artifactScanner) cancel(view string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timer, ok := s.delayed[view]; ok {
+		timer.Stop()
+		delete(s.delayed, view)
+		delete(s.producers, view)
+	}
+}
+
+// pending returns the queued and delayed scans, and drops them from the scanner
+func (s *artifactScanner) pending() []artifactScanRequest {
+	var reqs []artifactScanRequest
+	s.mu.Lock()
+	for view, timer := range s.delayed {
+		if timer.Stop() {
+			reqs = append(reqs, artifactScanRequest{view: view, producer: s.producers[view]})
+		}
+		delete(s.delayed, view)
+		delete(s.producers, view)
+	}
+	s.mu.Unlock()
+	for {
+		select {
+		case req := <-s.requests:
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
+}
+
+// match scans a captured artifact, and returns its sha256 and the rules that matched it
+func (s *artifactScanner) match(view string) (string, []yara.Match, error) {
+	fullPath := filepath.Join(s.outputPath, view)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// evicted before it was scanned
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	if info.Size() > artifactScanMaxSize {
+		return "", nil, fmt.Errorf("artifact scan: skipping %s: larger than %d bytes", view, artifactScanMaxSize)
+	}
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return "", nil, err
+	}
+	matches := s.rules.Scan(data)
+	if len(matches) == 0 {
+		return "", nil, nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), matches, nil
+}
+
+// CreateArtifactScanMatchEvent creates an artifact_scan_match event for a rule that matched a captured artifact
+func CreateArtifactScanMatchEvent(req artifactScanRequest, sha string, match yara.Match) external.Event {
+	processName := req.producer.ProcessName
+	if processName == "" {
+		processName = "tracee-ebpf"
+	}
+	values := map[string]interface{}{
+		"rule":     match.Rule,
+		"tags":     match.Tags,
+		"strings":  match.Strings,
+		"artifact": req.view,
+		"capture":  req.producer.Capture,
+		"pathname": req.producer.Pathname,
+		"sha256":   sha,
+	}
+	args := make([]external.Argument, len(EventsIDToParams[ArtifactScanMatchEventID]))
+	for i, meta := range EventsIDToParams[ArtifactScanMatchEventID] {
+		args[i] = external.Argument{ArgMeta: meta, Value: values[meta.Name]}
+	}
+	return external.Event{
+		Timestamp:     int(time.Now().UnixNano()),
+		HostProcessID: req.producer.HostProcessID,
+		HostThreadID:  req.producer.HostProcessID, // the thread isn't recorded, so that the pid filters apply
+		ProcessName:   processName,
+		MountNS:       req.producer.MountNS,
+		ContainerID:   req.producer.ContainerID,
+		EventID:       int(ArtifactScanMatchEventID),
+		EventName:     EventsIDToEvent[ArtifactScanMatchEventID].Name,
+		ArgsNum:       len(args),
+		Args:          args,
+	}
+}
+
+// scanArtifact scans a captured artifact and emits its matches that pass the filters
+func (t *Tracee) scanArtifact(req artifactScanRequest) {
+	sha, matches, err := t.artifactScanner.match(req.view)
+	if err != nil {
+		t.handleError(err)
+		return
+	}
+	for _, match := range matches {
+		if !t.emitUserspaceEvent(CreateArtifactScanMatchEvent(req, sha, match)) {
+			return
+		}
+	}
+}
+
+// processArtifactScans scans the captured artifacts queued for scanning
+func (t *Tracee) processArtifactScans() {
+	for req := range t.artifactScanner.requests {
+		t.scanArtifact(req)
+	}
+}
@@ -0,0 +1,171 @@
+package tracee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactScanner(t *testing.T) {
+	rulesDir, err := ioutil.TempDir("", "TestArtifactScanner-rules-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(rulesDir)
+	outputPath, err := ioutil.TempDir("", "TestArtifactScanner-out-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputPath)
+
+	rules := `
+rule miner : crypto {
+	strings:
+		$pool = "stratum+tcp://"
+	condition:
+		$pool
+}`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rulesDir, "miner.yar"), []byte(rules), 0640))
+	s, err := newArtifactScanner(rulesDir, outputPath)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(outputPath, "1"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputPath, "1", "exec.1.xmrig"), []byte("connect stratum+tcp://pool"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputPath, "1", "exec.2.ls"), []byte("ls"), 0640))
+
+	sha, matches, err := s.match("1/exec.1.xmrig")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("connect stratum+tcp://pool"), sha)
+	require.Len(t, matches, 1)
+
+	req := artifactScanRequest{view: "1/exec.1.xmrig", producer: artifactProducer{Capture: "exec", MountNS: 1, HostProcessID: 42, ProcessName: "xmrig", Pathname: "/tmp/xmrig"}}
+	evt := CreateArtifactScanMatchEvent(req, sha, matches[0])
+	assert.Equal(t, "artifact_scan_match", evt.EventName)
+	assert.Equal(t, "xmrig", evt.ProcessName)
+	assert.Equal(t, 42, evt.HostProcessID)
+	assert.Equal(t, []external.Argument{
+		{ArgMeta: external.ArgMeta{Name: "rule", Type: "const char*"}, Value: "miner"},
+		{ArgMeta: external.ArgMeta{Name: "tags", Type: "const char**"}, Value: []string{"crypto"}},
+		{ArgMeta: external.ArgMeta{Name: "strings", Type: "const char**"}, Value: []string{"$pool"}},
+		{ArgMeta: external.ArgMeta{Name: "artifact", Type: "const char*"}, Value: "1/exec.1.xmrig"},
+		{ArgMeta: external.ArgMeta{Name: "capture", Type: "const char*"}, Value: "exec"},
+		{ArgMeta: external.ArgMeta{Name: "pathname", Type: "const char*"}, Value: "/tmp/xmrig"},
+		{ArgMeta: external.ArgMeta{Name: "sha256", Type: "const char*"}, Value: sha},
+	}, evt.Args)
+
+	_, matches, err = s.match("1/exec.2.ls")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	// evicted artifacts are skipped
+	_, matches, err = s.match("1/exec.3.evicted")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	// delayed scans are returned once when tracee exits, unless they were cancelled
+	s.scanDelayed("1/write.dev-1.inode-2", artifactProducer{Capture: "write", MountNS: 1})
+	s.scanDelayed("1/write.dev-1.inode-2", artifactProducer{Capture: "write", MountNS: 1})
+	s.scanDelayed("1/write.dev-1.inode-3", artifactProducer{Capture: "write", MountNS: 1})
+	s.cancel("1/write.dev-1.inode-3")
+	s.scan("1/bin.4", artifactProducer{Capture: "mem", MountNS: 1})
+	pending := s.pending()
+	assert.ElementsMatch(t, []artifactScanRequest{
+		{view: "1/write.dev-1.inode-2", producer: artifactProducer{Capture: "write", MountNS: 1}},
+		{view: "1/bin.4", producer: artifactProducer{Capture: "mem", MountNS: 1}},
+	}, pending)
+	assert.Empty(t, s.pending())
+
+	// scans are dropped rather than waited for when the queue is full
+	for i := 0; i < artifactScanQueueSize+2; i++ {
+		s.scan("1/bin.4", artifactProducer{Capture: "mem", MountNS: 1})
+	}
+	assert.Len(t, s.pending(), artifactScanQueueSize)
+	assert.Equal(t, counter(2), s.dropped)
+}
+
+func TestTracee_scanArtifact(t *testing.T) {
+	rulesDir, err := ioutil.TempDir("", "TestTracee_scanArtifact-rules-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(rulesDir)
+	outputPath, err := ioutil.TempDir("", "TestTracee_scanArtifact-out-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputPath)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rulesDir, "miner.yar"), []byte(`rule miner { strings: $pool = "stratum+tcp://" condition: $pool }`), 0640))
+	require.NoError(t, os.MkdirAll(filepath.Join(outputPath, "1"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputPath, "1", "exec.1.xmrig"), []byte("connect stratum+tcp://pool"), 0640))
+	req := artifactScanRequest{view: "1/exec.1.xmrig", producer: artifactProducer{Capture: "exec", MountNS: 1, HostProcessID: 42, ProcessName: "xmrig", Pathname: "/tmp/xmrig"}}
+
+	testCases := []struct {
+		name          string
+		filters       func(f *Filter)
+		scopes        []*Scope
+		expectedCount int
+	}{
+		{
+			name:          "no filters",
+			expectedCount: 1,
+		},
+		{
+			name: "mount namespace filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.MntNSFilter.Parse("=2"))
+			},
+		},
+		{
+			name: "pid filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.PIDFilter.Parse("=42"))
+			},
+			expectedCount: 1,
+		},
+		{
+			name: "comm filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.CommFilter.Parse("!=xmrig"))
+			},
+		},
+		{
+			name: "argument filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.ArgFilter.Parse("artifact_scan_match.rule", "!=miner", map[string]int32{"artifact_scan_match": ArtifactScanMatchEventID}))
+			},
+		},
+		{
+			name:   "scopes",
+			scopes: []*Scope{{Name: "other", Filter: newTestFilter()}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newArtifactScanner(rulesDir, outputPath)
+			require.NoError(t, err)
+			filter := newTestFilter()
+			if tc.filters != nil {
+				tc.filters(filter)
+			}
+			events := make(chan external.Event, 1)
+			tracee := &Tracee{
+				config: Config{
+					Filter:     filter,
+					ChanEvents: events,
+					ChanDone:   make(chan struct{}),
+				},
+				eventsToTrace:   map[int32]bool{ArtifactScanMatchEventID: true},
+				artifactScanner: s,
+			}
+			for _, s := range tc.scopes {
+				tracee.scopeMatchers = append(tracee.scopeMatchers, newScopeMatcher(s))
+			}
+			tracee.scanArtifact(req)
+			close(events)
+			var emitted []external.Event
+			for evt := range events {
+				emitted = append(emitted, evt)
+			}
+			assert.Len(t, emitted, tc.expectedCount)
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package tracee
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	artifactStoreDir      = "sha256"
+	artifactManifestFile  = "manifest.json"
+	artifactManifestDelay = 5 * time.Second // minimal time between manifest writes while tracing
+)
+
+// artifactProducer describes what produced an artifact
+type artifactProducer struct {
+	Capture       string `json:"capture"` // exec, write, mem or module
+	EventName     string `json:"eventName,omitempty"`
+	Timestamp     int    `json:"timestamp,omitempty"` // of the first event
+	MountNS       int    `json:"mountNamespace"`
+	ContainerID   string `json:"containerId,omitempty"`
+	HostProcessID int    `json:"hostProcessId,omitempty"`
+	ProcessName   string `json:"processName,omitempty"`
+	Pathname      string `json:"pathname,omitempty"`
+	Count         int    `json:"count"`
+}
+
+// same returns true if both producers describe the same source, regardless of when and how many times it produced
+func (p artifactProducer) same(other artifactProducer) bool {
+	return p.Capture == other.Capture && p.EventName == other.EventName && p.MountNS == other.MountNS &&
+		p.ContainerID == other.ContainerID && p.Pathname == other.Pathname
+}
+
+// artifactManifestEntry records an artifact in the store, its views, and what produced it
+type artifactManifestEntry struct {
+	SHA256    string             `json:"sha256"`
+	Size      int64              `json:"size"`
+	Views     []string           `json:"views"` // relative to the output path, e.g. 4026531840/exec.1234.ls
+	Producers []artifactProducer `json:"producers"`
+}
+
+// artifactStore stores captured artifacts by their SHA256 under <output path>/sha256, so that identical artifacts are
+// stored once. Artifacts are still exposed per mount namespace under <output path>/<mntns>, as hardlinks to the stored
+// artifact. If hardlinks are not supported, the views are only recorded in the manifest.
+// The manifest (<output path>/manifest.json) records the views of every artifact and the events that produced it.
+type artifactStore struct {
+	mu         sync.Mutex
+	outputPath string
+	manifest   map[string]*artifactManifestEntry // sha256 -> entry
+	views      map[string]string                 // view -> sha256
+	pending    map[string][]artifactProducer     // view -> producers, for views that are still being written
+	lastSave   time.Time
+}
+
+func newArtifactStore(outputPath string) (*artifactStore, error) {
+	s := &artifactStore{
+		outputPath: outputPath,
+		manifest:   make(map[string]*artifactManifestEntry),
+		views:      make(map[string]string),
+		pending:    make(map[string][]artifactProducer),
+	}
+	if err := os.MkdirAll(filepath.Join(outputPath, artifactStoreDir), 0755); err != nil {
+		return nil, err
+	}
+
+	// keep the artifacts of previous runs in the same output path
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(outputPath, artifactManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var entries []*artifactManifestEntry
+	if err := json.Unmarshal(manifestBytes, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing artifacts manifest: %v", err)
+	}
+	for _, e := range entries {
+		s.manifest[e.SHA256] = e
+		for _, view := range e.Views {
+			s.views[view] = e.SHA256
+		}
+	}
+	return s, nil
+}
+
+// recordProducer records a producer of a view that is still being written, to be added to the manifest when the
+// view is added to the store
+func (s *artifactStore) recordProducer(view string, producer artifactProducer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[view] = mergeProducer(s.pending[view], producer)
+}
+
+// markPending records a view that is still being written, to be added to the store by addPending
+func (s *artifactStore) markPending(view string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[view]; !ok {
+		s.pending[view] = nil
+	}
+}
+
+// addPending adds all the views that are still being written to the store
+func (s *artifactStore) addPending() error {
+	s.mu.Lock()
+	views := make([]string, 0, len(s.pending))
+	for view := range s.pending {
+		views = append(views, view)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(views)
+	for _, view := range views {
+		if _, err := os.Stat(filepath.Join(s.outputPath, view)); os.IsNotExist(err) {
+			// only a producer was recorded, but nothing was captured
+			continue
+		}
+		if _, _, err := s.add(view, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add moves the given view (a captured file relative to the output path) into the store, replaces it with a hardlink
+// to the stored artifact, and returns its SHA256 and size. The view may not exist anymore if hardlinks are not
+// supported, so the stored artifact is what should be tracked for retention.
+func (s *artifactStore) add(view string, producer *artifactProducer) (string, int64, error) {
+	viewPath := filepath.Join(s.outputPath, view)
+	sha := getFileHash(viewPath)
+	if sha == "" {
+		return "", 0, fmt.Errorf("error hashing captured artifact %s", view)
+	}
+	info, err := os.Stat(viewPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storedPath := filepath.Join(s.outputPath, artifactStoreDir, sha)
+	if _, err := os.Stat(storedPath); os.IsNotExist(err) {
+		if err := os.Link(viewPath, storedPath); err != nil {
+			// hardlinks are not supported, keep a metadata-indexed view only
+			if err := os.Rename(viewPath, storedPath); err != nil {
+				return "", 0, err
+			}
+		}
+	} else {
+		// the artifact is already stored, replace the view by a link to the stored copy
+		if err := os.Remove(viewPath); err != nil {
+			return "", 0, err
+		}
+		_ = os.Link(storedPath, viewPath)
+	}
+
+	// a view that was rewritten with different content no longer refers to the previous artifact
+	if oldSHA, ok := s.views[view]; ok && oldSHA != sha {
+		s.removeView(view)
+	}
+
+	entry, ok := s.manifest[sha]
+	if !ok {
+		entry = &artifactManifestEntry{SHA256: sha, Size: info.Size()}
+		s.manifest[sha] = entry
+	}
+	if _, ok := s.views[view]; !ok {
+		entry.Views = append(entry.Views, view)
+		s.views[view] = sha
+	}
+	for _, p := range s.pending[view] {
+		entry.Producers = mergeProducer(entry.Producers, p)
+	}
+	delete(s.pending, view)
+	if producer != nil {
+		entry.Producers = mergeProducer(entry.Producers, *producer)
+	}
+
+	if time.Since(s.lastSave) > artifactManifestDelay {
+		if err := s.save(); err != nil {
+			return sha, entry.Size, err
+		}
+	}
+	return sha, entry.Size, nil
+}
+
+// addProducer records another producer of an artifact which is already stored
+func (s *artifactStore) addProducer(sha string, producer artifactProducer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.manifest[sha]; ok {
+		entry.Producers = mergeProducer(entry.Producers, producer)
+	}
+}
+
+// release is called when a view or a stored artifact is removed (e.g. evicted). A stored artifact is removed with all
+// of its views, and the stored artifact of a view is removed once it has no views left.
+func (s *artifactStore) release(relPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dir, sha := filepath.Split(relPath); filepath.Clean(dir) == artifactStoreDir {
+		entry, ok := s.manifest[sha]
+		if !ok {
+			return
+		}
+		for _, view := range entry.Views {
+			delete(s.views, view)
+			_ = os.Remove(filepath.Join(s.outputPath, view))
+		}
+		delete(s.manifest, sha)
+		_ = os.Remove(filepath.Join(s.outputPath, relPath))
+		return
+	}
+	delete(s.pending, relPath)
+	s.removeView(relPath)
+}
+
+// removeView removes a view from the manifest, and the stored artifact if it has no views left. s.mu must be held.
+func (s *artifactStore) removeView(view string) {
+	sha, ok := s.views[view]
+	if !ok {
+		return
+	}
+	delete(s.views, view)
+	entry := s.manifest[sha]
+	for i := range entry.Views {
+		if entry.Views[i] == view {
+			entry.Views = append(entry.Views[:i], entry.Views[i+1:]...)
+			break
+		}
+	}
+	if len(entry.Views) == 0 {
+		delete(s.manifest, sha)
+		_ = os.Remove(filepath.Join(s.outputPath, artifactStoreDir, sha))
+	}
+}
+
+// flush writes the manifest
+func (s *artifactStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+// save writes the manifest. s.mu must be held.
+func (s *artifactStore) save() error {
+	entries := make([]*artifactManifestEntry, 0, len(s.manifest))
+	for _, e := range s.manifest {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SHA256 < entries[j].SHA256 })
+	manifestBytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that readers never see a partial manifest
+	manifestPath := filepath.Join(s.outputPath, artifactManifestFile)
+	if err := ioutil.WriteFile(manifestPath+".tmp", manifestBytes, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(manifestPath+".tmp", manifestPath); err != nil {
+		return err
+	}
+	s.lastSave = time.Now()
+	return nil
+}
+
+// mergeProducer adds a producer to the list, or counts it if the same producer is already listed
+func mergeProducer(producers []artifactProducer, producer artifactProducer) []artifactProducer {
+	if producer.Count == 0 {
+		producer.Count = 1
+	}
+	for i := range producers {
+		if producers[i].same(producer) {
+			producers[i].Count += producer.Count
+			return producers
+		}
+	}
+	return append(producers, producer)
+}
+
+// newArtifactProducer describes the event that produced a captured artifact
+func (t *Tracee) newArtifactProducer(capture string, ctx *context, pathname string) artifactProducer {
+	ts := ctx.Ts
+	// same as the timestamp of the emitted event
+	if t.config.Output.RelativeTime {
+		ts -= t.startTime
+	} else {
+		ts += t.bootTime
+	}
+	return artifactProducer{
+		Capture:       capture,
+		EventName:     EventsIDToEvent[ctx.EventID].Name,
+		Timestamp:     int(ts),
+		MountNS:       int(ctx.MntID),
+		ContainerID:   t.containers.GetCgroupInfo(ctx.CgroupID).ContainerId,
+		HostProcessID: int(ctx.HostPid),
+		ProcessName:   string(bytes.TrimRight(ctx.Comm[:], "\x00")),
+		Pathname:      pathname,
+	}
+}
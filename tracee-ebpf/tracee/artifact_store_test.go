@@ -0,0 +1,148 @@
+package tracee
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestArtifactStore(t *testing.T) *artifactStore {
+	outputPath, err := ioutil.TempDir("", "TestArtifactStore-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(outputPath) })
+
+	s, err := newArtifactStore(outputPath)
+	require.NoError(t, err)
+	return s
+}
+
+func writeView(t *testing.T, s *artifactStore, view string, content string) {
+	viewPath := filepath.Join(s.outputPath, view)
+	require.NoError(t, os.MkdirAll(filepath.Dir(viewPath), 0755))
+	require.NoError(t, ioutil.WriteFile(viewPath, []byte(content), 0640))
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestArtifactStore_add(t *testing.T) {
+	s := newTestArtifactStore(t)
+
+	writeView(t, s, "1/exec.1.ls", "ls binary")
+	writeView(t, s, "2/exec.2.ls", "ls binary")
+	writeView(t, s, "2/exec.3.cat", "cat binary")
+
+	sha1, _, err := s.add("1/exec.1.ls", &artifactProducer{Capture: "exec", MountNS: 1, Pathname: "/bin/ls"})
+	require.NoError(t, err)
+	sha2, _, err := s.add("2/exec.2.ls", &artifactProducer{Capture: "exec", MountNS: 2, ContainerID: "abc", Pathname: "/bin/ls"})
+	require.NoError(t, err)
+	sha3, _, err := s.add("2/exec.3.cat", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, sha256Hex("ls binary"), sha1)
+	assert.Equal(t, sha1, sha2)
+	assert.Equal(t, sha256Hex("cat binary"), sha3)
+
+	// identical artifacts are stored once, and the views are links to the stored artifact
+	storedInfo, err := os.Stat(filepath.Join(s.outputPath, artifactStoreDir, sha1))
+	require.NoError(t, err)
+	for _, view := range []string{"1/exec.1.ls", "2/exec.2.ls"} {
+		viewInfo, err := os.Stat(filepath.Join(s.outputPath, view))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(storedInfo, viewInfo), view)
+	}
+
+	s.addProducer(sha1, artifactProducer{Capture: "exec", MountNS: 1, Pathname: "/bin/ls"})
+	require.NoError(t, s.flush())
+
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(s.outputPath, artifactManifestFile))
+	require.NoError(t, err)
+	var manifest []artifactManifestEntry
+	require.NoError(t, json.Unmarshal(manifestBytes, &manifest))
+	require.Len(t, manifest, 2)
+	lsEntry := manifest[0]
+	if lsEntry.SHA256 != sha1 {
+		lsEntry = manifest[1]
+	}
+	assert.Equal(t, artifactManifestEntry{
+		SHA256: sha1,
+		Size:   int64(len("ls binary")),
+		Views:  []string{"1/exec.1.ls", "2/exec.2.ls"},
+		Producers: []artifactProducer{
+			{Capture: "exec", MountNS: 1, Pathname: "/bin/ls", Count: 2},
+			{Capture: "exec", MountNS: 2, ContainerID: "abc", Pathname: "/bin/ls", Count: 1},
+		},
+	}, lsEntry)
+
+	// the manifest is loaded by the next run
+	reloaded, err := newArtifactStore(s.outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, s.views, reloaded.views)
+	assert.Len(t, reloaded.manifest, 2)
+}
+
+func TestArtifactStore_pending(t *testing.T) {
+	s := newTestArtifactStore(t)
+
+	s.recordProducer("1/write.dev-1.inode-2", artifactProducer{Capture: "write", MountNS: 1, Pathname: "/tmp/x"})
+	s.recordProducer("1/write.dev-1.inode-3", artifactProducer{Capture: "write", MountNS: 1, Pathname: "/tmp/y"})
+	writeView(t, s, "1/write.dev-1.inode-2", "written")
+	s.markPending("1/write.dev-1.inode-2")
+
+	require.NoError(t, s.addPending())
+	sha := sha256Hex("written")
+	require.Contains(t, s.manifest, sha)
+	assert.Equal(t, []string{"1/write.dev-1.inode-2"}, s.manifest[sha].Views)
+	assert.Equal(t, []artifactProducer{{Capture: "write", MountNS: 1, Pathname: "/tmp/x", Count: 1}}, s.manifest[sha].Producers)
+	// the producer of a file that was never captured is kept pending
+	assert.Len(t, s.manifest, 1)
+}
+
+func TestArtifactStore_release(t *testing.T) {
+	s := newTestArtifactStore(t)
+
+	writeView(t, s, "1/exec.1.ls", "ls binary")
+	writeView(t, s, "2/exec.2.ls", "ls binary")
+	sha, _, err := s.add("1/exec.1.ls", nil)
+	require.NoError(t, err)
+	_, _, err = s.add("2/exec.2.ls", nil)
+	require.NoError(t, err)
+	storedPath := filepath.Join(s.outputPath, artifactStoreDir, sha)
+
+	s.release("1/exec.1.ls")
+	assert.FileExists(t, storedPath)
+	assert.Equal(t, []string{"2/exec.2.ls"}, s.manifest[sha].Views)
+
+	s.release("2/exec.2.ls")
+	assert.NoFileExists(t, storedPath)
+	assert.NotContains(t, s.manifest, sha)
+}
+
+func TestArtifactStore_releaseStored(t *testing.T) {
+	s := newTestArtifactStore(t)
+
+	writeView(t, s, "1/exec.1.ls", "ls binary")
+	writeView(t, s, "2/exec.2.ls", "ls binary")
+	sha, size, err := s.add("1/exec.1.ls", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("ls binary")), size)
+	_, _, err = s.add("2/exec.2.ls", nil)
+	require.NoError(t, err)
+
+	// an evicted stored artifact is removed with all of its views
+	s.release(filepath.Join(artifactStoreDir, sha))
+	assert.NoFileExists(t, filepath.Join(s.outputPath, artifactStoreDir, sha))
+	assert.NoFileExists(t, filepath.Join(s.outputPath, "1/exec.1.ls"))
+	assert.NoFileExists(t, filepath.Join(s.outputPath, "2/exec.2.ls"))
+	assert.Empty(t, s.manifest)
+	assert.Empty(t, s.views)
+}
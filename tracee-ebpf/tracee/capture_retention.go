@@ -0,0 +1,305 @@
+package tracee
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetentionConfig bounds the disk space used by captured artifacts.
+// When a limit is exceeded, the least recently written artifacts are evicted first. Zero values mean no limit.
+type RetentionConfig struct {
+	MaxTotalSize int64         // maximum total size of captured artifacts, in bytes
+	MaxMntNsSize int64         // maximum size of the artifacts captured in a single mount namespace (i.e. container), in bytes
+	MaxAge       time.Duration // maximum time since an artifact was last written
+}
+
+// Enabled returns true if any retention limit is set
+func (rc RetentionConfig) Enabled() bool {
+	return rc.MaxTotalSize > 0 || rc.MaxMntNsSize > 0 || rc.MaxAge > 0
+}
+
+// capturedArtifact is an artifact file tracked by the capture retention
+type capturedArtifact struct {
+	relPath   string // relative to the capture output path, e.g. "4026531840/exec.1234.ls"
+	mntNS     uint32
+	size      int64
+	lastWrite time.Time
+	onEvict   func()
+}
+
+// captureRetention tracks the artifacts under the capture output path and evicts them according to a RetentionConfig
+type captureRetention struct {
+	mu         sync.Mutex
+	config     RetentionConfig
+	outputPath string
+	artifacts  map[string]*list.Element // relative path -> element of lru
+	lru        *list.List               // of *capturedArtifact, the most recently written artifact is at the front
+	totalSize  int64
+	mntNsSize  map[uint32]int64
+	onEvict    func(a *capturedArtifact, reason string)
+	now        func() time.Time
+}
+
+func newCaptureRetention(config RetentionConfig, outputPath string, onEvict func(a *capturedArtifact, reason string)) *captureRetention {
+	return &captureRetention{
+		config:     config,
+		outputPath: outputPath,
+		artifacts:  make(map[string]*list.Element),
+		lru:        list.New(),
+		mntNsSize:  make(map[uint32]int64),
+		onEvict:    onEvict,
+		now:        time.Now,
+	}
+}
+
+// loadExisting tracks the artifacts that were captured by previous runs, so that they count towards the limits.
+// Views that are hardlinks to stored artifacts are not counted, their stored artifacts are counted once instead.
+func (r *captureRetention) loadExisting() error {
+	dirs, err := ioutil.ReadDir(r.outputPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var existing []*capturedArtifact
+	linkedMntNS := make(map[uint64]uint32) // inode of a stored artifact -> mount namespace of one of its views
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		mntNS, err := strconv.ParseUint(dir.Name(), 10, 32)
+		if err != nil {
+			// not a mount namespace directory
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(r.outputPath, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if stat, ok := f.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+				if _, ok := linkedMntNS[stat.Ino]; !ok {
+					linkedMntNS[stat.Ino] = uint32(mntNS)
+				}
+				continue
+			}
+			existing = append(existing, &capturedArtifact{
+				relPath:   filepath.Join(dir.Name(), f.Name()),
+				mntNS:     uint32(mntNS),
+				size:      f.Size(),
+				lastWrite: f.ModTime(),
+			})
+		}
+	}
+	stored, err := ioutil.ReadDir(filepath.Join(r.outputPath, artifactStoreDir))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, f := range stored {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		a := &capturedArtifact{relPath: filepath.Join(artifactStoreDir, f.Name()), size: f.Size(), lastWrite: f.ModTime()}
+		if stat, ok := f.Sys().(*syscall.Stat_t); ok {
+			a.mntNS = linkedMntNS[stat.Ino]
+		}
+		existing = append(existing, a)
+	}
+
+	// oldest first, so that the most recently written artifact ends up at the front
+	sort.Slice(existing, func(i, j int) bool { return existing[i].lastWrite.Before(existing[j].lastWrite) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range existing {
+		r.artifacts[a.relPath] = r.lru.PushFront(a)
+		r.totalSize += a.size
+		r.mntNsSize[a.mntNS] += a.size
+	}
+	r.enforce()
+	return nil
+}
+
+// track records that an artifact was written and now has the given size, and evicts artifacts as needed.
+// onEvict, if not nil, is called when this artifact is evicted.
+func (r *captureRetention) track(mntNS uint32, relPath string, size int64, onEvict func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.artifacts[relPath]; ok {
+		a := e.Value.(*capturedArtifact)
+		r.totalSize += size - a.size
+		r.mntNsSize[a.mntNS] += size - a.size
+		a.size = size
+		a.lastWrite = r.now()
+		if onEvict != nil {
+			a.onEvict = onEvict
+		}
+		r.lru.MoveToFront(e)
+	} else {
+		a := &capturedArtifact{relPath: relPath, mntNS: mntNS, size: size, lastWrite: r.now(), onEvict: onEvict}
+		r.artifacts[relPath] = r.lru.PushFront(a)
+		r.totalSize += size
+		r.mntNsSize[mntNS] += size
+	}
+	r.enforce()
+}
+
+// trackStored tracks a stored artifact that the given view was added to, and stops tracking the view by itself, so that
+// the size of identical artifacts is counted once. The stored artifact counts towards the mount namespace of its first
+// view, and the eviction callbacks of all of its views are called when it is evicted.
+func (r *captureRetention) trackStored(mntNS uint32, view string, storedRelPath string, size int64, onEvict func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.artifacts[view]; ok {
+		r.untrack(e)
+	}
+	if e, ok := r.artifacts[storedRelPath]; ok {
+		a := e.Value.(*capturedArtifact)
+		a.lastWrite = r.now()
+		if prev := a.onEvict; prev != nil && onEvict != nil {
+			a.onEvict = func() {
+				prev()
+				onEvict()
+			}
+		} else if onEvict != nil {
+			a.onEvict = onEvict
+		}
+		r.lru.MoveToFront(e)
+	} else {
+		a := &capturedArtifact{relPath: storedRelPath, mntNS: mntNS, size: size, lastWrite: r.now(), onEvict: onEvict}
+		r.artifacts[storedRelPath] = r.lru.PushFront(a)
+		r.totalSize += size
+		r.mntNsSize[mntNS] += size
+	}
+	r.enforce()
+}
+
+// rename updates the path of a tracked artifact that was renamed
+func (r *captureRetention) rename(oldRelPath, newRelPath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.artifacts[oldRelPath]
+	if !ok {
+		return
+	}
+	delete(r.artifacts, oldRelPath)
+	e.Value.(*capturedArtifact).relPath = newRelPath
+	r.artifacts[newRelPath] = e
+}
+
+// evictExpired evicts the artifacts that weren't written for longer than the maximum age
+func (r *captureRetention) evictExpired() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enforce()
+}
+
+// enforce evicts artifacts until all the limits are met. r.mu must be held.
+func (r *captureRetention) enforce() {
+	if r.config.MaxAge > 0 {
+		expiry := r.now().Add(-r.config.MaxAge)
+		for e := r.lru.Back(); e != nil && e.Value.(*capturedArtifact).lastWrite.Before(expiry); e = r.lru.Back() {
+			r.evict(e, "max age exceeded")
+		}
+	}
+	if r.config.MaxMntNsSize > 0 {
+		for e := r.lru.Back(); e != nil; {
+			prev := e.Prev()
+			if r.mntNsSize[e.Value.(*capturedArtifact).mntNS] > r.config.MaxMntNsSize {
+				r.evict(e, "mount namespace quota exceeded")
+			}
+			e = prev
+		}
+	}
+	if r.config.MaxTotalSize > 0 {
+		for e := r.lru.Back(); e != nil && r.totalSize > r.config.MaxTotalSize; e = r.lru.Back() {
+			r.evict(e, "max total size exceeded")
+		}
+	}
+}
+
+// untrack stops tracking an artifact, without removing it. r.mu must be held.
+func (r *captureRetention) untrack(e *list.Element) {
+	a := e.Value.(*capturedArtifact)
+	r.lru.Remove(e)
+	delete(r.artifacts, a.relPath)
+	r.totalSize -= a.size
+	r.mntNsSize[a.mntNS] -= a.size
+	if r.mntNsSize[a.mntNS] <= 0 {
+		delete(r.mntNsSize, a.mntNS)
+	}
+}
+
+// evict removes an artifact from disk and stops tracking it. r.mu must be held.
+func (r *captureRetention) evict(e *list.Element, reason string) {
+	a := e.Value.(*capturedArtifact)
+	r.untrack(e)
+
+	if err := os.Remove(filepath.Join(r.outputPath, a.relPath)); err != nil && !os.IsNotExist(err) {
+		reason = fmt.Sprintf("%s (failed to remove: %v)", reason, err)
+	}
+	if a.onEvict != nil {
+		a.onEvict()
+	}
+	if r.onEvict != nil {
+		r.onEvict(a, reason)
+	}
+}
+
+// trackCapture tracks a captured artifact for retention, if retention is enabled
+func (t *Tracee) trackCapture(mntNS uint32, fullPath string, onEvict func()) {
+	if t.captureRetention == nil {
+		return
+	}
+	relPath, err := filepath.Rel(t.config.Capture.OutputPath, fullPath)
+	if err != nil {
+		t.handleError(err)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		t.handleError(err)
+		return
+	}
+	t.captureRetention.track(mntNS, relPath, info.Size(), onEvict)
+}
+
+// trackStored tracks an artifact that was added to the artifact store by its stored copy, if retention is enabled
+func (t *Tracee) trackStored(mntNS uint32, view string, sha string, size int64, onEvict func()) {
+	if t.captureRetention == nil {
+		return
+	}
+	t.captureRetention.trackStored(mntNS, view, filepath.Join(artifactStoreDir, sha), size, onEvict)
+}
+
+// processCaptureRetention periodically evicts captured artifacts that exceeded the maximum age
+func (t *Tracee) processCaptureRetention() {
+	interval := t.config.Capture.Retention.MaxAge / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.captureRetention.evictExpired()
+	}
+}
@@ -0,0 +1,151 @@
+package tracee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArtifact writes an artifact of the given size under the output path, and tracks it
+func writeArtifact(t *testing.T, r *captureRetention, mntNS uint32, relPath string, size int, onEvict func()) {
+	fullPath := filepath.Join(r.outputPath, relPath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+	require.NoError(t, ioutil.WriteFile(fullPath, make([]byte, size), 0640))
+	r.track(mntNS, relPath, int64(size), onEvict)
+}
+
+func newTestCaptureRetention(t *testing.T, config RetentionConfig) (*captureRetention, *[]string) {
+	outputPath, err := ioutil.TempDir("", "TestCaptureRetention-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(outputPath) })
+
+	var evicted []string
+	r := newCaptureRetention(config, outputPath, func(a *capturedArtifact, reason string) {
+		evicted = append(evicted, a.relPath)
+	})
+	return r, &evicted
+}
+
+func TestCaptureRetention_MaxTotalSize(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxTotalSize: 300})
+
+	writeArtifact(t, r, 1, "1/exec.1.a", 100, nil)
+	writeArtifact(t, r, 2, "2/exec.2.b", 100, nil)
+	writeArtifact(t, r, 1, "1/exec.3.c", 100, nil)
+	assert.Empty(t, *evicted)
+
+	// rewriting a file makes it the most recently written one
+	writeArtifact(t, r, 1, "1/exec.1.a", 100, nil)
+	writeArtifact(t, r, 2, "2/exec.4.d", 150, nil)
+	assert.Equal(t, []string{"2/exec.2.b", "1/exec.3.c"}, *evicted)
+	assert.Equal(t, int64(250), r.totalSize)
+	assert.NoFileExists(t, filepath.Join(r.outputPath, "2/exec.2.b"))
+	assert.FileExists(t, filepath.Join(r.outputPath, "1/exec.1.a"))
+}
+
+func TestCaptureRetention_MaxMntNsSize(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxMntNsSize: 200})
+
+	writeArtifact(t, r, 1, "1/exec.1.a", 100, nil)
+	writeArtifact(t, r, 2, "2/exec.2.b", 150, nil)
+	writeArtifact(t, r, 1, "1/exec.3.c", 100, nil)
+	assert.Empty(t, *evicted)
+
+	writeArtifact(t, r, 1, "1/exec.4.d", 50, nil)
+	assert.Equal(t, []string{"1/exec.1.a"}, *evicted)
+	assert.Equal(t, int64(150), r.mntNsSize[1])
+	assert.Equal(t, int64(150), r.mntNsSize[2])
+}
+
+func TestCaptureRetention_MaxAge(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxAge: time.Hour})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	writeArtifact(t, r, 1, "1/exec.1.a", 100, nil)
+	now = now.Add(30 * time.Minute)
+	writeArtifact(t, r, 1, "1/exec.2.b", 100, nil)
+
+	now = now.Add(45 * time.Minute)
+	r.evictExpired()
+	assert.Equal(t, []string{"1/exec.1.a"}, *evicted)
+
+	now = now.Add(time.Hour)
+	r.evictExpired()
+	assert.Equal(t, []string{"1/exec.1.a", "1/exec.2.b"}, *evicted)
+	assert.Equal(t, 0, r.lru.Len())
+}
+
+func TestCaptureRetention_OnEvictAndRename(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxTotalSize: 100})
+
+	artifactEvicted := false
+	writeArtifact(t, r, 1, "1/module.dev-1.inode-2", 100, func() { artifactEvicted = true })
+	require.NoError(t, os.Rename(filepath.Join(r.outputPath, "1/module.dev-1.inode-2"), filepath.Join(r.outputPath, "1/module.dev-1.inode-2.abc")))
+	r.rename("1/module.dev-1.inode-2", "1/module.dev-1.inode-2.abc")
+
+	writeArtifact(t, r, 1, "1/bin.1", 10, nil)
+	assert.True(t, artifactEvicted)
+	assert.Equal(t, []string{"1/module.dev-1.inode-2.abc"}, *evicted)
+	assert.NoFileExists(t, filepath.Join(r.outputPath, "1/module.dev-1.inode-2.abc"))
+}
+
+func TestCaptureRetention_LoadExisting(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxTotalSize: 150})
+
+	now := time.Now()
+	for i, relPath := range []string{"1/exec.1.old", "2/exec.2.new"} {
+		fullPath := filepath.Join(r.outputPath, relPath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, ioutil.WriteFile(fullPath, make([]byte, 100), 0640))
+		modTime := now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(fullPath, modTime, modTime))
+	}
+	// files which are not in a mount namespace directory are not tracked
+	require.NoError(t, ioutil.WriteFile(filepath.Join(r.outputPath, "written_files"), make([]byte, 100), 0640))
+
+	require.NoError(t, r.loadExisting())
+	assert.Equal(t, []string{"1/exec.1.old"}, *evicted)
+	assert.Equal(t, int64(100), r.totalSize)
+	assert.FileExists(t, filepath.Join(r.outputPath, "written_files"))
+}
+
+func TestCaptureRetention_TrackStored(t *testing.T) {
+	r, evicted := newTestCaptureRetention(t, RetentionConfig{MaxTotalSize: 150})
+
+	// a view that was tracked while it was captured is tracked by its stored artifact once it is stored
+	writeArtifact(t, r, 1, "1/module.dev-1.inode-2.abc", 100, nil)
+	var evictedViews []string
+	r.trackStored(1, "1/module.dev-1.inode-2.abc", "sha256/abc", 100, func() { evictedViews = append(evictedViews, "1") })
+	r.trackStored(2, "2/exec.2.ls", "sha256/abc", 100, func() { evictedViews = append(evictedViews, "2") })
+	assert.Equal(t, int64(100), r.totalSize, "identical artifacts are counted once")
+	assert.Equal(t, map[uint32]int64{1: 100}, r.mntNsSize)
+	assert.NotContains(t, r.artifacts, "1/module.dev-1.inode-2.abc")
+
+	writeArtifact(t, r, 1, "1/bin.1", 100, nil)
+	assert.Equal(t, []string{"sha256/abc"}, *evicted)
+	assert.Equal(t, []string{"1", "2"}, evictedViews)
+	assert.Equal(t, int64(100), r.totalSize)
+}
+
+func TestCaptureRetention_LoadExistingStored(t *testing.T) {
+	r, _ := newTestCaptureRetention(t, RetentionConfig{MaxTotalSize: 1000})
+
+	storedPath := filepath.Join(r.outputPath, artifactStoreDir, "abc")
+	require.NoError(t, os.MkdirAll(filepath.Dir(storedPath), 0755))
+	require.NoError(t, ioutil.WriteFile(storedPath, make([]byte, 100), 0640))
+	for _, view := range []string{"1/exec.1.ls", "2/exec.2.ls"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(r.outputPath, filepath.Dir(view)), 0755))
+		require.NoError(t, os.Link(storedPath, filepath.Join(r.outputPath, view)))
+	}
+
+	require.NoError(t, r.loadExisting())
+	assert.Equal(t, int64(100), r.totalSize, "views that are hardlinks to a stored artifact are not counted")
+	require.Contains(t, r.artifacts, "sha256/abc")
+	assert.Len(t, r.artifacts, 1)
+}
@@ -15,6 +15,10 @@ type bpfConfig uint32
 // Matches 'MAX_STACK_DEPTH' in eBPF code
 const maxStackDepth int = 20
 
+// Max size of comm and uts string filters, including the null terminator
+// Matches 'MAX_STR_FILTER_SIZE' in eBPF code
+const maxStrFilterSize int = 16
+
 // Custom KernelConfigOption's to extend kernel_config helper support
 // Add here all kconfig variables used within tracee.bpf.c
 const (
@@ -189,6 +193,12 @@ const (
 // Events originated from user-space
 const (
 	InitNamespacesEventID int32 = iota + 2000
+	ArtifactScanMatchEventID
+	NetFlowStartEventID
+	NetFlowEndEventID
+	NetDnsRequestEventID
+	NetDnsResponseEventID
+	NetHttpRequestEventID
 )
 
 const (
@@ -589,6 +599,12 @@ var EventsIDToEvent = map[int32]EventConfig{
 	SecurityPostReadFileEventID:   {ID: SecurityPostReadFileEventID, ID32Bit: sys32undefined, Name: "security_kernel_post_read_file", Probes: []probe{{event: "security_kernel_post_read_file", attach: kprobe, fn: "trace_security_kernel_post_read_file"}}, Sets: []string{"lsm_hooks"}},
 	SecurityInodeMknodEventID:     {ID: SecurityInodeMknodEventID, ID32Bit: sys32undefined, Name: "security_inode_mknod", Probes: []probe{{event: "security_inode_mknod", attach: kprobe, fn: "trace_security_inode_mknod"}}, Sets: []string{"lsm_hooks"}},
 	InitNamespacesEventID:         {ID: InitNamespacesEventID, ID32Bit: sys32undefined, Name: "init_namespaces", Probes: []probe{}, Sets: []string{}},
+	ArtifactScanMatchEventID:      {ID: ArtifactScanMatchEventID, ID32Bit: sys32undefined, Name: "artifact_scan_match", Probes: []probe{}, Sets: []string{}},
+	NetFlowStartEventID:           {ID: NetFlowStartEventID, ID32Bit: sys32undefined, Name: "net_flow_start", Probes: []probe{}, Sets: []string{}},
+	NetFlowEndEventID:             {ID: NetFlowEndEventID, ID32Bit: sys32undefined, Name: "net_flow_end", Probes: []probe{}, Sets: []string{}},
+	NetDnsRequestEventID:          {ID: NetDnsRequestEventID, ID32Bit: sys32undefined, Name: "net_dns_request", Probes: []probe{}, Sets: []string{}},
+	NetDnsResponseEventID:         {ID: NetDnsResponseEventID, ID32Bit: sys32undefined, Name: "net_dns_response", Probes: []probe{}, Sets: []string{}},
+	NetHttpRequestEventID:         {ID: NetHttpRequestEventID, ID32Bit: sys32undefined, Name: "net_http_request", Probes: []probe{}, Sets: []string{}},
 	SocketDupEventID:              {ID: SocketDupEventID, ID32Bit: sys32undefined, Name: "socket_dup", Probes: []probe{}, Sets: []string{}},
 }
 
@@ -967,5 +983,11 @@ var EventsIDToParams = map[int32][]external.ArgMeta{
 	SecurityPostReadFileEventID:   {{Type: "const char*", Name: "pathname"}, {Type: "long", Name: "size"}, {Type: "int", Name: "type"}},
 	SecurityInodeMknodEventID:     {{Type: "const char*", Name: "file_name"}, {Type: "umode_t", Name: "mode"}, {Type: "dev_t", Name: "dev"}},
 	InitNamespacesEventID:         {{Type: "u32", Name: "cgroup"}, {Type: "u32", Name: "ipc"}, {Type: "u32", Name: "mnt"}, {Type: "u32", Name: "net"}, {Type: "u32", Name: "pid"}, {Type: "u32", Name: "pid_for_children"}, {Type: "u32", Name: "time"}, {Type: "u32", Name: "time_for_children"}, {Type: "u32", Name: "user"}, {Type: "u32", Name: "uts"}},
+	ArtifactScanMatchEventID:      {{Type: "const char*", Name: "rule"}, {Type: "const char**", Name: "tags"}, {Type: "const char**", Name: "strings"}, {Type: "const char*", Name: "artifact"}, {Type: "const char*", Name: "capture"}, {Type: "const char*", Name: "pathname"}, {Type: "const char*", Name: "sha256"}},
+	NetFlowStartEventID:           {{Type: "const char*", Name: "srcIP"}, {Type: "u16", Name: "srcPort"}, {Type: "const char*", Name: "dstIP"}, {Type: "u16", Name: "dstPort"}, {Type: "const char*", Name: "protocol"}, {Type: "const char*", Name: "direction"}},
+	NetFlowEndEventID:             {{Type: "const char*", Name: "srcIP"}, {Type: "u16", Name: "srcPort"}, {Type: "const char*", Name: "dstIP"}, {Type: "u16", Name: "dstPort"}, {Type: "const char*", Name: "protocol"}, {Type: "const char*", Name: "direction"}, {Type: "u64", Name: "packets"}, {Type: "u64", Name: "bytes"}, {Type: "u64", Name: "duration"}},
+	NetDnsRequestEventID:          {{Type: "const char*", Name: "srcIP"}, {Type: "u16", Name: "srcPort"}, {Type: "const char*", Name: "dstIP"}, {Type: "u16", Name: "dstPort"}, {Type: "const char*", Name: "protocol"}, {Type: "u16", Name: "id"}, {Type: "const char*", Name: "name"}, {Type: "const char*", Name: "type"}},
+	NetDnsResponseEventID:         {{Type: "const char*", Name: "srcIP"}, {Type: "u16", Name: "srcPort"}, {Type: "const char*", Name: "dstIP"}, {Type: "u16", Name: "dstPort"}, {Type: "const char*", Name: "protocol"}, {Type: "u16", Name: "id"}, {Type: "const char*", Name: "name"}, {Type: "const char*", Name: "type"}, {Type: "const char*", Name: "rcode"}, {Type: "const char**", Name: "answers"}},
+	NetHttpRequestEventID:         {{Type: "const char*", Name: "srcIP"}, {Type: "u16", Name: "srcPort"}, {Type: "const char*", Name: "dstIP"}, {Type: "u16", Name: "dstPort"}, {Type: "const char*", Name: "method"}, {Type: "const char*", Name: "host"}, {Type: "const char*", Name: "path"}, {Type: "const char*", Name: "proto"}, {Type: "const char*", Name: "userAgent"}},
 	SocketDupEventID:              {{Type: "int", Name: "oldfd"}, {Type: "int", Name: "newfd"}, {Type: "struct sockaddr*", Name: "remote_addr"}},
 }
@@ -215,6 +215,31 @@ check:
 	return path, runtime
 }
 
+// GetContainerIdFromProcess returns the id of the container that a process runs in, or an empty string if it doesn't
+// run in a container, based on its cgroups
+func (c *Containers) GetContainerIdFromProcess(pid uint32) (string, error) {
+	cgroups, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	// each line is hierarchy-ID:controller-list:cgroup-path
+	for _, line := range strings.Split(string(cgroups), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, pc := range strings.Split(fields[2], "/") {
+			if len(pc) < 64 {
+				continue
+			}
+			if containerId, _ := c.getContainerIdFromCgroup(pc); containerId != "" {
+				return containerId, nil
+			}
+		}
+	}
+	return "", nil
+}
+
 func (c *Containers) CgroupRemove(cgroupId uint64) {
 	delete(c.cgroups, uint32(cgroupId))
 }
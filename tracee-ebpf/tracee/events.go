@@ -65,6 +65,10 @@ func (t *Tracee) processEvents(done <-chan struct{}) error {
 			argMetas[i] = argMeta
 		}
 
+		if t.procUtsNames != nil {
+			t.procUtsNames.Add(ctx.HostPid, string(bytes.TrimRight(ctx.UtsName[:], "\x00")))
+		}
+
 		if !t.shouldProcessEvent(&ctx, args) {
 			continue
 		}
@@ -95,6 +99,14 @@ func (t *Tracee) processEvents(done <-chan struct{}) error {
 			continue
 		}
 
+		var matchedScopes []string
+		if len(t.scopeMatchers) > 0 {
+			matchedScopes = t.matchScopes(&ctx, args, containerId)
+			if len(matchedScopes) == 0 {
+				continue
+			}
+		}
+
 		if t.config.Output.ParseArguments {
 			err = t.parseArgs(&ctx, args)
 			if err != nil {
@@ -140,6 +152,7 @@ func (t *Tracee) processEvents(done <-chan struct{}) error {
 			ReturnValue:         int(ctx.Retval),
 			Args:                make([]external.Argument, 0, len(args)),
 			StackAddresses:      StackAddresses,
+			MatchedScopes:       matchedScopes,
 		}
 		for _, meta := range argMetas {
 			evt.Args = append(evt.Args, external.Argument{
@@ -158,6 +171,61 @@ func (t *Tracee) processEvents(done <-chan struct{}) error {
 	return nil
 }
 
+// emitUserspaceEvent emits an event that was created in userspace, e.g. from captured packets or artifacts, if it
+// passes the filters and matches a scope, if scopes are used. It returns false if tracee is done.
+func (t *Tracee) emitUserspaceEvent(evt external.Event) bool {
+	eventID := int32(evt.EventID)
+	if !t.eventsToTrace[eventID] {
+		return true
+	}
+	ctx := userspaceEventContext(evt)
+	args := make(map[string]interface{}, len(evt.Args))
+	for _, arg := range evt.Args {
+		args[arg.Name] = arg.Value
+	}
+	// these events are attributed to processes in userspace, so the filters of the kernel are evaluated here as well.
+	// With follow, the threads that the kernel follows skip the filters of the process, like in the kernel.
+	if t.followed != nil && t.followed(ctx.HostTid) {
+		if t.config.Filter.ArgFilter != nil && !t.config.Filter.ArgFilter.InFilter(ctx.EventID, args) {
+			return true
+		}
+	} else if !t.config.Filter.matches(&ctx, args, evt.ContainerID, t.parentOf) {
+		return true
+	}
+	if len(t.scopeMatchers) > 0 {
+		evt.MatchedScopes = t.matchScopes(&ctx, args, evt.ContainerID)
+		if len(evt.MatchedScopes) == 0 {
+			return true
+		}
+	}
+	select {
+	case <-t.config.ChanDone:
+		return false
+	case t.config.ChanEvents <- evt:
+		t.stats.eventCounter.Increment()
+	}
+	return true
+}
+
+// userspaceEventContext returns the context that an event created in userspace is filtered by, like the events of
+// the kernel
+func userspaceEventContext(evt external.Event) context {
+	ctx := context{
+		Pid:      uint32(evt.ProcessID),
+		Tid:      uint32(evt.ThreadID),
+		HostPid:  uint32(evt.HostProcessID),
+		HostTid:  uint32(evt.HostThreadID),
+		HostPpid: uint32(evt.HostParentProcessID),
+		Uid:      uint32(evt.UserID),
+		MntID:    uint32(evt.MountNS),
+		PidID:    uint32(evt.PIDNS),
+		EventID:  int32(evt.EventID),
+	}
+	copy(ctx.Comm[:], evt.ProcessName)
+	copy(ctx.UtsName[:], evt.HostName)
+	return ctx
+}
+
 func (t *Tracee) getStackAddresses(StackID uint32) ([]uint64, error) {
 	StackAddresses := make([]uint64, maxStackDepth)
 	stackFrameSize := (strconv.IntSize / 8)
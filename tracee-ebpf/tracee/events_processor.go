@@ -1,12 +1,12 @@
 package tracee
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"unsafe"
 
@@ -24,57 +24,21 @@ func (t *Tracee) processLostEvents() {
 
 // shouldProcessEvent decides whether or not to drop an event before further processing it
 func (t *Tracee) shouldProcessEvent(ctx *context, args map[string]interface{}) bool {
-	if t.config.Filter.RetFilter.Enabled {
-		if filter, ok := t.config.Filter.RetFilter.Filters[ctx.EventID]; ok {
-			retVal := ctx.Retval
-			match := false
-			for _, f := range filter.Equal {
-				if retVal == f {
-					match = true
-					break
-				}
-			}
-			if !match && len(filter.Equal) > 0 {
-				return false
-			}
-			for _, f := range filter.NotEqual {
-				if retVal == f {
-					return false
-				}
-			}
-			if (filter.Greater != GreaterNotSetInt) && retVal <= filter.Greater {
-				return false
-			}
-			if (filter.Less != LessNotSetInt) && retVal >= filter.Less {
-				return false
-			}
-		}
+	// comm and uts filters with suffixes or globs are not set in the kernel, so evaluate them here
+	if t.config.Filter.CommFilter.UserspaceOnly() && !t.config.Filter.CommFilter.InFilter(string(bytes.TrimRight(ctx.Comm[:], "\x00"))) {
+		return false
 	}
 
-	if t.config.Filter.ArgFilter.Enabled {
-		for argName, filter := range t.config.Filter.ArgFilter.Filters[ctx.EventID] {
-			argVal, ok := args[argName]
-			if !ok {
-				continue
-			}
-			// TODO: use type assertion instead of string convertion
-			argValStr := fmt.Sprint(argVal)
-			match := false
-			for _, f := range filter.Equal {
-				if argValStr == f || (f[len(f)-1] == '*' && strings.HasPrefix(argValStr, f[0:len(f)-1])) {
-					match = true
-					break
-				}
-			}
-			if !match && len(filter.Equal) > 0 {
-				return false
-			}
-			for _, f := range filter.NotEqual {
-				if argValStr == f || (f[len(f)-1] == '*' && strings.HasPrefix(argValStr, f[0:len(f)-1])) {
-					return false
-				}
-			}
-		}
+	if t.config.Filter.UTSFilter.UserspaceOnly() && !t.config.Filter.UTSFilter.InFilter(string(bytes.TrimRight(ctx.UtsName[:], "\x00"))) {
+		return false
+	}
+
+	if !t.config.Filter.RetFilter.InFilter(ctx.EventID, ctx.Retval) {
+		return false
+	}
+
+	if !t.config.Filter.ArgFilter.InFilter(ctx.EventID, args) {
+		return false
 	}
 
 	return true
@@ -104,7 +68,14 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 			}
 
 			// stop processing if write was already indexed
-			fileName := fmt.Sprintf("%d/write.dev-%d.inode-%d", ctx.MntID, dev, inode)
+			// writes to /dev/null are captured per process, like the file writer names them
+			var pid uint32
+			if filePath == "/dev/null" {
+				pid = ctx.Pid
+			}
+			fileName := filepath.Join(strconv.Itoa(int(ctx.MntID)), writtenFileName(dev, inode, pid))
+			t.captureIndexMutex.Lock()
+			defer t.captureIndexMutex.Unlock()
 			indexName, ok := t.writtenFiles[fileName]
 			if ok && indexName == filePath {
 				return nil
@@ -112,6 +83,9 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 
 			// index written file by original filepath
 			t.writtenFiles[fileName] = filePath
+			if t.artifactStore != nil {
+				t.artifactStore.recordProducer(fileName, t.newArtifactProducer("write", ctx, filePath))
+			}
 		}
 
 	case SchedProcessExecEventID:
@@ -160,7 +134,9 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 					}
 
 					//don't capture same file twice unless it was modified
+					t.captureIndexMutex.Lock()
 					lastCtime, ok := t.capturedFiles[capturedFileID]
+					t.captureIndexMutex.Unlock()
 					if !ok || lastCtime != castedSourceFileCtime {
 						//capture
 						err = CopyFileByPath(sourceFilePath, destinationFilePath)
@@ -168,11 +144,35 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 							return err
 						}
 						//mark this file as captured
+						t.captureIndexMutex.Lock()
 						t.capturedFiles[capturedFileID] = castedSourceFileCtime
+						t.captureIndexMutex.Unlock()
+						view := filepath.Join(strconv.Itoa(int(ctx.MntID)), filepath.Base(destinationFilePath))
+						//capture the file again on its next execution if it gets evicted
+						onEvict := func() {
+							t.captureIndexMutex.Lock()
+							if t.capturedFiles[capturedFileID] == castedSourceFileCtime {
+								delete(t.capturedFiles, capturedFileID)
+							}
+							t.captureIndexMutex.Unlock()
+						}
+						if t.artifactStore != nil {
+							sha, size, err := t.artifactStore.add(view, nil)
+							if err != nil {
+								return err
+							}
+							t.fileHashes.Add(capturedFileID, fileExecInfo{castedSourceFileCtime, sha})
+							t.trackStored(ctx.MntID, view, sha, size, onEvict)
+						} else {
+							t.trackCapture(ctx.MntID, destinationFilePath, onEvict)
+						}
+						if t.artifactScanner != nil {
+							t.artifactScanner.scan(view, t.newArtifactProducer("exec", ctx, filePath))
+						}
 					}
 				}
 
-				if t.config.Output.ExecHash {
+				if t.config.Output.ExecHash || t.artifactStore != nil {
 					var hashInfoObj fileExecInfo
 					var currentHash string
 					hashInfoInterface, ok := t.fileHashes.Get(capturedFileID)
@@ -194,6 +194,10 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 					*argMetas = append(*argMetas, hashMeta)
 					ctx.Argnum += 1
 					args["sha256"] = currentHash
+
+					if t.artifactStore != nil {
+						t.artifactStore.addProducer(currentHash, t.newArtifactProducer("exec", ctx, filePath))
+					}
 				}
 
 				break
@@ -201,6 +205,14 @@ func (t *Tracee) processEvent(ctx *context, args map[string]interface{}, argMeta
 			return err
 		}
 
+	case SchedProcessExitEventID:
+		// the files are opened again if other threads of the process still send packets
+		if t.pcapWriters != nil && ctx.HostTid == ctx.HostPid {
+			if err := t.pcapWriters.closeProcess(ctx.HostPid); err != nil {
+				return err
+			}
+		}
+
 	case SocketEventID:
 		removeSocketTailOnce.Do(t.removeSocketTail)
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -27,6 +28,7 @@ type Filter struct {
 	RetFilter         *RetFilter
 	ArgFilter         *ArgFilter
 	ProcessTreeFilter *ProcessTreeFilter
+	NetFilter         *NetIfaces
 	Follow            bool
 }
 
@@ -157,6 +159,36 @@ func (filter *UintFilter) Set(bpfModule *bpf.Module, filterMapName string, confi
 	return err
 }
 
+// InFilter evaluates the filter against the given value in userspace.
+// The semantics match uint_filter_matches() in the ebpf code.
+func (filter *UintFilter) InFilter(val uint64) bool {
+	if !filter.Enabled {
+		return true
+	}
+
+	for _, f := range filter.Equal {
+		if val == f {
+			return true
+		}
+	}
+	for _, f := range filter.NotEqual {
+		if val == f {
+			return false
+		}
+	}
+	if len(filter.Equal) > 0 && len(filter.NotEqual) == 0 && filter.Greater == GreaterNotSetUint && filter.Less == LessNotSetUint {
+		return false
+	}
+	if filter.Less != LessNotSetUint && val >= filter.Less {
+		return false
+	}
+	if filter.Greater != GreaterNotSetUint && val <= filter.Greater {
+		return false
+	}
+
+	return true
+}
+
 type IntFilter struct {
 	Equal    []int64
 	NotEqual []int64
@@ -213,6 +245,33 @@ func (intFilter *IntFilter) Parse(operatorAndValues string) error {
 	return nil
 }
 
+// InFilter evaluates the filter against the given value in userspace
+func (filter *IntFilter) InFilter(val int64) bool {
+	match := false
+	for _, f := range filter.Equal {
+		if val == f {
+			match = true
+			break
+		}
+	}
+	if !match && len(filter.Equal) > 0 {
+		return false
+	}
+	for _, f := range filter.NotEqual {
+		if val == f {
+			return false
+		}
+	}
+	if (filter.Greater != GreaterNotSetInt) && val <= filter.Greater {
+		return false
+	}
+	if (filter.Less != LessNotSetInt) && val >= filter.Less {
+		return false
+	}
+
+	return true
+}
+
 type StringFilter struct {
 	Equal    []string
 	NotEqual []string
@@ -251,29 +310,131 @@ func (stringFilter *StringFilter) Parse(operatorAndValues string) error {
 	return nil
 }
 
-func (filter *StringFilter) Set(bpfModule *bpf.Module, filterMapName string, configFilter bpfConfig) error {
+// strPatternKind describes how a comm or uts filter value is matched
+type strPatternKind uint8
+
+const (
+	strPatternExact strPatternKind = iota
+	strPatternPrefix
+	strPatternSuffix
+	strPatternGlob
+)
+
+// parseStrPattern classifies a comm or uts filter value and returns the string to match against:
+// 'abc*' matches as a prefix, '*abc' matches as a suffix, and any other value with '*' or '?' matches as a glob.
+// Exact and prefix values are truncated to the size of the compared values, as done by the kernel.
+func parseStrPattern(val string) (strPatternKind, string) {
+	maxLen := maxStrFilterSize - 1
+	wildcards := strings.Count(val, "*") + strings.Count(val, "?")
+	switch {
+	case wildcards == 0:
+		if len(val) > maxLen {
+			val = val[:maxLen]
+		}
+		return strPatternExact, val
+	case wildcards == 1 && strings.HasSuffix(val, "*"):
+		val = val[:len(val)-1]
+		if len(val) > maxLen {
+			val = val[:maxLen]
+		}
+		return strPatternPrefix, val
+	case wildcards == 1 && strings.HasPrefix(val, "*"):
+		return strPatternSuffix, val[1:]
+	default:
+		return strPatternGlob, val
+	}
+}
+
+// globMatch reports whether val matches pattern, where '*' matches any sequence of characters and '?' matches any single character
+func globMatch(pattern, val string) bool {
+	p, v := 0, 0
+	starP, starV := -1, 0
+	for v < len(val) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == val[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starV = p, v
+			p++
+		case starP >= 0:
+			// backtrack: let the last '*' consume one more character
+			starV++
+			p, v = starP+1, starV
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// UserspaceOnly returns true if the filter has values that can't be evaluated by the kernel (suffixes and globs).
+// Such filters are not set in the kernel, and are fully evaluated in userspace instead.
+func (filter *StringFilter) UserspaceOnly() bool {
 	if !filter.Enabled {
+		return false
+	}
+	for _, vals := range [][]string{filter.Equal, filter.NotEqual} {
+		for _, val := range vals {
+			if kind, _ := parseStrPattern(val); kind == strPatternSuffix || kind == strPatternGlob {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterIn returns true if the filter only passes values that explicitly match it
+func (filter *StringFilter) filterIn() bool {
+	return len(filter.Equal) > 0 && len(filter.NotEqual) == 0
+}
+
+type stringPrefixFilterKey struct {
+	PrefixLen uint32 // in bits, as required by lpm trie keys
+	Str       [maxStrFilterSize]byte
+}
+
+func (filter *StringFilter) Set(bpfModule *bpf.Module, filterMapName string, prefixFilterMapName string, configFilter bpfConfig) error {
+	if !filter.Enabled || filter.UserspaceOnly() {
 		return nil
 	}
 
 	filterEqualU32 := uint32(filterEqual) // const need local var for bpfMap.Update()
 	filterNotEqualU32 := uint32(filterNotEqual)
 
-	// 1. uts_ns_filter     string[MAX_STR_FILTER_SIZE], u32    // filter events by uts namespace name
-	// 2. comm_filter       string[MAX_STR_FILTER_SIZE], u32    // filter events by command name
+	// 1. uts_ns_filter            string[MAX_STR_FILTER_SIZE], u32    // filter events by uts namespace name
+	// 2. comm_filter              string[MAX_STR_FILTER_SIZE], u32    // filter events by command name
+	// 3. uts_ns_prefix_filter     lpm key of string[MAX_STR_FILTER_SIZE], u32    // filter events by uts namespace name prefix
+	// 4. comm_prefix_filter       lpm key of string[MAX_STR_FILTER_SIZE], u32    // filter events by command name prefix
 	filterMap, err := bpfModule.GetMap(filterMapName)
 	if err != nil {
 		return err
 	}
+	prefixFilterMap, err := bpfModule.GetMap(prefixFilterMapName)
+	if err != nil {
+		return err
+	}
+	update := func(val string, equality *uint32) error {
+		kind, str := parseStrPattern(val)
+		if kind == strPatternPrefix {
+			key := stringPrefixFilterKey{PrefixLen: uint32(len(str) * 8)}
+			copy(key.Str[:], str)
+			return prefixFilterMap.Update(unsafe.Pointer(&key), unsafe.Pointer(equality))
+		}
+		var key [maxStrFilterSize]byte
+		copy(key[:], str)
+		return filterMap.Update(unsafe.Pointer(&key[0]), unsafe.Pointer(equality))
+	}
 	for i := 0; i < len(filter.Equal); i++ {
-		filterEqualBytes := []byte(filter.Equal[i])
-		if err = filterMap.Update(unsafe.Pointer(&filterEqualBytes[0]), unsafe.Pointer(&filterEqualU32)); err != nil {
+		if err = update(filter.Equal[i], &filterEqualU32); err != nil {
 			return err
 		}
 	}
 	for i := 0; i < len(filter.NotEqual); i++ {
-		filterNotEqualBytes := []byte(filter.NotEqual[i])
-		if err = filterMap.Update(unsafe.Pointer(&filterNotEqualBytes[0]), unsafe.Pointer(&filterNotEqualU32)); err != nil {
+		if err = update(filter.NotEqual[i], &filterNotEqualU32); err != nil {
 			return err
 		}
 	}
@@ -282,7 +443,7 @@ func (filter *StringFilter) Set(bpfModule *bpf.Module, filterMapName string, con
 	if err != nil {
 		return err
 	}
-	if len(filter.Equal) > 0 && len(filter.NotEqual) == 0 {
+	if filter.filterIn() {
 		filterInU32 := uint32(filterIn)
 		err = bpfConfigMap.Update(unsafe.Pointer(&configFilter), unsafe.Pointer(&filterInU32))
 	} else {
@@ -293,6 +454,90 @@ func (filter *StringFilter) Set(bpfModule *bpf.Module, filterMapName string, con
 	return err
 }
 
+// InFilter evaluates the filter against the given value in userspace.
+// The semantics match string_filter_matches() in the ebpf code: an exact match is checked first, then the longest
+// matching prefix. Suffixes and globs, which are only evaluated in userspace, are checked last.
+func (filter *StringFilter) InFilter(val string) bool {
+	if !filter.Enabled {
+		return true
+	}
+
+	type pattern struct {
+		kind  strPatternKind
+		str   string
+		equal bool
+	}
+	var patterns []pattern
+	for _, f := range filter.Equal {
+		kind, str := parseStrPattern(f)
+		patterns = append(patterns, pattern{kind, str, true})
+	}
+	// not equal values come last so they take precedence over identical equal values, as in the bpf maps
+	for _, f := range filter.NotEqual {
+		kind, str := parseStrPattern(f)
+		patterns = append(patterns, pattern{kind, str, false})
+	}
+
+	exactMatch := false
+	for _, p := range patterns {
+		if p.kind == strPatternExact && p.str == val {
+			if !p.equal {
+				return false
+			}
+			exactMatch = true
+		}
+	}
+	if exactMatch {
+		return true
+	}
+
+	if equal, ok := filter.prefixMatch(val); ok {
+		return equal
+	}
+
+	for _, p := range patterns {
+		if !p.equal && matchesUserspacePattern(p.kind, p.str, val) {
+			return false
+		}
+	}
+	for _, p := range patterns {
+		if p.equal && matchesUserspacePattern(p.kind, p.str, val) {
+			return true
+		}
+	}
+
+	return !filter.filterIn()
+}
+
+// prefixMatch evaluates the longest prefix of the filter that the given value starts with, if there is one.
+// Not equal prefixes take precedence over identical equal prefixes, as in the bpf maps.
+func (filter *StringFilter) prefixMatch(val string) (equal bool, ok bool) {
+	longest := -1
+	for _, vals := range []struct {
+		vals  []string
+		equal bool
+	}{{filter.Equal, true}, {filter.NotEqual, false}} {
+		for _, f := range vals.vals {
+			kind, str := parseStrPattern(f)
+			if kind == strPatternPrefix && strings.HasPrefix(val, str) && len(str) >= longest {
+				longest = len(str)
+				equal = vals.equal
+			}
+		}
+	}
+	return equal, longest >= 0
+}
+
+func matchesUserspacePattern(kind strPatternKind, pattern, val string) bool {
+	switch kind {
+	case strPatternSuffix:
+		return strings.HasSuffix(val, pattern)
+	case strPatternGlob:
+		return globMatch(pattern, val)
+	}
+	return false
+}
+
 type BoolFilter struct {
 	Value   bool
 	Enabled bool
@@ -328,6 +573,41 @@ func (filter *BoolFilter) Set(bpfModule *bpf.Module, configFilter bpfConfig) err
 	return err
 }
 
+// InFilter evaluates the filter against the given value in userspace
+func (filter *BoolFilter) InFilter(val bool) bool {
+	if !filter.Enabled {
+		return true
+	}
+	return filter.Value == val
+}
+
+// NetIfaces holds the network interfaces whose traffic is traced by the tc probes, e.g. for net_flow events
+type NetIfaces struct {
+	Ifaces []string
+}
+
+func (ifaces *NetIfaces) Parse(operatorAndValues string) error {
+	if len(operatorAndValues) < 2 || operatorAndValues[0] != '=' {
+		return fmt.Errorf("invalid operator and/or values given to filter: %s", operatorAndValues)
+	}
+	for _, iface := range strings.Split(operatorAndValues[1:], ",") {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return fmt.Errorf("invalid network interface: %s", iface)
+		}
+		found := false
+		for _, item := range ifaces.Ifaces {
+			if iface == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ifaces.Ifaces = append(ifaces.Ifaces, iface)
+		}
+	}
+	return nil
+}
+
 type RetFilter struct {
 	Filters map[int32]IntFilter
 	Enabled bool
@@ -370,14 +650,32 @@ func (retFilter *RetFilter) Parse(filterName string, operatorAndValues string, e
 	return nil
 }
 
+// InFilter checks the return value of the given event against the filter
+func (filter *RetFilter) InFilter(eventID int32, retVal int64) bool {
+	if !filter.Enabled {
+		return true
+	}
+	intFilter, ok := filter.Filters[eventID]
+	if !ok {
+		return true
+	}
+	return intFilter.InFilter(retVal)
+}
+
 type ArgFilter struct {
 	Filters map[int32]map[string]ArgFilterVal // key to the first map is event id, and to the second map the argument name
 	Enabled bool
 }
 
+// ArgFilterVal holds the filters of a single event argument.
+// String arguments are compared as strings using Equal and NotEqual, while integer arguments are compared numerically
+// using Int, and can also be tested against bitmasks.
 type ArgFilterVal struct {
-	Equal    []string
-	NotEqual []string
+	Equal      []string
+	NotEqual   []string
+	Int        *IntFilter
+	MaskSet    []uint64 // all the bits of each mask must be set
+	MaskNotSet []uint64 // at least one of the bits of each mask must not be set
 }
 
 func (argFilter *ArgFilter) Parse(filterName string, operatorAndValues string, eventsNameToID map[string]int32) error {
@@ -403,9 +701,11 @@ func (argFilter *ArgFilter) Parse(filterName string, operatorAndValues string, e
 
 	// check if argument name exists for this event
 	argFound := false
+	var paramType argType
 	for i := range eventParams {
 		if eventParams[i].Name == argName {
 			argFound = true
+			paramType = getParamType(eventParams[i].Type)
 			break
 		}
 	}
@@ -414,6 +714,29 @@ func (argFilter *ArgFilter) Parse(filterName string, operatorAndValues string, e
 		return fmt.Errorf("invalid argument filter argument name: %s", argName)
 	}
 
+	if _, ok := argFilter.Filters[id]; !ok {
+		argFilter.Filters[id] = make(map[string]ArgFilterVal)
+	}
+
+	if _, ok := argFilter.Filters[id][argName]; !ok {
+		argFilter.Filters[id][argName] = ArgFilterVal{}
+	}
+
+	val := argFilter.Filters[id][argName]
+
+	if isIntArgType(paramType) {
+		if err := val.parseInt(id, argName, operatorAndValues); err != nil {
+			return err
+		}
+		argFilter.Filters[id][argName] = val
+		return nil
+	}
+
+	if strings.HasPrefix(operatorAndValues, "<") || strings.HasPrefix(operatorAndValues, ">") ||
+		strings.HasPrefix(operatorAndValues, "&") || strings.HasPrefix(operatorAndValues, "!&") {
+		return fmt.Errorf("invalid argument filter %s%s: argument is not an integer", filterName, operatorAndValues)
+	}
+
 	strFilter := &StringFilter{
 		Equal:    []string{},
 		NotEqual: []string{},
@@ -425,24 +748,173 @@ func (argFilter *ArgFilter) Parse(filterName string, operatorAndValues string, e
 		return err
 	}
 
-	if _, ok := argFilter.Filters[id]; !ok {
-		argFilter.Filters[id] = make(map[string]ArgFilterVal)
+	val.Equal = append(val.Equal, strFilter.Equal...)
+	val.NotEqual = append(val.NotEqual, strFilter.NotEqual...)
+
+	argFilter.Filters[id][argName] = val
+
+	return nil
+}
+
+// isIntArgType returns true if arguments of the given type are decoded as integers
+func isIntArgType(paramType argType) bool {
+	switch paramType {
+	case intT, uintT, longT, ulongT, offT, modeT, devT, sizeT, u16T:
+		return true
 	}
+	return false
+}
 
-	if _, ok := argFilter.Filters[id][argName]; !ok {
-		argFilter.Filters[id][argName] = ArgFilterVal{}
+// parseInt parses a filter of an integer argument.
+// Values can be given as numbers (including hex and octal), or as the symbolic constants used to print the argument,
+// and can be ORed using '|', e.g. "&O_CREAT|O_TRUNC".
+func (val *ArgFilterVal) parseInt(eventID int32, argName string, operatorAndValues string) error {
+	if len(operatorAndValues) < 2 {
+		return fmt.Errorf("invalid operator and/or values given to filter: %s", operatorAndValues)
 	}
+	valuesString := string(operatorAndValues[1:])
+	operatorString := string(operatorAndValues[0])
 
-	val := argFilter.Filters[id][argName]
+	if operatorString == "!" {
+		if len(operatorAndValues) < 3 {
+			return fmt.Errorf("invalid operator and/or values given to filter: %s", operatorAndValues)
+		}
+		operatorString = operatorAndValues[0:2]
+		valuesString = operatorAndValues[2:]
+	}
 
-	val.Equal = append(val.Equal, strFilter.Equal...)
-	val.NotEqual = append(val.NotEqual, strFilter.NotEqual...)
+	if val.Int == nil {
+		val.Int = &IntFilter{Greater: GreaterNotSetInt, Less: LessNotSetInt, Enabled: true}
+	}
 
-	argFilter.Filters[id][argName] = val
+	var symbols map[string]uint64
+	for _, valueString := range strings.Split(valuesString, ",") {
+		var value uint64
+		for _, part := range strings.Split(valueString, "|") {
+			partVal, err := strconv.ParseInt(part, 0, 64)
+			if err == nil {
+				value |= uint64(partVal)
+				continue
+			}
+			if partUval, err := strconv.ParseUint(part, 0, 64); err == nil {
+				value |= partUval
+				continue
+			}
+			if symbols == nil {
+				symbols = argSymbols(eventID, argName)
+			}
+			symbolVal, ok := symbols[part]
+			if !ok {
+				return fmt.Errorf("invalid filter value for argument %s: %s", argName, part)
+			}
+			value |= symbolVal
+		}
+
+		switch operatorString {
+		case "=":
+			val.Int.Equal = append(val.Int.Equal, int64(value))
+		case "!=":
+			val.Int.NotEqual = append(val.Int.NotEqual, int64(value))
+		case ">":
+			if (val.Int.Greater == GreaterNotSetInt) || (int64(value) > val.Int.Greater) {
+				val.Int.Greater = int64(value)
+			}
+		case "<":
+			if (val.Int.Less == LessNotSetInt) || (int64(value) < val.Int.Less) {
+				val.Int.Less = int64(value)
+			}
+		case "&":
+			val.MaskSet = append(val.MaskSet, value)
+		case "!&":
+			val.MaskNotSet = append(val.MaskNotSet, value)
+		default:
+			return fmt.Errorf("invalid filter operator: %s", operatorString)
+		}
+	}
 
 	return nil
 }
 
+// inFilter checks an integer argument against the filter
+func (val *ArgFilterVal) inFilter(argVal int64) bool {
+	if !val.Int.InFilter(argVal) {
+		return false
+	}
+	for _, mask := range val.MaskSet {
+		if uint64(argVal)&mask != mask {
+			return false
+		}
+	}
+	for _, mask := range val.MaskNotSet {
+		if uint64(argVal)&mask == mask {
+			return false
+		}
+	}
+	return true
+}
+
+// argToInt converts an integer argument to int64, as done when parsing integer argument filters
+func argToInt(argVal interface{}) (int64, bool) {
+	switch v := argVal.(type) {
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// InFilter checks the arguments of the given event against the filter
+func (filter *ArgFilter) InFilter(eventID int32, args map[string]interface{}) bool {
+	if !filter.Enabled {
+		return true
+	}
+
+	for argName, f := range filter.Filters[eventID] {
+		argVal, ok := args[argName]
+		if !ok {
+			continue
+		}
+		if f.Int != nil {
+			argInt, ok := argToInt(argVal)
+			if !ok {
+				continue
+			}
+			if !f.inFilter(argInt) {
+				return false
+			}
+			continue
+		}
+		argValStr, ok := argVal.(string)
+		if !ok {
+			argValStr = fmt.Sprint(argVal)
+		}
+		match := false
+		for _, val := range f.Equal {
+			if argValStr == val || (val[len(val)-1] == '*' && strings.HasPrefix(argValStr, val[0:len(val)-1])) {
+				match = true
+				break
+			}
+		}
+		if !match && len(f.Equal) > 0 {
+			return false
+		}
+		for _, val := range f.NotEqual {
+			if argValStr == val || (val[len(val)-1] == '*' && strings.HasPrefix(argValStr, val[0:len(val)-1])) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 type ProcessTreeFilter struct {
 	PIDs    map[uint32]bool // PIDs is a map where k=pid and v represents whether it and its descendents should be traced or not
 	Enabled bool
@@ -561,3 +1033,32 @@ func (filter *ProcessTreeFilter) Set(bpfModule *bpf.Module) error {
 
 	return nil
 }
+
+// InFilter checks whether the given pid should be traced according to the filter.
+// parentOf is used to walk up the process ancestry until a pid given to the filter is found.
+// The semantics match the process_tree_map handling in the ebpf code.
+func (filter *ProcessTreeFilter) InFilter(pid uint32, parentOf func(uint32) (uint32, bool)) bool {
+	if !filter.Enabled {
+		return true
+	}
+
+	// Walk up the tree, bounded to avoid looping on a corrupted ancestry
+	for i := 0; i < maxProcessTreeDepth && pid > 1; i++ {
+		if shouldBeTraced, ok := filter.PIDs[pid]; ok {
+			return shouldBeTraced
+		}
+		ppid, ok := parentOf(pid)
+		if !ok {
+			break
+		}
+		pid = ppid
+	}
+
+	// Same default as in Set: only trace pids that are not given to the filter if there is a '!=' filter
+	for _, v := range filter.PIDs {
+		if !v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package tracee
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgFilter_Parse(t *testing.T) {
+	eventsNameToID := map[string]int32{"openat": OpenatEventID, "close": CloseEventID, "mmap": MmapEventID}
+
+	testCases := []struct {
+		name          string
+		filterName    string
+		filters       []string
+		expected      ArgFilterVal
+		expectedError string
+	}{
+		{
+			name:       "string argument",
+			filterName: "openat.pathname",
+			filters:    []string{"=/bin/ls,/tmp*", "!=/etc/passwd"},
+			expected:   ArgFilterVal{Equal: []string{"/bin/ls", "/tmp*"}, NotEqual: []string{"/etc/passwd"}},
+		},
+		{
+			name:       "integer range",
+			filterName: "close.fd",
+			filters:    []string{">2", "<10", "!=5"},
+			expected: ArgFilterVal{
+				Int: &IntFilter{NotEqual: []int64{5}, Greater: 2, Less: 10, Enabled: true},
+			},
+		},
+		{
+			name:       "hex and octal values",
+			filterName: "openat.mode",
+			filters:    []string{"=0x1ff,0644"},
+			expected: ArgFilterVal{
+				Int: &IntFilter{Equal: []int64{0777, 0644}, Greater: GreaterNotSetInt, Less: LessNotSetInt, Enabled: true},
+			},
+		},
+		{
+			name:       "bitmask of symbolic constants",
+			filterName: "openat.flags",
+			filters:    []string{"&O_CREAT|O_TRUNC", "!&O_WRONLY"},
+			expected: ArgFilterVal{
+				Int:        &IntFilter{Greater: GreaterNotSetInt, Less: LessNotSetInt, Enabled: true},
+				MaskSet:    []uint64{01100},
+				MaskNotSet: []uint64{01},
+			},
+		},
+		{
+			name:       "symbolic constant equality",
+			filterName: "mmap.prot",
+			filters:    []string{"=PROT_READ|PROT_EXEC,PROT_NONE"},
+			expected: ArgFilterVal{
+				Int: &IntFilter{Equal: []int64{5, 0}, Greater: GreaterNotSetInt, Less: LessNotSetInt, Enabled: true},
+			},
+		},
+		{
+			name:          "unknown symbolic constant",
+			filterName:    "openat.flags",
+			filters:       []string{"&PROT_EXEC"},
+			expectedError: "invalid filter value for argument flags: PROT_EXEC",
+		},
+		{
+			name:          "number operator on a string argument",
+			filterName:    "openat.pathname",
+			filters:       []string{">5"},
+			expectedError: "invalid argument filter openat.pathname>5: argument is not an integer",
+		},
+		{
+			name:          "bitmask operator on a string argument",
+			filterName:    "openat.pathname",
+			filters:       []string{"&5"},
+			expectedError: "invalid argument filter openat.pathname&5: argument is not an integer",
+		},
+		{
+			name:          "invalid argument name",
+			filterName:    "close.foo",
+			filters:       []string{"=5"},
+			expectedError: "invalid argument filter argument name: foo",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &ArgFilter{Filters: make(map[int32]map[string]ArgFilterVal)}
+			var err error
+			for _, expr := range tc.filters {
+				if err = f.Parse(tc.filterName, expr, eventsNameToID); err != nil {
+					break
+				}
+			}
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			split := strings.Split(tc.filterName, ".")
+			assert.Equal(t, tc.expected, f.Filters[eventsNameToID[split[0]]][split[1]])
+		})
+	}
+}
+
+func TestArgFilter_InFilter(t *testing.T) {
+	eventsNameToID := map[string]int32{"openat": OpenatEventID, "close": CloseEventID}
+
+	testCases := []struct {
+		name     string
+		filters  []string
+		eventID  int32
+		args     map[string]interface{}
+		expected bool
+	}{
+		{
+			name:     "string prefix",
+			filters:  []string{"openat.pathname=/tmp*"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"pathname": "/tmp/x"},
+			expected: true,
+		},
+		{
+			name:     "other event",
+			filters:  []string{"openat.pathname=/tmp*"},
+			eventID:  CloseEventID,
+			args:     map[string]interface{}{"fd": int32(3)},
+			expected: true,
+		},
+		{
+			name:     "in range",
+			filters:  []string{"close.fd>2", "close.fd<10"},
+			eventID:  CloseEventID,
+			args:     map[string]interface{}{"fd": int32(3)},
+			expected: true,
+		},
+		{
+			name:     "out of range",
+			filters:  []string{"close.fd>2", "close.fd<10"},
+			eventID:  CloseEventID,
+			args:     map[string]interface{}{"fd": int32(10)},
+			expected: false,
+		},
+		{
+			name:     "bits set",
+			filters:  []string{"openat.flags&O_CREAT"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"flags": int32(01101)},
+			expected: true,
+		},
+		{
+			name:     "bits not set",
+			filters:  []string{"openat.flags&O_CREAT|O_TRUNC"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"flags": int32(0101)},
+			expected: false,
+		},
+		{
+			name:     "negated bitmask",
+			filters:  []string{"openat.flags!&O_CREAT"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"flags": int32(0101)},
+			expected: false,
+		},
+		{
+			name:     "mode_t bitmask",
+			filters:  []string{"openat.mode&0111"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"mode": uint32(0755)},
+			expected: true,
+		},
+		{
+			name:     "combined string and integer arguments",
+			filters:  []string{"openat.pathname=/etc*", "openat.flags&O_WRONLY"},
+			eventID:  OpenatEventID,
+			args:     map[string]interface{}{"pathname": "/etc/passwd", "flags": int32(0)},
+			expected: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &ArgFilter{Filters: make(map[int32]map[string]ArgFilterVal)}
+			for _, expr := range tc.filters {
+				opIdx := strings.IndexAny(expr, "=!<>&")
+				require.NoError(t, f.Parse(expr[:opIdx], expr[opIdx:], eventsNameToID))
+			}
+			assert.Equal(t, tc.expected, f.InFilter(tc.eventID, tc.args))
+		})
+	}
+}
+
+func TestNetIfaces_Parse(t *testing.T) {
+	ifaces := &NetIfaces{}
+	require.NoError(t, ifaces.Parse("=lo"))
+	require.NoError(t, ifaces.Parse("=lo"))
+	assert.Equal(t, []string{"lo"}, ifaces.Ifaces)
+
+	assert.EqualError(t, ifaces.Parse("=no-such-iface0"), "invalid network interface: no-such-iface0")
+	assert.EqualError(t, ifaces.Parse("!=lo"), "invalid operator and/or values given to filter: !=lo")
+}
+
+func TestParseStrPattern(t *testing.T) {
+	testCases := []struct {
+		val          string
+		expectedKind strPatternKind
+		expectedStr  string
+	}{
+		{val: "bash", expectedKind: strPatternExact, expectedStr: "bash"},
+		{val: "averyveryverylongcomm", expectedKind: strPatternExact, expectedStr: "averyveryverylo"},
+		{val: "kworker*", expectedKind: strPatternPrefix, expectedStr: "kworker"},
+		{val: "averyveryverylongcomm*", expectedKind: strPatternPrefix, expectedStr: "averyveryverylo"},
+		{val: "*.sh", expectedKind: strPatternSuffix, expectedStr: ".sh"},
+		{val: "*bash*", expectedKind: strPatternGlob, expectedStr: "*bash*"},
+		{val: "ba?h", expectedKind: strPatternGlob, expectedStr: "ba?h"},
+		{val: "b*sh", expectedKind: strPatternGlob, expectedStr: "b*sh"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.val, func(t *testing.T) {
+			kind, str := parseStrPattern(tc.val)
+			assert.Equal(t, tc.expectedKind, kind)
+			assert.Equal(t, tc.expectedStr, str)
+		})
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		val      string
+		expected bool
+	}{
+		{pattern: "*", val: "", expected: true},
+		{pattern: "*", val: "kworker/0:1", expected: true},
+		{pattern: "k*r", val: "kworker", expected: true},
+		{pattern: "k*r", val: "kworkers", expected: false},
+		{pattern: "*/*", val: "kworker/0:1", expected: true},
+		{pattern: "b?sh", val: "bash", expected: true},
+		{pattern: "b?sh", val: "bsh", expected: false},
+		{pattern: "*a*b*", val: "xxaxxbxx", expected: true},
+		{pattern: "*a*b*", val: "xxbxxaxx", expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.val, func(t *testing.T) {
+			assert.Equal(t, tc.expected, globMatch(tc.pattern, tc.val))
+		})
+	}
+}
+
+func TestStringFilter_UserspaceOnly(t *testing.T) {
+	testCases := []struct {
+		filters  []string
+		expected bool
+	}{
+		{filters: nil, expected: false},
+		{filters: []string{"=bash,zsh"}, expected: false},
+		{filters: []string{"=kworker*", "!=kworker/0*"}, expected: false},
+		{filters: []string{"=kworker*", "!=*.sh"}, expected: true},
+		{filters: []string{"=b?sh"}, expected: true},
+	}
+	for _, tc := range testCases {
+		f := &StringFilter{}
+		for _, expr := range tc.filters {
+			assert.NoError(t, f.Parse(expr))
+		}
+		assert.Equal(t, tc.expected, f.UserspaceOnly(), "%v", tc.filters)
+	}
+}
@@ -0,0 +1,129 @@
+package tracee
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const dnsPort = 53
+
+// decodeDNSPacket decodes the DNS message carried by a captured packet, to or from port 53 over UDP or TCP.
+// DNS messages over TCP are only decoded if they are contained in a single segment.
+func decodeDNSPacket(data []byte) (netFlowKey, *layers.DNS, bool) {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	key, ok := packetFlowKey(packet)
+	if !ok || (key.srcPort != dnsPort && key.dstPort != dnsPort) {
+		return netFlowKey{}, nil, false
+	}
+	payload := packet.TransportLayer().LayerPayload()
+	if key.protocol == "tcp" {
+		// messages over TCP are prefixed by their length
+		if len(payload) < 2 || len(payload) < 2+int(binary.BigEndian.Uint16(payload)) {
+			return netFlowKey{}, nil, false
+		}
+		payload = payload[2 : 2+int(binary.BigEndian.Uint16(payload))]
+	}
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil || len(dns.Questions) == 0 {
+		return netFlowKey{}, nil, false
+	}
+	return key, dns, true
+}
+
+func dnsTypeName(t layers.DNSType) string {
+	if name := t.String(); name != "Unknown" {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+func dnsResponseCodeName(rcode layers.DNSResponseCode) string {
+	switch rcode {
+	case layers.DNSResponseCodeNoErr:
+		return "NOERROR"
+	case layers.DNSResponseCodeFormErr:
+		return "FORMERR"
+	case layers.DNSResponseCodeServFail:
+		return "SERVFAIL"
+	case layers.DNSResponseCodeNXDomain:
+		return "NXDOMAIN"
+	case layers.DNSResponseCodeNotImp:
+		return "NOTIMP"
+	case layers.DNSResponseCodeRefused:
+		return "REFUSED"
+	}
+	return strconv.Itoa(int(rcode))
+}
+
+// dnsAnswer formats an answer record as "<type> <data>", e.g. "A 93.184.216.34" or "CNAME www.example.com"
+func dnsAnswer(rr layers.DNSResourceRecord) string {
+	var data string
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		data = rr.IP.String()
+	case layers.DNSTypeCNAME:
+		data = string(rr.CNAME)
+	case layers.DNSTypeNS:
+		data = string(rr.NS)
+	case layers.DNSTypePTR:
+		data = string(rr.PTR)
+	case layers.DNSTypeMX:
+		data = fmt.Sprintf("%d %s", rr.MX.Preference, rr.MX.Name)
+	case layers.DNSTypeSRV:
+		data = fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight, rr.SRV.Port, rr.SRV.Name)
+	case layers.DNSTypeTXT:
+		txts := make([]string, len(rr.TXTs))
+		for i, txt := range rr.TXTs {
+			txts[i] = string(txt)
+		}
+		data = strings.Join(txts, " ")
+	default:
+		return dnsTypeName(rr.Type)
+	}
+	return dnsTypeName(rr.Type) + " " + data
+}
+
+// CreateDNSEvent creates a net_dns_request or net_dns_response event from a decoded DNS message
+func CreateDNSEvent(key netFlowKey, dns *layers.DNS, ctx netPacketContext, ts int) external.Event {
+	eventID := NetDnsRequestEventID
+	if dns.QR {
+		eventID = NetDnsResponseEventID
+	}
+	answers := make([]string, 0, len(dns.Answers))
+	for _, rr := range dns.Answers {
+		answers = append(answers, dnsAnswer(rr))
+	}
+	values := map[string]interface{}{
+		"srcIP":    key.srcIP,
+		"srcPort":  key.srcPort,
+		"dstIP":    key.dstIP,
+		"dstPort":  key.dstPort,
+		"protocol": key.protocol,
+		"id":       dns.ID,
+		"name":     string(dns.Questions[0].Name),
+		"type":     dnsTypeName(dns.Questions[0].Type),
+		"rcode":    dnsResponseCodeName(dns.ResponseCode),
+		"answers":  answers,
+	}
+	args := make([]external.Argument, len(EventsIDToParams[eventID]))
+	for i, meta := range EventsIDToParams[eventID] {
+		args[i] = external.Argument{ArgMeta: meta, Value: values[meta.Name]}
+	}
+	return ctx.event(eventID, ts, args)
+}
+
+// processDNSPacket emits the DNS message carried by a captured packet, if any
+func (t *Tracee) processDNSPacket(ts time.Time, hostTid uint32, comm string, data []byte) {
+	key, dns, ok := decodeDNSPacket(data)
+	if !ok {
+		return
+	}
+	t.emitUserspaceEvent(CreateDNSEvent(key, dns, t.netPacketContext(hostTid, comm), t.netEventTimestamp(ts)))
+}
@@ -0,0 +1,157 @@
+package tracee
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dnsPacket(t *testing.T, tcp bool, srcIP, dstIP string, srcPort, dstPort uint16, dns *layers.DNS) []byte {
+	dnsBuf := gopacket.NewSerializeBuffer()
+	require.NoError(t, dns.SerializeTo(dnsBuf, gopacket.SerializeOptions{FixLengths: true}))
+	payload := dnsBuf.Bytes()
+
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.ParseIP(srcIP), DstIP: net.ParseIP(dstIP)}
+	var transport gopacket.SerializableLayer
+	if tcp {
+		ip.Protocol = layers.IPProtocolTCP
+		tcpLayer := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), PSH: true, ACK: true}
+		require.NoError(t, tcpLayer.SetNetworkLayerForChecksum(ip))
+		transport = tcpLayer
+		prefixed := make([]byte, 2+len(payload))
+		binary.BigEndian.PutUint16(prefixed, uint16(len(payload)))
+		copy(prefixed[2:], payload)
+		payload = prefixed
+	} else {
+		ip.Protocol = layers.IPProtocolUDP
+		udpLayer := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+		require.NoError(t, udpLayer.SetNetworkLayerForChecksum(ip))
+		transport = udpLayer
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, transport, gopacket.Payload(payload)))
+	return buf.Bytes()
+}
+
+func TestCreateDNSEvent(t *testing.T) {
+	query := &layers.DNS{
+		ID:        0x1234,
+		RD:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+	response := &layers.DNS{
+		ID:           0x1234,
+		QR:           true,
+		RD:           true,
+		RA:           true,
+		ResponseCode: layers.DNSResponseCodeNoErr,
+		Questions:    query.Questions,
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 60, CNAME: []byte("www.example.com")},
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP("93.184.216.34").To4()},
+		},
+	}
+	nxdomain := &layers.DNS{
+		ID:           0x1,
+		QR:           true,
+		ResponseCode: layers.DNSResponseCodeNXDomain,
+		Questions:    []layers.DNSQuestion{{Name: []byte("c2.example.org"), Type: layers.DNSTypeTXT, Class: layers.DNSClassIN}},
+	}
+	ctx := netPacketContext{comm: "curl", hostTid: 11, hostPid: 10, containerID: "abc"}
+
+	testCases := []struct {
+		name          string
+		packet        []byte
+		expectedEvent *external.Event
+	}{
+		{
+			name:   "request over udp",
+			packet: dnsPacket(t, false, "10.0.0.1", "10.0.0.53", 40000, 53, query),
+			expectedEvent: &external.Event{
+				Timestamp:     1000,
+				HostProcessID: 10,
+				HostThreadID:  11,
+				ProcessName:   "curl",
+				ContainerID:   "abc",
+				EventID:       int(NetDnsRequestEventID),
+				EventName:     "net_dns_request",
+				ArgsNum:       8,
+				Args: []external.Argument{
+					{ArgMeta: external.ArgMeta{Name: "srcIP", Type: "const char*"}, Value: "10.0.0.1"},
+					{ArgMeta: external.ArgMeta{Name: "srcPort", Type: "u16"}, Value: uint16(40000)},
+					{ArgMeta: external.ArgMeta{Name: "dstIP", Type: "const char*"}, Value: "10.0.0.53"},
+					{ArgMeta: external.ArgMeta{Name: "dstPort", Type: "u16"}, Value: uint16(53)},
+					{ArgMeta: external.ArgMeta{Name: "protocol", Type: "const char*"}, Value: "udp"},
+					{ArgMeta: external.ArgMeta{Name: "id", Type: "u16"}, Value: uint16(0x1234)},
+					{ArgMeta: external.ArgMeta{Name: "name", Type: "const char*"}, Value: "example.com"},
+					{ArgMeta: external.ArgMeta{Name: "type", Type: "const char*"}, Value: "A"},
+				},
+			},
+		},
+		{
+			name:   "response over tcp",
+			packet: dnsPacket(t, true, "10.0.0.53", "10.0.0.1", 53, 40000, response),
+			expectedEvent: &external.Event{
+				Timestamp:     1000,
+				HostProcessID: 10,
+				HostThreadID:  11,
+				ProcessName:   "curl",
+				ContainerID:   "abc",
+				EventID:       int(NetDnsResponseEventID),
+				EventName:     "net_dns_response",
+				ArgsNum:       10,
+				Args: []external.Argument{
+					{ArgMeta: external.ArgMeta{Name: "srcIP", Type: "const char*"}, Value: "10.0.0.53"},
+					{ArgMeta: external.ArgMeta{Name: "srcPort", Type: "u16"}, Value: uint16(53)},
+					{ArgMeta: external.ArgMeta{Name: "dstIP", Type: "const char*"}, Value: "10.0.0.1"},
+					{ArgMeta: external.ArgMeta{Name: "dstPort", Type: "u16"}, Value: uint16(40000)},
+					{ArgMeta: external.ArgMeta{Name: "protocol", Type: "const char*"}, Value: "tcp"},
+					{ArgMeta: external.ArgMeta{Name: "id", Type: "u16"}, Value: uint16(0x1234)},
+					{ArgMeta: external.ArgMeta{Name: "name", Type: "const char*"}, Value: "example.com"},
+					{ArgMeta: external.ArgMeta{Name: "type", Type: "const char*"}, Value: "A"},
+					{ArgMeta: external.ArgMeta{Name: "rcode", Type: "const char*"}, Value: "NOERROR"},
+					{ArgMeta: external.ArgMeta{Name: "answers", Type: "const char**"}, Value: []string{"CNAME www.example.com", "A 93.184.216.34"}},
+				},
+			},
+		},
+		{
+			name:   "non-existent domain",
+			packet: dnsPacket(t, false, "10.0.0.53", "10.0.0.1", 53, 40001, nxdomain),
+			expectedEvent: func() *external.Event {
+				evt := CreateDNSEvent(netFlowKey{srcIP: "10.0.0.53", dstIP: "10.0.0.1", srcPort: 53, dstPort: 40001, protocol: "udp"}, nxdomain, ctx, 1000)
+				assert.Equal(t, "TXT", evt.Args[7].Value)
+				assert.Equal(t, "NXDOMAIN", evt.Args[8].Value)
+				assert.Equal(t, []string{}, evt.Args[9].Value)
+				return &evt
+			}(),
+		},
+		{
+			name:   "not dns port",
+			packet: dnsPacket(t, false, "10.0.0.1", "10.0.0.53", 40000, 5353, query),
+		},
+		{
+			name:   "truncated message over tcp",
+			packet: dnsPacket(t, true, "10.0.0.53", "10.0.0.1", 53, 40000, response)[:80],
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, dns, ok := decodeDNSPacket(tc.packet)
+			if tc.expectedEvent == nil {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			evt := CreateDNSEvent(key, dns, ctx, 1000)
+			assert.Equal(t, *tc.expectedEvent, evt)
+		})
+	}
+}
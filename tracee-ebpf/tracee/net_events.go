@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
 	"github.com/google/gopacket"
 	"inet.af/netaddr"
 )
 
 func (t *Tracee) processNetEvents() {
-	// Todo: split pcap files by context (tid + comm)
-	// Todo: add stats for network packets (in epilog)
 	for {
 		select {
 		case in := <-t.netChannel:
@@ -43,27 +46,20 @@ func (t *Tracee) processNetEvents() {
 					t.handleError(err)
 					continue
 				}
-				idx, ok := t.ngIfacesIndex[int(ifindex)]
-				if !ok {
+				var pktMeta netPacketMeta
+				err = binary.Read(dataBuff, binary.LittleEndian, &pktMeta)
+				if err != nil {
 					t.handleError(err)
 					continue
 				}
+				ifaceStats, ok := t.stats.netIfaces[int(ifindex)]
+				if !ok {
+					t.stats.unknownIfaceCounter.Increment()
+					continue
+				}
+				ifaceStats.count(pktMeta.Ingress != 0, pktLen)
 
 				if t.config.Debug {
-					var pktMeta struct {
-						SrcIP    [16]byte
-						DestIP   [16]byte
-						SrcPort  uint16
-						DestPort uint16
-						Protocol uint8
-						_        [3]byte //padding
-					}
-					err = binary.Read(dataBuff, binary.LittleEndian, &pktMeta)
-					if err != nil {
-						t.handleError(err)
-						continue
-					}
-
 					fmt.Printf("%v  %-16s  %-7d  debug_net/packet               Len: %d, SrcIP: %v, SrcPort: %d, DestIP: %v, DestPort: %d, Protocol: %d\n",
 						timeStampObj,
 						comm,
@@ -76,6 +72,27 @@ func (t *Tracee) processNetEvents() {
 						pktMeta.Protocol)
 				}
 
+				if t.netFlows != nil {
+					t.processNetFlowPacket(timeStampObj, hostTid, comm, pktLen, pktMeta)
+				}
+
+				if t.eventsToTrace[NetDnsRequestEventID] || t.eventsToTrace[NetDnsResponseEventID] {
+					t.processDNSPacket(timeStampObj, hostTid, comm, dataBuff.Bytes()[:pktLen])
+				}
+
+				if t.httpParser != nil {
+					t.processHTTPPacket(timeStampObj, hostTid, comm, dataBuff.Bytes()[:pktLen])
+				}
+
+				if t.pcapWriters == nil {
+					continue
+				}
+				idx, ok := t.ngIfacesIndex[int(ifindex)]
+				if !ok {
+					// the interface is traced for net flow events, but its packets are not captured
+					continue
+				}
+
 				info := gopacket.CaptureInfo{
 					Timestamp:      timeStampObj,
 					CaptureLength:  int(pktLen),
@@ -83,15 +100,9 @@ func (t *Tracee) processNetEvents() {
 					InterfaceIndex: idx,
 				}
 
-				err = t.pcapWriter.WritePacket(info, dataBuff.Bytes()[:pktLen])
-				if err != nil {
-					t.handleError(err)
-					continue
-				}
-
-				// todo: maybe we should not flush every packet?
-				err = t.pcapWriter.Flush()
+				err = t.pcapWriters.writePacket(t.netPacketContext(hostTid, comm), info, dataBuff.Bytes()[:pktLen])
 				if err != nil {
+					t.stats.pcapErrorCounter.Increment()
 					t.handleError(err)
 					continue
 				}
@@ -153,3 +164,100 @@ func (t *Tracee) processNetEvents() {
 		}
 	}
 }
+
+// netPacketContext returns the process and container of the thread that sent or received a captured packet
+func (t *Tracee) netPacketContext(hostTid uint32, comm string) netPacketContext {
+	if cached, ok := t.netProcesses.Get(hostTid); ok {
+		if ctx := cached.(netPacketContext); ctx.comm == comm {
+			return ctx
+		}
+	}
+	ctx := netPacketContext{comm: comm, hostTid: hostTid, hostPid: hostTid}
+	// the thread may have already exited, in which case its process and container are unknown
+	readProcessContext(&ctx)
+	ctx.containerID, _ = t.containers.GetContainerIdFromProcess(hostTid)
+	if t.procUtsNames != nil {
+		if utsName, ok := t.procUtsNames.Get(ctx.hostPid); ok {
+			ctx.utsName = utsName.(string)
+		}
+	}
+	t.netProcesses.Add(hostTid, ctx)
+	return ctx
+}
+
+// readProcessContext reads the process of a thread, its user and its namespaces from procfs
+func readProcessContext(ctx *netPacketContext) {
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", ctx.hostTid))
+	if err != nil {
+		return
+	}
+	// the last NStgid and NSpid values are in the pid namespace of the process
+	lastField := func(value string) uint32 {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return 0
+		}
+		v, _ := strconv.ParseUint(fields[len(fields)-1], 10, 32)
+		return uint32(v)
+	}
+	firstField := func(value string) uint32 {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return 0
+		}
+		v, _ := strconv.ParseUint(fields[0], 10, 32)
+		return uint32(v)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		name := strings.SplitN(line, ":", 2)
+		if len(name) != 2 {
+			continue
+		}
+		switch name[0] {
+		case "Tgid":
+			ctx.hostPid = firstField(name[1])
+		case "PPid":
+			ctx.hostPpid = firstField(name[1])
+		case "Uid":
+			ctx.uid = firstField(name[1])
+		case "NStgid":
+			ctx.pid = lastField(name[1])
+		case "NSpid":
+			ctx.tid = lastField(name[1])
+		}
+	}
+	ctx.mntNS = readProcessNamespace(ctx.hostTid, "mnt")
+	ctx.pidNS = readProcessNamespace(ctx.hostTid, "pid")
+}
+
+// readProcessNamespace returns the inode number of a namespace of a thread, e.g. "mnt:[4026531840]", or 0
+func readProcessNamespace(tid uint32, ns string) uint32 {
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/%s", tid, ns))
+	if err != nil {
+		return 0
+	}
+	inode, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, ns+":["), "]"), 10, 32)
+	return uint32(inode)
+}
+
+// event returns an event of the process that sent or received a captured packet
+func (ctx netPacketContext) event(eventID int32, timestamp int, args []external.Argument) external.Event {
+	return external.Event{
+		Timestamp:           timestamp,
+		ProcessID:           int(ctx.pid),
+		ThreadID:            int(ctx.tid),
+		HostProcessID:       int(ctx.hostPid),
+		HostThreadID:        int(ctx.hostTid),
+		HostParentProcessID: int(ctx.hostPpid),
+		UserID:              int(ctx.uid),
+		MountNS:             int(ctx.mntNS),
+		PIDNS:               int(ctx.pidNS),
+		ProcessName:         ctx.comm,
+		HostName:            ctx.utsName,
+		ContainerID:         ctx.containerID,
+		EventID:             int(eventID),
+		EventName:           EventsIDToEvent[eventID].Name,
+		ArgsNum:             len(args),
+		Args:                args,
+	}
+}
@@ -0,0 +1,229 @@
+package tracee
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	netFlowIdleTimeout = 30 * time.Second // a flow ends once no packets were seen for this long
+	maxNetFlows        = 16384
+)
+
+// netPacketMeta is the metadata of a captured packet, as sent by tc_probe in the ebpf code
+type netPacketMeta struct {
+	SrcIP    [16]byte
+	DestIP   [16]byte
+	SrcPort  uint16
+	DestPort uint16
+	Protocol uint8
+	Ingress  uint8
+	_        [2]byte //padding
+}
+
+// netFlowState is a flow that was aggregated from packets, attributed to the process of its first packet
+type netFlowState struct {
+	key       netFlowKey
+	ctx       netPacketContext
+	ingress   bool // the first packet was received, rather than sent, on the traced interface
+	firstSeen time.Time
+	lastSeen  time.Time
+	packets   uint64
+	bytes     uint64
+}
+
+// netFlowTracker aggregates packets into flows, by their 5-tuple in either direction
+type netFlowTracker struct {
+	mu    sync.Mutex
+	flows *lru.Cache      // netFlowKey -> *netFlowState, least recently seen first
+	ended []*netFlowState // flows that were removed from the cache, but weren't returned as ended yet
+}
+
+func newNetFlowTracker(size int) (*netFlowTracker, error) {
+	ft := &netFlowTracker{}
+	flows, err := lru.NewWithEvict(size, func(_ interface{}, value interface{}) {
+		// called with ft.mu held, when a flow expires or the least recently seen flow is evicted
+		ft.ended = append(ft.ended, value.(*netFlowState))
+	})
+	if err != nil {
+		return nil, err
+	}
+	ft.flows = flows
+	return ft, nil
+}
+
+func netFlowKeyFromMeta(meta netPacketMeta) netFlowKey {
+	return netFlowKey{
+		srcIP:    net.IP(meta.SrcIP[:]).String(),
+		dstIP:    net.IP(meta.DestIP[:]).String(),
+		srcPort:  meta.SrcPort,
+		dstPort:  meta.DestPort,
+		protocol: netProtocolName(meta.Protocol),
+	}
+}
+
+func netProtocolName(protocol uint8) string {
+	switch protocol {
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	}
+	return strconv.Itoa(int(protocol))
+}
+
+// addPacket counts a packet in its flow. It returns the flow if the packet started it, and the flows that were
+// evicted to make room for it.
+func (ft *netFlowTracker) addPacket(ctx netPacketContext, meta netPacketMeta, ts time.Time, length uint32) (*netFlowState, []netFlowState) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	key := netFlowKeyFromMeta(meta)
+	value, ok := ft.flows.Get(key)
+	if !ok {
+		// replies belong to the flow of the first packet
+		reverse := netFlowKey{srcIP: key.dstIP, dstIP: key.srcIP, srcPort: key.dstPort, dstPort: key.srcPort, protocol: key.protocol}
+		value, ok = ft.flows.Get(reverse)
+	}
+	var started *netFlowState
+	if ok {
+		flow := value.(*netFlowState)
+		flow.packets++
+		flow.bytes += uint64(length)
+		if ts.After(flow.lastSeen) {
+			flow.lastSeen = ts
+		}
+	} else {
+		flow := &netFlowState{
+			key:       key,
+			ctx:       ctx,
+			ingress:   meta.Ingress != 0,
+			firstSeen: ts,
+			lastSeen:  ts,
+			packets:   1,
+			bytes:     uint64(length),
+		}
+		ft.flows.Add(key, flow)
+		startedFlow := *flow
+		started = &startedFlow
+	}
+	return started, ft.drainEnded()
+}
+
+// expire ends the flows that weren't seen since the given time
+func (ft *netFlowTracker) expire(before time.Time) []netFlowState {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, key := range ft.flows.Keys() {
+		value, ok := ft.flows.Peek(key)
+		if !ok {
+			continue
+		}
+		if value.(*netFlowState).lastSeen.After(before) {
+			// the rest of the flows were seen more recently
+			break
+		}
+		ft.flows.Remove(key)
+	}
+	return ft.drainEnded()
+}
+
+// endAll ends all the flows, e.g. when tracee exits
+func (ft *netFlowTracker) endAll() []netFlowState {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, key := range ft.flows.Keys() {
+		ft.flows.Remove(key)
+	}
+	return ft.drainEnded()
+}
+
+// drainEnded returns the ended flows. ft.mu must be held.
+func (ft *netFlowTracker) drainEnded() []netFlowState {
+	if len(ft.ended) == 0 {
+		return nil
+	}
+	ended := make([]netFlowState, len(ft.ended))
+	for i, flow := range ft.ended {
+		ended[i] = *flow
+	}
+	ft.ended = ft.ended[:0]
+	return ended
+}
+
+// CreateNetFlowEvent creates a net_flow_start or net_flow_end event of a flow, with the given timestamp
+func CreateNetFlowEvent(eventID int32, flow netFlowState, ts int) external.Event {
+	direction := "egress"
+	if flow.ingress {
+		direction = "ingress"
+	}
+	values := map[string]interface{}{
+		"srcIP":     flow.key.srcIP,
+		"srcPort":   flow.key.srcPort,
+		"dstIP":     flow.key.dstIP,
+		"dstPort":   flow.key.dstPort,
+		"protocol":  flow.key.protocol,
+		"direction": direction,
+		"packets":   flow.packets,
+		"bytes":     flow.bytes,
+		"duration":  uint64(flow.lastSeen.Sub(flow.firstSeen)),
+	}
+	args := make([]external.Argument, len(EventsIDToParams[eventID]))
+	for i, meta := range EventsIDToParams[eventID] {
+		args[i] = external.Argument{ArgMeta: meta, Value: values[meta.Name]}
+	}
+	return flow.ctx.event(eventID, ts, args)
+}
+
+// netEventTimestamp converts the time of a captured packet to an event timestamp, relative to tracee's start time if
+// configured
+func (t *Tracee) netEventTimestamp(ts time.Time) int {
+	if t.config.Output.RelativeTime {
+		return int(ts.UnixNano() - int64(t.bootTime) - int64(t.startTime))
+	}
+	return int(ts.UnixNano())
+}
+
+// emitNetFlowEvents emits the net_flow_start or net_flow_end events of the given flows
+func (t *Tracee) emitNetFlowEvents(eventID int32, flows []netFlowState) {
+	if !t.eventsToTrace[eventID] {
+		return
+	}
+	for _, flow := range flows {
+		ts := flow.firstSeen
+		if eventID == NetFlowEndEventID {
+			ts = flow.lastSeen
+		}
+		if !t.emitUserspaceEvent(CreateNetFlowEvent(eventID, flow, t.netEventTimestamp(ts))) {
+			return
+		}
+	}
+}
+
+// processNetFlowPacket aggregates a captured packet into its flow
+func (t *Tracee) processNetFlowPacket(ts time.Time, hostTid uint32, comm string, pktLen uint32, meta netPacketMeta) {
+	started, evicted := t.netFlows.addPacket(t.netPacketContext(hostTid, comm), meta, ts, pktLen)
+	t.emitNetFlowEvents(NetFlowEndEventID, evicted)
+	if started != nil {
+		t.emitNetFlowEvents(NetFlowStartEventID, []netFlowState{*started})
+	}
+}
+
+// processNetFlowTimeouts periodically ends the flows that became idle
+func (t *Tracee) processNetFlowTimeouts() {
+	ticker := time.NewTicker(netFlowIdleTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.config.ChanDone:
+			return
+		case now := <-ticker.C:
+			t.emitNetFlowEvents(NetFlowEndEventID, t.netFlows.expire(now.Add(-netFlowIdleTimeout)))
+		}
+	}
+}
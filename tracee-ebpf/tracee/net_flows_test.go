@@ -0,0 +1,238 @@
+package tracee
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPacketMeta(srcIP, dstIP string, srcPort, dstPort uint16, ingress bool) netPacketMeta {
+	meta := netPacketMeta{SrcPort: srcPort, DestPort: dstPort, Protocol: 6}
+	copy(meta.SrcIP[:], net.ParseIP(srcIP).To16())
+	copy(meta.DestIP[:], net.ParseIP(dstIP).To16())
+	if ingress {
+		meta.Ingress = 1
+	}
+	return meta
+}
+
+func TestNetFlowTracker(t *testing.T) {
+	ft, err := newNetFlowTracker(2)
+	require.NoError(t, err)
+	curl := netPacketContext{comm: "curl", hostTid: 11, hostPid: 10, containerID: "abc"}
+	start := time.Unix(1000, 0)
+
+	request := testPacketMeta("10.0.0.1", "10.0.0.2", 40000, 80, false)
+	started, ended := ft.addPacket(curl, request, start, 100)
+	require.NotNil(t, started)
+	assert.Empty(t, ended)
+	assert.Equal(t, netFlowKey{srcIP: "10.0.0.1", dstIP: "10.0.0.2", srcPort: 40000, dstPort: 80, protocol: "tcp"}, started.key)
+	assert.False(t, started.ingress)
+
+	// the reply belongs to the same flow, even if attributed to another thread
+	started, ended = ft.addPacket(netPacketContext{comm: "curl", hostTid: 12, hostPid: 10}, testPacketMeta("10.0.0.2", "10.0.0.1", 80, 40000, true), start.Add(time.Second), 50)
+	assert.Nil(t, started)
+	assert.Empty(t, ended)
+
+	dns := testPacketMeta("10.0.0.1", "10.0.0.53", 40001, 53, false)
+	dns.Protocol = 17
+	started, _ = ft.addPacket(curl, dns, start.Add(2*time.Second), 60)
+	require.NotNil(t, started)
+	assert.Equal(t, "udp", started.key.protocol)
+
+	// the least recently seen flow is ended to make room for a new one
+	started, ended = ft.addPacket(curl, testPacketMeta("10.0.0.1", "10.0.0.3", 40002, 22, false), start.Add(3*time.Second), 70)
+	require.NotNil(t, started)
+	require.Len(t, ended, 1)
+	assert.Equal(t, request, testPacketMeta(ended[0].key.srcIP, ended[0].key.dstIP, ended[0].key.srcPort, ended[0].key.dstPort, false))
+	assert.Equal(t, uint64(2), ended[0].packets)
+	assert.Equal(t, uint64(150), ended[0].bytes)
+	assert.Equal(t, curl, ended[0].ctx)
+	assert.Equal(t, start.Add(time.Second), ended[0].lastSeen)
+
+	// only the flows that were idle since the given time are expired
+	ended = ft.expire(start.Add(2 * time.Second))
+	require.Len(t, ended, 1)
+	assert.Equal(t, "udp", ended[0].key.protocol)
+	assert.Empty(t, ft.expire(start.Add(2*time.Second)))
+
+	ended = ft.endAll()
+	require.Len(t, ended, 1)
+	assert.Equal(t, uint16(22), ended[0].key.dstPort)
+	assert.Empty(t, ft.endAll())
+}
+
+func TestEmitNetFlowEvents(t *testing.T) {
+	flow := netFlowState{
+		key:       netFlowKey{srcIP: "10.0.0.1", dstIP: "10.0.0.2", srcPort: 40000, dstPort: 22, protocol: "tcp"},
+		ctx:       netPacketContext{comm: "curl", hostTid: 11, hostPid: 10, containerID: "abc", uid: 1000, utsName: "web"},
+		firstSeen: time.Unix(1000, 0),
+		lastSeen:  time.Unix(1005, 0),
+		packets:   3,
+		bytes:     300,
+	}
+	otherFlow := flow
+	otherFlow.key.dstPort = 443
+
+	curlScope := &Scope{Name: "curl", Filter: newTestFilter()}
+	curlScope.Filter.EventsToTrace = []int32{NetFlowStartEventID}
+	require.NoError(t, curlScope.Filter.CommFilter.Parse("=curl"))
+	rootScope := &Scope{Name: "root", Filter: newTestFilter()}
+	rootScope.Filter.EventsToTrace = []int32{NetFlowStartEventID}
+	require.NoError(t, rootScope.Filter.UIDFilter.Parse("=0"))
+	withScopes := func(evt external.Event, scopes ...string) external.Event {
+		evt.MatchedScopes = scopes
+		return evt
+	}
+
+	testCases := []struct {
+		name           string
+		filters        func(f *Filter)
+		scopes         []*Scope
+		followedTid    uint32
+		eventID        int32
+		expectedEvents []external.Event
+	}{
+		{
+			name:    "flow end",
+			eventID: NetFlowEndEventID,
+			expectedEvents: []external.Event{{
+				Timestamp:     int(time.Unix(1005, 0).UnixNano()),
+				HostProcessID: 10,
+				HostThreadID:  11,
+				UserID:        1000,
+				ProcessName:   "curl",
+				HostName:      "web",
+				ContainerID:   "abc",
+				EventID:       int(NetFlowEndEventID),
+				EventName:     "net_flow_end",
+				ArgsNum:       9,
+				Args: []external.Argument{
+					{ArgMeta: external.ArgMeta{Name: "srcIP", Type: "const char*"}, Value: "10.0.0.1"},
+					{ArgMeta: external.ArgMeta{Name: "srcPort", Type: "u16"}, Value: uint16(40000)},
+					{ArgMeta: external.ArgMeta{Name: "dstIP", Type: "const char*"}, Value: "10.0.0.2"},
+					{ArgMeta: external.ArgMeta{Name: "dstPort", Type: "u16"}, Value: uint16(22)},
+					{ArgMeta: external.ArgMeta{Name: "protocol", Type: "const char*"}, Value: "tcp"},
+					{ArgMeta: external.ArgMeta{Name: "direction", Type: "const char*"}, Value: "egress"},
+					{ArgMeta: external.ArgMeta{Name: "packets", Type: "u64"}, Value: uint64(3)},
+					{ArgMeta: external.ArgMeta{Name: "bytes", Type: "u64"}, Value: uint64(300)},
+					{ArgMeta: external.ArgMeta{Name: "duration", Type: "u64"}, Value: uint64(5 * time.Second)},
+				},
+			}, CreateNetFlowEvent(NetFlowEndEventID, otherFlow, int(time.Unix(1005, 0).UnixNano()))},
+		},
+		{
+			name: "argument filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.ArgFilter.Parse("net_flow_start.dstPort", "!=80,443", map[string]int32{"net_flow_start": NetFlowStartEventID}))
+			},
+			eventID:        NetFlowStartEventID,
+			expectedEvents: []external.Event{CreateNetFlowEvent(NetFlowStartEventID, flow, int(time.Unix(1000, 0).UnixNano()))},
+		},
+		{
+			name: "comm filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.CommFilter.Parse("!=curl"))
+			},
+			eventID: NetFlowStartEventID,
+		},
+		{
+			name: "host filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.ContFilter.Parse("!container"))
+			},
+			eventID: NetFlowStartEventID,
+		},
+		{
+			name: "uid filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.UIDFilter.Parse("=0"))
+			},
+			eventID: NetFlowStartEventID,
+		},
+		{
+			name: "uts filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.UTSFilter.Parse("!=web"))
+			},
+			eventID: NetFlowStartEventID,
+		},
+		{
+			name: "followed thread",
+			filters: func(f *Filter) {
+				require.NoError(t, f.CommFilter.Parse("!=curl"))
+			},
+			followedTid: 11,
+			eventID:     NetFlowStartEventID,
+			expectedEvents: []external.Event{
+				CreateNetFlowEvent(NetFlowStartEventID, flow, int(time.Unix(1000, 0).UnixNano())),
+				CreateNetFlowEvent(NetFlowStartEventID, otherFlow, int(time.Unix(1000, 0).UnixNano())),
+			},
+		},
+		{
+			name: "followed thread argument filter",
+			filters: func(f *Filter) {
+				require.NoError(t, f.CommFilter.Parse("!=curl"))
+				require.NoError(t, f.ArgFilter.Parse("net_flow_start.dstPort", "!=80,443", map[string]int32{"net_flow_start": NetFlowStartEventID}))
+			},
+			followedTid:    11,
+			eventID:        NetFlowStartEventID,
+			expectedEvents: []external.Event{CreateNetFlowEvent(NetFlowStartEventID, flow, int(time.Unix(1000, 0).UnixNano()))},
+		},
+		{
+			name: "other followed thread",
+			filters: func(f *Filter) {
+				require.NoError(t, f.CommFilter.Parse("!=curl"))
+			},
+			followedTid: 12,
+			eventID:     NetFlowStartEventID,
+		},
+		{
+			name:    "scopes",
+			scopes:  []*Scope{curlScope, rootScope},
+			eventID: NetFlowStartEventID,
+			expectedEvents: []external.Event{
+				withScopes(CreateNetFlowEvent(NetFlowStartEventID, flow, int(time.Unix(1000, 0).UnixNano())), "curl"),
+				withScopes(CreateNetFlowEvent(NetFlowStartEventID, otherFlow, int(time.Unix(1000, 0).UnixNano())), "curl"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter := newTestFilter()
+			if tc.filters != nil {
+				tc.filters(filter)
+			}
+			events := make(chan external.Event, 2)
+			tracee := &Tracee{
+				config: Config{
+					Filter:     filter,
+					Output:     &OutputConfig{},
+					ChanEvents: events,
+					ChanDone:   make(chan struct{}),
+				},
+				eventsToTrace: map[int32]bool{NetFlowStartEventID: true, NetFlowEndEventID: true},
+			}
+			for _, s := range tc.scopes {
+				tracee.scopeMatchers = append(tracee.scopeMatchers, newScopeMatcher(s))
+			}
+			if tc.followedTid != 0 {
+				filter.Follow = true
+				tracee.followed = func(hostTid uint32) bool {
+					return hostTid == tc.followedTid
+				}
+			}
+			tracee.emitNetFlowEvents(tc.eventID, []netFlowState{flow, otherFlow})
+			close(events)
+			var emitted []external.Event
+			for evt := range events {
+				emitted = append(emitted, evt)
+			}
+			assert.Equal(t, tc.expectedEvents, emitted)
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package tracee
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	maxHTTPStreams         = 4096
+	maxHTTPHeaderSize      = 16384
+	maxHTTPPendingSegments = 32      // out of order segments that are buffered per stream, until the missing segment arrives
+	maxHTTPPendingBytes    = 4 << 20 // out of order bytes that are buffered by all streams
+)
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("HEAD "), []byte("POST "), []byte("PUT "), []byte("DELETE "),
+	[]byte("CONNECT "), []byte("OPTIONS "), []byte("TRACE "), []byte("PATCH "),
+}
+
+// isHTTPRequestStart returns true if the given data starts with an HTTP request line
+func isHTTPRequestStart(data []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(data, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpRequest is the request line and headers of an HTTP/1.x request
+type httpRequest struct {
+	method    string
+	host      string
+	path      string
+	proto     string
+	userAgent string
+}
+
+// httpStream reassembles one direction of a TCP connection, and parses the HTTP requests that were sent in it
+type httpStream struct {
+	nextSeq uint32
+	buf     []byte            // data that wasn't parsed yet
+	pending map[uint32][]byte // out of order segments, by their sequence number
+	// pendingBytes is the size of the pending segments, which is also counted in the pending bytes of all streams
+	pendingBytes int
+	skip         int  // body bytes of the last request that weren't received yet
+	broken       bool // the stream can't be parsed anymore, e.g. it isn't HTTP or a segment was lost
+}
+
+// position returns the number of bytes of a segment that were already received, or whether the segment is ahead of
+// the next sequence number. Sequence numbers wrap around, so a segment is ahead if it is less than half the sequence
+// space past the next sequence number, and behind otherwise.
+func (s *httpStream) position(seq uint32) (overlap uint32, ahead bool) {
+	if seq-s.nextSeq < 1<<31 && seq != s.nextSeq {
+		return 0, true
+	}
+	return s.nextSeq - seq, false
+}
+
+// addSegment adds the payload of a TCP segment to the stream, and returns the requests that were completed by it.
+// totalPending is the number of pending bytes of all streams.
+func (s *httpStream) addSegment(seq uint32, payload []byte, totalPending *int) []httpRequest {
+	overlap, ahead := s.position(seq)
+	if ahead {
+		if len(s.pending) >= maxHTTPPendingSegments || *totalPending+len(payload) > maxHTTPPendingBytes {
+			s.broken = true
+			return nil
+		}
+		if old, ok := s.pending[seq]; ok {
+			s.pendingBytes -= len(old)
+			*totalPending -= len(old)
+		}
+		s.pending[seq] = append([]byte(nil), payload...)
+		s.pendingBytes += len(payload)
+		*totalPending += len(payload)
+		return nil
+	}
+	if !s.append(payload, overlap) {
+		return nil
+	}
+	// the segments that were waiting for this one
+	for len(s.pending) > 0 {
+		found := false
+		for pendingSeq, data := range s.pending {
+			overlap, ahead := s.position(pendingSeq)
+			if ahead {
+				continue
+			}
+			delete(s.pending, pendingSeq)
+			s.pendingBytes -= len(data)
+			*totalPending -= len(data)
+			if !s.append(data, overlap) {
+				return nil
+			}
+			found = true
+		}
+		if !found {
+			break
+		}
+	}
+	return s.parse()
+}
+
+// append appends a payload whose first overlap bytes were already received. It returns false if the stream is
+// broken, since the payload is half the sequence space or more behind the stream.
+func (s *httpStream) append(payload []byte, overlap uint32) bool {
+	if overlap >= 1<<31 {
+		s.broken = true
+		return false
+	}
+	if uint64(overlap) >= uint64(len(payload)) {
+		// a retransmission, or the same packet captured on another interface
+		return true
+	}
+	payload = payload[overlap:]
+	s.nextSeq += uint32(len(payload))
+	if s.skip > 0 {
+		n := s.skip
+		if n > len(payload) {
+			n = len(payload)
+		}
+		s.skip -= n
+		payload = payload[n:]
+	}
+	s.buf = append(s.buf, payload...)
+	return true
+}
+
+// parse parses the requests whose headers were fully received
+func (s *httpStream) parse() []httpRequest {
+	var requests []httpRequest
+	for !s.broken && s.skip == 0 && len(s.buf) > 0 {
+		if len(s.buf) >= len("CONNECT ") && !isHTTPRequestStart(s.buf) {
+			s.broken = true
+			break
+		}
+		end := bytes.Index(s.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(s.buf) > maxHTTPHeaderSize {
+				s.broken = true
+			}
+			break
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(s.buf[:end+4])))
+		if err != nil {
+			s.broken = true
+			break
+		}
+		requests = append(requests, httpRequest{
+			method:    req.Method,
+			host:      req.Host,
+			path:      req.RequestURI,
+			proto:     req.Proto,
+			userAgent: req.UserAgent(),
+		})
+		s.buf = s.buf[end+4:]
+		if len(req.TransferEncoding) > 0 {
+			// the end of a chunked body can't be found without parsing it
+			s.broken = true
+			break
+		}
+		if req.ContentLength > 0 {
+			s.skip = int(req.ContentLength)
+			n := s.skip
+			if n > len(s.buf) {
+				n = len(s.buf)
+			}
+			s.skip -= n
+			s.buf = s.buf[n:]
+		}
+	}
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+	return requests
+}
+
+// httpParser reassembles TCP streams, and parses the HTTP/1.x requests that were sent in them
+type httpParser struct {
+	streams      *lru.Cache // netFlowKey -> *httpStream, by the direction of the stream
+	pendingBytes int        // the out of order bytes that are buffered by all streams
+}
+
+func newHTTPParser(size int) (*httpParser, error) {
+	p := &httpParser{}
+	streams, err := lru.NewWithEvict(size, func(_ interface{}, value interface{}) {
+		// the pending bytes of removed and evicted streams are released
+		p.pendingBytes -= value.(*httpStream).pendingBytes
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.streams = streams
+	return p, nil
+}
+
+// addSegment adds a TCP segment of the given stream, and returns the requests that were completed by it.
+// Streams that started before tracee are parsed from the first segment that starts with a request line.
+func (p *httpParser) addSegment(key netFlowKey, tcp *layers.TCP) []httpRequest {
+	var stream *httpStream
+	value, ok := p.streams.Get(key)
+	switch {
+	case tcp.SYN:
+		// a new connection, which may reuse the ports of an old one
+		p.streams.Remove(key)
+		p.streams.Add(key, &httpStream{nextSeq: tcp.Seq + 1, pending: make(map[uint32][]byte)})
+		return nil
+	case ok:
+		stream = value.(*httpStream)
+	case isHTTPRequestStart(tcp.Payload):
+		stream = &httpStream{nextSeq: tcp.Seq, pending: make(map[uint32][]byte)}
+		p.streams.Add(key, stream)
+	default:
+		return nil
+	}
+
+	var requests []httpRequest
+	if len(tcp.Payload) > 0 {
+		requests = stream.addSegment(tcp.Seq, tcp.Payload, &p.pendingBytes)
+	}
+	if stream.broken || tcp.FIN || tcp.RST {
+		p.streams.Remove(key)
+	}
+	return requests
+}
+
+// CreateHTTPRequestEvent creates a net_http_request event from a parsed request
+func CreateHTTPRequestEvent(key netFlowKey, req httpRequest, ctx netPacketContext, ts int) external.Event {
+	values := map[string]interface{}{
+		"srcIP":     key.srcIP,
+		"srcPort":   key.srcPort,
+		"dstIP":     key.dstIP,
+		"dstPort":   key.dstPort,
+		"method":    req.method,
+		"host":      req.host,
+		"path":      req.path,
+		"proto":     req.proto,
+		"userAgent": req.userAgent,
+	}
+	args := make([]external.Argument, len(EventsIDToParams[NetHttpRequestEventID]))
+	for i, meta := range EventsIDToParams[NetHttpRequestEventID] {
+		args[i] = external.Argument{ArgMeta: meta, Value: values[meta.Name]}
+	}
+	return ctx.event(NetHttpRequestEventID, ts, args)
+}
+
+// processHTTPPacket emits the HTTP requests that were completed by a captured packet, if any
+func (t *Tracee) processHTTPPacket(ts time.Time, hostTid uint32, comm string, data []byte) {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		return
+	}
+	key, ok := packetFlowKey(packet)
+	if !ok {
+		return
+	}
+	requests := t.httpParser.addSegment(key, tcp)
+	if len(requests) == 0 {
+		return
+	}
+	ctx := t.netPacketContext(hostTid, comm)
+	for _, req := range requests {
+		if !t.emitUserspaceEvent(CreateHTTPRequestEvent(key, req, ctx, t.netEventTimestamp(ts))) {
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package tracee
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tcpSegment(seq uint32, payload string) *layers.TCP {
+	tcp := &layers.TCP{Seq: seq, ACK: true, PSH: true}
+	tcp.Payload = []byte(payload)
+	return tcp
+}
+
+func TestHTTPParser(t *testing.T) {
+	getPods := "GET /api/v1/pods?limit=10 HTTP/1.1\r\nHost: 10.0.0.1:10250\r\nUser-Agent: curl/7.68.0\r\nAccept: */*\r\n\r\n"
+	postExec := "POST /exec/default/nginx/nginx?command=sh HTTP/1.1\r\nHost: 10.0.0.1:10250\r\nContent-Length: 5\r\n\r\nhello"
+	getPodsRequest := httpRequest{method: "GET", host: "10.0.0.1:10250", path: "/api/v1/pods?limit=10", proto: "HTTP/1.1", userAgent: "curl/7.68.0"}
+	postExecRequest := httpRequest{method: "POST", host: "10.0.0.1:10250", path: "/exec/default/nginx/nginx?command=sh", proto: "HTTP/1.1"}
+	syn := &layers.TCP{Seq: 999, SYN: true}
+
+	testCases := []struct {
+		name             string
+		segments         []*layers.TCP
+		expectedRequests []httpRequest
+	}{
+		{
+			name:             "single segment",
+			segments:         []*layers.TCP{syn, tcpSegment(1000, getPods)},
+			expectedRequests: []httpRequest{getPodsRequest},
+		},
+		{
+			name:             "split headers",
+			segments:         []*layers.TCP{syn, tcpSegment(1000, getPods[:10]), tcpSegment(1010, getPods[10:])},
+			expectedRequests: []httpRequest{getPodsRequest},
+		},
+		{
+			name: "out of order and retransmitted segments",
+			segments: []*layers.TCP{
+				syn,
+				tcpSegment(1020, getPods[20:]),
+				tcpSegment(1000, getPods[:10]),
+				tcpSegment(1000, getPods[:20]),
+			},
+			expectedRequests: []httpRequest{getPodsRequest},
+		},
+		{
+			name:             "pipelined requests with a body",
+			segments:         []*layers.TCP{syn, tcpSegment(1000, postExec[:len(postExec)-2]), tcpSegment(uint32(1000+len(postExec)-2), postExec[len(postExec)-2:]+getPods)},
+			expectedRequests: []httpRequest{postExecRequest, getPodsRequest},
+		},
+		{
+			name:             "connection started before tracing",
+			segments:         []*layers.TCP{tcpSegment(5000, getPods), tcpSegment(uint32(5000+len(getPods)), postExec)},
+			expectedRequests: []httpRequest{getPodsRequest, postExecRequest},
+		},
+		{
+			name:     "response",
+			segments: []*layers.TCP{syn, tcpSegment(1000, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")},
+		},
+		{
+			name:     "not http",
+			segments: []*layers.TCP{syn, tcpSegment(1000, "SSH-2.0-OpenSSH_8.2p1\r\n"), tcpSegment(1023, "\x00\x00\x05\xdc\x07\x14 GET /\r\n\r\n")},
+		},
+		{
+			name:     "lost segment",
+			segments: append([]*layers.TCP{syn}, lostSegments(getPods)...),
+		},
+		{
+			name:             "request after a lost segment",
+			segments:         append(append([]*layers.TCP{syn}, lostSegments(getPods)...), tcpSegment(uint32(1000+len(getPods)), postExec)),
+			expectedRequests: []httpRequest{postExecRequest},
+		},
+		{
+			name:     "segment half the sequence space away",
+			segments: []*layers.TCP{syn, tcpSegment(1000+1<<31, getPods)},
+		},
+		{
+			name:     "segment behind by more than half the sequence space",
+			segments: []*layers.TCP{syn, tcpSegment(1000+1<<31+1, getPods)},
+		},
+		{
+			name:     "headers too large",
+			segments: []*layers.TCP{syn, tcpSegment(1000, "GET / HTTP/1.1\r\nCookie: "+strings.Repeat("a", maxHTTPHeaderSize)), tcpSegment(uint32(1024+maxHTTPHeaderSize), "\r\n\r\n")},
+		},
+	}
+
+	key := netFlowKey{srcIP: "10.0.0.2", dstIP: "10.0.0.1", srcPort: 40000, dstPort: 10250, protocol: "tcp"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := newHTTPParser(8)
+			require.NoError(t, err)
+			var requests []httpRequest
+			for _, segment := range tc.segments {
+				requests = append(requests, p.addSegment(key, segment)...)
+			}
+			assert.Equal(t, tc.expectedRequests, requests)
+		})
+	}
+}
+
+// lostSegments returns the segments of a request, without its first segment, and more out of order segments than
+// can be buffered
+func lostSegments(request string) []*layers.TCP {
+	var segments []*layers.TCP
+	for i := 1; i <= maxHTTPPendingSegments+1 && i < len(request); i++ {
+		segments = append(segments, tcpSegment(uint32(1000+i), request[i:i+1]))
+	}
+	return segments
+}
+
+func TestCreateHTTPRequestEvent(t *testing.T) {
+	key := netFlowKey{srcIP: "10.0.0.2", dstIP: "10.0.0.1", srcPort: 40000, dstPort: 10250, protocol: "tcp"}
+	req := httpRequest{method: "GET", host: "10.0.0.1:10250", path: "/pods", proto: "HTTP/1.1", userAgent: "curl/7.68.0"}
+	ctx := netPacketContext{comm: "curl", hostTid: 11, hostPid: 10, containerID: "abc"}
+
+	assert.Equal(t, external.Event{
+		Timestamp:     1000,
+		HostProcessID: 10,
+		HostThreadID:  11,
+		ProcessName:   "curl",
+		ContainerID:   "abc",
+		EventID:       int(NetHttpRequestEventID),
+		EventName:     "net_http_request",
+		ArgsNum:       9,
+		Args: []external.Argument{
+			{ArgMeta: external.ArgMeta{Name: "srcIP", Type: "const char*"}, Value: "10.0.0.2"},
+			{ArgMeta: external.ArgMeta{Name: "srcPort", Type: "u16"}, Value: uint16(40000)},
+			{ArgMeta: external.ArgMeta{Name: "dstIP", Type: "const char*"}, Value: "10.0.0.1"},
+			{ArgMeta: external.ArgMeta{Name: "dstPort", Type: "u16"}, Value: uint16(10250)},
+			{ArgMeta: external.ArgMeta{Name: "method", Type: "const char*"}, Value: "GET"},
+			{ArgMeta: external.ArgMeta{Name: "host", Type: "const char*"}, Value: "10.0.0.1:10250"},
+			{ArgMeta: external.ArgMeta{Name: "path", Type: "const char*"}, Value: "/pods"},
+			{ArgMeta: external.ArgMeta{Name: "proto", Type: "const char*"}, Value: "HTTP/1.1"},
+			{ArgMeta: external.ArgMeta{Name: "userAgent", Type: "const char*"}, Value: "curl/7.68.0"},
+		},
+	}, CreateHTTPRequestEvent(key, req, ctx, 1000))
+}
+
+func TestHTTPStream_halfSequenceSpace(t *testing.T) {
+	// a pending segment that is half the sequence space behind once the missing segment arrives
+	s := &httpStream{nextSeq: 10, pending: map[uint32][]byte{11 + 1<<31: []byte("x")}, pendingBytes: 1}
+	totalPending := 1
+	assert.Empty(t, s.addSegment(10, []byte("G"), &totalPending))
+	assert.True(t, s.broken)
+	assert.Equal(t, 0, totalPending)
+}
+
+func TestHTTPParser_pendingBytes(t *testing.T) {
+	p, err := newHTTPParser(8)
+	require.NoError(t, err)
+	segment := strings.Repeat("a", 64<<10)
+	addPending := func(srcPort uint16) *httpStream {
+		key := netFlowKey{srcIP: "10.0.0.2", dstIP: "10.0.0.1", srcPort: srcPort, dstPort: 80, protocol: "tcp"}
+		p.addSegment(key, &layers.TCP{Seq: 999, SYN: true})
+		for i := 1; i < maxHTTPPendingSegments; i++ {
+			p.addSegment(key, tcpSegment(uint32(1000+i*len(segment)), segment))
+		}
+		value, ok := p.streams.Get(key)
+		if !ok {
+			return nil
+		}
+		return value.(*httpStream)
+	}
+
+	first := addPending(1)
+	require.NotNil(t, first)
+	assert.Equal(t, (maxHTTPPendingSegments-1)*len(segment), p.pendingBytes)
+	require.NotNil(t, addPending(2))
+	// the pending bytes of all streams are bounded
+	assert.Nil(t, addPending(3))
+	assert.LessOrEqual(t, p.pendingBytes, maxHTTPPendingBytes)
+
+	// the pending bytes of a closed stream are released
+	key := netFlowKey{srcIP: "10.0.0.2", dstIP: "10.0.0.1", srcPort: 1, dstPort: 80, protocol: "tcp"}
+	p.addSegment(key, &layers.TCP{Seq: 1000, RST: true})
+	assert.Equal(t, (maxHTTPPendingSegments-1)*len(segment), p.pendingBytes)
+}
@@ -0,0 +1,467 @@
+package tracee
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	PcapSplitContainer = "container"
+	PcapSplitProcess   = "process"
+
+	pcapFlowsFile = "flows.json"
+
+	// pcapIdleTimeout is the time after which split pcap files that had no packets are closed, so that a file
+	// descriptor isn't held for every process or container that was ever captured
+	pcapIdleTimeout = time.Minute
+	// maxPcapFlows bounds the flows that are summarized. Beyond it, the flows that were seen least recently are
+	// dropped from the summary
+	maxPcapFlows = 1 << 16
+)
+
+// PcapConfig configures how captured network packets are split into pcap files
+type PcapConfig struct {
+	Split          string        // "" (a single capture.pcap file), PcapSplitContainer or PcapSplitProcess
+	RotateSize     int64         // start a new pcap file once the current one exceeds this size, in bytes
+	RotateInterval time.Duration // start a new pcap file once the current one is older than this
+}
+
+// netPacketContext is the process that sent or received a captured packet
+type netPacketContext struct {
+	comm        string
+	hostTid     uint32
+	hostPid     uint32
+	containerID string
+	// the rest of the process context, which is read from procfs, so that events of packets are filtered like other
+	// events. It's zero if the thread already exited.
+	tid, pid     uint32 // in the pid namespace of the process
+	hostPpid     uint32
+	uid          uint32
+	mntNS, pidNS uint32
+	utsName      string
+}
+
+// pcapFile is a pcapng file that captured packets are written to
+type pcapFile struct {
+	name    string // relative to the output path, without the .pcap extension
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+	created time.Time
+	written time.Time // when a packet was last written to the file
+	hostPid uint32    // the process of the packets, when split by process
+}
+
+// netFlowKey is the 5-tuple of a flow, in the direction of its first packet
+type netFlowKey struct {
+	srcIP, dstIP     string
+	srcPort, dstPort uint16
+	protocol         string
+}
+
+// netFlow summarizes the packets of a flow
+type netFlow struct {
+	SrcIP         string    `json:"srcIP"`
+	SrcPort       uint16    `json:"srcPort"`
+	DstIP         string    `json:"dstIP"`
+	DstPort       uint16    `json:"dstPort"`
+	Protocol      string    `json:"protocol"`
+	Packets       int       `json:"packets"`
+	Bytes         int       `json:"bytes"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+	ProcessName   string    `json:"processName"`
+	HostProcessID int       `json:"hostProcessId"`
+	HostThreadID  int       `json:"hostThreadId"`
+	ContainerID   string    `json:"containerId,omitempty"`
+	Pcaps         []string  `json:"pcaps"` // the files that the packets were written to, relative to the output path
+
+	segments []pcapSegment
+}
+
+// pcapSegment is a pcap file by its name and the number of times it was rotated before, which is renamed to
+// <name>.<rotation+1>.pcap once it's rotated
+type pcapSegment struct {
+	name     string
+	rotation int
+}
+
+// pcapWriters writes captured packets into pcap files, split by container or process and rotated by size or age,
+// and summarizes their flows into flows.json
+type pcapWriters struct {
+	mu         sync.Mutex
+	config     PcapConfig
+	outputPath string
+	ifaces     []string
+	files      map[string]*pcapFile
+	rotations  map[string]int // number of times each pcap file was rotated
+	flows      map[netFlowKey]*netFlow
+	now        func() time.Time
+	lastIdle   time.Time // when the idle files were last closed
+}
+
+func newPcapWriters(config PcapConfig, outputPath string, ifaces []string) *pcapWriters {
+	return &pcapWriters{
+		config:     config,
+		outputPath: outputPath,
+		ifaces:     ifaces,
+		files:      make(map[string]*pcapFile),
+		rotations:  make(map[string]int),
+		flows:      make(map[netFlowKey]*netFlow),
+		now:        time.Now,
+	}
+}
+
+// init creates capture.pcap in advance if the packets are not split, as a single pcap file is always expected
+func (p *pcapWriters) init() error {
+	if p.config.Split != "" {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := p.open("capture")
+	if err != nil {
+		return err
+	}
+	p.files[f.name] = f
+	return nil
+}
+
+// pcapName returns the name of the pcap file that the packets of a process are written to
+func (p *pcapWriters) pcapName(ctx netPacketContext) string {
+	container := ctx.containerID
+	if container == "" {
+		container = "host"
+	}
+	switch p.config.Split {
+	case PcapSplitContainer:
+		return filepath.Join("pcap", container)
+	case PcapSplitProcess:
+		return filepath.Join("pcap", container, fmt.Sprintf("%s.%d", ctx.comm, ctx.hostPid))
+	default:
+		return "capture"
+	}
+}
+
+// open creates a pcap file, and writes the section header and the interfaces to it.
+// Split pcap files may be opened again after they were closed when they were idle, or when their process exited, in
+// which case a new section is appended to them and they keep the count of their rotations.
+func (p *pcapWriters) open(name string) (*pcapFile, error) {
+	path := filepath.Join(p.outputPath, name+".pcap")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	p.rotations[name] = 0
+	if p.config.Split != "" {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		p.rotations[name] = pcapRotations(filepath.Join(p.outputPath, name))
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pcap file: %v", err)
+	}
+
+	ngWriter, err := pcapgo.NewNgWriterInterface(f, pcapNgInterface(p.ifaces[0]), pcapgo.NgWriterOptions{})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, iface := range p.ifaces[1:] {
+		if _, err := ngWriter.AddInterface(pcapNgInterface(iface)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	// Flush the header
+	if err := ngWriter.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &pcapFile{name: name, file: f, w: bufio.NewWriter(f), size: info.Size(), created: p.now()}, nil
+}
+
+// pcapRotations returns the number of rotated files of a pcap file, by the <path>.<n>.pcap files that exist
+func pcapRotations(path string) int {
+	n := 0
+	for {
+		if _, err := os.Stat(fmt.Sprintf("%s.%d.pcap", path, n+1)); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func pcapNgInterface(iface string) pcapgo.NgInterface {
+	return pcapgo.NgInterface{
+		Name:       iface,
+		Comment:    "tracee tc capture",
+		Filter:     "",
+		LinkType:   layers.LinkTypeEthernet,
+		SnapLength: uint32(math.MaxUint16),
+	}
+}
+
+// rotate closes a pcap file, renames it to <name>.<n>.pcap, and opens a new one instead
+func (p *pcapWriters) rotate(f *pcapFile) (*pcapFile, error) {
+	if err := f.close(); err != nil {
+		return nil, err
+	}
+	rotated := p.rotations[f.name] + 1
+	path := filepath.Join(p.outputPath, f.name)
+	if err := os.Rename(path+".pcap", fmt.Sprintf("%s.%d.pcap", path, rotated)); err != nil {
+		return nil, err
+	}
+	newFile, err := p.open(f.name)
+	if err != nil {
+		return nil, err
+	}
+	p.rotations[f.name] = rotated
+	p.files[f.name] = newFile
+	return newFile, p.writeFlows()
+}
+
+func (f *pcapFile) close() error {
+	if err := f.w.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// writePacket writes a captured packet to the pcap file of its process, with the process as the packet comment
+func (p *pcapWriters) writePacket(ctx netPacketContext, info gopacket.CaptureInfo, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name := p.pcapName(ctx)
+	f, ok := p.files[name]
+	if !ok {
+		var err error
+		f, err = p.open(name)
+		if err != nil {
+			return err
+		}
+		f.hostPid = ctx.hostPid
+		p.files[name] = f
+	}
+	if (p.config.RotateSize > 0 && f.size >= p.config.RotateSize) ||
+		(p.config.RotateInterval > 0 && p.now().Sub(f.created) >= p.config.RotateInterval) {
+		var err error
+		f, err = p.rotate(f)
+		if err != nil {
+			return err
+		}
+		f.hostPid = ctx.hostPid
+	}
+	f.written = p.now()
+
+	comment := fmt.Sprintf("comm=%s host_tid=%d container_id=%s", ctx.comm, ctx.hostTid, ctx.containerID)
+	n, err := writeNgPacket(f.w, info, data, comment)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// todo: maybe we should not flush every packet?
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+
+	p.addToFlow(ctx, info, data, name)
+	if p.config.Split != "" && p.now().Sub(p.lastIdle) >= pcapIdleTimeout {
+		p.lastIdle = p.now()
+		return p.closeIdle()
+	}
+	return nil
+}
+
+// closeIdle closes the pcap files that had no packets for pcapIdleTimeout. p.mu must be held.
+func (p *pcapWriters) closeIdle() error {
+	for name, f := range p.files {
+		if p.now().Sub(f.written) < pcapIdleTimeout {
+			continue
+		}
+		delete(p.files, name)
+		if err := f.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeProcess closes the pcap files of a process that exited, when the packets are split by process
+func (p *pcapWriters) closeProcess(hostPid uint32) error {
+	if p.config.Split != PcapSplitProcess {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, f := range p.files {
+		if f.hostPid != hostPid {
+			continue
+		}
+		delete(p.files, name)
+		if err := f.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNgPacket writes an enhanced packet block with a comment option, which pcapgo.NgWriter doesn't support,
+// and returns the number of bytes written
+func writeNgPacket(w *bufio.Writer, info gopacket.CaptureInfo, data []byte, comment string) (int, error) {
+	if info.CaptureLength != len(data) {
+		return 0, fmt.Errorf("capture length %d does not match data length %d", info.CaptureLength, len(data))
+	}
+	pad := func(n int) int { return (4 - n&3) & 3 }
+	optionsLength := 4 + len(comment) + pad(len(comment)) + 4 // comment option and end of options
+	length := 28 + len(data) + pad(len(data)) + optionsLength + 4
+
+	buf := make([]byte, length)
+	le := binary.LittleEndian
+	ts := info.Timestamp.UnixNano() // interfaces are written with a nanoseconds timestamp resolution
+	le.PutUint32(buf[0:4], 6)       // enhanced packet block
+	le.PutUint32(buf[4:8], uint32(length))
+	le.PutUint32(buf[8:12], uint32(info.InterfaceIndex))
+	le.PutUint32(buf[12:16], uint32(ts>>32))
+	le.PutUint32(buf[16:20], uint32(ts))
+	le.PutUint32(buf[20:24], uint32(info.CaptureLength))
+	le.PutUint32(buf[24:28], uint32(info.Length))
+	off := 28 + copy(buf[28:], data) + pad(len(data))
+	le.PutUint16(buf[off:off+2], 1) // comment option
+	le.PutUint16(buf[off+2:off+4], uint16(len(comment)))
+	copy(buf[off+4:], comment)
+	// the padding and the end of options are already zeroed
+	le.PutUint32(buf[length-4:], uint32(length))
+	return w.Write(buf)
+}
+
+// addToFlow counts a packet in the summary of its flow
+func (p *pcapWriters) addToFlow(ctx netPacketContext, info gopacket.CaptureInfo, data []byte, pcapName string) {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	key, ok := packetFlowKey(packet)
+	if !ok {
+		return
+	}
+
+	flow, ok := p.flows[key]
+	if !ok {
+		// replies belong to the flow of the first packet
+		reverse := netFlowKey{srcIP: key.dstIP, dstIP: key.srcIP, srcPort: key.dstPort, dstPort: key.srcPort, protocol: key.protocol}
+		flow, ok = p.flows[reverse]
+	}
+	if !ok {
+		if len(p.flows) >= maxPcapFlows {
+			p.dropFlows()
+		}
+		flow = &netFlow{
+			SrcIP:         key.srcIP,
+			SrcPort:       key.srcPort,
+			DstIP:         key.dstIP,
+			DstPort:       key.dstPort,
+			Protocol:      key.protocol,
+			FirstSeen:     info.Timestamp,
+			ProcessName:   ctx.comm,
+			HostProcessID: int(ctx.hostPid),
+			HostThreadID:  int(ctx.hostTid),
+			ContainerID:   ctx.containerID,
+		}
+		p.flows[key] = flow
+	}
+	// a flow spans the files that its packets were written to, e.g. before and after a rotation
+	segment := pcapSegment{name: pcapName, rotation: p.rotations[pcapName]}
+	if len(flow.segments) == 0 || flow.segments[len(flow.segments)-1] != segment {
+		flow.segments = append(flow.segments, segment)
+	}
+	flow.Packets++
+	flow.Bytes += info.Length
+	flow.LastSeen = info.Timestamp
+}
+
+// dropFlows drops the tenth of the flows that were seen least recently from the summary, to make room for new flows
+func (p *pcapWriters) dropFlows() {
+	keys := make([]netFlowKey, 0, len(p.flows))
+	for key := range p.flows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return p.flows[keys[i]].LastSeen.Before(p.flows[keys[j]].LastSeen) })
+	for _, key := range keys[:len(keys)/10+1] {
+		delete(p.flows, key)
+	}
+}
+
+// packetFlowKey returns the 5-tuple of a decoded packet, if it has a network and a transport layer
+func packetFlowKey(packet gopacket.Packet) (netFlowKey, bool) {
+	network, transport := packet.NetworkLayer(), packet.TransportLayer()
+	if network == nil || transport == nil {
+		return netFlowKey{}, false
+	}
+	src, dst := network.NetworkFlow().Endpoints()
+	srcPort, dstPort := transport.TransportFlow().Endpoints()
+	return netFlowKey{
+		srcIP:    src.String(),
+		dstIP:    dst.String(),
+		srcPort:  binary.BigEndian.Uint16(srcPort.Raw()),
+		dstPort:  binary.BigEndian.Uint16(dstPort.Raw()),
+		protocol: strings.ToLower(transport.LayerType().String()),
+	}, true
+}
+
+// writeFlows writes the summary of all the flows to flows.json. p.mu must be held.
+func (p *pcapWriters) writeFlows() error {
+	flows := make([]*netFlow, 0, len(p.flows))
+	for _, flow := range p.flows {
+		flow.Pcaps = flow.Pcaps[:0]
+		for _, segment := range flow.segments {
+			flow.Pcaps = append(flow.Pcaps, p.segmentFile(segment))
+		}
+		flows = append(flows, flow)
+	}
+	sort.Slice(flows, func(i, j int) bool { return flows[i].FirstSeen.Before(flows[j].FirstSeen) })
+	flowsBytes, err := json.MarshalIndent(flows, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(p.outputPath, pcapFlowsFile), flowsBytes, 0640)
+}
+
+// segmentFile returns the file of a pcap segment, relative to the output path. p.mu must be held.
+func (p *pcapWriters) segmentFile(segment pcapSegment) string {
+	if p.rotations[segment.name] == segment.rotation {
+		return segment.name + ".pcap"
+	}
+	return fmt.Sprintf("%s.%d.pcap", segment.name, segment.rotation+1)
+}
+
+// close closes all the pcap files and writes the summary of the flows
+func (p *pcapWriters) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, f := range p.files {
+		if err := f.close(); err != nil {
+			return err
+		}
+		delete(p.files, name)
+	}
+	return p.writeFlows()
+}
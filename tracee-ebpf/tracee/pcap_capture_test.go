@@ -0,0 +1,184 @@
+package tracee
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tcpPacket(t *testing.T, srcIP, dstIP string, srcPort, dstPort uint16, payload string) []byte {
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(srcIP), DstIP: net.ParseIP(dstIP)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort)}
+	require.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, tcp, gopacket.Payload(payload)))
+	return buf.Bytes()
+}
+
+func readPcap(t *testing.T, path string) [][]byte {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	var packets [][]byte
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packets = append(packets, data)
+	}
+	return packets
+}
+
+func TestPcapWriters(t *testing.T) {
+	outputPath, err := ioutil.TempDir("", "TestPcapWriters-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputPath)
+
+	p := newPcapWriters(PcapConfig{Split: PcapSplitProcess, RotateSize: 300}, outputPath, []string{"lo"})
+	require.NoError(t, p.init())
+	now := time.Unix(1000, 0)
+	curl := netPacketContext{comm: "curl", hostTid: 11, hostPid: 10, containerID: "abc"}
+	nginx := netPacketContext{comm: "nginx", hostTid: 20, hostPid: 20}
+
+	request := tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 80, "GET / HTTP/1.1")
+	response := tcpPacket(t, "10.0.0.2", "10.0.0.1", 80, 40000, "HTTP/1.1 200 OK")
+	other := tcpPacket(t, "10.0.0.3", "10.0.0.2", 40001, 80, "GET /other HTTP/1.1")
+	write := func(ctx netPacketContext, data []byte) {
+		now = now.Add(time.Second)
+		require.NoError(t, p.writePacket(ctx, gopacket.CaptureInfo{Timestamp: now, CaptureLength: len(data), Length: len(data)}, data))
+	}
+	write(curl, request)
+	write(curl, response)
+	write(nginx, other)
+	// exceeds the rotation size
+	write(curl, request)
+	require.NoError(t, p.close())
+
+	curlPcap := filepath.Join(outputPath, "pcap", "abc", "curl.10")
+	assert.Equal(t, [][]byte{request, response}, readPcap(t, curlPcap+".1.pcap"))
+	assert.Equal(t, [][]byte{request}, readPcap(t, curlPcap+".pcap"))
+	assert.Equal(t, [][]byte{other}, readPcap(t, filepath.Join(outputPath, "pcap", "host", "nginx.20.pcap")))
+	// packets are not split into a single capture.pcap
+	assert.NoFileExists(t, filepath.Join(outputPath, "capture.pcap"))
+
+	raw, err := ioutil.ReadFile(curlPcap + ".pcap")
+	require.NoError(t, err)
+	assert.True(t, bytes.Contains(raw, []byte("comm=curl host_tid=11 container_id=abc")))
+
+	flowsBytes, err := ioutil.ReadFile(filepath.Join(outputPath, pcapFlowsFile))
+	require.NoError(t, err)
+	var flows []netFlow
+	require.NoError(t, json.Unmarshal(flowsBytes, &flows))
+	require.Len(t, flows, 2)
+	assert.Equal(t, netFlow{
+		SrcIP:         "10.0.0.1",
+		SrcPort:       40000,
+		DstIP:         "10.0.0.2",
+		DstPort:       80,
+		Protocol:      "tcp",
+		Packets:       3,
+		Bytes:         2*len(request) + len(response),
+		FirstSeen:     time.Unix(1001, 0),
+		LastSeen:      time.Unix(1004, 0),
+		ProcessName:   "curl",
+		HostProcessID: 10,
+		HostThreadID:  11,
+		ContainerID:   "abc",
+		// the flow spans the rotated file and the new one
+		Pcaps: []string{filepath.Join("pcap", "abc", "curl.10.1.pcap"), filepath.Join("pcap", "abc", "curl.10.pcap")},
+	}, normalizeFlowTimes(flows[0]))
+	assert.Equal(t, "nginx", flows[1].ProcessName)
+	assert.Equal(t, 1, flows[1].Packets)
+	assert.Equal(t, []string{filepath.Join("pcap", "host", "nginx.20.pcap")}, flows[1].Pcaps)
+}
+
+func normalizeFlowTimes(flow netFlow) netFlow {
+	flow.FirstSeen = time.Unix(0, flow.FirstSeen.UnixNano())
+	flow.LastSeen = time.Unix(0, flow.LastSeen.UnixNano())
+	return flow
+}
+
+func TestPcapWriters_single(t *testing.T) {
+	outputPath, err := ioutil.TempDir("", "TestPcapWriters-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputPath)
+
+	p := newPcapWriters(PcapConfig{}, outputPath, []string{"lo", "eth0"})
+	require.NoError(t, p.init())
+	// capture.pcap is created before any packet is captured
+	assert.FileExists(t, filepath.Join(outputPath, "capture.pcap"))
+
+	data := tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 80, "x")
+	for _, ctx := range []netPacketContext{{comm: "a", hostTid: 1, hostPid: 1}, {comm: "b", hostTid: 2, hostPid: 2, containerID: "abc"}} {
+		require.NoError(t, p.writePacket(ctx, gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data), InterfaceIndex: 1}, data))
+	}
+	require.NoError(t, p.close())
+	assert.Equal(t, [][]byte{data, data}, readPcap(t, filepath.Join(outputPath, "capture.pcap")))
+}
+
+func TestPcapWriters_close(t *testing.T) {
+	outputPath, err := ioutil.TempDir("", "TestPcapWriters-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputPath)
+
+	p := newPcapWriters(PcapConfig{Split: PcapSplitProcess}, outputPath, []string{"lo"})
+	require.NoError(t, p.init())
+	now := time.Unix(1000, 0)
+	p.now = func() time.Time { return now }
+	curl := netPacketContext{comm: "curl", hostTid: 10, hostPid: 10}
+	nginx := netPacketContext{comm: "nginx", hostTid: 20, hostPid: 20}
+
+	request := tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 80, "GET / HTTP/1.1")
+	response := tcpPacket(t, "10.0.0.2", "10.0.0.1", 80, 40000, "HTTP/1.1 200 OK")
+	write := func(ctx netPacketContext, data []byte) {
+		require.NoError(t, p.writePacket(ctx, gopacket.CaptureInfo{Timestamp: now, CaptureLength: len(data), Length: len(data)}, data))
+	}
+	curlName := filepath.Join("pcap", "host", "curl.10")
+	nginxName := filepath.Join("pcap", "host", "nginx.20")
+
+	// the files of a process are closed when it exits
+	write(curl, request)
+	write(nginx, response)
+	require.NoError(t, p.closeProcess(10))
+	assert.NotContains(t, p.files, curlName)
+	assert.Contains(t, p.files, nginxName)
+
+	// and of a process that had no packets for a while
+	write(curl, request)
+	now = now.Add(pcapIdleTimeout)
+	write(curl, response)
+	assert.Contains(t, p.files, curlName)
+	assert.NotContains(t, p.files, nginxName)
+	require.NoError(t, p.close())
+
+	// a closed file is appended with a new section when it's opened again
+	assert.Equal(t, [][]byte{request, request, response}, readPcap(t, filepath.Join(outputPath, curlName+".pcap")))
+}
+
+func TestPcapWriters_dropFlows(t *testing.T) {
+	p := newPcapWriters(PcapConfig{}, "", []string{"lo"})
+	for i := 0; i < 20; i++ {
+		p.flows[netFlowKey{srcPort: uint16(i)}] = &netFlow{LastSeen: time.Unix(int64(i), 0)}
+	}
+	p.dropFlows()
+	// the flows that were seen least recently are dropped
+	assert.Len(t, p.flows, 17)
+	for i := 0; i < 3; i++ {
+		assert.NotContains(t, p.flows, netFlowKey{srcPort: uint16(i)})
+	}
+}
@@ -0,0 +1,396 @@
+package tracee
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"unsafe"
+
+	bpf "github.com/aquasecurity/libbpfgo"
+)
+
+const (
+	// maxProcessTreeDepth bounds the ancestry walk done by process tree filters in userspace
+	maxProcessTreeDepth = 64
+	// maxScopes is the max number of scopes, as each scope is a bit of the scopes bitmaps in the kernel
+	maxScopes = 64
+)
+
+// Scope is a named set of filters that is evaluated independently of other scopes.
+// When scopes are used, the kernel is programmed with the union of the scopes events and with the filters
+// that are common to all scopes (Config.Filter). The scopes filters are set in the kernel as bitmaps of the scopes
+// that each value matches, so that the kernel drops the events that match no scope. The filters that the kernel
+// can't evaluate (process trees, comm and uts suffixes and globs) pass there, and every event is matched against
+// the scopes again in userspace, where it is tagged with the names of the scopes it matched.
+type Scope struct {
+	Name   string
+	Filter *Filter
+}
+
+// Validate does static validation of the scope
+func (s *Scope) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("scope name cannot be empty")
+	}
+	if s.Filter == nil || s.Filter.EventsToTrace == nil {
+		return fmt.Errorf("scope %s: Filter or EventsToTrace is nil", s.Name)
+	}
+	if s.Filter.Follow {
+		return fmt.Errorf("scope %s: follow is not supported in scopes", s.Name)
+	}
+	if s.Filter.NewContFilter != nil && s.Filter.NewContFilter.Enabled {
+		return fmt.Errorf("scope %s: container=new is not supported in scopes", s.Name)
+	}
+	if s.Filter.NetFilter != nil && len(s.Filter.NetFilter.Ifaces) > 0 {
+		return fmt.Errorf("scope %s: net is not supported in scopes", s.Name)
+	}
+	return nil
+}
+
+// scopeMatcher evaluates scopes in userspace
+type scopeMatcher struct {
+	scope         *Scope
+	eventsToTrace map[int32]bool
+}
+
+func newScopeMatcher(s *Scope) scopeMatcher {
+	m := scopeMatcher{
+		scope:         s,
+		eventsToTrace: make(map[int32]bool, len(s.Filter.EventsToTrace)),
+	}
+	for _, e := range s.Filter.EventsToTrace {
+		m.eventsToTrace[e] = true
+	}
+	return m
+}
+
+// matches returns true if the given event passes all the filters of the scope
+func (m scopeMatcher) matches(ctx *context, args map[string]interface{}, containerID string, parentOf func(uint32) (uint32, bool)) bool {
+	if !m.eventsToTrace[ctx.EventID] {
+		return false
+	}
+	return m.scope.Filter.matches(ctx, args, containerID, parentOf)
+}
+
+// matches returns true if the given event passes all the filters that are set, except for the new pid and new
+// container filters, which are only known to the kernel
+func (f *Filter) matches(ctx *context, args map[string]interface{}, containerID string, parentOf func(uint32) (uint32, bool)) bool {
+	if f.ContFilter != nil && !f.ContFilter.InFilter(containerID != "") {
+		return false
+	}
+	if f.UIDFilter != nil && !f.UIDFilter.InFilter(uint64(ctx.Uid)) {
+		return false
+	}
+	if f.MntNSFilter != nil && !f.MntNSFilter.InFilter(uint64(ctx.MntID)) {
+		return false
+	}
+	if f.PidNSFilter != nil && !f.PidNSFilter.InFilter(uint64(ctx.PidID)) {
+		return false
+	}
+	if f.PIDFilter != nil && !f.PIDFilter.InFilter(uint64(ctx.HostTid)) {
+		return false
+	}
+	if f.UTSFilter != nil && !f.UTSFilter.InFilter(string(bytes.TrimRight(ctx.UtsName[:], "\x00"))) {
+		return false
+	}
+	if f.CommFilter != nil && !f.CommFilter.InFilter(string(bytes.TrimRight(ctx.Comm[:], "\x00"))) {
+		return false
+	}
+	if f.ProcessTreeFilter != nil && !f.ProcessTreeFilter.InFilter(ctx.HostPid, parentOf) {
+		return false
+	}
+	if f.RetFilter != nil && !f.RetFilter.InFilter(ctx.EventID, ctx.Retval) {
+		return false
+	}
+	if f.ArgFilter != nil && !f.ArgFilter.InFilter(ctx.EventID, args) {
+		return false
+	}
+
+	return true
+}
+
+// matchScopes returns the names of the scopes that the given event matched
+func (t *Tracee) matchScopes(ctx *context, args map[string]interface{}, containerID string) []string {
+	// Record the process ancestry as seen in the event for the process tree filters
+	if ctx.HostPpid != 0 {
+		t.procParents.Add(ctx.HostPid, ctx.HostPpid)
+	}
+
+	var matched []string
+	for _, m := range t.scopeMatchers {
+		if m.matches(ctx, args, containerID, t.parentOf) {
+			matched = append(matched, m.scope.Name)
+		}
+	}
+	return matched
+}
+
+// parentOf returns the parent of the given host pid, as seen in events or in procfs
+func (t *Tracee) parentOf(pid uint32) (uint32, bool) {
+	if ppid, ok := t.procParents.Get(pid); ok {
+		return ppid.(uint32), true
+	}
+
+	// see https://man7.org/linux/man-pages/man5/proc.5.html for how to read /proc/pid/stat
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, false
+	}
+	// comm may contain spaces, so skip to the closing parenthesis
+	idx := bytes.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, false
+	}
+	splitStat := bytes.SplitN(stat[idx+1:], []byte{' '}, 4)
+	if len(splitStat) != 4 {
+		return 0, false
+	}
+	ppid, err := strconv.ParseUint(string(splitStat[2]), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	t.procParents.Add(pid, uint32(ppid))
+	return uint32(ppid), true
+}
+
+// uintScopesConfig matches uint_scopes_config_t in the ebpf code
+type uintScopesConfig struct {
+	DefaultScopes uint64
+	RangedScopes  uint64
+	Less          uint64
+	Greater       uint64
+}
+
+// scopesConfig matches scopes_config_t in the ebpf code
+type scopesConfig struct {
+	EnabledScopes     uint64
+	ContFilterIn      uint64
+	ContFilterOut     uint64
+	UIDFilter         uintScopesConfig
+	PIDFilter         uintScopesConfig
+	MntNSFilter       uintScopesConfig
+	PidNSFilter       uintScopesConfig
+	UTSFilterDefault  uint64
+	CommFilterDefault uint64
+}
+
+// uintScopes returns the kernel configuration of the given uint filter of every scope, and the scopes matched by each
+// value that is set in the filters.
+// Values that are not set in the filters match the scopes that have no such filter, the scopes that only filter
+// values out, and the scopes that also filter by range if the value is in the union of their ranges.
+func uintScopes(scopes []*Scope, filterOf func(*Filter) *UintFilter) (uintScopesConfig, map[uint64]uint64) {
+	config := uintScopesConfig{Less: LessNotSetUint, Greater: GreaterNotSetUint}
+	values := make(map[uint64]uint64)
+	ranged := false
+	for i, s := range scopes {
+		bit := uint64(1) << i
+		f := filterOf(s.Filter)
+		switch {
+		case f == nil || !f.Enabled:
+			config.DefaultScopes |= bit
+			continue
+		case f.Less == LessNotSetUint && f.Greater == GreaterNotSetUint:
+			if len(f.NotEqual) > 0 || len(f.Equal) == 0 {
+				config.DefaultScopes |= bit
+			}
+		case !ranged:
+			config.RangedScopes |= bit
+			config.Less, config.Greater = f.Less, f.Greater
+			ranged = true
+		default:
+			config.RangedScopes |= bit
+			if config.Less != LessNotSetUint && (f.Less == LessNotSetUint || f.Less > config.Less) {
+				config.Less = f.Less
+			}
+			if config.Greater != GreaterNotSetUint && (f.Greater == GreaterNotSetUint || f.Greater < config.Greater) {
+				config.Greater = f.Greater
+			}
+		}
+		for _, vals := range [][]uint64{f.Equal, f.NotEqual} {
+			for _, val := range vals {
+				values[val] = 0
+			}
+		}
+	}
+	for val := range values {
+		for i, s := range scopes {
+			if f := filterOf(s.Filter); f == nil || f.InFilter(val) {
+				values[val] |= uint64(1) << i
+			}
+		}
+	}
+	return config, values
+}
+
+// stringScopes returns the scopes matched by the comm or uts names that are not set in the given string filter of
+// any scope, and the scopes matched by each exact value and by each prefix that is set in the filters.
+// The kernel checks the exact values first, then the longest prefix, so every scope is evaluated against the prefix
+// as the values that have it as their longest prefix. Filters that the kernel can't evaluate match every value.
+func stringScopes(scopes []*Scope, filterOf func(*Filter) *StringFilter) (uint64, map[string]uint64, map[string]uint64) {
+	var defaultScopes uint64
+	exact := make(map[string]uint64)
+	prefixes := make(map[string]uint64)
+	for i, s := range scopes {
+		f := filterOf(s.Filter)
+		if f == nil || !f.Enabled || f.UserspaceOnly() || !f.filterIn() {
+			defaultScopes |= uint64(1) << i
+		}
+		if f == nil || !f.Enabled || f.UserspaceOnly() {
+			continue
+		}
+		for _, vals := range [][]string{f.Equal, f.NotEqual} {
+			for _, val := range vals {
+				switch kind, str := parseStrPattern(val); kind {
+				case strPatternExact:
+					exact[str] = 0
+				case strPatternPrefix:
+					prefixes[str] = 0
+				}
+			}
+		}
+	}
+	for i, s := range scopes {
+		bit := uint64(1) << i
+		f := filterOf(s.Filter)
+		kernelFilter := f != nil && f.Enabled && !f.UserspaceOnly()
+		for val := range exact {
+			if !kernelFilter || f.InFilter(val) {
+				exact[val] |= bit
+			}
+		}
+		for prefix := range prefixes {
+			if !kernelFilter {
+				prefixes[prefix] |= bit
+			} else if equal, ok := f.prefixMatch(prefix); (ok && equal) || (!ok && !f.filterIn()) {
+				prefixes[prefix] |= bit
+			}
+		}
+	}
+	return defaultScopes, exact, prefixes
+}
+
+// setScopes programs the kernel with the events and the filters of the scopes
+func (t *Tracee) setScopes() error {
+	scopes := t.config.Scopes
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	var config scopesConfig
+	config.EnabledScopes = uint64(1)<<len(scopes) - 1
+	for i, s := range scopes {
+		if s.Filter.ContFilter != nil && s.Filter.ContFilter.Enabled {
+			if s.Filter.ContFilter.Value {
+				config.ContFilterIn |= uint64(1) << i
+			} else {
+				config.ContFilterOut |= uint64(1) << i
+			}
+		}
+	}
+
+	// essential events are not set, so the kernel submits them whether they match a scope or not
+	scopeEventsMap, err := t.bpfModule.GetMap("scope_events_map") // u32, u64
+	if err != nil {
+		return err
+	}
+	for e := range t.eventsToTrace {
+		if EventsIDToEvent[e].EssentialEvent {
+			continue
+		}
+		var chosen uint64
+		for i, m := range t.scopeMatchers {
+			if m.eventsToTrace[e] {
+				chosen |= uint64(1) << i
+			}
+		}
+		eU32 := uint32(e)
+		if err := scopeEventsMap.Update(unsafe.Pointer(&eU32), unsafe.Pointer(&chosen)); err != nil {
+			return err
+		}
+	}
+
+	var values map[uint64]uint64
+	config.UIDFilter, values = uintScopes(scopes, func(f *Filter) *UintFilter { return f.UIDFilter })
+	if err := setUintScopes(t.bpfModule, "scope_uid_filter", true, values); err != nil {
+		return err
+	}
+	config.PIDFilter, values = uintScopes(scopes, func(f *Filter) *UintFilter { return f.PIDFilter })
+	if err := setUintScopes(t.bpfModule, "scope_pid_filter", true, values); err != nil {
+		return err
+	}
+	config.MntNSFilter, values = uintScopes(scopes, func(f *Filter) *UintFilter { return f.MntNSFilter })
+	if err := setUintScopes(t.bpfModule, "scope_mnt_ns_filter", false, values); err != nil {
+		return err
+	}
+	config.PidNSFilter, values = uintScopes(scopes, func(f *Filter) *UintFilter { return f.PidNSFilter })
+	if err := setUintScopes(t.bpfModule, "scope_pid_ns_filter", false, values); err != nil {
+		return err
+	}
+
+	var exact, prefixes map[string]uint64
+	config.UTSFilterDefault, exact, prefixes = stringScopes(scopes, func(f *Filter) *StringFilter { return f.UTSFilter })
+	if err := setStringScopes(t.bpfModule, "scope_uts_ns_filter", "scope_uts_ns_prefix_filter", exact, prefixes); err != nil {
+		return err
+	}
+	config.CommFilterDefault, exact, prefixes = stringScopes(scopes, func(f *Filter) *StringFilter { return f.CommFilter })
+	if err := setStringScopes(t.bpfModule, "scope_comm_filter", "scope_comm_prefix_filter", exact, prefixes); err != nil {
+		return err
+	}
+
+	scopesConfigMap, err := t.bpfModule.GetMap("scopes_config_map") // u32, scopes_config_t
+	if err != nil {
+		return err
+	}
+	zero := uint32(0)
+	return scopesConfigMap.Update(unsafe.Pointer(&zero), unsafe.Pointer(&config))
+}
+
+func setUintScopes(bpfModule *bpf.Module, filterMapName string, is32Bit bool, values map[uint64]uint64) error {
+	filterMap, err := bpfModule.GetMap(filterMapName)
+	if err != nil {
+		return err
+	}
+	for val, scopes := range values {
+		scopes := scopes
+		if is32Bit {
+			valU32 := uint32(val)
+			err = filterMap.Update(unsafe.Pointer(&valU32), unsafe.Pointer(&scopes))
+		} else {
+			val := val
+			err = filterMap.Update(unsafe.Pointer(&val), unsafe.Pointer(&scopes))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setStringScopes(bpfModule *bpf.Module, filterMapName string, prefixFilterMapName string, exact map[string]uint64, prefixes map[string]uint64) error {
+	filterMap, err := bpfModule.GetMap(filterMapName)
+	if err != nil {
+		return err
+	}
+	prefixFilterMap, err := bpfModule.GetMap(prefixFilterMapName)
+	if err != nil {
+		return err
+	}
+	for val, scopes := range exact {
+		scopes := scopes
+		var key [maxStrFilterSize]byte
+		copy(key[:], val)
+		if err := filterMap.Update(unsafe.Pointer(&key[0]), unsafe.Pointer(&scopes)); err != nil {
+			return err
+		}
+	}
+	for prefix, scopes := range prefixes {
+		scopes := scopes
+		key := stringPrefixFilterKey{PrefixLen: uint32(len(prefix) * 8)}
+		copy(key.Str[:], prefix)
+		if err := prefixFilterMap.Update(unsafe.Pointer(&key), unsafe.Pointer(&scopes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package tracee
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFilter() *Filter {
+	return &Filter{
+		UIDFilter:         &UintFilter{Less: LessNotSetUint, Greater: GreaterNotSetUint, Is32Bit: true},
+		PIDFilter:         &UintFilter{Less: LessNotSetUint, Greater: GreaterNotSetUint, Is32Bit: true},
+		NewPidFilter:      &BoolFilter{},
+		MntNSFilter:       &UintFilter{Less: LessNotSetUint, Greater: GreaterNotSetUint},
+		PidNSFilter:       &UintFilter{Less: LessNotSetUint, Greater: GreaterNotSetUint},
+		UTSFilter:         &StringFilter{},
+		CommFilter:        &StringFilter{},
+		ContFilter:        &BoolFilter{},
+		NewContFilter:     &BoolFilter{},
+		RetFilter:         &RetFilter{Filters: make(map[int32]IntFilter)},
+		ArgFilter:         &ArgFilter{Filters: make(map[int32]map[string]ArgFilterVal)},
+		ProcessTreeFilter: &ProcessTreeFilter{PIDs: make(map[uint32]bool)},
+		NetFilter:         &NetIfaces{},
+		EventsToTrace:     []int32{},
+	}
+}
+
+func newTestContext(eventID int32, comm string, uid uint32, hostPid uint32) *context {
+	ctx := &context{EventID: eventID, Uid: uid, HostPid: hostPid, HostTid: hostPid}
+	copy(ctx.Comm[:], comm)
+	return ctx
+}
+
+func TestUintFilter_InFilter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  []string
+		val      uint64
+		expected bool
+	}{
+		{name: "disabled", val: 5, expected: true},
+		{name: "equal match", filters: []string{"=5,6"}, val: 6, expected: true},
+		{name: "equal no match", filters: []string{"=5,6"}, val: 7, expected: false},
+		{name: "not equal match", filters: []string{"!=5"}, val: 5, expected: false},
+		{name: "not equal no match", filters: []string{"!=5"}, val: 7, expected: true},
+		{name: "greater", filters: []string{">5"}, val: 6, expected: true},
+		{name: "not greater", filters: []string{">5"}, val: 5, expected: false},
+		{name: "range", filters: []string{">5", "<10"}, val: 7, expected: true},
+		{name: "out of range", filters: []string{">5", "<10"}, val: 10, expected: false},
+		{name: "equal overrides range", filters: []string{">5", "=1"}, val: 1, expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &UintFilter{Less: LessNotSetUint, Greater: GreaterNotSetUint}
+			for _, expr := range tc.filters {
+				assert.NoError(t, f.Parse(expr))
+			}
+			assert.Equal(t, tc.expected, f.InFilter(tc.val))
+		})
+	}
+}
+
+func TestStringFilter_InFilter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  []string
+		val      string
+		expected bool
+	}{
+		{name: "disabled", val: "ls", expected: true},
+		{name: "equal match", filters: []string{"=ls,bash"}, val: "bash", expected: true},
+		{name: "equal no match", filters: []string{"=ls,bash"}, val: "zsh", expected: false},
+		{name: "not equal match", filters: []string{"!=ls"}, val: "ls", expected: false},
+		{name: "not equal no match", filters: []string{"!=ls"}, val: "zsh", expected: true},
+		{name: "truncated equal match", filters: []string{"=averyveryverylongcomm"}, val: "averyveryverylo", expected: true},
+		{name: "prefix match", filters: []string{"=kworker*"}, val: "kworker/0:1", expected: true},
+		{name: "prefix no match", filters: []string{"=kworker*"}, val: "kthreadd", expected: false},
+		{name: "not equal prefix match", filters: []string{"!=kworker*"}, val: "kworker/0:1", expected: false},
+		{name: "longest prefix wins", filters: []string{"=k*", "!=kworker*"}, val: "kworker/0:1", expected: false},
+		{name: "longest prefix wins equal", filters: []string{"!=k*", "=kworker*"}, val: "kworker/0:1", expected: true},
+		{name: "exact overrides prefix", filters: []string{"!=kworker*", "=kworker"}, val: "kworker", expected: true},
+		{name: "suffix match", filters: []string{"=*.sh"}, val: "run.sh", expected: true},
+		{name: "suffix no match", filters: []string{"=*.sh"}, val: "run.py", expected: false},
+		{name: "not equal suffix match", filters: []string{"!=*.sh"}, val: "run.sh", expected: false},
+		{name: "not equal suffix no match", filters: []string{"!=*.sh"}, val: "run.py", expected: true},
+		{name: "glob match", filters: []string{"=web-?-*"}, val: "web-1-abc", expected: true},
+		{name: "glob no match", filters: []string{"=web-?-*"}, val: "web-12-abc", expected: false},
+		{name: "not equal glob overrides equal glob", filters: []string{"=*a*", "!=*b*"}, val: "ab", expected: false},
+		{name: "prefix overrides glob", filters: []string{"=py*", "!=*thon*"}, val: "python3", expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &StringFilter{}
+			for _, expr := range tc.filters {
+				assert.NoError(t, f.Parse(expr))
+			}
+			assert.Equal(t, tc.expected, f.InFilter(tc.val))
+		})
+	}
+}
+
+func TestProcessTreeFilter_InFilter(t *testing.T) {
+	// 1 -> 100 -> 200 -> 300, 1 -> 400
+	parents := map[uint32]uint32{100: 1, 200: 100, 300: 200, 400: 1}
+	parentOf := func(pid uint32) (uint32, bool) {
+		ppid, ok := parents[pid]
+		return ppid, ok
+	}
+
+	testCases := []struct {
+		name     string
+		filters  []string
+		pid      uint32
+		expected bool
+	}{
+		{name: "disabled", pid: 300, expected: true},
+		{name: "descendant", filters: []string{"=100"}, pid: 300, expected: true},
+		{name: "not a descendant", filters: []string{"=100"}, pid: 400, expected: false},
+		{name: "excluded descendant", filters: []string{"!=200"}, pid: 300, expected: false},
+		{name: "not excluded", filters: []string{"!=200"}, pid: 400, expected: true},
+		{name: "closest ancestor wins", filters: []string{"=100", "!=200"}, pid: 300, expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &ProcessTreeFilter{PIDs: make(map[uint32]bool)}
+			for _, expr := range tc.filters {
+				assert.NoError(t, f.Parse(expr))
+			}
+			assert.Equal(t, tc.expected, f.InFilter(tc.pid, parentOf))
+		})
+	}
+}
+
+func TestScopeMatcher_matches(t *testing.T) {
+	noParents := func(uint32) (uint32, bool) { return 0, false }
+
+	execveScope := &Scope{Name: "all", Filter: newTestFilter()}
+	execveScope.Filter.EventsToTrace = []int32{ExecveEventID}
+
+	nginxScope := &Scope{Name: "nginx", Filter: newTestFilter()}
+	nginxScope.Filter.EventsToTrace = []int32{OpenatEventID, ExecveEventID}
+	assert.NoError(t, nginxScope.Filter.CommFilter.Parse("=nginx"))
+	assert.NoError(t, nginxScope.Filter.ContFilter.Parse("container"))
+
+	rootScope := &Scope{Name: "root", Filter: newTestFilter()}
+	rootScope.Filter.EventsToTrace = []int32{OpenatEventID}
+	assert.NoError(t, rootScope.Filter.UIDFilter.Parse("=0"))
+	assert.NoError(t, rootScope.Filter.ArgFilter.Parse("openat.pathname", "=/etc/*", map[string]int32{"openat": OpenatEventID}))
+
+	matchers := []scopeMatcher{newScopeMatcher(execveScope), newScopeMatcher(nginxScope), newScopeMatcher(rootScope)}
+
+	testCases := []struct {
+		name        string
+		ctx         *context
+		args        map[string]interface{}
+		containerID string
+		expected    []string
+	}{
+		{
+			name:     "execve on the host",
+			ctx:      newTestContext(ExecveEventID, "bash", 1000, 10),
+			expected: []string{"all"},
+		},
+		{
+			name:        "execve of nginx in a container",
+			ctx:         newTestContext(ExecveEventID, "nginx", 1000, 10),
+			containerID: "abc",
+			expected:    []string{"all", "nginx"},
+		},
+		{
+			name:     "openat of nginx on the host",
+			ctx:      newTestContext(OpenatEventID, "nginx", 1000, 10),
+			args:     map[string]interface{}{"pathname": "/tmp/x"},
+			expected: nil,
+		},
+		{
+			name:        "openat of /etc by root nginx in a container",
+			ctx:         newTestContext(OpenatEventID, "nginx", 0, 10),
+			args:        map[string]interface{}{"pathname": "/etc/passwd"},
+			containerID: "abc",
+			expected:    []string{"nginx", "root"},
+		},
+		{
+			name:     "openat of /tmp by root",
+			ctx:      newTestContext(OpenatEventID, "bash", 0, 10),
+			args:     map[string]interface{}{"pathname": "/tmp/x"},
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var matched []string
+			for _, m := range matchers {
+				if m.matches(tc.ctx, tc.args, tc.containerID, noParents) {
+					matched = append(matched, m.scope.Name)
+				}
+			}
+			assert.Equal(t, tc.expected, matched)
+		})
+	}
+}
+
+func TestUintScopes(t *testing.T) {
+	scopeFilters := [][]string{
+		nil,
+		{"=0,1000"},
+		{"!=0"},
+		{">1000", "<2000"},
+		{">500", "!=1500"},
+	}
+	var scopes []*Scope
+	for _, filters := range scopeFilters {
+		s := &Scope{Filter: newTestFilter()}
+		for _, expr := range filters {
+			assert.NoError(t, s.Filter.UIDFilter.Parse(expr))
+		}
+		scopes = append(scopes, s)
+	}
+	config, values := uintScopes(scopes, func(f *Filter) *UintFilter { return f.UIDFilter })
+	assert.Equal(t, uintScopesConfig{DefaultScopes: 0b00101, RangedScopes: 0b11000, Less: LessNotSetUint, Greater: 500}, config)
+
+	// kernelMatch mirrors uint_scopes_match() in the ebpf code
+	kernelMatch := func(val uint64) uint64 {
+		if scopes, ok := values[val]; ok {
+			return scopes
+		}
+		if (config.Less != LessNotSetUint && val >= config.Less) || (config.Greater != GreaterNotSetUint && val <= config.Greater) {
+			return config.DefaultScopes
+		}
+		return config.DefaultScopes | config.RangedScopes
+	}
+	for _, val := range []uint64{0, 1, 500, 501, 1000, 1500, 1999, 2000, 3000} {
+		for i, s := range scopes {
+			matched := kernelMatch(val)&(1<<i) != 0
+			if s.Filter.UIDFilter.InFilter(val) {
+				assert.True(t, matched, "uid %d must match scope %d in the kernel", val, i)
+			} else if config.RangedScopes&(1<<i) == 0 {
+				assert.False(t, matched, "uid %d must not match scope %d in the kernel", val, i)
+			}
+		}
+	}
+	assert.Equal(t, uint64(0b00101), kernelMatch(200), "out of the ranges of all the ranged scopes")
+}
+
+func TestStringScopes(t *testing.T) {
+	scopeFilters := [][]string{
+		nil,
+		{"=nginx,bash"},
+		{"!=bash"},
+		{"=k*", "!=kworker*"},
+		{"=kworker*", "!=kworker/1*"},
+		{"=*.sh"},
+	}
+	var scopes []*Scope
+	for _, filters := range scopeFilters {
+		s := &Scope{Filter: newTestFilter()}
+		for _, expr := range filters {
+			assert.NoError(t, s.Filter.CommFilter.Parse(expr))
+		}
+		scopes = append(scopes, s)
+	}
+	defaultScopes, exact, prefixes := stringScopes(scopes, func(f *Filter) *StringFilter { return f.CommFilter })
+	assert.Equal(t, uint64(0b111101), defaultScopes)
+
+	// kernelMatch mirrors string_scopes_match() in the ebpf code
+	kernelMatch := func(val string) uint64 {
+		if scopes, ok := exact[val]; ok {
+			return scopes
+		}
+		longest := -1
+		scopes := defaultScopes
+		for prefix, prefixScopes := range prefixes {
+			if strings.HasPrefix(val, prefix) && len(prefix) > longest {
+				longest = len(prefix)
+				scopes = prefixScopes
+			}
+		}
+		return scopes
+	}
+	for _, val := range []string{"nginx", "bash", "zsh", "kthreadd", "kworker/0:1", "kworker/1:1", "run.sh"} {
+		for i, s := range scopes {
+			matched := kernelMatch(val)&(1<<i) != 0
+			if s.Filter.CommFilter.UserspaceOnly() {
+				assert.True(t, matched, "comm %s must pass scope %d in the kernel", val, i)
+			} else {
+				assert.Equal(t, s.Filter.CommFilter.InFilter(val), matched, "comm %s, scope %d", val, i)
+			}
+		}
+	}
+}
@@ -360,6 +360,15 @@ BPF_MAP(_name, BPF_MAP_TYPE_PERCPU_ARRAY, u32, _value_type, _max_entries)
 #define BPF_PROG_ARRAY(_name, _max_entries) \
 BPF_MAP(_name, BPF_MAP_TYPE_PROG_ARRAY, u32, u32, _max_entries)
 
+#define BPF_LPM_TRIE(_name, _key_type, _value_type, _max_entries) \
+struct bpf_map_def SEC("maps") _name = { \
+  .type = BPF_MAP_TYPE_LPM_TRIE, \
+  .key_size = sizeof(_key_type), \
+  .value_size = sizeof(_value_type), \
+  .max_entries = _max_entries, \
+  .map_flags = BPF_F_NO_PREALLOC, \
+};
+
 #define BPF_PERF_OUTPUT(_name) \
 BPF_MAP(_name, BPF_MAP_TYPE_PERF_EVENT_ARRAY, int, __u32, 1024)
 
@@ -440,6 +449,30 @@ typedef struct string_filter {
     char str[MAX_STR_FILTER_SIZE];
 } string_filter_t;
 
+typedef struct string_prefix_filter {
+    u32 prefix_len;                 // in bits, as required by lpm trie keys
+    char str[MAX_STR_FILTER_SIZE];
+} string_prefix_filter_t;
+
+typedef struct uint_scopes_config {
+    u64 default_scopes;             // The scopes matched by values that are not in the scopes filter map
+    u64 ranged_scopes;              // The scopes matched by such values only if they are between greater and less
+    u64 less;                       // The union of the ranges of the ranged scopes
+    u64 greater;
+} uint_scopes_config_t;
+
+typedef struct scopes_config {
+    u64 enabled_scopes;             // Zero if scopes are not used
+    u64 cont_filter_in;             // The scopes that only match events of containers
+    u64 cont_filter_out;            // The scopes that only match events of the host
+    uint_scopes_config_t uid_filter;
+    uint_scopes_config_t pid_filter;
+    uint_scopes_config_t mnt_ns_filter;
+    uint_scopes_config_t pid_ns_filter;
+    u64 uts_ns_filter_default;      // The scopes matched by uts names that are not in the scopes filter maps
+    u64 comm_filter_default;        // The scopes matched by command names that are not in the scopes filter maps
+} scopes_config_t;
+
 typedef struct event_data {
     struct task_struct *task;
     context_t context;
@@ -499,6 +532,7 @@ typedef struct net_packet {
     struct in6_addr src_addr, dst_addr;
     __be16 src_port, dst_port;
     u8 protocol;
+    u8 ingress;
 } net_packet_t;
 
 typedef struct net_debug {
@@ -559,10 +593,22 @@ BPF_HASH(mnt_ns_filter, u64, u32);                      // Used to filter events
 BPF_HASH(pid_ns_filter, u64, u32);                      // Used to filter events by pid namespace id
 BPF_HASH(uts_ns_filter, string_filter_t, u32);          // Used to filter events by uts namespace name
 BPF_HASH(comm_filter, string_filter_t, u32);            // Used to filter events by command name
+BPF_LPM_TRIE(uts_ns_prefix_filter, string_prefix_filter_t, u32, 1024); // Used to filter events by uts namespace name prefix
+BPF_LPM_TRIE(comm_prefix_filter, string_prefix_filter_t, u32, 1024);   // Used to filter events by command name prefix
 BPF_HASH(bin_args_map, u64, bin_args_t);                // Persist args for send_bin funtion
 BPF_HASH(sys_32_to_64_map, u32, u32);                   // Map 32bit syscalls numbers to 64bit syscalls numbers
 BPF_HASH(params_types_map, u32, u64);                   // Encoded parameters types for event
 BPF_HASH(process_tree_map, u32, u32);                   // Used to filter events by the ancestry of the traced process
+BPF_ARRAY(scopes_config_map, scopes_config_t, 1);       // Configuration of the scopes filters
+BPF_HASH(scope_events_map, u32, u64);                   // Map events to the scopes that chose them
+BPF_HASH(scope_uid_filter, u32, u64);                   // Map UIDs to the scopes they match
+BPF_HASH(scope_pid_filter, u32, u64);                   // Map PIDs to the scopes they match
+BPF_HASH(scope_mnt_ns_filter, u64, u64);                // Map mount namespace ids to the scopes they match
+BPF_HASH(scope_pid_ns_filter, u64, u64);                // Map pid namespace ids to the scopes they match
+BPF_HASH(scope_uts_ns_filter, string_filter_t, u64);    // Map uts namespace names to the scopes they match
+BPF_HASH(scope_comm_filter, string_filter_t, u64);      // Map command names to the scopes they match
+BPF_LPM_TRIE(scope_uts_ns_prefix_filter, string_prefix_filter_t, u64, 1024); // Map uts namespace name prefixes to the scopes they match
+BPF_LPM_TRIE(scope_comm_prefix_filter, string_prefix_filter_t, u64, 1024);   // Map command name prefixes to the scopes they match
 BPF_LRU_HASH(sock_ctx_map, u64, net_ctx_ext_t);         // Socket address to process context
 BPF_LRU_HASH(network_map, local_net_id_t, net_ctx_t);   // Network identifier to process context
 BPF_ARRAY(file_filter, path_filter_t, 3);               // Used to filter vfs_write events
@@ -1175,6 +1221,32 @@ static __always_inline int equality_filter_matches(int filter_config, void *filt
     return 1;
 }
 
+// like equality_filter_matches, but falls back to the longest matching prefix if there is no exact match
+static __always_inline int string_filter_matches(int filter_config, void *filter_map, void *prefix_filter_map, char *str)
+{
+    int config = get_config(filter_config);
+    if (!config)
+        return 1;
+
+    u32* equality = bpf_map_lookup_elem(filter_map, str);
+    if (equality != NULL) {
+        return *equality;
+    }
+
+    string_prefix_filter_t prefix_key = {0};
+    prefix_key.prefix_len = MAX_STR_FILTER_SIZE * 8;
+    __builtin_memcpy(prefix_key.str, str, MAX_STR_FILTER_SIZE);
+    equality = bpf_map_lookup_elem(prefix_filter_map, &prefix_key);
+    if (equality != NULL) {
+        return *equality;
+    }
+
+    if (config == FILTER_IN)
+        return 0;
+
+    return 1;
+}
+
 static __always_inline int bool_filter_matches(int filter_config, bool val)
 {
     int config = get_config(filter_config);
@@ -1252,12 +1324,12 @@ static __always_inline int should_trace(context_t *context)
         return 0;
     }
 
-    if (!equality_filter_matches(CONFIG_UTS_NS_FILTER, &uts_ns_filter, &context->uts_name))
+    if (!string_filter_matches(CONFIG_UTS_NS_FILTER, &uts_ns_filter, &uts_ns_prefix_filter, context->uts_name))
     {
         return 0;
     }
 
-    if (!equality_filter_matches(CONFIG_COMM_FILTER, &comm_filter, &context->comm))
+    if (!string_filter_matches(CONFIG_COMM_FILTER, &comm_filter, &comm_prefix_filter, context->comm))
     {
         return 0;
     }
@@ -1271,6 +1343,80 @@ static __always_inline int should_trace(context_t *context)
     return 1;
 }
 
+// returns the scopes matched by the given uint value
+static __always_inline u64 uint_scopes_match(void *filter_map, u64 key, uint_scopes_config_t *config)
+{
+    u64 *scopes = bpf_map_lookup_elem(filter_map, &key);
+    if (scopes != NULL)
+        return *scopes;
+
+    if ((config->less != LESS_NOT_SET) && (key >= config->less))
+        return config->default_scopes;
+
+    if ((config->greater != GREATER_NOT_SET) && (key <= config->greater))
+        return config->default_scopes;
+
+    return config->default_scopes | config->ranged_scopes;
+}
+
+// returns the scopes matched by the given string, by its exact value or else by its longest prefix
+static __always_inline u64 string_scopes_match(void *filter_map, void *prefix_filter_map, char *str, u64 default_scopes)
+{
+    u64 *scopes = bpf_map_lookup_elem(filter_map, str);
+    if (scopes != NULL)
+        return *scopes;
+
+    string_prefix_filter_t prefix_key = {0};
+    prefix_key.prefix_len = MAX_STR_FILTER_SIZE * 8;
+    __builtin_memcpy(prefix_key.str, str, MAX_STR_FILTER_SIZE);
+    scopes = bpf_map_lookup_elem(prefix_filter_map, &prefix_key);
+    if (scopes != NULL)
+        return *scopes;
+
+    return default_scopes;
+}
+
+// returns 1 if the given event may match a scope, 0 if it matches none.
+// The scopes filters that the kernel can't evaluate (process trees, comm and uts suffixes and globs, and the exact
+// ranges of uint filters) pass here, and the events are matched against all the scopes filters again in userspace.
+static __always_inline int scopes_match(context_t *context, u32 event_id)
+{
+    int zero = 0;
+    scopes_config_t *config = bpf_map_lookup_elem(&scopes_config_map, &zero);
+    if (config == NULL || config->enabled_scopes == 0)
+        return 1;
+
+    // events that are not in the map are essential to tracee (e.g. for capture), so they are submitted anyway
+    u64 *chosen = bpf_map_lookup_elem(&scope_events_map, &event_id);
+    if (chosen == NULL)
+        return 1;
+
+    u64 scopes = *chosen;
+
+    bool is_container = false;
+    u32 cgroup_id_lsb = context->cgroup_id;
+    u8 *state = bpf_map_lookup_elem(&containers_map, &cgroup_id_lsb);
+    if (state != NULL && *state != CONTAINER_CREATED)
+        is_container = true;
+
+    if (is_container)
+        scopes &= ~config->cont_filter_out;
+    else
+        scopes &= ~config->cont_filter_in;
+
+    scopes &= uint_scopes_match(&scope_uid_filter, context->uid, &config->uid_filter);
+    scopes &= uint_scopes_match(&scope_mnt_ns_filter, context->mnt_id, &config->mnt_ns_filter);
+    scopes &= uint_scopes_match(&scope_pid_ns_filter, context->pid_id, &config->pid_ns_filter);
+    scopes &= uint_scopes_match(&scope_pid_filter, context->host_tid, &config->pid_filter);
+    if (scopes == 0)
+        return 0;
+
+    scopes &= string_scopes_match(&scope_uts_ns_filter, &scope_uts_ns_prefix_filter, context->uts_name, config->uts_ns_filter_default);
+    scopes &= string_scopes_match(&scope_comm_filter, &scope_comm_prefix_filter, context->comm, config->comm_filter_default);
+
+    return scopes != 0;
+}
+
 static __always_inline int event_chosen(u32 key)
 {
     u32 *config = bpf_map_lookup_elem(&chosen_events_map, &key);
@@ -1645,6 +1791,10 @@ static __always_inline void* get_dentry_path_str(struct dentry* dentry)
 
 static __always_inline int events_perf_submit(event_data_t *data, u32 id, long ret)
 {
+    // Drop the events that match no scope before they are submitted
+    if (!scopes_match(&data->context, id))
+        return 0;
+
     data->context.eventid = id;
     data->context.retval = ret;
 
@@ -4098,6 +4248,7 @@ static __always_inline int tc_probe(struct __sk_buff *skb, bool ingress) {
     pkt.ts = bpf_ktime_get_ns();
     pkt.len = skb->len;
     pkt.ifindex = skb->ifindex;
+    pkt.ingress = ingress;
     local_net_id_t connect_id = {0};
 
     uint32_t l4_hdr_off;
@@ -4207,16 +4358,10 @@ static __always_inline int tc_probe(struct __sk_buff *skb, bool ingress) {
      */
     u64 flags = BPF_F_CURRENT_CPU;
     flags |= (u64)skb->len << 32;
-    if (get_config(CONFIG_DEBUG_NET)){
-        pkt.src_port = __bpf_ntohs(pkt.src_port);
-        pkt.dst_port = __bpf_ntohs(pkt.dst_port);
-        bpf_perf_event_output(skb, &net_events, flags, &pkt, sizeof(pkt));
-    }
-    else {
-        // If not debugging, only send the minimal required data to save the packet.
-        // This will be the timestamp (u64), net event_id (u32), host_tid (u32), comm (16 bytes), packet len (u32), and ifindex (u32)
-        bpf_perf_event_output(skb, &net_events, flags, &pkt, 40);
-    }
+    // Packet metadata is needed for the network stats, debug printing and aggregating flows in userspace
+    pkt.src_port = __bpf_ntohs(pkt.src_port);
+    pkt.dst_port = __bpf_ntohs(pkt.dst_port);
+    bpf_perf_event_output(skb, &net_events, flags, &pkt, sizeof(pkt));
 
     return TC_ACT_UNSPEC;
 }
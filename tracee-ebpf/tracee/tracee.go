@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"net"
 	"os"
 	"os/signal"
@@ -16,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -24,8 +24,6 @@ import (
 	bpf "github.com/aquasecurity/libbpfgo"
 	"github.com/aquasecurity/libbpfgo/helpers"
 	"github.com/aquasecurity/tracee/tracee-ebpf/external"
-	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcapgo"
 	lru "github.com/hashicorp/golang-lru"
 	"golang.org/x/sys/unix"
 )
@@ -33,6 +31,7 @@ import (
 // Config is a struct containing user defined configuration of tracee
 type Config struct {
 	Filter             *Filter
+	Scopes             []*Scope
 	Capture            *CaptureConfig
 	Output             *OutputConfig
 	PerfBufferSize     int
@@ -57,6 +56,10 @@ type CaptureConfig struct {
 	Mem             bool
 	Profile         bool
 	NetIfaces       []string
+	Retention       RetentionConfig
+	Store           bool   // store captured files by their sha256
+	ScanRulesDir    string // directory of yara rules to scan captured files with
+	Pcap            PcapConfig
 }
 
 type OutputConfig struct {
@@ -103,6 +106,30 @@ func (tc Config) Validate() error {
 			}
 		}
 	}
+	if tc.Filter.Follow {
+		// followed processes are tracked by the kernel, which can't evaluate suffixes and globs
+		if (tc.Filter.CommFilter != nil && tc.Filter.CommFilter.UserspaceOnly()) || (tc.Filter.UTSFilter != nil && tc.Filter.UTSFilter.UserspaceOnly()) {
+			return fmt.Errorf("follow can't be used with comm or uts suffix and glob patterns")
+		}
+	}
+	if len(tc.Scopes) > maxScopes {
+		return fmt.Errorf("too many scopes, at most %d scopes are supported", maxScopes)
+	}
+	scopeNames := make(map[string]bool, len(tc.Scopes))
+	for _, s := range tc.Scopes {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if scopeNames[s.Name] {
+			return fmt.Errorf("duplicate scope name: %s", s.Name)
+		}
+		scopeNames[s.Name] = true
+		for _, e := range s.Filter.EventsToTrace {
+			if _, ok := EventsIDToEvent[e]; !ok {
+				return fmt.Errorf("invalid event to trace in scope %s: %d", s.Name, e)
+			}
+		}
+	}
 	if (tc.PerfBufferSize & (tc.PerfBufferSize - 1)) != 0 {
 		return fmt.Errorf("invalid perf buffer size - must be a power of 2")
 	}
@@ -118,6 +145,16 @@ func (tc Config) Validate() error {
 		}
 	}
 
+	eventsToTrace := append([]int32{}, tc.Filter.EventsToTrace...)
+	for _, s := range tc.Scopes {
+		eventsToTrace = append(eventsToTrace, s.Filter.EventsToTrace...)
+	}
+	for _, e := range eventsToTrace {
+		if isNetPacketEvent(e) && len(tc.netIfaces()) == 0 {
+			return fmt.Errorf("%s events require tracing a network interface (net=interface)", EventsIDToEvent[e].Name)
+		}
+	}
+
 	if tc.BPFObjBytes == nil {
 		return errors.New("nil bpf object in memory")
 	}
@@ -137,6 +174,51 @@ func (tc Config) Validate() error {
 	return nil
 }
 
+// isNetPacketEvent returns true if the given event is created from the packets captured by the tc probes
+func isNetPacketEvent(eventID int32) bool {
+	switch eventID {
+	case NetFlowStartEventID, NetFlowEndEventID, NetDnsRequestEventID, NetDnsResponseEventID, NetHttpRequestEventID:
+		return true
+	}
+	return false
+}
+
+// usesUTSFilter returns true if events are filtered by their uts name, by the filter or by a scope
+func (tc Config) usesUTSFilter() bool {
+	if tc.Filter != nil && tc.Filter.UTSFilter != nil && tc.Filter.UTSFilter.Enabled {
+		return true
+	}
+	for _, s := range tc.Scopes {
+		if s.Filter.UTSFilter != nil && s.Filter.UTSFilter.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// netIfaces returns the network interfaces that the tc probes are attached to, for either capture or net flow events
+func (tc Config) netIfaces() []string {
+	var ifaces []string
+	if tc.Capture != nil {
+		ifaces = append(ifaces, tc.Capture.NetIfaces...)
+	}
+	if tc.Filter != nil && tc.Filter.NetFilter != nil {
+		for _, iface := range tc.Filter.NetFilter.Ifaces {
+			found := false
+			for _, item := range ifaces {
+				if iface == item {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+	return ifaces
+}
+
 type profilerInfo struct {
 	Times            int64  `json:"times,omitempty"`
 	FileHash         string `json:"file_hash,omitempty"`
@@ -166,6 +248,10 @@ type Tracee struct {
 	startTime         uint64
 	stats             statsStore
 	capturedFiles     map[string]int64
+	captureIndexMutex sync.Mutex // guards writtenFiles and capturedFiles, which are updated when artifacts are evicted
+	captureRetention  *captureRetention
+	artifactStore     *artifactStore
+	artifactScanner   *artifactScanner
 	fileHashes        *lru.Cache
 	profiledFiles     map[string]profilerInfo
 	writtenFiles      map[string]string
@@ -173,10 +259,17 @@ type Tracee struct {
 	pidsInMntns       bucketsCache //record the first n PIDs (host) in each mount namespace, for internal usage
 	StackAddressesMap *bpf.BPFMap
 	tcProbe           []netProbe
-	pcapWriter        *pcapgo.NgWriter
-	pcapFile          *os.File
+	pcapWriters       *pcapWriters
+	netProcesses      *lru.Cache // host tid -> netPacketContext
+	netFlows          *netFlowTracker
+	httpParser        *httpParser
 	ngIfacesIndex     map[int]int
 	containers        *Containers
+	scopeMatchers     []scopeMatcher
+	procParents       *lru.Cache // host pid -> host ppid, used by scopes process tree filters
+	procUtsNames      *lru.Cache // host pid -> uts name, used to filter the events of captured packets
+	// with follow, whether the kernel traces a thread, as it descends from a traced process
+	followed func(hostTid uint32) bool
 }
 
 type counter int32
@@ -192,12 +285,47 @@ func (c *counter) Increment(amount ...int) {
 	atomic.AddInt32((*int32)(c), int32(sum))
 }
 
+// counter64 is a counter of values that may overflow an int32, e.g. bytes
+type counter64 int64
+
+func (c *counter64) Increment(amount int) {
+	atomic.AddInt64((*int64)(c), int64(amount))
+}
+
+func (c *counter64) Value() int {
+	return int(atomic.LoadInt64((*int64)(c)))
+}
+
+// netIfaceStats counts the packets captured on a traced network interface
+type netIfaceStats struct {
+	name           string
+	ingressPackets counter64
+	ingressBytes   counter64
+	egressPackets  counter64
+	egressBytes    counter64
+}
+
+// count counts a packet that was captured on the interface
+func (s *netIfaceStats) count(ingress bool, length uint32) {
+	if ingress {
+		s.ingressPackets.Increment(1)
+		s.ingressBytes.Increment(int(length))
+	} else {
+		s.egressPackets.Increment(1)
+		s.egressBytes.Increment(int(length))
+	}
+}
+
 type statsStore struct {
-	eventCounter  counter
-	errorCounter  counter
-	lostEvCounter counter
-	lostWrCounter counter
-	lostNtCounter counter
+	eventCounter        counter
+	errorCounter        counter
+	lostEvCounter       counter
+	lostWrCounter       counter
+	lostNtCounter       counter
+	evictedCounter      counter
+	pcapErrorCounter    counter
+	unknownIfaceCounter counter
+	netIfaces           map[int]*netIfaceStats // ifindex -> stats, set before packets are processed
 }
 
 func (t *Tracee) GetStats() external.Stats {
@@ -208,6 +336,23 @@ func (t *Tracee) GetStats() external.Stats {
 	stats.LostEvCount = int(t.stats.lostEvCounter)
 	stats.LostWrCount = int(t.stats.lostWrCounter)
 	stats.LostNtCount = int(t.stats.lostNtCounter)
+	stats.EvictedCount = int(t.stats.evictedCounter)
+	stats.PcapErrorCount = int(t.stats.pcapErrorCounter)
+	stats.UnknownIfaceCount = int(t.stats.unknownIfaceCounter)
+	if t.artifactScanner != nil {
+		stats.ScanDroppedCount = int(t.artifactScanner.dropped)
+	}
+	if len(t.stats.netIfaces) > 0 {
+		stats.NetStats = make(map[string]external.NetIfaceStats, len(t.stats.netIfaces))
+		for _, s := range t.stats.netIfaces {
+			stats.NetStats[s.name] = external.NetIfaceStats{
+				IngressPackets: s.ingressPackets.Value(),
+				IngressBytes:   s.ingressBytes.Value(),
+				EgressPackets:  s.egressPackets.Value(),
+				EgressBytes:    s.egressBytes.Value(),
+			}
+		}
+	}
 
 	return stats
 }
@@ -243,7 +388,7 @@ func New(cfg Config) (*Tracee, error) {
 		setEssential(MemProtAlertEventID)
 	}
 
-	if cfg.Capture.NetIfaces != nil || cfg.Debug {
+	if len(cfg.netIfaces()) > 0 || cfg.Debug {
 		setEssential(SecuritySocketBindEventID)
 	}
 
@@ -268,6 +413,17 @@ func New(cfg Config) (*Tracee, error) {
 		// Map value is true iff events requested by the user
 		t.eventsToTrace[e] = true
 	}
+	for _, s := range t.config.Scopes {
+		for _, e := range s.Filter.EventsToTrace {
+			t.eventsToTrace[e] = true
+		}
+		t.scopeMatchers = append(t.scopeMatchers, newScopeMatcher(s))
+	}
+
+	if t.config.Capture.ScanRulesDir != "" {
+		// scanning captured files is only useful if the matches are emitted
+		t.eventsToTrace[ArtifactScanMatchEventID] = true
+	}
 
 	if t.eventsToTrace[MagicWriteEventID] {
 		setEssential(VfsWriteEventID)
@@ -313,6 +469,11 @@ func New(cfg Config) (*Tracee, error) {
 		t.Close()
 		return nil, err
 	}
+	t.procParents, err = lru.New(16384)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
 	t.profiledFiles = make(map[string]profilerInfo)
 	//set a default value for config.maxPidsCache
 	if t.config.maxPidsCache == 0 {
@@ -333,6 +494,39 @@ func New(cfg Config) (*Tracee, error) {
 		t.Close()
 		return nil, fmt.Errorf("error creating output path: %v", err)
 	}
+	if t.config.Capture.Store {
+		t.artifactStore, err = newArtifactStore(t.config.Capture.OutputPath)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("error creating artifact store: %v", err)
+		}
+	}
+	if t.config.Capture.ScanRulesDir != "" {
+		t.artifactScanner, err = newArtifactScanner(t.config.Capture.ScanRulesDir, t.config.Capture.OutputPath)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("error loading yara rules: %v", err)
+		}
+	}
+	if t.config.Capture.Retention.Enabled() {
+		t.captureRetention = newCaptureRetention(t.config.Capture.Retention, t.config.Capture.OutputPath, func(a *capturedArtifact, reason string) {
+			t.stats.evictedCounter.Increment()
+			if t.artifactScanner != nil {
+				t.artifactScanner.cancel(a.relPath)
+			}
+			if t.artifactStore != nil {
+				t.artifactStore.release(a.relPath)
+			}
+			// evictions are counted in the stats, and are logged only with debug
+			if t.config.Debug {
+				fmt.Fprintf(os.Stderr, "capture: evicted %s (%d bytes): %s\n", a.relPath, a.size, reason)
+			}
+		})
+		if err := t.captureRetention.loadExisting(); err != nil {
+			t.Close()
+			return nil, fmt.Errorf("error loading captured artifacts: %v", err)
+		}
+	}
 	// Todo: tracee.pid should be in a known constant location. /var/run is probably a better choice
 	err = ioutil.WriteFile(path.Join(t.config.Capture.OutputPath, "tracee.pid"), []byte(strconv.Itoa(os.Getpid())+"\n"), 0640)
 	if err != nil {
@@ -340,57 +534,62 @@ func New(cfg Config) (*Tracee, error) {
 		return nil, fmt.Errorf("error creating readiness file: %v", err)
 	}
 
-	if t.config.Capture.NetIfaces != nil {
-		pcapFile, err := os.Create(path.Join(t.config.Capture.OutputPath, "capture.pcap"))
+	if len(t.config.netIfaces()) > 0 {
+		t.netProcesses, err = lru.New(1024)
 		if err != nil {
-			return nil, fmt.Errorf("error creating pcap file: %v", err)
+			t.Close()
+			return nil, err
 		}
-		t.pcapFile = pcapFile
-
-		t.ngIfacesIndex = make(map[int]int)
-		for idx, iface := range t.config.Capture.NetIfaces {
+		// the uts name of a process isn't in procfs, so it's recorded from its events if it's filtered by
+		if t.config.usesUTSFilter() {
+			t.procUtsNames, err = lru.New(16384)
+			if err != nil {
+				t.Close()
+				return nil, err
+			}
+		}
+		t.stats.netIfaces = make(map[int]*netIfaceStats)
+		for _, iface := range t.config.netIfaces() {
 			netIface, err := net.InterfaceByName(iface)
 			if err != nil {
+				t.Close()
 				return nil, fmt.Errorf("invalid network interface: %s", iface)
 			}
-			// Map real network interface index to NgInterface index
-			t.ngIfacesIndex[netIface.Index] = idx
+			t.stats.netIfaces[netIface.Index] = &netIfaceStats{name: iface}
 		}
+	}
 
-		ngIface := pcapgo.NgInterface{
-			Name:       t.config.Capture.NetIfaces[0],
-			Comment:    "tracee tc capture",
-			Filter:     "",
-			LinkType:   layers.LinkTypeEthernet,
-			SnapLength: uint32(math.MaxUint16),
+	if t.eventsToTrace[NetFlowStartEventID] || t.eventsToTrace[NetFlowEndEventID] {
+		t.netFlows, err = newNetFlowTracker(maxNetFlows)
+		if err != nil {
+			t.Close()
+			return nil, err
 		}
+	}
 
-		pcapWriter, err := pcapgo.NewNgWriterInterface(t.pcapFile, ngIface, pcapgo.NgWriterOptions{})
+	if t.eventsToTrace[NetHttpRequestEventID] {
+		t.httpParser, err = newHTTPParser(maxHTTPStreams)
 		if err != nil {
+			t.Close()
 			return nil, err
 		}
+	}
 
-		for _, iface := range t.config.Capture.NetIfaces[1:] {
-			ngIface = pcapgo.NgInterface{
-				Name:       iface,
-				Comment:    "tracee tc capture",
-				Filter:     "",
-				LinkType:   layers.LinkTypeEthernet,
-				SnapLength: uint32(math.MaxUint16),
-			}
-
-			_, err := pcapWriter.AddInterface(ngIface)
+	if t.config.Capture.NetIfaces != nil {
+		t.ngIfacesIndex = make(map[int]int)
+		for idx, iface := range t.config.Capture.NetIfaces {
+			netIface, err := net.InterfaceByName(iface)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("invalid network interface: %s", iface)
 			}
+			// Map real network interface index to NgInterface index
+			t.ngIfacesIndex[netIface.Index] = idx
 		}
 
-		// Flush the header
-		err = pcapWriter.Flush()
-		if err != nil {
+		t.pcapWriters = newPcapWriters(t.config.Capture.Pcap, t.config.Capture.OutputPath, t.config.Capture.NetIfaces)
+		if err := t.pcapWriters.init(); err != nil {
 			return nil, err
 		}
-		t.pcapWriter = pcapWriter
 	}
 
 	// Get refernce to stack trace addresses map
@@ -438,7 +637,7 @@ func getParamType(paramType string) argType {
 		return intArr2T
 	case "slim_cred_t":
 		return credT
-	case "umode_t":
+	case "umode_t", "u16":
 		return u16T
 	default:
 		// Default to pointer (printed as hex) for unsupported types
@@ -573,6 +772,18 @@ func (t *Tracee) populateBPFMaps() error {
 		}
 	}
 
+	// with follow, the events that are created in userspace are emitted for the threads that the kernel follows
+	if t.config.Filter.Follow {
+		tracedPidsMap, err := t.bpfModule.GetMap("traced_pids_map") // u32, u32
+		if err != nil {
+			return err
+		}
+		t.followed = func(hostTid uint32) bool {
+			_, err := tracedPidsMap.GetValue(unsafe.Pointer(&hostTid))
+			return err == nil
+		}
+	}
+
 	// Populate containers_map with existing containers
 	t.containers.PopulateBpfMap(t.bpfModule)
 
@@ -607,8 +818,8 @@ func (t *Tracee) populateBPFMaps() error {
 	errmap["pid=new_filter"] = t.config.Filter.NewPidFilter.Set(t.bpfModule, configNewPidFilter)
 	errmap["mnt_ns_filter"] = t.config.Filter.MntNSFilter.Set(t.bpfModule, "mnt_ns_filter", configMntNsFilter, mntNsLess)
 	errmap["pid_ns_filter"] = t.config.Filter.PidNSFilter.Set(t.bpfModule, "pid_ns_filter", configPidNsFilter, pidNsLess)
-	errmap["uts_ns_filter"] = t.config.Filter.UTSFilter.Set(t.bpfModule, "uts_ns_filter", configUTSNsFilter)
-	errmap["comm_filter"] = t.config.Filter.CommFilter.Set(t.bpfModule, "comm_filter", configCommFilter)
+	errmap["uts_ns_filter"] = t.config.Filter.UTSFilter.Set(t.bpfModule, "uts_ns_filter", "uts_ns_prefix_filter", configUTSNsFilter)
+	errmap["comm_filter"] = t.config.Filter.CommFilter.Set(t.bpfModule, "comm_filter", "comm_prefix_filter", configCommFilter)
 	errmap["cont_filter"] = t.config.Filter.ContFilter.Set(t.bpfModule, configContFilter)
 	errmap["cont=new_filter"] = t.config.Filter.NewContFilter.Set(t.bpfModule, configNewContFilter)
 	for k, v := range errmap {
@@ -617,6 +828,10 @@ func (t *Tracee) populateBPFMaps() error {
 		}
 	}
 
+	if err := t.setScopes(); err != nil {
+		return fmt.Errorf("error setting scopes: %v", err)
+	}
+
 	stringStoreMap, err := t.bpfModule.GetMap("string_store") // []string[MAX_PATH_PREF_SIZE]
 	if err != nil {
 		return err
@@ -799,8 +1014,8 @@ func (t *Tracee) initBPF() error {
 		}
 	}
 
-	if t.config.Capture.NetIfaces == nil && !t.config.Debug {
-		// SecuritySocketBindEventID is set as an essentialEvent if 'capture net' or 'debug' were chosen by the user.
+	if len(t.config.netIfaces()) == 0 && !t.config.Debug {
+		// SecuritySocketBindEventID is set as an essentialEvent if 'capture net', 'trace net' or 'debug' were chosen by the user.
 		networkProbes := []string{"tc_ingress", "tc_egress", "trace_udp_sendmsg", "trace_udp_disconnect", "trace_udp_destroy_sock", "trace_udpv6_destroy_sock", "tracepoint__inet_sock_set_state"}
 		for _, progName := range networkProbes {
 			prog, _ := t.bpfModule.GetProgram(progName)
@@ -824,8 +1039,8 @@ func (t *Tracee) initBPF() error {
 		return err
 	}
 
-	if t.config.Capture.NetIfaces != nil || t.config.Debug {
-		for _, iface := range t.config.Capture.NetIfaces {
+	if len(t.config.netIfaces()) > 0 || t.config.Debug {
+		for _, iface := range t.config.netIfaces() {
 			ingressHook, err := t.attachTcProg(iface, bpf.BPFTcIngress, "tc_ingress")
 			if err != nil {
 				return err
@@ -933,10 +1148,27 @@ func (t *Tracee) Run() error {
 	go t.processEvents(t.config.ChanDone)
 	go t.processFileWrites()
 	go t.processNetEvents()
+	if t.captureRetention != nil && t.config.Capture.Retention.MaxAge > 0 {
+		go t.processCaptureRetention()
+	}
+	if t.artifactScanner != nil {
+		go t.processArtifactScans()
+	}
+	if t.netFlows != nil {
+		go t.processNetFlowTimeouts()
+	}
 	<-sig
 	t.eventsPerfMap.Stop()
 	t.fileWrPerfMap.Stop()
 	t.netPerfMap.Stop()
+	if t.netFlows != nil {
+		t.emitNetFlowEvents(NetFlowEndEventID, t.netFlows.endAll())
+	}
+	if t.pcapWriters != nil {
+		if err := t.pcapWriters.close(); err != nil {
+			return fmt.Errorf("error closing pcap files: %v", err)
+		}
+	}
 	// capture profiler stats
 	if t.config.Capture.Profile {
 		f, err := os.Create(filepath.Join(t.config.Capture.OutputPath, "tracee.profile"))
@@ -952,6 +1184,23 @@ func (t *Tracee) Run() error {
 		}
 	}
 
+	// scan the files that are still being written, before they are moved into the store
+	if t.artifactScanner != nil {
+		for _, req := range t.artifactScanner.pending() {
+			t.scanArtifact(req)
+		}
+	}
+
+	// store the written files and record which artifacts were captured
+	if t.artifactStore != nil {
+		if err := t.artifactStore.addPending(); err != nil {
+			return fmt.Errorf("error storing captured files: %v", err)
+		}
+		if err := t.artifactStore.flush(); err != nil {
+			return fmt.Errorf("error writing artifacts manifest: %v", err)
+		}
+	}
+
 	// record index of written files
 	if t.config.Capture.FileWrite {
 		destinationFilePath := filepath.Join(t.config.Capture.OutputPath, "written_files")
@@ -960,6 +1209,8 @@ func (t *Tracee) Run() error {
 			return fmt.Errorf("error logging written files")
 		}
 		defer f.Close()
+		t.captureIndexMutex.Lock()
+		defer t.captureIndexMutex.Unlock()
 		for fileName, filePath := range t.writtenFiles {
 			writeFiltered := false
 			for _, filterPrefix := range t.config.Capture.FilterFileWrite {
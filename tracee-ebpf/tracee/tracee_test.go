@@ -288,3 +288,30 @@ func Test_updateFileSHA(t *testing.T) {
 		},
 	}, trc.profiledFiles)
 }
+
+func TestGetStats(t *testing.T) {
+	trc := Tracee{
+		stats: statsStore{
+			netIfaces: map[int]*netIfaceStats{1: {name: "lo"}, 2: {name: "eth0"}},
+		},
+	}
+	trc.stats.eventCounter.Increment(3)
+	trc.stats.netIfaces[2].count(true, 100)
+	trc.stats.netIfaces[2].count(true, 50)
+	trc.stats.netIfaces[2].count(false, 60)
+	trc.stats.pcapErrorCounter.Increment()
+	trc.stats.unknownIfaceCounter.Increment(2)
+
+	assert.Equal(t, external.Stats{
+		EventCount: 3,
+		NetStats: map[string]external.NetIfaceStats{
+			"lo":   {},
+			"eth0": {IngressPackets: 2, IngressBytes: 150, EgressPackets: 1, EgressBytes: 60},
+		},
+		PcapErrorCount:    1,
+		UnknownIfaceCount: 2,
+	}, trc.GetStats())
+
+	// without traced interfaces there are no network stats
+	assert.Nil(t, (&Tracee{}).GetStats().NetStats)
+}
@@ -91,11 +91,7 @@ func (t *Tracee) processFileWrites() {
 				if vfsMeta.Mode&S_IFSOCK == S_IFSOCK || vfsMeta.Mode&S_IFCHR == S_IFCHR || vfsMeta.Mode&S_IFIFO == S_IFIFO {
 					appendFile = true
 				}
-				if vfsMeta.Pid == 0 {
-					filename = fmt.Sprintf("write.dev-%d.inode-%d", vfsMeta.DevID, vfsMeta.Inode)
-				} else {
-					filename = fmt.Sprintf("write.dev-%d.inode-%d.pid-%d", vfsMeta.DevID, vfsMeta.Inode, vfsMeta.Pid)
-				}
+				filename = writtenFileName(vfsMeta.DevID, vfsMeta.Inode, vfsMeta.Pid)
 			} else if meta.BinType == sendMprotect {
 				var mprotectMeta mprotectWriteMeta
 				err = binary.Read(metaBuff, binary.LittleEndian, &mprotectMeta)
@@ -162,11 +158,65 @@ func (t *Tracee) processFileWrites() {
 				t.handleError(err)
 				continue
 			}
+			view := path.Join(strconv.Itoa(int(meta.MntID)), filename)
+			var onEvict func()
+			if meta.BinType == sendVfsWrite {
+				// remove evicted files from the written files index
+				onEvict = func() {
+					t.captureIndexMutex.Lock()
+					delete(t.writtenFiles, view)
+					t.captureIndexMutex.Unlock()
+				}
+			}
+			stored := false
+			if t.artifactStore != nil {
+				switch meta.BinType {
+				case sendVfsWrite:
+					// written files may still be written to, so store them only when tracee exits
+					t.artifactStore.markPending(view)
+				case sendMprotect:
+					if sha, size, err := t.artifactStore.add(view, &artifactProducer{Capture: "mem", MountNS: int(meta.MntID)}); err != nil {
+						t.handleError(err)
+					} else {
+						t.trackStored(meta.MntID, view, sha, size, onEvict)
+						stored = true
+					}
+				}
+			}
+			if !stored {
+				t.trackCapture(meta.MntID, fullname, onEvict)
+			}
+			if t.artifactScanner != nil {
+				switch meta.BinType {
+				case sendVfsWrite:
+					// scan written files once they are no longer written to
+					t.captureIndexMutex.Lock()
+					pathname := t.writtenFiles[view]
+					t.captureIndexMutex.Unlock()
+					t.artifactScanner.scanDelayed(view, artifactProducer{Capture: "write", MountNS: int(meta.MntID), Pathname: pathname})
+				case sendMprotect:
+					t.artifactScanner.scan(view, artifactProducer{Capture: "mem", MountNS: int(meta.MntID)})
+				}
+			}
 			// Rename the file to add hash when last chunk was received
 			if meta.BinType == sendKernelModule {
 				if uint64(meta.Size)+meta.Off == kernelModuleMeta.Size {
 					fileHash := getFileHash(fullname)
 					os.Rename(fullname, fullname+"."+fileHash)
+					if t.captureRetention != nil {
+						t.captureRetention.rename(view, view+"."+fileHash)
+					}
+					if t.artifactStore != nil {
+						producer := &artifactProducer{Capture: "module", MountNS: int(meta.MntID), HostProcessID: int(kernelModuleMeta.Pid)}
+						if sha, size, err := t.artifactStore.add(view+"."+fileHash, producer); err != nil {
+							t.handleError(err)
+						} else {
+							t.trackStored(meta.MntID, view+"."+fileHash, sha, size, nil)
+						}
+					}
+					if t.artifactScanner != nil {
+						t.artifactScanner.scan(view+"."+fileHash, artifactProducer{Capture: "module", MountNS: int(meta.MntID), HostProcessID: int(kernelModuleMeta.Pid)})
+					}
 				}
 			}
 		case lost := <-t.lostWrChannel:
@@ -174,3 +224,12 @@ func (t *Tracee) processFileWrites() {
 		}
 	}
 }
+
+// writtenFileName returns the name of the file that captures the writes to a file. Writes to /dev/null are captured
+// per process, with pid as the ID of the writing process in its namespace, and 0 otherwise.
+func writtenFileName(dev uint32, inode uint64, pid uint32) string {
+	if pid == 0 {
+		return fmt.Sprintf("write.dev-%d.inode-%d", dev, inode)
+	}
+	return fmt.Sprintf("write.dev-%d.inode-%d.pid-%d", dev, inode, pid)
+}
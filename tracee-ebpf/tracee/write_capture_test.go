@@ -0,0 +1,13 @@
+package tracee
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrittenFileName(t *testing.T) {
+	assert.Equal(t, "write.dev-1.inode-2", writtenFileName(1, 2, 0))
+	// writes to /dev/null are captured per process
+	assert.Equal(t, "write.dev-1.inode-2.pid-3", writtenFileName(1, 2, 3))
+}
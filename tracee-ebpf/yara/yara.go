@@ -0,0 +1,988 @@
+// Package yara implements a pure Go matcher for a subset of the YARA rules language (https://yara.readthedocs.io),
+// used to scan captured artifacts without depending on libyara.
+//
+// Supported:
+//   - rule modifiers: private
+//   - rule tags and meta
+//   - text strings with the nocase, wide, ascii, fullword and private modifiers
+//   - hex strings with wildcards (??, A?, ?B), jumps ([n], [n-m], [n-], [-]) and alternatives ( AB | CD )
+//   - regular expressions with the i and s modifiers (RE2 syntax)
+//   - conditions: and, or, not, parentheses, true, false, $a, #a, filesize, uint8/16/32[be](offset), references to
+//     previous rules, comparisons (==, !=, <, <=, >, >=), and quantifiers (any, all, none, N) of them or of a set ($a, $b*)
+//
+// Not supported: imports (modules), includes, global rules, string offsets (at, in, @a, !a), arithmetic, for loops,
+// and the xor and base64 modifiers.
+package yara
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxStringMatches bounds the number of matches counted for a single string
+const maxStringMatches = 10000
+
+// compiledString is a compiled string of a rule
+type compiledString struct {
+	id      string // including the leading '$'
+	private bool
+	re      *regexp.Regexp // matched against the artifact decoded as latin-1, so that every byte is a single rune
+}
+
+// compiledRule is a compiled rule
+type compiledRule struct {
+	name      string
+	private   bool
+	tags      []string
+	meta      map[string]string
+	strings   []*compiledString
+	condition expr
+}
+
+type expr func(c *scanContext) bool
+type numExpr func(c *scanContext) int64
+
+// Ruleset is a list of compiled rules, in the order they were defined
+type Ruleset struct {
+	rules []*compiledRule
+}
+
+// Match is a rule that matched a scanned artifact
+type Match struct {
+	Rule    string
+	Tags    []string
+	Meta    map[string]string
+	Strings []string // identifiers of the matched strings
+}
+
+// scanContext holds the state of a single scan
+type scanContext struct {
+	raw     []byte
+	data    string // raw, decoded as latin-1
+	rule    *compiledRule
+	counts  map[*compiledString]int
+	results map[string]bool // rule name -> result, for rules that were evaluated already
+}
+
+// LoadRules compiles the rules of all the .yar and .yara files in the given directory
+func LoadRules(dir string) (*Ruleset, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && (filepath.Ext(f.Name()) == ".yar" || filepath.Ext(f.Name()) == ".yara") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	rs := &Ruleset{}
+	for _, name := range names {
+		src, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := rs.compile(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if len(rs.rules) == 0 {
+		return nil, fmt.Errorf("no yara rules found in %s", dir)
+	}
+	return rs, nil
+}
+
+// compile parses the rules in src and adds them to the ruleset
+func (rs *Ruleset) compile(src string) error {
+	p := &parser{src: src, ruleset: rs}
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			return nil
+		}
+		if p.acceptWord("import") || p.acceptWord("include") {
+			return p.errorf("imports and includes are not supported")
+		}
+		rule, err := p.parseRule()
+		if err != nil {
+			return err
+		}
+		rs.rules = append(rs.rules, rule)
+	}
+}
+
+func (rs *Ruleset) rule(name string) *compiledRule {
+	for _, r := range rs.rules {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Scan evaluates all the rules against the given artifact and returns the rules that matched
+func (rs *Ruleset) Scan(data []byte) []Match {
+	c := &scanContext{
+		raw:     data,
+		data:    latin1(data),
+		counts:  make(map[*compiledString]int),
+		results: make(map[string]bool, len(rs.rules)),
+	}
+
+	var matches []Match
+	for _, r := range rs.rules {
+		c.rule = r
+		matched := r.condition(c)
+		c.results[r.name] = matched
+		if !matched || r.private {
+			continue
+		}
+		match := Match{Rule: r.name, Tags: r.tags, Meta: r.meta}
+		for _, s := range r.strings {
+			if !s.private && c.matches(s) {
+				match.Strings = append(match.Strings, s.id)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func (c *scanContext) matches(s *compiledString) bool {
+	if count, ok := c.counts[s]; ok {
+		return count > 0
+	}
+	return s.re.MatchString(c.data)
+}
+
+func (c *scanContext) count(s *compiledString) int {
+	count, ok := c.counts[s]
+	if !ok {
+		count = len(s.re.FindAllStringIndex(c.data, maxStringMatches))
+		c.counts[s] = count
+	}
+	return count
+}
+
+// latin1 decodes data as latin-1, so that regular expressions can match arbitrary bytes
+func latin1(data []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for _, b := range data {
+		if b < 0x80 {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+// parser is a recursive descent parser of the supported YARA subset
+type parser struct {
+	src     string
+	pos     int
+	ruleset *Ruleset
+	rule    *compiledRule
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip skips whitespace and comments
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n' || p.src[p.pos] == '\r':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// peekWord returns the identifier or keyword at the current position, without consuming it
+func (p *parser) peekWord() string {
+	p.skip()
+	end := p.pos
+	for end < len(p.src) && isIdentChar(p.src[end]) {
+		end++
+	}
+	return p.src[p.pos:end]
+}
+
+func (p *parser) acceptWord(word string) bool {
+	if p.peekWord() != word {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	p.skip()
+	if !strings.HasPrefix(p.src[p.pos:], punct) {
+		return false
+	}
+	p.pos += len(punct)
+	return true
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.acceptPunct(punct) {
+		return p.errorf("expected '%s'", punct)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	word := p.peekWord()
+	if word == "" || (word[0] >= '0' && word[0] <= '9') {
+		return "", p.errorf("expected an identifier")
+	}
+	p.pos += len(word)
+	return word, nil
+}
+
+// stringID parses a string identifier ($a), or a string set identifier ($a*) if wildcard is set
+func (p *parser) stringID(prefix byte, wildcard bool) (string, error) {
+	p.skip()
+	if p.pos >= len(p.src) || p.src[p.pos] != prefix {
+		return "", p.errorf("expected a string identifier")
+	}
+	end := p.pos + 1
+	for end < len(p.src) && isIdentChar(p.src[end]) {
+		end++
+	}
+	if wildcard && end < len(p.src) && p.src[end] == '*' {
+		end++
+	}
+	id := "$" + p.src[p.pos+1:end]
+	p.pos = end
+	return id, nil
+}
+
+func (p *parser) number() (int64, error) {
+	word := p.peekWord()
+	if word == "" || word[0] < '0' || word[0] > '9' {
+		return 0, p.errorf("expected a number")
+	}
+	multiplier := int64(1)
+	numString := word
+	if strings.HasSuffix(word, "KB") {
+		multiplier, numString = 1024, strings.TrimSuffix(word, "KB")
+	} else if strings.HasSuffix(word, "MB") {
+		multiplier, numString = 1024*1024, strings.TrimSuffix(word, "MB")
+	}
+	var n int64
+	var err error
+	if strings.HasPrefix(numString, "0x") {
+		n, err = strconv.ParseInt(numString[2:], 16, 64)
+	} else {
+		n, err = strconv.ParseInt(numString, 10, 64)
+	}
+	if err != nil {
+		return 0, p.errorf("invalid number: %s", word)
+	}
+	p.pos += len(word)
+	return n * multiplier, nil
+}
+
+// quoted parses a double quoted text string and returns its bytes
+func (p *parser) quoted() ([]byte, error) {
+	if err := p.expectPunct(`"`); err != nil {
+		return nil, err
+	}
+	var b []byte
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b, nil
+		case '\n':
+			return nil, p.errorf("unterminated string")
+		case '\\':
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case '"', '\\':
+				b = append(b, e)
+			case 'n':
+				b = append(b, '\n')
+			case 't':
+				b = append(b, '\t')
+			case 'r':
+				b = append(b, '\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					return nil, p.errorf("invalid escape sequence")
+				}
+				v, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					return nil, p.errorf("invalid escape sequence: \\x%s", p.src[p.pos:p.pos+2])
+				}
+				b = append(b, byte(v))
+				p.pos += 2
+			default:
+				return nil, p.errorf("invalid escape sequence: \\%c", e)
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *parser) parseRule() (*compiledRule, error) {
+	rule := &compiledRule{meta: make(map[string]string)}
+	if p.acceptWord("global") {
+		return nil, p.errorf("global rules are not supported")
+	}
+	rule.private = p.acceptWord("private")
+	if !p.acceptWord("rule") {
+		return nil, p.errorf("expected 'rule'")
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if p.ruleset.rule(name) != nil {
+		return nil, p.errorf("duplicate rule name: %s", name)
+	}
+	rule.name = name
+	p.rule = rule
+
+	if p.acceptPunct(":") {
+		for p.peekWord() != "" {
+			tag, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			rule.tags = append(rule.tags, tag)
+		}
+	}
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+
+	if p.acceptWord("meta") {
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if err := p.parseMeta(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptWord("strings") {
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if err := p.parseStrings(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.acceptWord("condition") {
+		return nil, p.errorf("expected 'condition'")
+	}
+	if err := p.expectPunct(":"); err != nil {
+		return nil, err
+	}
+	rule.condition, err = p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("}"); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (p *parser) parseMeta() error {
+	for {
+		key := p.peekWord()
+		if key == "" || key == "strings" || key == "condition" {
+			return nil
+		}
+		p.pos += len(key)
+		if err := p.expectPunct("="); err != nil {
+			return err
+		}
+		p.skip()
+		switch {
+		case p.pos < len(p.src) && p.src[p.pos] == '"':
+			val, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			p.rule.meta[key] = string(val)
+		case p.acceptWord("true"):
+			p.rule.meta[key] = "true"
+		case p.acceptWord("false"):
+			p.rule.meta[key] = "false"
+		default:
+			negative := p.acceptPunct("-")
+			n, err := p.number()
+			if err != nil {
+				return err
+			}
+			if negative {
+				n = -n
+			}
+			p.rule.meta[key] = strconv.FormatInt(n, 10)
+		}
+	}
+}
+
+func (p *parser) parseStrings() error {
+	for {
+		p.skip()
+		if p.pos >= len(p.src) || p.src[p.pos] != '$' {
+			return nil
+		}
+		id, err := p.stringID('$', false)
+		if err != nil {
+			return err
+		}
+		for _, s := range p.rule.strings {
+			if s.id == id && id != "$" {
+				return p.errorf("duplicate string identifier: %s", id)
+			}
+		}
+		if err := p.expectPunct("="); err != nil {
+			return err
+		}
+
+		var pattern string
+		s := &compiledString{id: id}
+		p.skip()
+		switch {
+		case p.pos < len(p.src) && p.src[p.pos] == '"':
+			text, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			pattern, err = p.textPattern(text, s)
+			if err != nil {
+				return err
+			}
+		case p.pos < len(p.src) && p.src[p.pos] == '{':
+			pattern, err = p.hexPattern()
+			if err != nil {
+				return err
+			}
+			if err := p.stringModifiers(s, map[string]bool{"private": true}); err != nil {
+				return err
+			}
+		case p.pos < len(p.src) && p.src[p.pos] == '/':
+			pattern, err = p.regexPattern(s)
+			if err != nil {
+				return err
+			}
+		default:
+			return p.errorf("expected a text, hex or regular expression string")
+		}
+
+		s.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return p.errorf("invalid string %s: %v", id, err)
+		}
+		p.rule.strings = append(p.rule.strings, s)
+	}
+}
+
+// stringModifiers parses the modifiers of a string, and returns an error for modifiers which are not allowed
+func (p *parser) stringModifiers(s *compiledString, allowed map[string]bool) error {
+	for {
+		word := p.peekWord()
+		switch word {
+		case "nocase", "wide", "ascii", "fullword", "private", "xor", "base64", "base64wide":
+		default:
+			return nil
+		}
+		if !allowed[word] {
+			return p.errorf("string modifier %s is not supported for %s", word, s.id)
+		}
+		p.pos += len(word)
+		if word == "private" {
+			s.private = true
+		}
+	}
+}
+
+func (p *parser) textPattern(text []byte, s *compiledString) (string, error) {
+	start := p.pos
+	if err := p.stringModifiers(s, map[string]bool{"nocase": true, "wide": true, "ascii": true, "fullword": true, "private": true}); err != nil {
+		return "", err
+	}
+	modifiers := strings.Fields(p.src[start:p.pos])
+	has := func(m string) bool {
+		for _, modifier := range modifiers {
+			if modifier == m {
+				return true
+			}
+		}
+		return false
+	}
+
+	quote := func(wide bool) string {
+		var sb strings.Builder
+		for _, b := range text {
+			if b >= 0x20 && b < 0x7f {
+				sb.WriteString(regexp.QuoteMeta(string(b)))
+			} else {
+				fmt.Fprintf(&sb, `\x%02x`, b)
+			}
+			if wide {
+				sb.WriteString(`\x00`)
+			}
+		}
+		return sb.String()
+	}
+	var pattern string
+	switch {
+	case has("wide") && has("ascii"):
+		pattern = fmt.Sprintf("(?:%s|%s)", quote(false), quote(true))
+	case has("wide"):
+		pattern = quote(true)
+	default:
+		pattern = quote(false)
+	}
+	if has("fullword") {
+		pattern = fmt.Sprintf(`(?:^|[^0-9A-Za-z])%s(?:[^0-9A-Za-z]|$)`, pattern)
+	}
+	if has("nocase") {
+		pattern = "(?i)" + pattern
+	}
+	return pattern, nil
+}
+
+func (p *parser) hexPattern() (string, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("(?s)")
+	depth := 0
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			return "", p.errorf("unterminated hex string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '}':
+			p.pos++
+			if depth != 0 {
+				return "", p.errorf("unbalanced alternatives in hex string")
+			}
+			return sb.String(), nil
+		case c == '(':
+			p.pos++
+			depth++
+			sb.WriteString("(?:")
+		case c == '|':
+			p.pos++
+			sb.WriteString("|")
+		case c == ')':
+			p.pos++
+			depth--
+			sb.WriteString(")")
+		case c == '[':
+			end := strings.IndexByte(p.src[p.pos:], ']')
+			if end < 0 {
+				return "", p.errorf("unterminated jump in hex string")
+			}
+			jump := strings.ReplaceAll(p.src[p.pos+1:p.pos+end], " ", "")
+			p.pos += end + 1
+			bounds := strings.SplitN(jump, "-", 2)
+			if len(bounds) == 1 {
+				sb.WriteString(fmt.Sprintf(".{%s}", bounds[0]))
+				continue
+			}
+			if bounds[0] == "" {
+				bounds[0] = "0"
+			}
+			sb.WriteString(fmt.Sprintf(".{%s,%s}", bounds[0], bounds[1]))
+		default:
+			if p.pos+2 > len(p.src) {
+				return "", p.errorf("invalid hex string")
+			}
+			hi, lo := p.src[p.pos], p.src[p.pos+1]
+			p.pos += 2
+			switch {
+			case hi == '?' && lo == '?':
+				sb.WriteString(".")
+			case lo == '?':
+				h, err := strconv.ParseUint(string(hi), 16, 8)
+				if err != nil {
+					return "", p.errorf("invalid hex byte: %c%c", hi, lo)
+				}
+				sb.WriteString(fmt.Sprintf(`[\x%02x-\x%02x]`, h<<4, h<<4|0xf))
+			case hi == '?':
+				l, err := strconv.ParseUint(string(lo), 16, 8)
+				if err != nil {
+					return "", p.errorf("invalid hex byte: %c%c", hi, lo)
+				}
+				sb.WriteString("[")
+				for h := uint64(0); h < 16; h++ {
+					sb.WriteString(fmt.Sprintf(`\x%02x`, h<<4|l))
+				}
+				sb.WriteString("]")
+			default:
+				b, err := strconv.ParseUint(string([]byte{hi, lo}), 16, 8)
+				if err != nil {
+					return "", p.errorf("invalid hex byte: %c%c", hi, lo)
+				}
+				sb.WriteString(fmt.Sprintf(`\x%02x`, b))
+			}
+		}
+	}
+}
+
+func (p *parser) regexPattern(s *compiledString) (string, error) {
+	p.pos++ // opening '/'
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return "", p.errorf("unterminated regular expression")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.pos < len(p.src) && p.src[p.pos] == '/' {
+			c = '/'
+			p.pos++
+		} else if c == '\\' && p.pos < len(p.src) {
+			sb.WriteByte(c)
+			c = p.src[p.pos]
+			p.pos++
+		}
+		sb.WriteByte(c)
+	}
+	flags := ""
+	for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+		flags += string(p.src[p.pos])
+		p.pos++
+	}
+	if err := p.stringModifiers(s, map[string]bool{"nocase": true, "private": true}); err != nil {
+		return "", err
+	}
+	if flags != "" {
+		return fmt.Sprintf("(?%s)%s", flags, sb.String()), nil
+	}
+	return sb.String(), nil
+}
+
+// string returns the string of the current rule with the given identifier
+func (p *parser) string(id string) (*compiledString, error) {
+	for _, s := range p.rule.strings {
+		if s.id == id {
+			return s, nil
+		}
+	}
+	return nil, p.errorf("undefined string identifier: %s", id)
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *scanContext) bool { return l(c) || right(c) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *scanContext) bool { return l(c) && right(c) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptWord("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *scanContext) bool { return !e(c) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	if p.acceptPunct("(") {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectPunct(")")
+	}
+
+	p.skip()
+	if p.pos < len(p.src) && p.src[p.pos] == '$' {
+		id, err := p.stringID('$', false)
+		if err != nil {
+			return nil, err
+		}
+		s, err := p.string(id)
+		if err != nil {
+			return nil, err
+		}
+		if w := p.peekWord(); w == "at" || w == "in" {
+			return nil, p.errorf("string offsets are not supported")
+		}
+		return func(c *scanContext) bool { return c.matches(s) }, nil
+	}
+
+	switch word := p.peekWord(); word {
+	case "true", "false":
+		p.pos += len(word)
+		val := word == "true"
+		return func(*scanContext) bool { return val }, nil
+	case "any", "all", "none":
+		p.pos += len(word)
+		return p.parseOf(word, 0)
+	case "for":
+		return nil, p.errorf("for loops are not supported")
+	default:
+		if word != "" && word[0] >= '0' && word[0] <= '9' {
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			if p.acceptWord("of") {
+				p.pos -= len("of")
+				return p.parseOf("", n)
+			}
+			return p.parseComparison(func(*scanContext) int64 { return n })
+		}
+		if r := p.ruleset.rule(word); r != nil {
+			p.pos += len(word)
+			return func(c *scanContext) bool { return c.results[r.name] }, nil
+		}
+	}
+
+	left, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseComparison(left)
+}
+
+// parseOf parses a quantifier expression, e.g. "any of them", "2 of ($a, $b*)"
+func (p *parser) parseOf(quantifier string, n int64) (expr, error) {
+	if !p.acceptWord("of") {
+		return nil, p.errorf("expected 'of'")
+	}
+
+	var set []*compiledString
+	if p.acceptWord("them") {
+		set = p.rule.strings
+	} else {
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		for {
+			id, err := p.stringID('$', true)
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasSuffix(id, "*") {
+				prefix := strings.TrimSuffix(id, "*")
+				found := false
+				for _, s := range p.rule.strings {
+					if strings.HasPrefix(s.id, prefix) {
+						set = append(set, s)
+						found = true
+					}
+				}
+				if !found {
+					return nil, p.errorf("no strings match %s", id)
+				}
+			} else {
+				s, err := p.string(id)
+				if err != nil {
+					return nil, err
+				}
+				set = append(set, s)
+			}
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(set) == 0 {
+		return nil, p.errorf("rule %s has no strings", p.rule.name)
+	}
+
+	return func(c *scanContext) bool {
+		matched := int64(0)
+		for _, s := range set {
+			if c.matches(s) {
+				matched++
+			}
+		}
+		switch quantifier {
+		case "any":
+			return matched > 0
+		case "all":
+			return matched == int64(len(set))
+		case "none":
+			return matched == 0
+		default:
+			return matched >= n
+		}
+	}, nil
+}
+
+func (p *parser) parseNumber() (numExpr, error) {
+	p.skip()
+	if p.pos < len(p.src) && p.src[p.pos] == '#' {
+		id, err := p.stringID('#', false)
+		if err != nil {
+			return nil, err
+		}
+		s, err := p.string(id)
+		if err != nil {
+			return nil, err
+		}
+		return func(c *scanContext) int64 { return int64(c.count(s)) }, nil
+	}
+
+	word := p.peekWord()
+	switch word {
+	case "filesize":
+		p.pos += len(word)
+		return func(c *scanContext) int64 { return int64(len(c.raw)) }, nil
+	case "uint8", "uint16", "uint32", "uint16be", "uint32be":
+		p.pos += len(word)
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		offset, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		size := 1
+		if strings.HasPrefix(word, "uint16") {
+			size = 2
+		} else if strings.HasPrefix(word, "uint32") {
+			size = 4
+		}
+		bigEndian := strings.HasSuffix(word, "be")
+		return func(c *scanContext) int64 {
+			off := offset(c)
+			if off < 0 || off+int64(size) > int64(len(c.raw)) {
+				// out of bounds reads are undefined in yara, and never compare as equal
+				return -1
+			}
+			var v int64
+			for i := 0; i < size; i++ {
+				b := int64(c.raw[off+int64(i)])
+				if bigEndian {
+					v = v<<8 | b
+				} else {
+					v |= b << (8 * i)
+				}
+			}
+			return v
+		}, nil
+	}
+
+	n, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	return func(*scanContext) int64 { return n }, nil
+}
+
+func (p *parser) parseComparison(left numExpr) (expr, error) {
+	p.skip()
+	var op string
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.acceptPunct(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("expected a comparison operator")
+	}
+	right, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	return func(c *scanContext) bool {
+		l, r := left(c), right(c)
+		switch op {
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		case "<=":
+			return l <= r
+		case ">=":
+			return l >= r
+		case "<":
+			return l < r
+		default:
+			return l > r
+		}
+	}, nil
+}
@@ -0,0 +1,230 @@
+package yara
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleset_Scan(t *testing.T) {
+	elf := append([]byte("\x7fELF\x02\x01\x01\x00"), []byte("...Hello World... hello world\x00\x90\x90\x90\xcc")...)
+	testCases := []struct {
+		name            string
+		rules           string
+		data            []byte
+		expectedMatches []Match
+	}{
+		{
+			name: "text string",
+			rules: `
+rule hello : greeting test {
+	meta:
+		author = "tracee"
+		severity = 3
+	strings:
+		$a = "Hello World"
+	condition:
+		$a
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "hello", Tags: []string{"greeting", "test"}, Meta: map[string]string{"author": "tracee", "severity": "3"}, Strings: []string{"$a"}}},
+		},
+		{
+			name: "nocase and count",
+			rules: `
+rule hello {
+	strings:
+		$a = "hello world" nocase
+	condition:
+		#a == 2 and #a > 1
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "hello", Meta: map[string]string{}, Strings: []string{"$a"}}},
+		},
+		{
+			name: "no match",
+			rules: `
+rule hello {
+	strings:
+		$a = "goodbye"
+	condition:
+		$a
+}`,
+			data: elf,
+		},
+		{
+			name: "hex string with wildcards, jumps and alternatives",
+			rules: `
+rule shellcode {
+	strings:
+		$nops = { 90 90 ?? CC }
+		$jump = { 7F 45 [2-4] 01 ( 01 | 02 ) 0? }
+		$nibble = { ?F 45 4C }
+	condition:
+		all of them
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "shellcode", Meta: map[string]string{}, Strings: []string{"$nops", "$jump", "$nibble"}}},
+		},
+		{
+			name: "wide string",
+			rules: `
+rule wide {
+	strings:
+		$w = "abc" wide
+		$a = "abc" ascii wide
+	condition:
+		$w and $a
+}`,
+			data:            []byte("xa\x00b\x00c\x00x"),
+			expectedMatches: []Match{{Rule: "wide", Meta: map[string]string{}, Strings: []string{"$w", "$a"}}},
+		},
+		{
+			name: "regex and fullword",
+			rules: `
+rule re {
+	strings:
+		$re = /hel+o\s+w[a-z]+/i
+		$word = "world" fullword
+		$part = "wor" fullword
+	condition:
+		$re and $word and not $part
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "re", Meta: map[string]string{}, Strings: []string{"$re", "$word"}}},
+		},
+		{
+			name: "quantifiers and string sets",
+			rules: `
+rule any_of {
+	strings:
+		$s1 = "Hello"
+		$s2 = "missing"
+		$x = "ELF"
+	condition:
+		any of ($s*) and 2 of them and not all of them and none of ($s2)
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "any_of", Meta: map[string]string{}, Strings: []string{"$s1", "$x"}}},
+		},
+		{
+			name: "filesize, uint and rule references",
+			rules: `
+private rule is_elf {
+	condition:
+		uint32(0) == 0x464c457f and uint16be(0) == 0x7f45 and uint8(4) == 2
+}
+rule small_elf {
+	condition:
+		is_elf and filesize < 1KB and not (filesize > 100 or false)
+}
+rule big_elf {
+	condition:
+		is_elf and filesize >= 1MB
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "small_elf", Meta: map[string]string{}}},
+		},
+		{
+			name: "comments and private strings",
+			rules: `
+// a comment
+rule commented { /* another
+	comment */
+	strings:
+		$a = "Hello" private
+		$b = "\x7fELF"
+	condition:
+		$a and $b // trailing comment
+}`,
+			data:            elf,
+			expectedMatches: []Match{{Rule: "commented", Meta: map[string]string{}, Strings: []string{"$b"}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := &Ruleset{}
+			require.NoError(t, rs.compile(tc.rules))
+			assert.Equal(t, tc.expectedMatches, rs.Scan(tc.data))
+		})
+	}
+}
+
+func TestRuleset_compileErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rules         string
+		expectedError string
+	}{
+		{
+			name:          "imports",
+			rules:         `import "pe"`,
+			expectedError: "line 1: imports and includes are not supported",
+		},
+		{
+			name:          "undefined string",
+			rules:         "rule r {\n strings:\n $a = \"a\"\n condition:\n $b\n}",
+			expectedError: "line 5: undefined string identifier: $b",
+		},
+		{
+			name:          "duplicate rule",
+			rules:         "rule r { condition: true }\nrule r { condition: true }",
+			expectedError: "line 2: duplicate rule name: r",
+		},
+		{
+			name:          "unsupported modifier",
+			rules:         `rule r { strings: $a = "a" xor condition: $a }`,
+			expectedError: "line 1: string modifier xor is not supported for $a",
+		},
+		{
+			name:          "string offsets",
+			rules:         `rule r { strings: $a = "a" condition: $a at 0 }`,
+			expectedError: "line 1: string offsets are not supported",
+		},
+		{
+			name:          "missing condition",
+			rules:         `rule r { strings: $a = "a" }`,
+			expectedError: "line 1: expected 'condition'",
+		},
+		{
+			name:          "invalid hex string",
+			rules:         `rule r { strings: $a = { 4G } condition: $a }`,
+			expectedError: "line 1: invalid hex byte: 4G",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := &Ruleset{}
+			err := rs.compile(tc.rules)
+			require.Error(t, err)
+			assert.Equal(t, tc.expectedError, err.Error())
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadRules-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.yar"), []byte(`rule a { condition: true }`), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.yara"), []byte(`rule b { condition: a }`), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte(`not a rule`), 0640))
+
+	rs, err := LoadRules(dir)
+	require.NoError(t, err)
+	matches := rs.Scan(nil)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "a", matches[0].Rule)
+	assert.Equal(t, "b", matches[1].Rule)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.yar"), []byte(`rule c { condition: missing }`), 0640))
+	_, err = LoadRules(dir)
+	assert.EqualError(t, err, "c.yar: line 1: expected a number")
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+const (
+	// maxArtifactHashes is the max number of files whose hashes are cached. The least recently used hashes are evicted
+	// when it's full.
+	maxArtifactHashes = 4096
+	// artifactQueueSize is the max number of findings whose artifacts are resolved ahead of the output, and of the
+	// findings that wait for their evidence tarballs to be written
+	artifactQueueSize = 64
+)
+
+// artifactResolver attaches the files captured by tracee-ebpf (see tracee-ebpf --capture) to findings, and optionally
+// bundles them with the finding into an evidence tarball
+type artifactResolver struct {
+	capturePath string // tracee-ebpf capture output path, e.g. /tmp/tracee/out
+	evidenceDir string
+	hashes      map[string]*list.Element // path -> hash of the file, as long as it wasn't modified
+	hashesLRU   *list.List               // *artifactHash, the most recently used first
+}
+
+type artifactHash struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+func newArtifactResolver(capturePath string, evidenceDir string) (*artifactResolver, error) {
+	info, err := os.Stat(capturePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture dir: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid capture dir: %s is not a directory", capturePath)
+	}
+	if evidenceDir != "" {
+		if err := os.MkdirAll(evidenceDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating evidence dir: %v", err)
+		}
+	}
+	return &artifactResolver{
+		capturePath: capturePath,
+		evidenceDir: evidenceDir,
+		hashes:      make(map[string]*list.Element),
+		hashesLRU:   list.New(),
+	}, nil
+}
+
+// attach starts attaching the artifacts of the findings of in, and writing their evidence tarballs, so that hashing
+// the artifacts and writing the tarballs doesn't hold the output. It returns the findings with their artifacts, in the
+// order of in, and a channel that is closed once the evidence tarballs of all the findings were written.
+func (r *artifactResolver) attach(in <-chan types.Finding) (<-chan types.Finding, <-chan struct{}) {
+	out := make(chan types.Finding, artifactQueueSize)
+	evidence := make(chan types.Finding, artifactQueueSize)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for res := range evidence {
+			if _, err := r.writeEvidence(res); err != nil {
+				log.Printf("error writing evidence: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer close(out)
+		defer close(evidence)
+		for res := range in {
+			if event, ok := res.Context.(tracee.Event); ok {
+				res.Artifacts = r.resolve(event)
+				if r.evidenceDir != "" && len(res.Artifacts) > 0 {
+					evidence <- res
+				}
+			}
+			out <- res
+		}
+	}()
+	return out, written
+}
+
+// resolve returns the captured files that are related to the event of a finding
+func (r *artifactResolver) resolve(event tracee.Event) []types.Artifact {
+	var artifacts []types.Artifact
+	for _, path := range r.candidates(event) {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			// e.g. evicted by the capture retention
+			continue
+		}
+		sha, err := r.hash(path, info)
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, types.Artifact{Path: path, SHA256: sha, Size: info.Size()})
+	}
+	return artifacts
+}
+
+// candidates returns the paths that tracee-ebpf captures the artifacts of the given event to
+func (r *artifactResolver) candidates(event tracee.Event) []string {
+	mntDir := filepath.Join(r.capturePath, strconv.Itoa(event.MountNS))
+	args := make(map[string]interface{}, len(event.Args))
+	for _, arg := range event.Args {
+		args[arg.Name] = arg.Value
+	}
+
+	var paths []string
+	// artifact_scan_match events refer to the scanned artifact
+	if artifact, ok := args["artifact"].(string); ok && artifact != "" {
+		paths = append(paths, filepath.Join(r.capturePath, filepath.Clean("/"+artifact)))
+	}
+
+	// written files and kernel modules are captured by their device and inode, e.g. 4026531840/write.dev-1.inode-2
+	dev, devOk := argToUint(args["dev"])
+	inode, inodeOk := argToUint(args["inode"])
+	if devOk && inodeOk {
+		for _, prefix := range []string{"write", "module"} {
+			matches, _ := filepath.Glob(filepath.Join(mntDir, fmt.Sprintf("%s.dev-%d.inode-%d*", prefix, dev, inode)))
+			paths = append(paths, matches...)
+		}
+	}
+
+	switch event.EventName {
+	case "init_module":
+		// modules loaded from memory are captured by the pid that loaded them
+		matches, _ := filepath.Glob(filepath.Join(mntDir, fmt.Sprintf("module.pid-%d.*", event.HostProcessID)))
+		paths = append(paths, matches...)
+	case "sched_process_exec", "security_bprm_check", "execve", "execveat":
+		// executed files are captured as exec.<timestamp>.<name>, use the most recent capture
+		if pathname, ok := args["pathname"].(string); ok && pathname != "" {
+			if exec := latestExecCapture(mntDir, filepath.Base(pathname)); exec != "" {
+				paths = append(paths, exec)
+			}
+		}
+	}
+
+	// with the artifact store, the stored copy is available even if the mount namespace view isn't
+	if sha, ok := args["sha256"].(string); ok && sha != "" && len(paths) == 0 {
+		paths = append(paths, filepath.Join(r.capturePath, "sha256", filepath.Base(sha)))
+	}
+
+	sort.Strings(paths)
+	unique := paths[:0]
+	for i, path := range paths {
+		if i == 0 || path != paths[i-1] {
+			unique = append(unique, path)
+		}
+	}
+	return unique
+}
+
+// latestExecCapture returns the most recent capture of the executable with the given name, or an empty string
+func latestExecCapture(mntDir string, name string) string {
+	matches, _ := filepath.Glob(filepath.Join(mntDir, "exec.*."+name))
+	latest := ""
+	var latestTs uint64
+	for _, match := range matches {
+		parts := strings.SplitN(filepath.Base(match), ".", 3)
+		if len(parts) != 3 || parts[2] != name {
+			continue
+		}
+		ts, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if latest == "" || ts > latestTs {
+			latest, latestTs = match, ts
+		}
+	}
+	return latest
+}
+
+// argToUint returns the value of a numeric argument, which may have been decoded from json or gob
+func argToUint(val interface{}) (uint64, bool) {
+	switch v := val.(type) {
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int:
+		return uint64(v), true
+	case int64:
+		return uint64(v), true
+	case float64:
+		return uint64(v), true
+	case json.Number:
+		n, err := strconv.ParseUint(v.String(), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// hash returns the SHA256 of a file. It isn't safe for concurrent use.
+func (r *artifactResolver) hash(path string, info os.FileInfo) (string, error) {
+	if elem, ok := r.hashes[path]; ok {
+		h := elem.Value.(*artifactHash)
+		if h.size == info.Size() && h.modTime.Equal(info.ModTime()) {
+			r.hashesLRU.MoveToFront(elem)
+			return h.sha256, nil
+		}
+		r.hashesLRU.Remove(elem)
+		delete(r.hashes, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+	if r.hashesLRU.Len() >= maxArtifactHashes {
+		oldest := r.hashesLRU.Back()
+		r.hashesLRU.Remove(oldest)
+		delete(r.hashes, oldest.Value.(*artifactHash).path)
+	}
+	r.hashes[path] = r.hashesLRU.PushFront(&artifactHash{path: path, size: info.Size(), modTime: info.ModTime(), sha256: sha})
+	return sha, nil
+}
+
+// writeEvidence bundles a finding and its artifacts into <evidence dir>/<signature id>-<event timestamp>.tar.gz,
+// and returns the path of the tarball
+func (r *artifactResolver) writeEvidence(res types.Finding) (string, error) {
+	event, _ := res.Context.(tracee.Event)
+	base := filepath.Join(r.evidenceDir, fmt.Sprintf("%s-%d", res.SigMetadata.ID, event.Timestamp))
+	path := base + ".tar.gz"
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	for i := 1; os.IsExist(err); i++ {
+		path = fmt.Sprintf("%s-%d.tar.gz", base, i)
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	findingJSON, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "finding.json", Mode: 0640, Size: int64(len(findingJSON)), ModTime: time.Now()}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(findingJSON); err != nil {
+		return "", err
+	}
+	for _, a := range res.Artifacts {
+		if err := addArtifactToTar(tw, r.capturePath, a); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// addArtifactToTar adds an artifact to the tarball as artifacts/<path relative to the capture dir>
+func addArtifactToTar(tw *tar.Writer, capturePath string, a types.Artifact) error {
+	src, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	relPath, err := filepath.Rel(capturePath, a.Path)
+	if err != nil {
+		relPath = filepath.Base(a.Path)
+	}
+	hdr := &tar.Header{Name: filepath.ToSlash(filepath.Join("artifacts", relPath)), Mode: 0640, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, src, info.Size())
+	return err
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCapturedFile(t *testing.T, capturePath string, relPath string, content string) string {
+	path := filepath.Join(capturePath, relPath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0640))
+	return path
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestArtifactResolver_resolve(t *testing.T) {
+	capturePath, err := ioutil.TempDir("", "TestArtifactResolver-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(capturePath)
+
+	writeCapturedFile(t, capturePath, "1/exec.100.ls", "old ls")
+	latestLs := writeCapturedFile(t, capturePath, "1/exec.200.ls", "new ls")
+	writeCapturedFile(t, capturePath, "1/exec.300.x.ls", "another binary")
+	written := writeCapturedFile(t, capturePath, "1/write.dev-8.inode-42", "dropped")
+	writtenByPid := writeCapturedFile(t, capturePath, "1/write.dev-8.inode-42.pid-7", "dropped by pid")
+	module := writeCapturedFile(t, capturePath, "1/module.pid-1234.abcd", "module")
+	scanned := writeCapturedFile(t, capturePath, "2/bin.555", "unpacked")
+	stored := writeCapturedFile(t, capturePath, "sha256/"+sha256Hex("stored"), "stored")
+
+	r, err := newArtifactResolver(capturePath, "")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name              string
+		event             tracee.Event
+		expectedArtifacts []types.Artifact
+	}{
+		{
+			name: "executed file",
+			event: tracee.Event{
+				EventName: "sched_process_exec",
+				MountNS:   1,
+				Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/ls"}},
+			},
+			expectedArtifacts: []types.Artifact{{Path: latestLs, SHA256: sha256Hex("new ls"), Size: 6}},
+		},
+		{
+			name: "written file, with arguments decoded from json",
+			event: tracee.Event{
+				EventName: "magic_write",
+				MountNS:   1,
+				Args: []tracee.Argument{
+					{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/tmp/dropped"},
+					{ArgMeta: tracee.ArgMeta{Name: "dev"}, Value: float64(8)},
+					{ArgMeta: tracee.ArgMeta{Name: "inode"}, Value: float64(42)},
+				},
+			},
+			expectedArtifacts: []types.Artifact{
+				{Path: written, SHA256: sha256Hex("dropped"), Size: 7},
+				{Path: writtenByPid, SHA256: sha256Hex("dropped by pid"), Size: 14},
+			},
+		},
+		{
+			name: "written file in another mount namespace",
+			event: tracee.Event{
+				EventName: "magic_write",
+				MountNS:   2,
+				Args: []tracee.Argument{
+					{ArgMeta: tracee.ArgMeta{Name: "dev"}, Value: uint32(8)},
+					{ArgMeta: tracee.ArgMeta{Name: "inode"}, Value: uint64(42)},
+				},
+			},
+		},
+		{
+			name:              "module loaded from memory",
+			event:             tracee.Event{EventName: "init_module", MountNS: 1, HostProcessID: 1234},
+			expectedArtifacts: []types.Artifact{{Path: module, SHA256: sha256Hex("module"), Size: 6}},
+		},
+		{
+			name: "scanned artifact",
+			event: tracee.Event{
+				EventName: "artifact_scan_match",
+				MountNS:   2,
+				Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "artifact"}, Value: "2/bin.555"}},
+			},
+			expectedArtifacts: []types.Artifact{{Path: scanned, SHA256: sha256Hex("unpacked"), Size: 8}},
+		},
+		{
+			name: "scanned artifact outside of the capture dir",
+			event: tracee.Event{
+				EventName: "artifact_scan_match",
+				Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "artifact"}, Value: "../../etc/passwd"}},
+			},
+		},
+		{
+			name: "stored artifact",
+			event: tracee.Event{
+				EventName: "sched_process_exec",
+				MountNS:   3,
+				Args: []tracee.Argument{
+					{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/stored"},
+					{ArgMeta: tracee.ArgMeta{Name: "sha256"}, Value: sha256Hex("stored")},
+				},
+			},
+			expectedArtifacts: []types.Artifact{{Path: stored, SHA256: sha256Hex("stored"), Size: 6}},
+		},
+		{
+			name:  "no artifacts",
+			event: tracee.Event{EventName: "ptrace", MountNS: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedArtifacts, r.resolve(tc.event))
+		})
+	}
+}
+
+func TestArtifactResolver_writeEvidence(t *testing.T) {
+	capturePath, err := ioutil.TempDir("", "TestArtifactResolver-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(capturePath)
+	evidenceDir := filepath.Join(capturePath, "evidence")
+
+	r, err := newArtifactResolver(capturePath, evidenceDir)
+	require.NoError(t, err)
+	dropped := writeCapturedFile(t, capturePath, "1/write.dev-8.inode-42", "dropped")
+	finding := types.Finding{
+		Data:        map[string]interface{}{"file path": "/tmp/dropped"},
+		Context:     tracee.Event{Timestamp: 1000, EventName: "magic_write", MountNS: 1},
+		SigMetadata: types.SignatureMetadata{ID: "TRC-9"},
+		Artifacts:   []types.Artifact{{Path: dropped, SHA256: sha256Hex("dropped"), Size: 7}},
+	}
+
+	path, err := r.writeEvidence(finding)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(evidenceDir, "TRC-9-1000.tar.gz"), path)
+	// findings of the same event don't overwrite each other's evidence
+	path, err = r.writeEvidence(finding)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(evidenceDir, "TRC-9-1000-1.tar.gz"), path)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	contents := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		contents[hdr.Name] = string(b)
+	}
+	assert.Equal(t, "dropped", contents["artifacts/1/write.dev-8.inode-42"])
+	assert.Contains(t, contents["finding.json"], `"SHA256": "`+sha256Hex("dropped")+`"`)
+	assert.Contains(t, contents["finding.json"], `"file path": "/tmp/dropped"`)
+}
+
+func TestArtifactResolver_attach(t *testing.T) {
+	capturePath, err := ioutil.TempDir("", "TestArtifactResolver-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(capturePath)
+	evidenceDir := filepath.Join(capturePath, "evidence")
+
+	r, err := newArtifactResolver(capturePath, evidenceDir)
+	require.NoError(t, err)
+	written := writeCapturedFile(t, capturePath, "1/write.dev-8.inode-42", "dropped")
+	event := tracee.Event{
+		EventName: "magic_write",
+		MountNS:   1,
+		Args: []tracee.Argument{
+			{ArgMeta: tracee.ArgMeta{Name: "dev"}, Value: uint32(8)},
+			{ArgMeta: tracee.ArgMeta{Name: "inode"}, Value: uint64(42)},
+		},
+	}
+
+	in := make(chan types.Finding)
+	out, evidenceWritten := r.attach(in)
+	go func() {
+		for i := 0; i < 3; i++ {
+			event.Timestamp = i
+			in <- types.Finding{Context: event, SigMetadata: types.SignatureMetadata{ID: "TRC-9"}}
+		}
+		close(in)
+	}()
+	var timestamps []int
+	for res := range out {
+		timestamps = append(timestamps, res.Context.(tracee.Event).Timestamp)
+		assert.Equal(t, []types.Artifact{{Path: written, SHA256: sha256Hex("dropped"), Size: 7}}, res.Artifacts)
+	}
+	// the findings keep their order
+	assert.Equal(t, []int{0, 1, 2}, timestamps)
+
+	<-evidenceWritten
+	for i := 0; i < 3; i++ {
+		assert.FileExists(t, filepath.Join(evidenceDir, fmt.Sprintf("TRC-9-%d.tar.gz", i)))
+	}
+
+	// a modified file is hashed again
+	writeCapturedFile(t, capturePath, "1/write.dev-8.inode-42", "modified")
+	require.NoError(t, os.Chtimes(written, time.Now(), time.Now().Add(time.Hour)))
+	assert.Equal(t, sha256Hex("modified"), r.resolve(event)[0].SHA256)
+}
@@ -98,7 +98,7 @@ func BenchmarkEngineWithCodeInjectionSignature(b *testing.B) {
 				s, err := bc.sigFunc()
 				require.NoError(b, err, bc.name)
 
-				e, err := engine.NewEngine([]types.Signature{s}, inputs, output, os.Stderr, bc.preparedEvents)
+				e, err := engine.NewEngine([]types.Signature{s}, inputs, output, os.Stderr, bc.preparedEvents, nil)
 				require.NoError(b, err, "constructing engine")
 				b.StartTimer()
 
@@ -153,7 +153,7 @@ func BenchmarkEngineWithMultipleSignatures(b *testing.B) {
 				inputs := ProduceEventsInMemory(inputEventsCount)
 				output := make(chan types.Finding, inputEventsCount*len(sigs))
 
-				e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, bc.preparedEvents)
+				e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, bc.preparedEvents, nil)
 				require.NoError(b, err, "constructing engine")
 				b.StartTimer()
 
@@ -213,7 +213,7 @@ func BenchmarkEngineWithNSignatures(b *testing.B) {
 					b.StopTimer()
 					inputs := ProduceEventsInMemory(inputEventsCount)
 					output := make(chan types.Finding, inputEventsCount*len(sigs))
-					e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, false)
+					e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, false, nil)
 					require.NoError(b, err, "constructing engine")
 					b.StartTimer()
 
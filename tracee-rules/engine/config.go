@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// Config configures which signatures the engine loads, and the findings that they report.
+// Patterns are globs, where * matches any string and ? matches any character.
+type Config struct {
+	// Signatures enable or disable signatures, and override their severity. When a signature is selected by more than
+	// one item, the later items override the earlier ones. Signatures are enabled by default.
+	Signatures []SignatureConfig `json:"signatures"`
+	// Exceptions suppress the findings that they match
+	Exceptions []Exception `json:"exceptions"`
+	// Images resolves the images of the containers of the events for the exceptions. Without it, exceptions match the
+	// containerImage field of the data.
+	Images ContainerImages `json:"-"`
+}
+
+// SignatureSelector selects signatures by an ID pattern and a tag. An empty selector selects all signatures.
+type SignatureSelector struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag"`
+
+	id *regexp.Regexp
+}
+
+// SignatureConfig configures the signatures that it selects
+type SignatureConfig struct {
+	SignatureSelector
+	Enabled  *bool `json:"enabled"`
+	Severity *int  `json:"severity"`
+}
+
+// Exception suppresses the findings of the signatures that it selects, whose context and data match all of its
+// patterns. ContainerImage matches the image of the container of the event, or the containerImage field of the data if
+// the image can't be resolved.
+type Exception struct {
+	SignatureSelector
+	ProcessName    string            `json:"processName"`
+	ContainerID    string            `json:"containerId"`
+	ContainerImage string            `json:"containerImage"`
+	Data           map[string]string `json:"data"` // by field of the data
+
+	processName    *regexp.Regexp
+	containerID    *regexp.Regexp
+	containerImage *regexp.Regexp
+	data           map[string]*regexp.Regexp
+}
+
+// LoadConfig reads a YAML or JSON configuration file
+func LoadConfig(path string) (*Config, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	var config Config
+	if err := util.Unmarshal(bs, &config); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// compile compiles the patterns of the configuration
+func (c *Config) compile() error {
+	var err error
+	for i := range c.Signatures {
+		if err := c.Signatures[i].SignatureSelector.compile(); err != nil {
+			return fmt.Errorf("signatures[%d]: %w", i, err)
+		}
+	}
+	for i := range c.Exceptions {
+		e := &c.Exceptions[i]
+		if err := e.SignatureSelector.compile(); err != nil {
+			return fmt.Errorf("exceptions[%d]: %w", i, err)
+		}
+		if e.processName, err = compileGlob(e.ProcessName); err != nil {
+			return fmt.Errorf("exceptions[%d]: processName: %w", i, err)
+		}
+		if e.containerID, err = compileGlob(e.ContainerID); err != nil {
+			return fmt.Errorf("exceptions[%d]: containerId: %w", i, err)
+		}
+		if e.containerImage, err = compileGlob(e.ContainerImage); err != nil {
+			return fmt.Errorf("exceptions[%d]: containerImage: %w", i, err)
+		}
+		e.data = make(map[string]*regexp.Regexp)
+		for field, pattern := range e.Data {
+			if e.data[field], err = compileGlob(pattern); err != nil {
+				return fmt.Errorf("exceptions[%d]: data.%s: %w", i, field, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SignatureSelector) compile() error {
+	var err error
+	s.id, err = compileGlob(s.ID)
+	if err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+	return nil
+}
+
+// compileGlob compiles a glob pattern to a regular expression, nil if the pattern is empty
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, `.*`)
+	expr = strings.ReplaceAll(expr, `\?`, `.`)
+	return regexp.Compile("^" + expr + "$")
+}
+
+// matchGlob returns whether s matches a compiled pattern, where a nil pattern matches anything
+func matchGlob(re *regexp.Regexp, s string) bool {
+	return re == nil || re.MatchString(s)
+}
+
+func (s *SignatureSelector) matches(metadata types.SignatureMetadata) bool {
+	if !matchGlob(s.id, metadata.ID) {
+		return false
+	}
+	if s.Tag == "" {
+		return true
+	}
+	for _, tag := range metadata.Tags {
+		if tag == s.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled returns whether a signature is enabled
+func (c *Config) Enabled(metadata types.SignatureMetadata) bool {
+	enabled := true
+	if c == nil {
+		return enabled
+	}
+	for _, sc := range c.Signatures {
+		if sc.Enabled != nil && sc.matches(metadata) {
+			enabled = *sc.Enabled
+		}
+	}
+	return enabled
+}
+
+// severity returns the severity that overrides the severity of a signature, if any
+func (c *Config) severity(metadata types.SignatureMetadata) (int, bool) {
+	var severity *int
+	for _, sc := range c.Signatures {
+		if sc.Severity != nil && sc.matches(metadata) {
+			severity = sc.Severity
+		}
+	}
+	if severity == nil {
+		return 0, false
+	}
+	return *severity, true
+}
+
+func (e *Exception) matches(finding types.Finding, images ContainerImages) bool {
+	if !e.SignatureSelector.matches(finding.SigMetadata) {
+		return false
+	}
+	var event tracee.Event
+	var isEvent bool
+	switch v := finding.Context.(type) {
+	case tracee.Event:
+		event, isEvent = v, true
+	case ParsedEvent:
+		event, isEvent = v.Event, true
+	}
+	if e.processName != nil || e.containerID != nil {
+		if !isEvent || !matchGlob(e.processName, event.ProcessName) || !matchGlob(e.containerID, event.ContainerID) {
+			return false
+		}
+	}
+	if e.containerImage != nil {
+		image, ok := resolveImage(event, finding.Data, images)
+		if !ok || !e.containerImage.MatchString(image) {
+			return false
+		}
+	}
+	for field, re := range e.data {
+		if !matchData(re, finding.Data, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveImage returns the image of the container of an event, or the containerImage field of the data if it can't
+// be resolved
+func resolveImage(event tracee.Event, data map[string]interface{}, images ContainerImages) (string, bool) {
+	if images != nil && event.ContainerID != "" {
+		if image, ok := images.Image(event.ContainerID); ok {
+			return image, true
+		}
+	}
+	v, ok := data["containerImage"]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// matchData returns whether a field of the data of a finding matches a compiled pattern
+func matchData(re *regexp.Regexp, data map[string]interface{}, field string) bool {
+	v, ok := data[field]
+	return ok && re.MatchString(fmt.Sprint(v))
+}
+
+// Apply applies the configuration to a finding. It returns the finding with its severity overridden, and false if
+// the finding is suppressed.
+func (c *Config) Apply(finding types.Finding) (types.Finding, bool) {
+	if c == nil {
+		return finding, true
+	}
+	if !c.Enabled(finding.SigMetadata) {
+		return finding, false
+	}
+	for i := range c.Exceptions {
+		if c.Exceptions[i].matches(finding, c.Images) {
+			return finding, false
+		}
+	}
+	if severity, ok := c.severity(finding.SigMetadata); ok {
+		// the properties are shared by all the findings of the signature
+		properties := make(map[string]interface{}, len(finding.SigMetadata.Properties)+1)
+		for k, v := range finding.SigMetadata.Properties {
+			properties[k] = v
+		}
+		properties["Severity"] = severity
+		finding.SigMetadata.Properties = properties
+	}
+	return finding, true
+}
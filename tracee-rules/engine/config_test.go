@@ -0,0 +1,290 @@
+package engine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+signatures:
+  - tag: experimental
+    enabled: false
+  - id: TRC-EXP-2
+    enabled: true
+  - id: TRC-1*
+    severity: 1
+exceptions:
+  - id: TRC-2
+    processName: "apt*"
+  - containerId: trusted
+    containerImage: "docker.io/library/nginx:*"
+  - id: TRC-3
+    data:
+      pathname: /tmp/*
+      count: "1?"
+`
+
+func loadTestConfig(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return LoadConfig(path)
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	require.NoError(t, err)
+	require.Len(t, config.Signatures, 3)
+	assert.Equal(t, "experimental", config.Signatures[0].Tag)
+	require.NotNil(t, config.Signatures[2].Severity)
+	assert.Equal(t, 1, *config.Signatures[2].Severity)
+	require.Len(t, config.Exceptions, 3)
+	assert.Equal(t, map[string]string{"pathname": "/tmp/*", "count": "1?"}, config.Exceptions[2].Data)
+
+	_, err = loadTestConfig(t, "signatures:\n  - enabled: yes please\n")
+	assert.Error(t, err)
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestConfig_Enabled(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		metadata types.SignatureMetadata
+		enabled  bool
+	}{
+		{
+			name:     "enabled by default",
+			metadata: types.SignatureMetadata{ID: "TRC-2", Tags: []string{"linux"}},
+			enabled:  true,
+		},
+		{
+			name:     "disabled by tag",
+			metadata: types.SignatureMetadata{ID: "TRC-EXP-1", Tags: []string{"linux", "experimental"}},
+			enabled:  false,
+		},
+		{
+			name:     "enabled by a later ID",
+			metadata: types.SignatureMetadata{ID: "TRC-EXP-2", Tags: []string{"experimental"}},
+			enabled:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.enabled, config.Enabled(tc.metadata))
+		})
+	}
+
+	var nilConfig *Config
+	assert.True(t, nilConfig.Enabled(types.SignatureMetadata{ID: "TRC-EXP-1", Tags: []string{"experimental"}}))
+}
+
+func TestConfig_Apply(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		finding          types.Finding
+		suppressed       bool
+		expectedSeverity interface{}
+	}{
+		{
+			name: "severity override",
+			finding: types.Finding{
+				Context:     tracee.Event{ProcessName: "sh"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-12", Properties: map[string]interface{}{"Severity": 3}},
+			},
+			expectedSeverity: 1,
+		},
+		{
+			name: "no severity override",
+			finding: types.Finding{
+				Context:     tracee.Event{ProcessName: "sh"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-2", Properties: map[string]interface{}{"Severity": 3}},
+			},
+			expectedSeverity: 3,
+		},
+		{
+			name: "disabled signature",
+			finding: types.Finding{
+				Context:     tracee.Event{ProcessName: "sh"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-EXP-1", Tags: []string{"experimental"}},
+			},
+			suppressed: true,
+		},
+		{
+			name: "process name exception",
+			finding: types.Finding{
+				Context:     tracee.Event{ProcessName: "apt-get"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-2"},
+			},
+			suppressed: true,
+		},
+		{
+			name: "process name exception of a parsed event",
+			finding: types.Finding{
+				Context:     ParsedEvent{Event: tracee.Event{ProcessName: "apt-get"}},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-2"},
+			},
+			suppressed: true,
+		},
+		{
+			name: "process name exception of another signature",
+			finding: types.Finding{
+				Context:     tracee.Event{ProcessName: "apt-get"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+		},
+		{
+			name: "container exception",
+			finding: types.Finding{
+				Data:        map[string]interface{}{"containerImage": "docker.io/library/nginx:1.21"},
+				Context:     tracee.Event{ContainerID: "trusted"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+			suppressed: true,
+		},
+		{
+			name: "container exception with another image",
+			finding: types.Finding{
+				Data:        map[string]interface{}{"containerImage": "docker.io/library/redis:6"},
+				Context:     tracee.Event{ContainerID: "trusted"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+		},
+		{
+			name: "data exception",
+			finding: types.Finding{
+				Data:        map[string]interface{}{"pathname": "/tmp/a/b", "count": 12},
+				Context:     tracee.Event{},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-3"},
+			},
+			suppressed: true,
+		},
+		{
+			name: "data exception with a missing field",
+			finding: types.Finding{
+				Data:        map[string]interface{}{"pathname": "/tmp/a/b"},
+				Context:     tracee.Event{},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-3"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			finding, ok := config.Apply(tc.finding)
+			assert.Equal(t, !tc.suppressed, ok)
+			if ok {
+				assert.Equal(t, tc.expectedSeverity, finding.SigMetadata.Properties["Severity"])
+			}
+		})
+	}
+}
+
+type fakeContainerImages map[string]string
+
+func (f fakeContainerImages) Image(containerID string) (string, bool) {
+	image, ok := f[containerID]
+	return image, ok
+}
+
+func TestConfig_Apply_ContainerImages(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		images     fakeContainerImages
+		finding    types.Finding
+		suppressed bool
+	}{
+		{
+			name:   "image of the container",
+			images: fakeContainerImages{"trusted": "docker.io/library/nginx:1.21"},
+			finding: types.Finding{
+				Context:     tracee.Event{ContainerID: "trusted"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+			suppressed: true,
+		},
+		{
+			name:   "image of the container over the data",
+			images: fakeContainerImages{"trusted": "docker.io/library/nginx:1.21"},
+			finding: types.Finding{
+				Data:        map[string]interface{}{"containerImage": "docker.io/library/redis:6"},
+				Context:     ParsedEvent{Event: tracee.Event{ContainerID: "trusted"}},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+			suppressed: true,
+		},
+		{
+			name:   "another image of the container",
+			images: fakeContainerImages{"trusted": "docker.io/library/redis:6"},
+			finding: types.Finding{
+				Data:        map[string]interface{}{"containerImage": "docker.io/library/nginx:1.21"},
+				Context:     tracee.Event{ContainerID: "trusted"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+		},
+		{
+			name:   "unresolved image falls back to the data",
+			images: fakeContainerImages{},
+			finding: types.Finding{
+				Data:        map[string]interface{}{"containerImage": "docker.io/library/nginx:1.21"},
+				Context:     tracee.Event{ContainerID: "trusted"},
+				SigMetadata: types.SignatureMetadata{ID: "TRC-4"},
+			},
+			suppressed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Images = tc.images
+			_, ok := config.Apply(tc.finding)
+			assert.Equal(t, !tc.suppressed, ok)
+		})
+	}
+}
+
+func TestNewEngine_Config(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	require.NoError(t, err)
+	selectedEvents := func() ([]types.SignatureEventSelector, error) {
+		return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+	}
+	enabled := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1"}, nil
+		},
+		getSelectedEvents: selectedEvents,
+	}
+	disabled := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-EXP-1", Tags: []string{"experimental"}}, nil
+		},
+		getSelectedEvents: selectedEvents,
+	}
+	logger := bytes.Buffer{}
+	e, err := NewEngine([]types.Signature{enabled, disabled}, EventSources{Tracee: make(chan types.Event)}, make(chan types.Finding), &logger, false, config)
+	require.NoError(t, err)
+	assert.Len(t, e.signatures, 1)
+	assert.Contains(t, e.signatures, types.Signature(enabled))
+	assert.Contains(t, logger.String(), "signature TRC-EXP-1 is disabled by the configuration")
+
+	_, err = e.LoadSignature(disabled)
+	assert.EqualError(t, err, "signature TRC-EXP-1 is disabled by the configuration")
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDockerSocket is the default path of the socket of the docker daemon
+	DefaultDockerSocket = "/var/run/docker.sock"
+	// containerImagesMaxEntries is the max number of containers whose images are cached
+	containerImagesMaxEntries = 4096
+	dockerRequestTimeout      = time.Second
+	// containerImagesFailureTTL is how long a container that couldn't be resolved isn't queried again, e.g. since it
+	// was just created, or the docker daemon was restarting
+	containerImagesFailureTTL = 10 * time.Second
+)
+
+// ContainerImages resolves the image of a container by its ID
+type ContainerImages interface {
+	// Image returns the image of a container, and false if it can't be resolved
+	Image(containerID string) (string, bool)
+}
+
+type containerImage struct {
+	containerID string
+	image       string
+	ok          bool
+	expires     time.Time // of a container that couldn't be resolved
+}
+
+// DockerImages resolves the images of containers from the docker daemon. The images are cached, since the image of a
+// container doesn't change. The containers that couldn't be resolved are queried again after
+// containerImagesFailureTTL, so that a failing daemon delays the findings of a container at most once per TTL.
+type DockerImages struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // *containerImage, the most recently used first
+}
+
+// NewDockerImages returns a DockerImages that queries the docker daemon through its unix socket
+func NewDockerImages(socket string) *DockerImages {
+	return &DockerImages{
+		client: &http.Client{
+			Timeout: dockerRequestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Image implements the ContainerImages interface
+func (d *DockerImages) Image(containerID string) (string, bool) {
+	d.mu.Lock()
+	if elem, ok := d.entries[containerID]; ok {
+		entry := elem.Value.(*containerImage)
+		if entry.ok || d.now().Before(entry.expires) {
+			d.lru.MoveToFront(elem)
+			d.mu.Unlock()
+			return entry.image, entry.ok
+		}
+	}
+	d.mu.Unlock()
+
+	image, err := d.inspect(containerID)
+	entry := &containerImage{containerID: containerID, image: image, ok: err == nil}
+	if !entry.ok {
+		entry.expires = d.now().Add(containerImagesFailureTTL)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if elem, ok := d.entries[containerID]; ok {
+		// replace the expired failure, unless the container was resolved meanwhile
+		if !elem.Value.(*containerImage).ok {
+			elem.Value = entry
+		}
+		d.lru.MoveToFront(elem)
+	} else {
+		if d.lru.Len() >= containerImagesMaxEntries {
+			oldest := d.lru.Back()
+			d.lru.Remove(oldest)
+			delete(d.entries, oldest.Value.(*containerImage).containerID)
+		}
+		d.entries[containerID] = d.lru.PushFront(entry)
+	}
+	return entry.image, entry.ok
+}
+
+// inspect returns the normalized image of a container from the docker daemon
+func (d *DockerImages) inspect(containerID string) (string, error) {
+	resp, err := d.client.Get("http://docker/containers/" + url.PathEscape(containerID) + "/json")
+	if err != nil {
+		return "", fmt.Errorf("inspecting container %s: %w", containerID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("inspecting container %s: %s", containerID, resp.Status)
+	}
+	var container struct {
+		Config struct {
+			Image string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
+		return "", fmt.Errorf("inspecting container %s: %w", containerID, err)
+	}
+	if container.Config.Image == "" {
+		return "", fmt.Errorf("inspecting container %s: no image", containerID)
+	}
+	return normalizeImage(container.Config.Image), nil
+}
+
+// normalizeImage returns the fully qualified reference of an image, e.g. docker.io/library/nginx:latest for nginx
+func normalizeImage(image string) string {
+	if i := strings.IndexByte(image, '/'); i < 0 {
+		image = "docker.io/library/" + image
+	} else if domain := image[:i]; !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		image = "docker.io/" + image
+	}
+	// images referenced by digest have no tag
+	if strings.Contains(image, "@") {
+		return image
+	}
+	if i := strings.LastIndexByte(image, '/'); !strings.Contains(image[i+1:], ":") {
+		image += ":latest"
+	}
+	return image
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerImages(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	var requests int32
+	var created int32
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch {
+		case r.URL.Path == "/containers/abc/json":
+			_, _ = w.Write([]byte(`{"Id": "abc", "Config": {"Image": "nginx"}}`))
+		case r.URL.Path == "/containers/new/json" && atomic.LoadInt32(&created) == 1:
+			_, _ = w.Write([]byte(`{"Id": "new", "Config": {"Image": "redis"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+	go server.Serve(l)
+	defer server.Close()
+
+	now := time.Unix(1000, 0)
+	images := NewDockerImages(socket)
+	images.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		image, ok := images.Image("abc")
+		assert.True(t, ok)
+		assert.Equal(t, "docker.io/library/nginx:latest", image)
+		_, ok = images.Image("new")
+		assert.False(t, ok)
+	}
+	// the images are cached, and so are the failures for a while
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the containers that couldn't be resolved are queried again after the TTL
+	atomic.StoreInt32(&created, 1)
+	now = now.Add(containerImagesFailureTTL)
+	for i := 0; i < 2; i++ {
+		image, ok := images.Image("new")
+		assert.True(t, ok)
+		assert.Equal(t, "docker.io/library/redis:latest", image)
+	}
+	_, ok := images.Image("abc")
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestNormalizeImage(t *testing.T) {
+	testCases := map[string]string{
+		"nginx":                         "docker.io/library/nginx:latest",
+		"nginx:1.21":                    "docker.io/library/nginx:1.21",
+		"aquasec/tracee:0.6.0":          "docker.io/aquasec/tracee:0.6.0",
+		"quay.io/org/app":               "quay.io/org/app:latest",
+		"localhost:5000/app:1":          "localhost:5000/app:1",
+		"localhost/app":                 "localhost/app:latest",
+		"nginx@sha256:0123456789abcdef": "docker.io/library/nginx@sha256:0123456789abcdef",
+	}
+	for image, expected := range testCases {
+		assert.Equal(t, expected, normalizeImage(image), image)
+	}
+}
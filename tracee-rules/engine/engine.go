@@ -8,8 +8,11 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/mitre"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 	"github.com/open-policy-agent/opa/ast"
 )
@@ -19,6 +22,9 @@ const EVENT_CONTAINER_ORIGIN = "container"
 const EVENT_HOST_ORIGIN = "host"
 const ALL_EVENT_TYPES = "*"
 
+// DefaultDrainTimeout is the default time that signatures have to handle their pending events when the engine stops
+const DefaultDrainTimeout = 5 * time.Second
+
 // Engine is a rule-engine that can process events coming from a set of input sources against a set of loaded signatures, and report the signatures' findings
 type Engine struct {
 	logger          log.Logger
@@ -27,8 +33,37 @@ type Engine struct {
 	signaturesMutex sync.RWMutex
 	inputs          EventSources
 	output          chan types.Finding
-	waitGroup       sync.WaitGroup
+	finished        map[types.Signature]chan struct{} // closed when the goroutine of a signature exits
 	parsedEvents    bool
+	config          *Config
+	drainTimeout    time.Duration
+	outputMutex     sync.RWMutex
+	stopped         bool // findings aren't reported to the output once the engine stopped
+	events          int64
+	findings        int64
+	clock           int // the latest timestamp of the events, which drives the ticks
+	tickers         map[types.Signature]*ticker
+	reorderDelay    time.Duration
+	lateEvents      int64
+}
+
+// ticker schedules the SignalTick signals of a signature
+type ticker struct {
+	interval int // nanoseconds, like the timestamps of events
+	next     int // the time of the next tick, 0 until the first event
+}
+
+// signal is sent to a signature through its events channel, so that it's handled in order with the events
+type signal struct {
+	types.Signal
+}
+
+// Stats summarizes the work of the engine, when it stops
+type Stats struct {
+	Events   int64 // the events that were read from the input sources
+	Findings int64 // the findings that were reported to the output
+	Drained  bool  // whether the signatures handled all of their events before the drain timeout
+	Late     int64 // the events that were dropped since they arrived after the reorder delay
 }
 
 //EventSources is a bundle of input sources used to configure the Engine
@@ -38,20 +73,25 @@ type EventSources struct {
 
 // NewEngine creates a new rules-engine with the given arguments
 // inputs and outputs are given as channels created by the consumer
-func NewEngine(sigs []types.Signature, sources EventSources, output chan types.Finding, logWriter io.Writer, parsedEvents bool) (*Engine, error) {
+// config is optional, and configures the loaded signatures and their findings
+func NewEngine(sigs []types.Signature, sources EventSources, output chan types.Finding, logWriter io.Writer, parsedEvents bool, config *Config) (*Engine, error) {
 	if sources.Tracee == nil || output == nil || logWriter == nil {
 		return nil, fmt.Errorf("nil input received")
 	}
 	engine := Engine{}
-	engine.waitGroup = sync.WaitGroup{}
+	engine.config = config
 	engine.logger = *log.New(logWriter, "", 0)
 	engine.inputs = sources
 	engine.output = output
 	engine.parsedEvents = parsedEvents
+	engine.drainTimeout = DefaultDrainTimeout
 	engine.signaturesMutex.Lock()
 	engine.signatures = make(map[types.Signature]chan types.Event)
 	engine.signaturesIndex = make(map[types.SignatureEventSelector][]types.Signature)
+	engine.tickers = make(map[types.Signature]*ticker)
+	engine.finished = make(map[types.Signature]chan struct{})
 	engine.signaturesMutex.Unlock()
+	sigs = engine.loadableSignatures(sigs)
 	for _, sig := range sigs {
 		engine.signaturesMutex.Lock()
 		engine.signatures[sig] = make(chan types.Event)
@@ -61,6 +101,9 @@ func NewEngine(sigs []types.Signature, sources EventSources, output chan types.F
 			engine.logger.Printf("error getting metadata: %v", err)
 			continue
 		}
+		engine.signaturesMutex.Lock()
+		engine.addTicker(sig, meta)
+		engine.signaturesMutex.Unlock()
 		se, err := sig.GetSelectedEvents()
 		if err != nil {
 			engine.logger.Printf("error getting selected events for signature %s: %v", meta.Name, err)
@@ -96,57 +139,290 @@ func NewEngine(sigs []types.Signature, sources EventSources, output chan types.F
 	return &engine, nil
 }
 
+// loadableSignatures returns the signatures that can be loaded: their MITRE ATT&CK mapping is valid, and the
+// configuration doesn't disable them
+func (engine *Engine) loadableSignatures(sigs []types.Signature) []types.Signature {
+	var res []types.Signature
+	for _, sig := range sigs {
+		meta, err := sig.GetMetadata()
+		if err == nil {
+			if err := engine.checkSignature(meta); err != nil {
+				engine.logger.Print(err)
+				continue
+			}
+		}
+		if group, ok := sig.(types.SignatureGroup); ok && !engine.loadableGroupSignatures(group) {
+			continue
+		}
+		res = append(res, sig)
+	}
+	return res
+}
+
+// checkSignature returns an error if a signature can't be loaded
+func (engine *Engine) checkSignature(meta types.SignatureMetadata) error {
+	if err := mitre.Validate(meta.Mitre); err != nil {
+		return fmt.Errorf("signature %s has an invalid MITRE ATT&CK mapping: %w", meta.ID, err)
+	}
+	if !engine.config.Enabled(meta) {
+		return fmt.Errorf("signature %s is disabled by the configuration", meta.ID)
+	}
+	return nil
+}
+
+// loadableGroupSignatures removes the signatures that can't be loaded from a group, and returns whether any
+// signature is left in the group
+func (engine *Engine) loadableGroupSignatures(group types.SignatureGroup) bool {
+	metas, err := group.GetSignaturesMetadata()
+	if err != nil {
+		engine.logger.Printf("error getting metadata of signature group: %v", err)
+		return true
+	}
+	loadable := 0
+	for _, meta := range metas {
+		checkErr := engine.checkSignature(meta)
+		if checkErr == nil {
+			loadable++
+			continue
+		}
+		if err := group.RemoveSignature(meta.ID); err != nil {
+			engine.logger.Printf("error removing signature %s: %v", meta.ID, err)
+			loadable++
+			continue
+		}
+		engine.logger.Print(checkErr)
+	}
+	return loadable > 0
+}
+
+// SetReorderDelay enables the reordering of events by their timestamps, before they are dispatched to the
+// signatures. Events are buffered until they are delay older than the latest event, so signatures receive them in
+// the order of their timestamps, and the events that arrive later than that are dropped. The signatures are signaled
+// the watermark (see types.SignalWatermark) as it advances, and their ticks are driven by it.
+// It must be called before Start
+func (engine *Engine) SetReorderDelay(delay time.Duration) {
+	engine.reorderDelay = delay
+}
+
+// SetDrainTimeout sets the time that signatures have to handle their pending events when the engine stops
+func (engine *Engine) SetDrainTimeout(timeout time.Duration) {
+	engine.drainTimeout = timeout
+}
+
+// startSignature starts the goroutine of a signature. The lock must be held.
+func (engine *Engine) startSignature(signature types.Signature, c chan types.Event) {
+	finished := make(chan struct{})
+	engine.finished[signature] = finished
+	go signatureStart(signature, c, finished)
+}
+
 // signatureStart is the signature handling business logics.
-func signatureStart(signature types.Signature, c chan types.Event, wg *sync.WaitGroup) {
-	wg.Add(1)
+// it closes finished once c is closed and all of its events were handled
+func signatureStart(signature types.Signature, c chan types.Event, finished chan struct{}) {
 	for e := range c {
-		if err := signature.OnEvent(e); err != nil {
-			meta, _ := signature.GetMetadata()
-			log.Printf("error handling event by signature %s: %v", meta.Name, err)
+		var err error
+		if s, ok := e.(signal); ok {
+			err = signature.OnSignal(s.Signal)
+		} else {
+			err = signature.OnEvent(e)
+		}
+		if err != nil {
+			logSignatureError(signature, err)
+		}
+	}
+	close(finished)
+}
+
+// addTicker schedules the ticks of a signature, if it declares a tick interval. The lock must be held.
+func (engine *Engine) addTicker(sig types.Signature, meta types.SignatureMetadata) {
+	if meta.TickInterval > 0 {
+		engine.tickers[sig] = &ticker{interval: int(meta.TickInterval)}
+	}
+}
+
+// tick advances the clock to the timestamp of an event, or to the watermark when events are reordered, and signals the signatures whose ticks are due, before the
+// event is dispatched to them. The first event starts the ticks of a signature, at the multiples of its interval.
+// Events that are older than the clock don't move it. The read lock must be held.
+func (engine *Engine) tick(timestamp int) {
+	if timestamp <= engine.clock {
+		return
+	}
+	engine.clock = timestamp
+	for sig, t := range engine.tickers {
+		if t.next == 0 {
+			t.next = timestamp - timestamp%t.interval + t.interval
+			continue
+		}
+		if timestamp < t.next {
+			continue
 		}
+		// ticks that are due together are sent as the latest of them
+		at := timestamp - (timestamp-t.next)%t.interval
+		engine.signatures[sig] <- signal{types.SignalTick{Timestamp: at}}
+		t.next = at + t.interval
+	}
+}
+
+// signalSource signals the signatures that select the events of an input source. The read lock must be held.
+func (engine *Engine) signalSource(source string, s types.Signal) {
+	for sig, c := range engine.signatures {
+		se, err := sig.GetSelectedEvents()
+		if err != nil {
+			engine.logger.Printf("error getting selected events: %v", err)
+			continue
+		}
+		for _, sel := range se {
+			if sel.Source == source {
+				c <- signal{s}
+				break
+			}
+		}
+	}
+}
+
+// signalAll signals all of the signatures. The read lock must be held.
+func (engine *Engine) signalAll(s types.Signal) {
+	for _, c := range engine.signatures {
+		c <- signal{s}
+	}
+}
+
+// logSignatureError logs an error of a signature, where the errors of a group are attributed to the signatures of the
+// group that they are of
+func logSignatureError(signature types.Signature, err error) {
+	var sigErrs types.SignatureErrors
+	var sigErr types.SignatureError
+	switch {
+	case errors.As(err, &sigErrs):
+		for _, sigErr := range sigErrs {
+			log.Printf("error handling event by signature %s: %v", sigErr.ID, sigErr.Err)
+		}
+	case errors.As(err, &sigErr):
+		log.Printf("error handling event by signature %s: %v", sigErr.ID, sigErr.Err)
+	default:
+		meta, _ := signature.GetMetadata()
+		log.Printf("error handling event by signature %s: %v", meta.Name, err)
 	}
-	wg.Done()
 }
 
 // Start starts processing events and detecting signatures
-// it runs continuously until stopped by the done channel
-// once done, it cleans all internal resources, which means the engine is not reusable
+// it runs continuously until stopped by the done channel, or until the input sources end
+// once done, it stops reading the input sources and shuts the signatures down (see shutdown), which means the engine
+// is not reusable, and it returns the stats of the engine. no finding is reported to the output after it returns
 // note that the input and output channels are created by the consumer and therefore are not closed
-func (engine *Engine) Start(done chan bool) {
-	defer engine.unloadAllSignatures()
-	engine.signaturesMutex.RLock()
+func (engine *Engine) Start(done chan bool) Stats {
+	engine.signaturesMutex.Lock()
 	for s, c := range engine.signatures {
-		go signatureStart(s, c, &engine.waitGroup)
+		engine.startSignature(s, c)
+	}
+	engine.signalSource("tracee", types.SignalSourceStart("tracee"))
+	engine.signaturesMutex.Unlock()
+	if engine.reorderDelay > 0 {
+		// the reorder stage is drained into the signatures before they are shut down, so consumeSources returns
+		// once it was drained rather than on done
+		drain := make(chan struct{})
+		consumed := make(chan struct{})
+		engine.inputs.Tracee = engine.reorder(engine.inputs.Tracee, drain)
+		go func() {
+			select {
+			case <-done:
+				close(drain)
+			case <-consumed:
+			}
+		}()
+		engine.consumeSources(nil)
+		close(consumed)
+	} else {
+		engine.consumeSources(done)
+	}
+	drained := engine.shutdown()
+
+	engine.outputMutex.Lock()
+	engine.stopped = true
+	engine.outputMutex.Unlock()
+	return Stats{
+		Events:   atomic.LoadInt64(&engine.events),
+		Findings: atomic.LoadInt64(&engine.findings),
+		Drained:  drained,
+		Late:     atomic.LoadInt64(&engine.lateEvents),
 	}
-	engine.signaturesMutex.RUnlock()
-	engine.consumeSources(done)
 }
 
-func (engine *Engine) unloadAllSignatures() {
+// shutdown unloads all signatures: it sends them the shutdown signal after the events that were dispatched to them, so
+// that they report their pending findings, and closes them once they handled it. it waits up to the drain timeout for
+// the signatures to stop, and returns whether all of them stopped in time. signatures that didn't stop in time are
+// closed once they do
+func (engine *Engine) shutdown() bool {
 	engine.signaturesMutex.Lock()
-	defer engine.signaturesMutex.Unlock()
+	stopped := make(map[types.Signature]chan struct{}, len(engine.signatures))
 	for sig, c := range engine.signatures {
-		sig.Close()
-		close(c)
-		delete(engine.signatures, sig)
+		stopped[sig] = make(chan struct{})
+		go stopSignature(sig, c, engine.finished[sig], stopped[sig])
 	}
+	engine.signatures = make(map[types.Signature]chan types.Event)
 	engine.signaturesIndex = make(map[types.SignatureEventSelector][]types.Signature)
+	engine.tickers = make(map[types.Signature]*ticker)
+	engine.finished = make(map[types.Signature]chan struct{})
+	engine.signaturesMutex.Unlock()
+
+	timer := time.NewTimer(engine.drainTimeout)
+	defer timer.Stop()
+	expired := false
+	drained := true
+	for sig, s := range stopped {
+		if !expired {
+			select {
+			case <-s:
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-s:
+		default:
+			meta, _ := sig.GetMetadata()
+			engine.logger.Printf("signature %s didn't handle its pending events within %s", meta.ID, engine.drainTimeout)
+			drained = false
+		}
+	}
+	return drained
+}
+
+// stopSignature sends the shutdown signal to a signature through its goroutine, closes its channel, and closes the
+// signature once the goroutine finished. it closes stopped when done
+func stopSignature(signature types.Signature, c chan types.Event, finished chan struct{}, stopped chan struct{}) {
+	c <- signal{types.SignalShutdown{}}
+	close(c)
+	<-finished
+	signature.Close()
+	close(stopped)
 }
 
 // matchHandler is a function that runs when a signature is matched
+// the configuration is applied to the finding, and it is enriched with the MITRE ATT&CK mapping of its signature
+// before it is reported
 func (engine *Engine) matchHandler(res types.Finding) {
+	res, ok := engine.config.Apply(res)
+	if !ok {
+		return
+	}
+	if res.Mitre == nil {
+		res.Mitre = mitre.Resolve(res.SigMetadata.Mitre)
+	}
+	engine.outputMutex.RLock()
+	defer engine.outputMutex.RUnlock()
+	if engine.stopped {
+		return
+	}
 	engine.output <- res
+	atomic.AddInt64(&engine.findings, 1)
 }
 
 // checkCompletion is a function that runs at the end of each input source
 // closing tracee-rules if no more pending input sources exists
 func (engine *Engine) checkCompletion() bool {
-	if engine.inputs.Tracee == nil {
-		engine.unloadAllSignatures()
-		engine.waitGroup.Wait()
-		return true
-	}
-	return false
+	return engine.inputs.Tracee == nil
 }
 
 // consumeSources starts consuming the input sources
@@ -157,25 +433,24 @@ func (engine *Engine) consumeSources(done <-chan bool) {
 		case event, ok := <-engine.inputs.Tracee:
 			if !ok {
 				engine.signaturesMutex.RLock()
-				for sig := range engine.signatures {
-					se, err := sig.GetSelectedEvents()
-					if err != nil {
-						engine.logger.Printf("error getting selected events: %v", err)
-						continue
-					}
-					for _, sel := range se {
-						if sel.Source == "tracee" {
-							_ = sig.OnSignal(types.SignalSourceComplete("tracee"))
-							break
-						}
-					}
-				}
+				engine.signalSource("tracee", types.SignalSourceComplete("tracee"))
 				engine.signaturesMutex.RUnlock()
 				engine.inputs.Tracee = nil
 				if engine.checkCompletion() {
 					return
 				}
 			} else if event != nil {
+				switch v := event.(type) {
+				case watermark:
+					engine.signaturesMutex.RLock()
+					engine.tick(int(v))
+					engine.signalAll(types.SignalWatermark{Timestamp: int(v)})
+					engine.signaturesMutex.RUnlock()
+					continue
+				case reorderDrained:
+					return
+				}
+				atomic.AddInt64(&engine.events, 1)
 				engine.signaturesMutex.RLock()
 				traceeEvt, ok := event.(tracee.Event)
 				if !ok {
@@ -183,6 +458,10 @@ func (engine *Engine) consumeSources(done <-chan bool) {
 					engine.signaturesMutex.RUnlock()
 					continue
 				}
+				// when events are reordered, the ticks are driven by the watermark instead
+				if engine.reorderDelay == 0 {
+					engine.tick(traceeEvt.Timestamp)
+				}
 
 				eventOrigin := analyzeEventOrigin(traceeEvt)
 				for _, s := range engine.signaturesIndex[types.SignatureEventSelector{Source: "tracee", Name: traceeEvt.EventName, Origin: eventOrigin}] {
@@ -231,6 +510,9 @@ func (engine *Engine) LoadSignature(signature types.Signature) (string, error) {
 		return "", fmt.Errorf("failed to store signature: %w", err)
 	}
 	metadata, _ := signature.GetMetadata()
+	if err := engine.checkSignature(metadata); err != nil {
+		return "", err
+	}
 	// insert in engine.signatures map
 	engine.signaturesMutex.Lock()
 	defer engine.signaturesMutex.Unlock()
@@ -240,6 +522,7 @@ func (engine *Engine) LoadSignature(signature types.Signature) (string, error) {
 	}
 	c := make(chan types.Event)
 	engine.signatures[signature] = c
+	engine.addTicker(signature, metadata)
 
 	// insert in engine.signaturesIndex map
 	for _, selectedEvent := range selectedEvents {
@@ -259,7 +542,7 @@ func (engine *Engine) LoadSignature(signature types.Signature) (string, error) {
 		engine.logger.Printf("error initializing signature %s: %v", metadata.Name, err)
 
 	}
-	go signatureStart(signature, c, &engine.waitGroup)
+	engine.startSignature(signature, c)
 	return metadata.ID, nil
 }
 
@@ -276,7 +559,7 @@ func (engine *Engine) UnloadSignature(signatureId string) error {
 	}
 	engine.signaturesMutex.RUnlock()
 	if signature == nil {
-		return fmt.Errorf("could not find signature with ID: %v", signatureId)
+		return engine.unloadGroupSignature(signatureId)
 	}
 	selectedEvents, err := signature.GetSelectedEvents()
 	if err != nil {
@@ -288,6 +571,8 @@ func (engine *Engine) UnloadSignature(signatureId string) error {
 	c, ok := engine.signatures[signature]
 	if ok {
 		delete(engine.signatures, signature)
+		delete(engine.tickers, signature)
+		delete(engine.finished, signature)
 		defer signature.Close()
 		defer close(c)
 	}
@@ -307,6 +592,92 @@ func (engine *Engine) UnloadSignature(signatureId string) error {
 	return nil
 }
 
+// unloadGroupSignature removes a signature from the group that it is in, and unloads the group if no signature is
+// left in it
+func (engine *Engine) unloadGroupSignature(signatureId string) error {
+	var group types.SignatureGroup
+	engine.signaturesMutex.RLock()
+	for sig := range engine.signatures {
+		g, ok := sig.(types.SignatureGroup)
+		if !ok {
+			continue
+		}
+		metas, _ := g.GetSignaturesMetadata()
+		for _, meta := range metas {
+			if meta.ID == signatureId {
+				group = g
+				break
+			}
+		}
+	}
+	engine.signaturesMutex.RUnlock()
+	if group == nil {
+		return fmt.Errorf("could not find signature with ID: %v", signatureId)
+	}
+	if err := group.RemoveSignature(signatureId); err != nil {
+		return fmt.Errorf("failed to unload signature: %w", err)
+	}
+
+	engine.signaturesMutex.Lock()
+	defer engine.signaturesMutex.Unlock()
+	if err := engine.reindexSignature(group); err != nil {
+		return fmt.Errorf("failed to unload signature: %w", err)
+	}
+	if metas, err := group.GetSignaturesMetadata(); err == nil && len(metas) == 0 {
+		if c, ok := engine.signatures[group]; ok {
+			delete(engine.signatures, group)
+			delete(engine.tickers, group)
+			delete(engine.finished, group)
+			defer group.Close()
+			defer close(c)
+		}
+	}
+	return nil
+}
+
+// ReindexSignature updates the selected events of a loaded signature, e.g. after the signatures of a group changed
+func (engine *Engine) ReindexSignature(signature types.Signature) error {
+	engine.signaturesMutex.Lock()
+	defer engine.signaturesMutex.Unlock()
+	if _, ok := engine.signatures[signature]; !ok {
+		return fmt.Errorf("signature isn't loaded")
+	}
+	return engine.reindexSignature(signature)
+}
+
+// reindexSignature replaces the selected events of a signature in the index. The lock must be held.
+func (engine *Engine) reindexSignature(signature types.Signature) error {
+	selectedEvents, err := signature.GetSelectedEvents()
+	if err != nil {
+		return err
+	}
+	for selectedEvent, signatures := range engine.signaturesIndex {
+		var res []types.Signature
+		for _, sig := range signatures {
+			if sig != signature {
+				res = append(res, sig)
+			}
+		}
+		if len(res) == 0 {
+			delete(engine.signaturesIndex, selectedEvent)
+		} else {
+			engine.signaturesIndex[selectedEvent] = res
+		}
+	}
+	for _, selectedEvent := range selectedEvents {
+		if selectedEvent.Name == "" {
+			selectedEvent.Name = ALL_EVENT_TYPES
+		}
+		if selectedEvent.Origin == "" {
+			selectedEvent.Origin = ALL_EVENT_ORIGINS
+		}
+		if selectedEvent.Source != "" {
+			engine.signaturesIndex[selectedEvent] = append(engine.signaturesIndex[selectedEvent], signature)
+		}
+	}
+	return nil
+}
+
 // ParsedEvent holds the original tracee.Event and its OPA ast.Value representation.
 type ParsedEvent struct {
 	Event tracee.Event
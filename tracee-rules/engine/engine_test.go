@@ -19,6 +19,7 @@ type regoFakeSignature struct {
 	init              func(types.SignatureHandler) error
 	onEvent           func(types.Event) error
 	onSignal          func(signal types.Signal) error
+	close             func()
 }
 
 func (fs regoFakeSignature) GetMetadata() (types.SignatureMetadata, error) {
@@ -59,7 +60,11 @@ func (fs regoFakeSignature) OnSignal(signal types.Signal) error {
 	}
 	return nil
 }
-func (fs *regoFakeSignature) Close() {}
+func (fs *regoFakeSignature) Close() {
+	if fs.close != nil {
+		fs.close()
+	}
+}
 
 func TestConsumeSources(t *testing.T) {
 	testCases := []struct {
@@ -365,9 +370,6 @@ func TestConsumeSources(t *testing.T) {
 
 		t.Run(tc.name, func(t *testing.T) {
 			defer func() {
-				// signal the end
-				done <- true
-
 				// cleanup
 				close(done)
 				close(outputChan)
@@ -388,18 +390,24 @@ func TestConsumeSources(t *testing.T) {
 				return nil
 			}
 
-			e, err := NewEngine(sigs, inputs, outputChan, logger, tc.enableParsedEvent)
+			e, err := NewEngine(sigs, inputs, outputChan, logger, tc.enableParsedEvent, nil)
 			require.NoError(t, err, "constructing engine")
+			stopped := make(chan struct{})
 			go func() {
 				e.Start(done)
+				close(stopped)
 			}()
 
 			// send a test event
-			e.inputs.Tracee <- tc.inputEvent
+			inputs.Tracee <- tc.inputEvent
+			time.Sleep(time.Millisecond * 1) // wait for events to propagate
+
+			// signal the end, and wait for the engine to stop using the signature
+			done <- true
+			<-stopped
 
 			// assert
 			var gotEvent types.Event
-			time.Sleep(time.Millisecond * 1) // wait for events to propagate
 
 			if tc.expectedNumEvents <= 0 {
 				assert.Nil(t, gotEvent, tc.name)
@@ -447,7 +455,7 @@ func TestGetSelectedEvents(t *testing.T) {
 			},
 		},
 	}
-	e, err := NewEngine(sigs, EventSources{Tracee: make(chan types.Event)}, make(chan types.Finding), &bytes.Buffer{}, false)
+	e, err := NewEngine(sigs, EventSources{Tracee: make(chan types.Event)}, make(chan types.Finding), &bytes.Buffer{}, false, nil)
 	require.NoError(t, err, "constructing engine")
 	se := e.GetSelectedEvents()
 	expected := []types.SignatureEventSelector{
@@ -469,3 +477,276 @@ func TestGetSelectedEvents(t *testing.T) {
 	}
 	assert.ElementsMatch(t, expected, se)
 }
+
+// fakeSignatureGroup is a group of signatures that select the event of their name
+type fakeSignatureGroup struct {
+	regoFakeSignature
+	ids []string
+}
+
+func newFakeSignatureGroup(ids ...string) *fakeSignatureGroup {
+	g := &fakeSignatureGroup{ids: ids}
+	g.getMetadata = func() (types.SignatureMetadata, error) {
+		return types.SignatureMetadata{ID: "TRC-GROUP"}, nil
+	}
+	g.getSelectedEvents = func() ([]types.SignatureEventSelector, error) {
+		var res []types.SignatureEventSelector
+		for _, id := range g.ids {
+			res = append(res, types.SignatureEventSelector{Source: "tracee", Name: id})
+		}
+		return res, nil
+	}
+	return g
+}
+
+func (g *fakeSignatureGroup) GetSignaturesMetadata() ([]types.SignatureMetadata, error) {
+	var res []types.SignatureMetadata
+	for _, id := range g.ids {
+		res = append(res, types.SignatureMetadata{ID: id})
+	}
+	return res, nil
+}
+
+func (g *fakeSignatureGroup) RemoveSignature(id string) error {
+	for i, sigID := range g.ids {
+		if sigID == id {
+			g.ids = append(g.ids[:i], g.ids[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func TestUnloadSignature_Group(t *testing.T) {
+	group := newFakeSignatureGroup("TRC-1", "TRC-2")
+	e, err := NewEngine([]types.Signature{group}, EventSources{Tracee: make(chan types.Event)}, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, e.UnloadSignature("TRC-1"))
+	assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "TRC-2", Origin: "*"}}, e.GetSelectedEvents())
+	assert.Contains(t, e.signatures, types.Signature(group))
+
+	// the group is unloaded with its last signature
+	require.NoError(t, e.UnloadSignature("TRC-2"))
+	assert.Empty(t, e.GetSelectedEvents())
+	assert.Empty(t, e.signatures)
+
+	assert.EqualError(t, e.UnloadSignature("TRC-3"), "could not find signature with ID: TRC-3")
+}
+
+func TestNewEngine_ConfigGroup(t *testing.T) {
+	config := &Config{Signatures: []SignatureConfig{{SignatureSelector: SignatureSelector{ID: "TRC-1"}, Enabled: new(bool)}}}
+	require.NoError(t, config.compile())
+	group := newFakeSignatureGroup("TRC-1", "TRC-2")
+	e, err := NewEngine([]types.Signature{group}, EventSources{Tracee: make(chan types.Event)}, make(chan types.Finding), &bytes.Buffer{}, false, config)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TRC-2"}, group.ids)
+	assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "TRC-2", Origin: "*"}}, e.GetSelectedEvents())
+}
+
+func TestNewEngine_Mitre(t *testing.T) {
+	newSig := func(id string, mapping types.MitreMapping) *regoFakeSignature {
+		return &regoFakeSignature{
+			getMetadata: func() (types.SignatureMetadata, error) {
+				return types.SignatureMetadata{ID: id, Mitre: mapping}, nil
+			},
+			getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+				return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+			},
+		}
+	}
+	valid := newSig("TRC-1", types.MitreMapping{Tactics: []string{"TA0005"}, Techniques: []string{"T1036"}})
+	invalid := newSig("TRC-2", types.MitreMapping{Tactics: []string{"TA0005"}, Techniques: []string{"T1611"}})
+	logger := bytes.Buffer{}
+	output := make(chan types.Finding, 1)
+	e, err := NewEngine([]types.Signature{valid, invalid}, EventSources{Tracee: make(chan types.Event)}, output, &logger, false, nil)
+	require.NoError(t, err)
+	assert.Len(t, e.signatures, 1)
+	assert.Contains(t, logger.String(), "signature TRC-2 has an invalid MITRE ATT&CK mapping: technique T1611 isn't of tactics TA0005")
+
+	_, err = e.LoadSignature(invalid)
+	assert.EqualError(t, err, "signature TRC-2 has an invalid MITRE ATT&CK mapping: technique T1611 isn't of tactics TA0005")
+
+	// findings are enriched with the mapping of their signature
+	metadata, _ := valid.GetMetadata()
+	e.matchHandler(types.Finding{SigMetadata: metadata})
+	finding := <-output
+	assert.Equal(t, &types.MitreAttack{
+		Tactics:    []types.MitreItem{{ID: "TA0005", Name: "Defense Evasion", URL: "https://attack.mitre.org/tactics/TA0005/"}},
+		Techniques: []types.MitreItem{{ID: "T1036", Name: "Masquerading", URL: "https://attack.mitre.org/techniques/T1036/"}},
+	}, finding.Mitre)
+}
+
+func TestStart_Shutdown(t *testing.T) {
+	newSig := func(onEvent func(types.Event) error, onSignal func(types.Signal) error) *regoFakeSignature {
+		return &regoFakeSignature{
+			getMetadata: func() (types.SignatureMetadata, error) {
+				return types.SignatureMetadata{ID: "TRC-1"}, nil
+			},
+			getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+				return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+			},
+			onEvent:  onEvent,
+			onSignal: onSignal,
+		}
+	}
+
+	t.Run("drained", func(t *testing.T) {
+		var cb types.SignatureHandler
+		handled := 0
+		sig := newSig(func(types.Event) error {
+			time.Sleep(time.Millisecond)
+			handled++
+			return nil
+		}, func(signal types.Signal) error {
+			// pending findings are reported on shutdown, once all the events were handled
+			if _, ok := signal.(types.SignalShutdown); ok {
+				cb(types.Finding{Data: map[string]interface{}{"handled": handled}})
+			}
+			return nil
+		})
+		sig.init = func(h types.SignatureHandler) error {
+			cb = h
+			return nil
+		}
+		inputs := EventSources{Tracee: make(chan types.Event)}
+		output := make(chan types.Finding, 1)
+		e, err := NewEngine([]types.Signature{sig}, inputs, output, &bytes.Buffer{}, false, nil)
+		require.NoError(t, err)
+
+		done := make(chan bool, 1)
+		stats := make(chan Stats)
+		go func() {
+			stats <- e.Start(done)
+		}()
+		for i := 0; i < 3; i++ {
+			inputs.Tracee <- tracee.Event{EventName: "execve"}
+		}
+		done <- true
+
+		assert.Equal(t, Stats{Events: 3, Findings: 1, Drained: true}, <-stats)
+		assert.Equal(t, map[string]interface{}{"handled": 3}, (<-output).Data)
+		assert.Empty(t, e.signatures)
+	})
+
+	t.Run("drain timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		signaled := make(map[string]bool)
+		closed := make(map[string]bool)
+		onSignal := func(id string) func(types.Signal) error {
+			return func(signal types.Signal) error {
+				if _, ok := signal.(types.SignalShutdown); ok {
+					signaled[id] = true
+				}
+				return nil
+			}
+		}
+		blocked := newSig(func(types.Event) error {
+			<-release
+			return nil
+		}, onSignal("TRC-1"))
+		blocked.close = func() { closed["TRC-1"] = true }
+		drained := newSig(nil, onSignal("TRC-2"))
+		drained.getMetadata = func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-2"}, nil
+		}
+		drained.close = func() { closed["TRC-2"] = true }
+		inputs := EventSources{Tracee: make(chan types.Event)}
+		logger := bytes.Buffer{}
+		e, err := NewEngine([]types.Signature{blocked, drained}, inputs, make(chan types.Finding), &logger, false, nil)
+		require.NoError(t, err)
+		e.SetDrainTimeout(10 * time.Millisecond)
+
+		done := make(chan bool, 1)
+		stats := make(chan Stats)
+		go func() {
+			stats <- e.Start(done)
+		}()
+		inputs.Tracee <- tracee.Event{EventName: "execve"}
+		done <- true
+
+		assert.Equal(t, Stats{Events: 1, Drained: false}, <-stats)
+		// a signature that is still handling an event is neither signaled to shut down nor closed
+		assert.Equal(t, map[string]bool{"TRC-2": true}, signaled)
+		assert.Equal(t, map[string]bool{"TRC-2": true}, closed)
+		assert.Contains(t, logger.String(), "signature TRC-1 didn't handle its pending events within 10ms")
+	})
+
+	t.Run("shutdown signal timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		closed := make(chan struct{})
+		sig := newSig(nil, func(signal types.Signal) error {
+			if _, ok := signal.(types.SignalShutdown); ok {
+				<-release
+			}
+			return nil
+		})
+		sig.close = func() { close(closed) }
+		inputs := EventSources{Tracee: make(chan types.Event)}
+		e, err := NewEngine([]types.Signature{sig}, inputs, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+		require.NoError(t, err)
+		e.SetDrainTimeout(10 * time.Millisecond)
+
+		done := make(chan bool, 1)
+		done <- true
+		// the engine doesn't wait for the shutdown signal beyond the drain timeout
+		assert.Equal(t, Stats{Drained: false}, e.Start(done))
+		select {
+		case <-closed:
+			t.Fatal("the signature was closed while it handled the shutdown signal")
+		default:
+		}
+		// the signature is closed once it handled the shutdown signal
+		close(release)
+		<-closed
+	})
+}
+
+func TestStart_Signals(t *testing.T) {
+	var got []interface{}
+	sig := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1", TickInterval: 10}, nil
+		},
+		getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+			return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+		},
+		onEvent: func(event types.Event) error {
+			got = append(got, event.(tracee.Event).Timestamp)
+			return nil
+		},
+		onSignal: func(signal types.Signal) error {
+			got = append(got, signal)
+			return nil
+		},
+	}
+	inputs := EventSources{Tracee: make(chan types.Event)}
+	e, err := NewEngine([]types.Signature{sig}, inputs, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+	require.NoError(t, err)
+
+	go func() {
+		// the timestamps of the events drive the ticks, regardless of when the events arrive
+		for _, timestamp := range []int{5, 12, 15, 8, 47, 50} {
+			inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: timestamp}
+		}
+		close(inputs.Tracee)
+	}()
+	e.Start(make(chan bool))
+
+	assert.Equal(t, []interface{}{
+		types.SignalSourceStart("tracee"),
+		5,
+		types.SignalTick{Timestamp: 10},
+		12,
+		15,
+		8,
+		// the ticks at 20, 30 and 40 are due together
+		types.SignalTick{Timestamp: 40},
+		47,
+		types.SignalTick{Timestamp: 50},
+		50,
+		types.SignalSourceComplete("tracee"),
+		types.SignalShutdown{},
+	}, got)
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// reorderer buffers events for a bounded delay of event time, and releases them in the order of their timestamps.
+// The watermark is the timestamp that all the events before it were released at: events that arrive after it passed
+// their timestamp are late.
+type reorderer struct {
+	delay     int // nanoseconds, like the timestamps of events
+	events    eventHeap
+	latest    int // the latest timestamp of the events
+	watermark int
+	seq       uint64 // orders events of the same timestamp by their arrival
+}
+
+func newReorderer(delay time.Duration) *reorderer {
+	return &reorderer{delay: int(delay)}
+}
+
+// push buffers an event, and returns false if it's late
+func (r *reorderer) push(event tracee.Event) bool {
+	if event.Timestamp < r.watermark {
+		return false
+	}
+	if event.Timestamp > r.latest {
+		r.latest = event.Timestamp
+	}
+	r.seq++
+	heap.Push(&r.events, orderedEvent{event: event, seq: r.seq})
+	return true
+}
+
+// release returns the events that are at least delay older than the latest event, in the order of their timestamps
+func (r *reorderer) release() []tracee.Event {
+	if watermark := r.latest - r.delay; watermark > r.watermark {
+		r.watermark = watermark
+	}
+	var res []tracee.Event
+	for len(r.events) > 0 && r.events[0].event.Timestamp <= r.watermark {
+		res = append(res, heap.Pop(&r.events).(orderedEvent).event)
+	}
+	return res
+}
+
+// releaseAll returns all of the buffered events, in the order of their timestamps, without advancing the watermark
+func (r *reorderer) releaseAll() []tracee.Event {
+	var res []tracee.Event
+	for len(r.events) > 0 {
+		res = append(res, heap.Pop(&r.events).(orderedEvent).event)
+	}
+	return res
+}
+
+// flush returns all of the buffered events, in the order of their timestamps, and advances the watermark to the
+// latest event
+func (r *reorderer) flush() []tracee.Event {
+	if r.latest > r.watermark {
+		r.watermark = r.latest
+	}
+	return r.release()
+}
+
+type orderedEvent struct {
+	event tracee.Event
+	seq   uint64
+}
+
+// eventHeap is a min-heap of events by their timestamps, implementing heap.Interface
+type eventHeap []orderedEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].event.Timestamp != h[j].event.Timestamp {
+		return h[i].event.Timestamp < h[j].event.Timestamp
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x interface{}) { *h = append(*h, x.(orderedEvent)) }
+
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// watermark is sent by the reorder stage to the engine after the events that it released, when the watermark
+// advanced by at least watermarkResolution
+type watermark int
+
+// watermarkResolution is the event time that the watermark advances by before it's signaled, so the signatures aren't
+// signaled for every event
+const watermarkResolution = int(time.Millisecond)
+
+// reorderDrained is sent by the reorder stage to the engine once it released its buffered events, after the engine
+// was stopped
+type reorderDrained struct{}
+
+// reorder returns a channel of the events of in, in the order of their timestamps, buffering them for the reorder
+// delay. Late events are dropped and counted. The watermark is sent in between the events whenever it advances, so a
+// signature never receives an event that is older than a watermark it was signaled.
+// When no event arrives for the delay, by the wall clock, the buffered events are released, so events aren't held when
+// the input is idle. The watermark isn't moved for that, so events that arrive afterwards within the delay aren't
+// late, which keeps the reordering independent of how fast the input is read, but they may be older than the events
+// that were released early.
+// The channel is closed once in is closed and the buffered events were released. When drain is closed, the stage
+// stops reading in, and it releases the buffered events followed by reorderDrained.
+func (engine *Engine) reorder(in <-chan types.Event, drain <-chan struct{}) chan types.Event {
+	out := make(chan types.Event)
+	go func() {
+		defer close(out)
+		r := newReorderer(engine.reorderDelay)
+		signaled := r.watermark
+		emit := func(events []tracee.Event) {
+			for _, event := range events {
+				out <- event
+			}
+			if r.watermark-signaled >= watermarkResolution {
+				signaled = r.watermark
+				out <- watermark(r.watermark)
+			}
+		}
+		idle := time.NewTimer(engine.reorderDelay)
+		defer idle.Stop()
+		for {
+			select {
+			case event, ok := <-in:
+				if !ok {
+					emit(r.flush())
+					return
+				}
+				traceeEvt, ok := event.(tracee.Event)
+				if !ok {
+					// consumeSources reports the invalid event
+					out <- event
+					continue
+				}
+				if !r.push(traceeEvt) {
+					atomic.AddInt64(&engine.lateEvents, 1)
+					continue
+				}
+				emit(r.release())
+				if !idle.Stop() {
+					select {
+					case <-idle.C:
+					default:
+					}
+				}
+				idle.Reset(engine.reorderDelay)
+			case <-idle.C:
+				emit(r.releaseAll())
+				idle.Reset(engine.reorderDelay)
+			case <-drain:
+				emit(r.flush())
+				out <- reorderDrained{}
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func timestamps(events []tracee.Event) []int {
+	res := make([]int, 0, len(events))
+	for _, e := range events {
+		res = append(res, e.Timestamp)
+	}
+	return res
+}
+
+func TestReorderer(t *testing.T) {
+	r := newReorderer(10)
+	var released []int
+	for _, ts := range []int{5, 3, 12, 8, 14, 20, 17} {
+		require.True(t, r.push(tracee.Event{Timestamp: ts}), ts)
+		released = append(released, timestamps(r.release())...)
+	}
+	// events are released once they are 10 older than the latest event
+	assert.Equal(t, []int{3, 5, 8}, released)
+	assert.Equal(t, 10, r.watermark)
+
+	// events before the watermark are late
+	assert.False(t, r.push(tracee.Event{Timestamp: 9}))
+	assert.True(t, r.push(tracee.Event{Timestamp: 10}))
+
+	// events of the same timestamp keep the order of their arrival
+	r.push(tracee.Event{Timestamp: 14, EventName: "second"})
+	events := r.flush()
+	assert.Equal(t, []int{10, 12, 14, 14, 17, 20}, timestamps(events))
+	assert.Equal(t, "second", events[3].EventName)
+	assert.Equal(t, 20, r.watermark)
+
+	// releasing all of the events doesn't advance the watermark
+	r.push(tracee.Event{Timestamp: 35})
+	r.push(tracee.Event{Timestamp: 32})
+	assert.Equal(t, []int{32, 35}, timestamps(r.releaseAll()))
+	assert.Equal(t, 20, r.watermark)
+	assert.True(t, r.push(tracee.Event{Timestamp: 30}))
+}
+
+func TestStart_Reorder(t *testing.T) {
+	var got []interface{}
+	second := int(time.Second)
+	sig := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1", TickInterval: 10 * time.Second}, nil
+		},
+		getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+			return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+		},
+		onEvent: func(event types.Event) error {
+			got = append(got, event.(tracee.Event).Timestamp/second)
+			return nil
+		},
+		onSignal: func(signal types.Signal) error {
+			got = append(got, signal)
+			return nil
+		},
+	}
+	inputs := EventSources{Tracee: make(chan types.Event)}
+	e, err := NewEngine([]types.Signature{sig}, inputs, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+	require.NoError(t, err)
+	e.SetReorderDelay(10 * time.Second)
+
+	go func() {
+		for _, ts := range []int{5, 3, 12, 8, 20, 14, 25, 1} {
+			inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: ts * second}
+		}
+		close(inputs.Tracee)
+	}()
+	stats := e.Start(make(chan bool))
+
+	// 8 and 14 arrived within the delay, and 1 arrived after the watermark passed it. The ticks are driven by the
+	// watermark, so they are sent once all of the events before them were received.
+	assert.Equal(t, []interface{}{
+		types.SignalSourceStart("tracee"),
+		types.SignalWatermark{Timestamp: 2 * second},
+		3, 5, 8,
+		types.SignalTick{Timestamp: 10 * second},
+		types.SignalWatermark{Timestamp: 10 * second},
+		12, 14,
+		types.SignalWatermark{Timestamp: 15 * second},
+		20, 25,
+		types.SignalTick{Timestamp: 20 * second},
+		types.SignalWatermark{Timestamp: 25 * second},
+		types.SignalSourceComplete("tracee"),
+		types.SignalShutdown{},
+	}, got)
+	assert.Equal(t, Stats{Events: 7, Drained: true, Late: 1}, stats)
+}
+
+func TestStart_ReorderIdle(t *testing.T) {
+	got := make(chan int, 1)
+	sig := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1"}, nil
+		},
+		getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+			return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+		},
+		onEvent: func(event types.Event) error {
+			got <- event.(tracee.Event).Timestamp
+			return nil
+		},
+	}
+	inputs := EventSources{Tracee: make(chan types.Event)}
+	e, err := NewEngine([]types.Signature{sig}, inputs, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+	require.NoError(t, err)
+	e.SetReorderDelay(10 * time.Millisecond)
+	done := make(chan bool, 1)
+	stopped := make(chan Stats)
+	go func() {
+		stopped <- e.Start(done)
+	}()
+
+	receive := func() int {
+		select {
+		case ts := <-got:
+			return ts
+		case <-time.After(time.Second):
+			t.Fatal("the event wasn't released")
+		}
+		return 0
+	}
+	// the buffered events are released when the input is idle for the delay
+	millisecond := int(time.Millisecond)
+	inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: 1000 * millisecond}
+	assert.Equal(t, 1000*millisecond, receive())
+
+	// the watermark didn't move, so an event within the delay isn't late, but an event before it is
+	inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: 995 * millisecond}
+	assert.Equal(t, 995*millisecond, receive())
+	inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: 500 * millisecond}
+
+	done <- true
+	stats := <-stopped
+	assert.Equal(t, int64(1), stats.Late)
+}
+
+func TestStart_ReorderDrain(t *testing.T) {
+	var got []int
+	sig := &regoFakeSignature{
+		getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1"}, nil
+		},
+		getSelectedEvents: func() ([]types.SignatureEventSelector, error) {
+			return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+		},
+		onEvent: func(event types.Event) error {
+			got = append(got, event.(tracee.Event).Timestamp)
+			return nil
+		},
+	}
+	inputs := EventSources{Tracee: make(chan types.Event)}
+	e, err := NewEngine([]types.Signature{sig}, inputs, make(chan types.Finding), &bytes.Buffer{}, false, nil)
+	require.NoError(t, err)
+	e.SetReorderDelay(time.Hour)
+	done := make(chan bool, 1)
+	go func() {
+		for _, ts := range []int{3, 1, 2} {
+			inputs.Tracee <- tracee.Event{EventName: "execve", Timestamp: ts}
+		}
+		done <- true
+	}()
+	stats := e.Start(done)
+
+	// the buffered events are handled by the signatures before they are shut down
+	assert.Equal(t, []int{1, 2, 3}, got)
+	assert.Equal(t, Stats{Events: 3, Drained: true}, stats)
+}
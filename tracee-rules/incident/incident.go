@@ -0,0 +1,349 @@
+// Package incident groups related findings into incidents
+package incident
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/mitre"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// Metadata is the metadata of the findings that report incidents
+var Metadata = types.SignatureMetadata{
+	ID:          "TRC-INCIDENT",
+	Version:     "1.0.0",
+	Name:        "Incident",
+	Description: "Related findings of a container or of a process lineage",
+}
+
+const (
+	// maxTimelineEntries is the max number of findings in the timeline of an incident. The findings of the earliest
+	// events are removed from the timeline when it's full.
+	maxTimelineEntries = 100
+	// maxProcesses is the max number of processes whose parents are tracked. The least recently seen processes are
+	// evicted when it's full.
+	maxProcesses = 1 << 16
+	// maxAncestors is the max number of ancestors of a process that are looked up for its incident
+	maxAncestors = 64
+)
+
+// Aggregator groups findings into incidents. A finding of a container joins the incident of the container, and a
+// finding of a host process joins the incident of its process or of one of its ancestors, if the previous finding of
+// the incident is within the window, by the timestamps of the events. Otherwise, the finding starts a new incident.
+// The ancestors of processes are tracked from the events that the aggregator observes, and from the findings.
+type Aggregator struct {
+	window      time.Duration
+	minFindings int
+	seq         int
+	incidents   []*incident // the incidents that findings may still join
+
+	mu        sync.Mutex
+	processes map[int]*list.Element // by host process ID
+	lru       *list.List            // *process, the most recently seen first
+}
+
+type incident struct {
+	types.Incident
+	pids       map[int]bool // the host process IDs of the findings
+	techniques []string
+	last       tracee.Event // the event of the finding that joined last
+}
+
+type process struct {
+	pid  int
+	ppid int
+}
+
+// NewAggregator creates a new Aggregator, which reports incidents that have at least minFindings findings
+func NewAggregator(window time.Duration, minFindings int) *Aggregator {
+	return &Aggregator{
+		window:      window,
+		minFindings: minFindings,
+		processes:   make(map[int]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// observe records the parent of the process of an event
+func (a *Aggregator) observe(event tracee.Event) {
+	if event.HostProcessID <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if elem, ok := a.processes[event.HostProcessID]; ok {
+		// the process ID may have been reused by another process
+		elem.Value.(*process).ppid = event.HostParentProcessID
+		a.lru.MoveToFront(elem)
+		return
+	}
+	if a.lru.Len() >= maxProcesses {
+		oldest := a.lru.Back()
+		a.lru.Remove(oldest)
+		delete(a.processes, oldest.Value.(*process).pid)
+	}
+	a.processes[event.HostProcessID] = a.lru.PushFront(&process{pid: event.HostProcessID, ppid: event.HostParentProcessID})
+}
+
+// lineage returns the host process IDs of the process of an event and of its known ancestors, the nearest first. The
+// ancestors above init aren't looked up, since all processes descend from it.
+func (a *Aggregator) lineage(event tracee.Event) []int {
+	lineage := []int{event.HostProcessID, event.HostParentProcessID}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for pid := event.HostParentProcessID; pid > 1 && len(lineage) < maxAncestors; {
+		elem, ok := a.processes[pid]
+		if !ok {
+			break
+		}
+		pid = elem.Value.(*process).ppid
+		if containsInt(lineage, pid) {
+			break
+		}
+		lineage = append(lineage, pid)
+	}
+	return lineage
+}
+
+// Add adds a finding to the incident that it is related to, or to a new incident. It returns the finding of the
+// incident if the incident has at least minFindings findings.
+func (a *Aggregator) Add(finding types.Finding) (types.Finding, bool) {
+	event, ok := toTraceeEvent(finding.Context)
+	if !ok {
+		return types.Finding{}, false
+	}
+	a.observe(event)
+	a.expire(event.Timestamp)
+	inc := a.related(event)
+	if inc == nil {
+		a.seq++
+		inc = &incident{
+			Incident: types.Incident{
+				ID:          fmt.Sprintf("INC-%d", a.seq),
+				ContainerID: event.ContainerID,
+				Start:       event.Timestamp,
+				End:         event.Timestamp,
+			},
+			pids: make(map[int]bool),
+		}
+		a.incidents = append(a.incidents, inc)
+	}
+	inc.add(finding, event)
+	if inc.Findings < a.minFindings {
+		return types.Finding{}, false
+	}
+	return inc.finding(), true
+}
+
+// expire removes the incidents whose last finding is out of the window of timestamp
+func (a *Aggregator) expire(timestamp int) {
+	active := a.incidents[:0]
+	for _, inc := range a.incidents {
+		if time.Duration(timestamp-inc.End) <= a.window {
+			active = append(active, inc)
+		}
+	}
+	for i := len(active); i < len(a.incidents); i++ {
+		a.incidents[i] = nil
+	}
+	a.incidents = active
+}
+
+// related returns the incident that the finding of an event joins, preferring the most recent one
+func (a *Aggregator) related(event tracee.Event) *incident {
+	var lineage []int
+	if event.ContainerID == "" {
+		lineage = a.lineage(event)
+	}
+	for i := len(a.incidents) - 1; i >= 0; i-- {
+		inc := a.incidents[i]
+		if event.ContainerID != "" {
+			if inc.ContainerID == event.ContainerID {
+				return inc
+			}
+			continue
+		}
+		if inc.ContainerID != "" {
+			continue
+		}
+		for _, pid := range lineage {
+			if inc.pids[pid] {
+				return inc
+			}
+		}
+	}
+	return nil
+}
+
+func (inc *incident) add(finding types.Finding, event tracee.Event) {
+	entry := types.IncidentEntry{
+		Timestamp:     event.Timestamp,
+		SignatureID:   finding.SigMetadata.ID,
+		SignatureName: finding.SigMetadata.Name,
+		Severity:      severity(finding.SigMetadata),
+		ProcessName:   event.ProcessName,
+		HostProcessID: event.HostProcessID,
+		Data:          finding.Data,
+	}
+	// findings of different signatures may arrive out of the order of their events
+	i := sort.Search(len(inc.Timeline), func(i int) bool {
+		return inc.Timeline[i].Timestamp > entry.Timestamp
+	})
+	inc.Timeline = append(inc.Timeline, types.IncidentEntry{})
+	copy(inc.Timeline[i+1:], inc.Timeline[i:])
+	inc.Timeline[i] = entry
+	if n := len(inc.Timeline) - maxTimelineEntries; n > 0 {
+		copy(inc.Timeline, inc.Timeline[n:])
+		inc.Timeline = inc.Timeline[:maxTimelineEntries]
+	}
+
+	inc.Findings++
+	inc.pids[event.HostProcessID] = true
+	if event.Timestamp < inc.Start {
+		inc.Start = event.Timestamp
+	}
+	if event.Timestamp > inc.End {
+		inc.End = event.Timestamp
+	}
+	if entry.Severity > inc.Severity {
+		inc.Severity = entry.Severity
+	}
+	inc.Tactics = mergeTactics(inc.Tactics, finding.SigMetadata.Mitre.Tactics)
+	for _, id := range finding.SigMetadata.Mitre.Techniques {
+		if !containsString(inc.techniques, id) {
+			inc.techniques = append(inc.techniques, id)
+		}
+	}
+	inc.last = event
+}
+
+// finding returns the finding that reports the incident. The incident is copied, since it changes when findings
+// join it.
+func (inc *incident) finding() types.Finding {
+	snapshot := inc.Incident
+	snapshot.Tactics = append([]types.MitreItem(nil), inc.Tactics...)
+	snapshot.Timeline = append([]types.IncidentEntry(nil), inc.Timeline...)
+
+	metadata := Metadata
+	metadata.Properties = map[string]interface{}{"Severity": inc.Severity}
+	for _, tactic := range inc.Tactics {
+		metadata.Mitre.Tactics = append(metadata.Mitre.Tactics, tactic.ID)
+	}
+	metadata.Mitre.Techniques = append([]string(nil), inc.techniques...)
+
+	signatures := make([]string, len(inc.Timeline))
+	for i, entry := range inc.Timeline {
+		signatures[i] = entry.SignatureID
+	}
+	return types.Finding{
+		Data: map[string]interface{}{
+			"incident":   inc.ID,
+			"findings":   inc.Findings,
+			"signatures": signatures,
+		},
+		Context:     inc.last,
+		SigMetadata: metadata,
+		Mitre:       mitre.Resolve(metadata.Mitre),
+		Incident:    &snapshot,
+	}
+}
+
+// mergeTactics adds the tactics of ids to tactics, in the order of the ATT&CK matrix
+func mergeTactics(tactics []types.MitreItem, ids []string) []types.MitreItem {
+	if len(ids) == 0 {
+		return tactics
+	}
+	var res []types.MitreItem
+	for _, tactic := range mitre.Tactics() {
+		found := containsString(ids, tactic.ID)
+		for _, t := range tactics {
+			found = found || t.ID == tactic.ID
+		}
+		if found {
+			res = append(res, types.MitreItem{ID: tactic.ID, Name: tactic.Name, URL: tactic.URL()})
+		}
+	}
+	return res
+}
+
+// severity returns the severity of a signature, 0 if it has none
+func severity(metadata types.SignatureMetadata) int {
+	switch v := metadata.Properties["Severity"].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case json.Number:
+		i, _ := v.Int64()
+		return int(i)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	return 0
+}
+
+func toTraceeEvent(e types.Event) (tracee.Event, bool) {
+	switch v := e.(type) {
+	case tracee.Event:
+		return v, true
+	case engine.ParsedEvent:
+		return v.Event, true
+	}
+	return tracee.Event{}, false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, i int) bool {
+	for _, v := range values {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe forwards the events of in to the returned channel, and records the ancestors of their processes in the
+// aggregator, so that findings of the descendants of a process join its incident. It closes the returned channel once
+// in is closed.
+func Observe(in chan types.Event, a *Aggregator) chan types.Event {
+	out := make(chan types.Event)
+	go func() {
+		defer close(out)
+		for e := range in {
+			if event, ok := toTraceeEvent(e); ok {
+				a.observe(event)
+			}
+			out <- e
+		}
+	}()
+	return out
+}
+
+// Run forwards the findings of in to out, followed by the findings of the incidents that they update, until in is
+// closed. It closes out once in is closed
+func Run(in <-chan types.Finding, out chan<- types.Finding, a *Aggregator) {
+	defer close(out)
+	for finding := range in {
+		out <- finding
+		if inc, ok := a.Add(finding); ok {
+			out <- inc
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package incident_test
+
+import (
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/incident"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFinding(id string, severity interface{}, tactics []string, event types.Event) types.Finding {
+	return types.Finding{
+		Data:    map[string]interface{}{"sig": id},
+		Context: event,
+		SigMetadata: types.SignatureMetadata{
+			ID:         id,
+			Name:       "signature " + id,
+			Properties: map[string]interface{}{"Severity": severity},
+			Mitre:      types.MitreMapping{Tactics: tactics},
+		},
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	sec := int(time.Second)
+	testCases := []struct {
+		name     string
+		findings []types.Finding
+		want     []string // the IDs of the incidents that the findings are reported by, "" if none
+	}{
+		{
+			name: "same container",
+			findings: []types.Finding{
+				newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: 1 * sec, ContainerID: "c1", HostProcessID: 10}),
+				newFinding("TRC-2", 2, nil, tracee.Event{Timestamp: 2 * sec, ContainerID: "c1", HostProcessID: 20}),
+				newFinding("TRC-3", 2, nil, tracee.Event{Timestamp: 3 * sec, ContainerID: "c2", HostProcessID: 10}),
+				newFinding("TRC-4", 2, nil, tracee.Event{Timestamp: 4 * sec, ContainerID: "c1", HostProcessID: 30}),
+			},
+			want: []string{"", "INC-1", "", "INC-1"},
+		},
+		{
+			name: "process lineage",
+			findings: []types.Finding{
+				newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: 1 * sec, HostProcessID: 10, HostParentProcessID: 1}),
+				newFinding("TRC-2", 1, nil, tracee.Event{Timestamp: 2 * sec, HostProcessID: 11, HostParentProcessID: 10}),
+				newFinding("TRC-3", 1, nil, tracee.Event{Timestamp: 3 * sec, HostProcessID: 12, HostParentProcessID: 11}),
+				newFinding("TRC-4", 1, nil, tracee.Event{Timestamp: 4 * sec, HostProcessID: 99, HostParentProcessID: 1}),
+			},
+			want: []string{"", "INC-1", "INC-1", ""},
+		},
+		{
+			name: "process ancestry",
+			findings: []types.Finding{
+				newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: 1 * sec, HostProcessID: 10, HostParentProcessID: 1}),
+				// the grandchild of the first process, whose parent had no finding, but was seen by a finding
+				newFinding("TRC-2", 1, nil, tracee.Event{Timestamp: 2 * sec, HostProcessID: 20, HostParentProcessID: 10, ContainerID: "c1"}),
+				newFinding("TRC-3", 1, nil, tracee.Event{Timestamp: 3 * sec, HostProcessID: 30, HostParentProcessID: 20}),
+			},
+			want: []string{"", "", "INC-1"},
+		},
+		{
+			name: "out of window",
+			findings: []types.Finding{
+				newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: 1 * sec, ContainerID: "c1"}),
+				newFinding("TRC-2", 1, nil, tracee.Event{Timestamp: 70 * sec, ContainerID: "c1"}),
+				newFinding("TRC-3", 1, nil, tracee.Event{Timestamp: 80 * sec, ContainerID: "c1"}),
+			},
+			want: []string{"", "", "INC-2"},
+		},
+		{
+			name: "unsupported context",
+			findings: []types.Finding{
+				{Context: "foo"},
+				{Context: "foo"},
+			},
+			want: []string{"", ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := incident.NewAggregator(time.Minute, 2)
+			for i, f := range tc.findings {
+				res, ok := a.Add(f)
+				if tc.want[i] == "" {
+					assert.False(t, ok, i)
+					continue
+				}
+				require.True(t, ok, i)
+				assert.Equal(t, tc.want[i], res.Incident.ID, i)
+			}
+		})
+	}
+}
+
+func TestAggregator_Incident(t *testing.T) {
+	a := incident.NewAggregator(time.Minute, 1)
+	first := newFinding("TRC-2", 3, []string{"TA0005"}, tracee.Event{Timestamp: 20, ContainerID: "c1", ProcessName: "sh", HostProcessID: 10})
+	res, ok := a.Add(first)
+	require.True(t, ok)
+	snapshot := res.Incident
+	// findings may be out of the order of their events, and have parsed events
+	res, ok = a.Add(newFinding("TRC-3", "1", []string{"TA0002", "TA0005"}, engine.ParsedEvent{Event: tracee.Event{Timestamp: 10, ContainerID: "c1", ProcessName: "ls", HostProcessID: 11}}))
+	require.True(t, ok)
+
+	assert.Len(t, snapshot.Timeline, 1, "a reported incident doesn't change")
+	assert.Equal(t, &types.Incident{
+		ID:          "INC-1",
+		ContainerID: "c1",
+		Start:       10,
+		End:         20,
+		Severity:    3,
+		Findings:    2,
+		Tactics: []types.MitreItem{
+			{ID: "TA0002", Name: "Execution", URL: "https://attack.mitre.org/tactics/TA0002/"},
+			{ID: "TA0005", Name: "Defense Evasion", URL: "https://attack.mitre.org/tactics/TA0005/"},
+		},
+		Timeline: []types.IncidentEntry{
+			{Timestamp: 10, SignatureID: "TRC-3", SignatureName: "signature TRC-3", Severity: 1, ProcessName: "ls", HostProcessID: 11, Data: map[string]interface{}{"sig": "TRC-3"}},
+			{Timestamp: 20, SignatureID: "TRC-2", SignatureName: "signature TRC-2", Severity: 3, ProcessName: "sh", HostProcessID: 10, Data: map[string]interface{}{"sig": "TRC-2"}},
+		},
+	}, res.Incident)
+	assert.Equal(t, "TRC-INCIDENT", res.SigMetadata.ID)
+	assert.Equal(t, 3, res.SigMetadata.Properties["Severity"])
+	assert.Equal(t, []string{"TA0002", "TA0005"}, res.SigMetadata.Mitre.Tactics)
+	require.NotNil(t, res.Mitre)
+	assert.Len(t, res.Mitre.Tactics, 2)
+	assert.Equal(t, map[string]interface{}{"incident": "INC-1", "findings": 2, "signatures": []string{"TRC-3", "TRC-2"}}, res.Data)
+	assert.Equal(t, "ls", res.Context.(tracee.Event).ProcessName)
+}
+
+func TestAggregator_Timeline(t *testing.T) {
+	a := incident.NewAggregator(time.Minute, 1)
+	var res types.Finding
+	for i := 1; i <= 150; i++ {
+		var ok bool
+		res, ok = a.Add(newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: i, ContainerID: "c1"}))
+		require.True(t, ok)
+	}
+	assert.Equal(t, 150, res.Incident.Findings)
+	assert.Equal(t, 150, res.Data["findings"])
+	// the timeline has the findings of the latest events
+	require.Len(t, res.Incident.Timeline, 100)
+	assert.Equal(t, 51, res.Incident.Timeline[0].Timestamp)
+	assert.Equal(t, 150, res.Incident.Timeline[99].Timestamp)
+	assert.Equal(t, 1, res.Incident.Start)
+}
+
+func TestObserve(t *testing.T) {
+	a := incident.NewAggregator(time.Minute, 2)
+	in := make(chan types.Event)
+	out := incident.Observe(in, a)
+	go func() {
+		// the parent of the grandchild has no finding
+		in <- tracee.Event{Timestamp: 2, HostProcessID: 11, HostParentProcessID: 10}
+		close(in)
+	}()
+	for range out {
+	}
+
+	_, ok := a.Add(newFinding("TRC-1", 1, nil, tracee.Event{Timestamp: 1, HostProcessID: 10, HostParentProcessID: 1}))
+	assert.False(t, ok)
+	res, ok := a.Add(newFinding("TRC-2", 1, nil, tracee.Event{Timestamp: 3, HostProcessID: 12, HostParentProcessID: 11}))
+	require.True(t, ok)
+	assert.Equal(t, "INC-1", res.Incident.ID)
+}
+
+func TestRun(t *testing.T) {
+	in := make(chan types.Finding)
+	out := make(chan types.Finding, 3)
+	go func() {
+		in <- newFinding("TRC-1", 1, nil, tracee.Event{ContainerID: "c1"})
+		in <- newFinding("TRC-2", 1, nil, tracee.Event{ContainerID: "c1"})
+		close(in)
+	}()
+	incident.Run(in, out, incident.NewAggregator(time.Minute, 2))
+
+	var ids []string
+	for f := range out {
+		ids = append(ids, f.SigMetadata.ID)
+	}
+	assert.Equal(t, []string{"TRC-1", "TRC-2", "TRC-INCIDENT"}, ids)
+}
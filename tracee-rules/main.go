@@ -9,10 +9,16 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/incident"
+	"github.com/aquasecurity/tracee/tracee-rules/mitre"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/rego/regosig"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/wasm/wasmsig"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 	"github.com/open-policy-agent/opa/compile"
 	"github.com/urfave/cli/v2"
@@ -29,6 +35,11 @@ func main() {
 				return errors.New("no flags specified")
 			}
 
+			var regoProfiler *regosig.Profiler
+			if c.Bool("rego-profile") {
+				regoProfiler = regosig.NewProfiler()
+			}
+
 			if c.Bool("pprof") {
 				mux := http.NewServeMux()
 				mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -40,6 +51,9 @@ func main() {
 				mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 				mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 				mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+				if regoProfiler != nil {
+					mux.HandleFunc("/debug/pprof/rego", regoProfileHandler(regoProfiler))
+				}
 				go func() {
 					addr := c.String("pprof-addr")
 					fmt.Fprintf(os.Stdout, "Serving pprof endpoints at %s\n", addr)
@@ -52,26 +66,40 @@ func main() {
 			var target string
 			switch strings.ToLower(c.String("rego-runtime-target")) {
 			case "wasm":
-				return errors.New("target unsupported: " + target)
+				target = compile.TargetWasm
 			case "rego":
 				target = compile.TargetRego
 			default:
 				return errors.New("invalid target specified " + target)
 			}
 
-			sigs, err := getSignatures(target, c.Bool("rego-partial-eval"), c.String("rules-dir"), c.StringSlice("rules"), c.Bool("rego-aio"))
+			var rulesData *regosig.RulesData
+			if paths := c.StringSlice("rules-data"); len(paths) > 0 {
+				var err error
+				rulesData, err = regosig.NewRulesData(paths...)
+				if err != nil {
+					return err
+				}
+				go watchRulesData(rulesData, rulesDataReloadInterval)
+			}
+
+			wasmLimits := wasmsig.DefaultLimits.MemoryLimitMiB(uint32(c.Uint("wasm-memory-limit")))
+			wasmLimits.Timeout = c.Duration("wasm-timeout")
+			sigs, err := getSignatures(target, c.Bool("rego-partial-eval"), c.String("rules-dir"), c.StringSlice("rules"), c.Bool("rego-aio"), rulesData, regoProfiler, wasmLimits)
 			if err != nil {
 				return err
 			}
 
 			var loadedSigIDs []string
 			for _, s := range sigs {
-				m, err := s.GetMetadata()
+				metas, err := signaturesMetadata(s)
 				if err != nil {
 					log.Printf("failed to load signature: %v", err)
 					continue
 				}
-				loadedSigIDs = append(loadedSigIDs, m.ID)
+				for _, m := range metas {
+					loadedSigIDs = append(loadedSigIDs, m.ID)
+				}
 			}
 
 			if c.Bool("list-events") {
@@ -82,7 +110,7 @@ func main() {
 			fmt.Printf("Loaded %d signature(s): %s\n", len(loadedSigIDs), loadedSigIDs)
 
 			if c.Bool("list") {
-				return listSigs(os.Stdout, sigs)
+				return listSigs(os.Stdout, sigs, c.StringSlice("list-tactic"), c.Bool("list-by-tactic"))
 			}
 
 			var inputs engine.EventSources
@@ -98,17 +126,61 @@ func main() {
 			if err != nil {
 				return err
 			}
+			var aggregator *incident.Aggregator
+			if c.Bool("incidents") {
+				aggregator = incident.NewAggregator(c.Duration("incident-window"), c.Int("incident-min-findings"))
+				inputs.Tracee = incident.Observe(inputs.Tracee, aggregator)
+			}
+
+			var artifacts *artifactResolver
+			if c.String("capture-dir") != "" {
+				artifacts, err = newArtifactResolver(c.String("capture-dir"), c.String("evidence-dir"))
+				if err != nil {
+					return err
+				}
+			} else if c.String("evidence-dir") != "" {
+				return errors.New("--evidence-dir requires --capture-dir")
+			}
 
-			output, err := setupOutput(os.Stdout, c.String("webhook"), c.String("webhook-template"), c.String("webhook-content-type"), c.String("output-template"))
+			output, flushed, err := setupOutput(os.Stdout, artifacts, c.String("webhook"), c.String("webhook-template"), c.String("webhook-content-type"), c.String("output-template"))
 			if err != nil {
 				return err
 			}
-			e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, c.Bool("rego-enable-parsed-events"))
+			if aggregator != nil {
+				findings := make(chan types.Finding)
+				go incident.Run(findings, output, aggregator)
+				output = findings
+			}
+			var config *engine.Config
+			if c.String("config") != "" {
+				config, err = engine.LoadConfig(c.String("config"))
+				if err != nil {
+					return err
+				}
+				config.Images = engine.NewDockerImages(c.String("docker-socket"))
+			}
+			e, err := engine.NewEngine(sigs, inputs, output, os.Stderr, c.Bool("rego-enable-parsed-events"), config)
 			if err != nil {
 				return fmt.Errorf("constructing engine: %w", err)
 			}
-			e.Start(sigHandler())
-			return nil
+			e.SetDrainTimeout(c.Duration("drain-timeout"))
+			e.SetReorderDelay(c.Duration("reorder-delay"))
+			if c.Bool("rego-aio-watch") {
+				for _, s := range sigs {
+					if aio, ok := s.(*regosig.AIO); ok {
+						go watchRegoModules(e, aio, defaultRulesDir(c.String("rules-dir")), regoModulesReloadInterval)
+					}
+				}
+			}
+			stats := e.Start(sigHandler())
+			close(output)
+			outputFlushed := waitFlushed(flushed, c.Duration("drain-timeout"))
+			if regoProfiler != nil {
+				if err := regoProfiler.WriteReport(os.Stderr, regoProfileTopExpressions); err != nil {
+					return err
+				}
+			}
+			return printSummary(os.Stderr, stats, outputFlushed)
 		},
 		Flags: []cli.Flag{
 			&cli.StringSliceFlag{
@@ -117,7 +189,20 @@ func main() {
 			},
 			&cli.StringFlag{
 				Name:  "rules-dir",
-				Usage: "directory where to search for rules in OPA (.rego) or Go plugin (.so) formats",
+				Usage: "directory where to search for rules in OPA (.rego), Go plugin (.so), plugin executable (.plugin) or WebAssembly (.wasm) formats",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "path to a YAML or JSON configuration file that enables or disables rules, overrides their severity and defines exceptions of their findings",
+			},
+			&cli.StringFlag{
+				Name:  "docker-socket",
+				Value: engine.DefaultDockerSocket,
+				Usage: "path to the socket of the docker daemon, which resolves the images of containers for the containerImage exceptions of the configuration",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rules-data",
+				Usage: "JSON or YAML file, or directory of JSON and YAML files, of data that rego rules read as data.tracee.config, e.g. allow-lists. reloaded when changed. Specify multiple paths by repeating this flag",
 			},
 			&cli.BoolFlag{
 				Name:  "rego-partial-eval",
@@ -127,6 +212,14 @@ func main() {
 				Name:  "list",
 				Usage: "print all available rules",
 			},
+			&cli.StringSliceFlag{
+				Name:  "list-tactic",
+				Usage: "print only the rules of a MITRE ATT&CK tactic, by its ID or name, with --list. Specify multiple tactics by repeating this flag",
+			},
+			&cli.BoolFlag{
+				Name:  "list-by-tactic",
+				Usage: "print the rules grouped by their MITRE ATT&CK tactics, with --list",
+			},
 			&cli.StringFlag{
 				Name:  "webhook",
 				Usage: "HTTP endpoint to call for every match",
@@ -147,6 +240,28 @@ func main() {
 				Name:  "output-template",
 				Usage: "configure output format via templates. Usage: --output-template=path/to/my.tmpl",
 			},
+			&cli.BoolFlag{
+				Name:  "incidents",
+				Usage: "group related findings, of the same container or process lineage, into incidents. every finding that joins an incident is followed by a TRC-INCIDENT finding of the incident",
+			},
+			&cli.DurationFlag{
+				Name:  "incident-window",
+				Usage: "max time between the events of consecutive findings of an incident, with --incidents",
+				Value: 10 * time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "incident-min-findings",
+				Usage: "min number of findings of an incident to report it, with --incidents",
+				Value: 2,
+			},
+			&cli.StringFlag{
+				Name:  "capture-dir",
+				Usage: "tracee-ebpf capture output directory (e.g. /tmp/tracee/out). attaches the captured files related to a finding to it",
+			},
+			&cli.StringFlag{
+				Name:  "evidence-dir",
+				Usage: "directory to write an evidence tarball with the finding and its captured files to, for every finding that has captured files. requires --capture-dir",
+			},
 			&cli.BoolFlag{
 				Name:  "pprof",
 				Usage: "enables pprof endpoints",
@@ -164,11 +279,38 @@ func main() {
 				Name:  "rego-aio",
 				Usage: "compile rego signatures altogether as an aggregate policy. By default each signature is compiled separately.",
 			},
+			&cli.BoolFlag{
+				Name:  "rego-aio-watch",
+				Usage: "recompile the rego rules in the rules directory that change, with --rego-aio. only the changed rules are parsed again",
+			},
+			&cli.BoolFlag{
+				Name:  "rego-profile",
+				Usage: "profile the evaluation time and count of each rego rule and expression. the report is served at /debug/pprof/rego with --pprof, and is written to stderr on exit",
+			},
 			&cli.StringFlag{
 				Name:  "rego-runtime-target",
 				Usage: "select which runtime target to use for evaluation of rego rules: rego, wasm",
 				Value: "rego",
 			},
+			&cli.UintFlag{
+				Name:  "wasm-memory-limit",
+				Usage: "max memory of each WebAssembly signature, and of each rego signature with the wasm runtime target, in MiB",
+				Value: 32,
+			},
+			&cli.DurationFlag{
+				Name:  "wasm-timeout",
+				Usage: "max duration of handling a single event by a WebAssembly signature, or by a rego signature with the wasm runtime target",
+				Value: wasmsig.DefaultLimits.Timeout,
+			},
+			&cli.DurationFlag{
+				Name:  "reorder-delay",
+				Usage: "reorder events by their timestamps, buffering them for this delay of event time (e.g. 100ms), before rules handle them. events that arrive later than that are dropped. disabled by default",
+			},
+			&cli.DurationFlag{
+				Name:  "drain-timeout",
+				Usage: "max time to handle the pending events of the signatures, and to flush the findings to the outputs, when tracee-rules stops",
+				Value: engine.DefaultDrainTimeout,
+			},
 			&cli.BoolFlag{
 				Name:  "list-events",
 				Usage: "print a list of events that currently loaded signatures require",
@@ -181,18 +323,78 @@ func main() {
 	}
 }
 
-func listSigs(w io.Writer, sigs []types.Signature) error {
-	fmt.Fprintf(w, "%-10s %-35s %s %s\n", "ID", "NAME", "VERSION", "DESCRIPTION")
+// listSigs prints the metadata of the signatures, and of the signatures of signature groups. With tactics, it prints
+// only the signatures of the MITRE ATT&CK tactics, by ID or name, and with byTactic, it groups them by tactic.
+func listSigs(w io.Writer, sigs []types.Signature, tactics []string, byTactic bool) error {
+	filter := make(map[string]bool)
+	for _, s := range tactics {
+		tactic, ok := mitre.FindTactic(s)
+		if !ok {
+			return fmt.Errorf("unknown MITRE ATT&CK tactic %s", s)
+		}
+		filter[tactic.ID] = true
+	}
+	var metas []types.SignatureMetadata
 	for _, sig := range sigs {
-		meta, err := sig.GetMetadata()
+		sigMetas, err := signaturesMetadata(sig)
 		if err != nil {
 			continue
 		}
-		fmt.Fprintf(w, "%-10s %-35s %-7s %s\n", meta.ID, meta.Name, meta.Version, meta.Description)
+		for _, meta := range sigMetas {
+			if len(filter) == 0 || ofTactics(meta, filter) {
+				metas = append(metas, meta)
+			}
+		}
+	}
+	if !byTactic {
+		printSigs(w, metas)
+		return nil
+	}
+
+	grouped := make(map[string]bool)
+	for _, tactic := range mitre.Tactics() {
+		var group []types.SignatureMetadata
+		for _, meta := range metas {
+			if ofTactics(meta, map[string]bool{tactic.ID: true}) {
+				group = append(group, meta)
+				grouped[meta.ID] = true
+			}
+		}
+		if len(group) > 0 {
+			fmt.Fprintf(w, "%s %s\n", tactic.ID, tactic.Name)
+			printSigs(w, group)
+			fmt.Fprintln(w)
+		}
+	}
+	var ungrouped []types.SignatureMetadata
+	for _, meta := range metas {
+		if !grouped[meta.ID] {
+			ungrouped = append(ungrouped, meta)
+		}
+	}
+	if len(ungrouped) > 0 {
+		fmt.Fprintln(w, "No tactic")
+		printSigs(w, ungrouped)
 	}
 	return nil
 }
 
+func ofTactics(meta types.SignatureMetadata, tactics map[string]bool) bool {
+	for _, id := range meta.Mitre.Tactics {
+		if tactics[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func printSigs(w io.Writer, metas []types.SignatureMetadata) {
+	fmt.Fprintf(w, "%-10s %-35s %s %s\n", "ID", "NAME", "VERSION", "DESCRIPTION")
+	for _, meta := range metas {
+		fmt.Fprintf(w, "%-10s %-35s %-7s %s\n", meta.ID, meta.Name, meta.Version, meta.Description)
+	}
+}
+
 func listEvents(w io.Writer, sigs []types.Signature) {
 	var events []string
 	for _, sig := range sigs {
@@ -204,6 +406,47 @@ func listEvents(w io.Writer, sigs []types.Signature) {
 	fmt.Fprintln(w, strings.Join(events, ","))
 }
 
+// rulesDataReloadInterval is the interval of checking whether the files of --rules-data changed
+const rulesDataReloadInterval = 5 * time.Second
+
+// regoModulesReloadInterval is the interval of checking whether the rego rules changed, with --rego-aio-watch
+const regoModulesReloadInterval = 5 * time.Second
+
+// watchRulesData reloads the rules data when its files change
+func watchRulesData(data *regosig.RulesData, interval time.Duration) {
+	for range time.Tick(interval) {
+		changed, err := data.Reload()
+		if err != nil {
+			log.Printf("error reloading rules data: %v", err)
+			continue
+		}
+		if changed {
+			log.Printf("reloaded rules data")
+		}
+	}
+}
+
+// regoProfileTopExpressions is the number of the most expensive expressions in the report of --rego-profile
+const regoProfileTopExpressions = 50
+
+// regoProfileHandler serves the report of the rego profiler, with the top n expressions of the n query parameter
+func regoProfileHandler(p *regosig.Profiler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := regoProfileTopExpressions
+		if s := r.URL.Query().Get("n"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil {
+				http.Error(w, fmt.Sprintf("invalid n: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		p.WriteReport(w, n)
+	}
+}
+
+// sigHandler returns a channel that is sent to on SIGINT or SIGTERM, to stop the engine gracefully. A second signal
+// exits immediately
 func sigHandler() chan bool {
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
@@ -211,6 +454,37 @@ func sigHandler() chan bool {
 	go func() {
 		<-sigs
 		done <- true
+		<-sigs
+		log.Fatal("forced shutdown")
 	}()
 	return done
 }
+
+// waitFlushed waits up to timeout for the outputs to be flushed, and returns whether they were
+func waitFlushed(flushed <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-flushed:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// printSummary prints a summary of the work of the engine when tracee-rules stops, and returns an error if the
+// shutdown didn't complete within the drain timeout
+func printSummary(w io.Writer, stats engine.Stats, outputFlushed bool) error {
+	fmt.Fprintf(w, "tracee-rules stopped: %d events, %d findings", stats.Events, stats.Findings)
+	if stats.Late > 0 {
+		fmt.Fprintf(w, ", %d late events dropped", stats.Late)
+	}
+	fmt.Fprintln(w)
+	if !stats.Drained {
+		return errors.New("signatures didn't handle their pending events within the drain timeout")
+	}
+	if !outputFlushed {
+		return errors.New("findings weren't flushed to the outputs within the drain timeout")
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 )
 
@@ -45,13 +46,85 @@ func Test_listSigs(t *testing.T) {
 	}
 
 	buf := bytes.Buffer{}
-	assert.NoError(t, listSigs(&buf, inputSigs))
+	assert.NoError(t, listSigs(&buf, inputSigs, nil, false))
 	assert.Equal(t, `ID         NAME                                VERSION DESCRIPTION
 FOO-1      foo signature                       1.2.3   foo signature helps with foo
 BAR-1      bar signature                       4.5.6   bar signature helps with bar
 `, buf.String())
 }
 
+func Test_listSigs_Tactics(t *testing.T) {
+	newSig := func(id string, tactics ...string) types.Signature {
+		return fakeSignature{
+			getMetadata: func() (types.SignatureMetadata, error) {
+				return types.SignatureMetadata{
+					ID:          id,
+					Version:     "1.0.0",
+					Name:        id + " signature",
+					Description: id + " description",
+					Mitre:       types.MitreMapping{Tactics: tactics},
+				}, nil
+			},
+		}
+	}
+	sigs := []types.Signature{
+		newSig("FOO-1", "TA0005"),
+		newSig("BAR-1", "TA0004", "TA0005"),
+		newSig("BAZ-1"),
+	}
+
+	testCases := []struct {
+		name     string
+		tactics  []string
+		byTactic bool
+		expected string
+		wantErr  string
+	}{
+		{
+			name:    "filter by ID and name",
+			tactics: []string{"ta0004", "Initial Access"},
+			expected: `ID         NAME                                VERSION DESCRIPTION
+BAR-1      BAR-1 signature                     1.0.0   BAR-1 description
+`,
+		},
+		{
+			name:     "group by tactic",
+			byTactic: true,
+			expected: `TA0004 Privilege Escalation
+ID         NAME                                VERSION DESCRIPTION
+BAR-1      BAR-1 signature                     1.0.0   BAR-1 description
+
+TA0005 Defense Evasion
+ID         NAME                                VERSION DESCRIPTION
+FOO-1      FOO-1 signature                     1.0.0   FOO-1 description
+BAR-1      BAR-1 signature                     1.0.0   BAR-1 description
+
+No tactic
+ID         NAME                                VERSION DESCRIPTION
+BAZ-1      BAZ-1 signature                     1.0.0   BAZ-1 description
+`,
+		},
+		{
+			name:    "unknown tactic",
+			tactics: []string{"Lunch"},
+			wantErr: "unknown MITRE ATT&CK tactic Lunch",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := listSigs(&buf, sigs, tc.tactics, tc.byTactic)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
 func Test_listEvents(t *testing.T) {
 	fakeSigs := []fakeSignature{
 		{
@@ -86,3 +159,52 @@ func Test_listEvents(t *testing.T) {
 	listEvents(&buf, inputSigs)
 	assert.Equal(t, "execve,ptrace\n", buf.String())
 }
+
+func Test_printSummary(t *testing.T) {
+	testCases := []struct {
+		name          string
+		stats         engine.Stats
+		outputFlushed bool
+		want          string
+		wantErr       string
+	}{
+		{
+			name:          "complete",
+			stats:         engine.Stats{Events: 10, Findings: 2, Drained: true},
+			outputFlushed: true,
+			want:          "tracee-rules stopped: 10 events, 2 findings\n",
+		},
+		{
+			name:          "late events",
+			stats:         engine.Stats{Events: 10, Findings: 2, Drained: true, Late: 3},
+			outputFlushed: true,
+			want:          "tracee-rules stopped: 10 events, 2 findings, 3 late events dropped\n",
+		},
+		{
+			name:          "signatures not drained",
+			stats:         engine.Stats{Events: 10, Findings: 2},
+			outputFlushed: true,
+			want:          "tracee-rules stopped: 10 events, 2 findings\n",
+			wantErr:       "signatures didn't handle their pending events within the drain timeout",
+		},
+		{
+			name:    "outputs not flushed",
+			stats:   engine.Stats{Events: 10, Findings: 2, Drained: true},
+			want:    "tracee-rules stopped: 10 events, 2 findings\n",
+			wantErr: "findings weren't flushed to the outputs within the drain timeout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := printSummary(&buf, tc.stats, tc.outputFlushed)
+			assert.Equal(t, tc.want, buf.String())
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
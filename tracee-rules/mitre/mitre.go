@@ -0,0 +1,164 @@
+// Package mitre maps signatures to the tactics and techniques of MITRE ATT&CK, which are validated against an
+// embedded dataset of ATT&CK Enterprise
+package mitre
+
+import (
+	_ "embed"
+
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// datasetJSON is a subset of ATT&CK Enterprise: all of its tactics, and the techniques that apply to Linux and
+// containers
+//
+//go:embed enterprise-attack.json
+var datasetJSON []byte
+
+const baseURL = "https://attack.mitre.org"
+
+// Tactic is an ATT&CK tactic, e.g. TA0005 Defense Evasion
+type Tactic struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// URL returns the page of the tactic on the ATT&CK website
+func (t Tactic) URL() string {
+	return fmt.Sprintf("%s/tactics/%s/", baseURL, t.ID)
+}
+
+// Technique is an ATT&CK technique or sub-technique, e.g. T1036 Masquerading or T1574.006 Dynamic Linker Hijacking
+type Technique struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tactics []string `json:"tactics"` // the IDs of the tactics of the technique
+}
+
+// URL returns the page of the technique on the ATT&CK website
+func (t Technique) URL() string {
+	return fmt.Sprintf("%s/techniques/%s/", baseURL, strings.ReplaceAll(t.ID, ".", "/"))
+}
+
+type dataset struct {
+	Version    string      `json:"version"`
+	Tactics    []Tactic    `json:"tactics"`
+	Techniques []Technique `json:"techniques"`
+}
+
+var (
+	attack         dataset
+	tacticsByID    map[string]Tactic
+	techniquesByID map[string]Technique
+)
+
+func init() {
+	if err := json.Unmarshal(datasetJSON, &attack); err != nil {
+		panic(fmt.Sprintf("parsing the ATT&CK dataset: %v", err))
+	}
+	tacticsByID = make(map[string]Tactic, len(attack.Tactics))
+	for _, t := range attack.Tactics {
+		tacticsByID[t.ID] = t
+	}
+	techniquesByID = make(map[string]Technique, len(attack.Techniques))
+	for _, t := range attack.Techniques {
+		techniquesByID[t.ID] = t
+	}
+}
+
+// Version returns the version of ATT&CK that the dataset is of
+func Version() string {
+	return attack.Version
+}
+
+// Tactics returns the tactics, in the order of the ATT&CK matrix
+func Tactics() []Tactic {
+	return append([]Tactic(nil), attack.Tactics...)
+}
+
+// LookupTactic returns the tactic of an ID
+func LookupTactic(id string) (Tactic, bool) {
+	t, ok := tacticsByID[id]
+	return t, ok
+}
+
+// LookupTechnique returns the technique of an ID
+func LookupTechnique(id string) (Technique, bool) {
+	t, ok := techniquesByID[id]
+	return t, ok
+}
+
+// FindTactic returns the tactic of an ID or a name, ignoring case
+func FindTactic(s string) (Tactic, bool) {
+	for _, t := range attack.Tactics {
+		if strings.EqualFold(t.ID, s) || strings.EqualFold(t.Name, s) {
+			return t, true
+		}
+	}
+	return Tactic{}, false
+}
+
+// Validate returns an error if a mapping has IDs that aren't in the dataset, or a technique that isn't of any of the
+// tactics of the mapping
+func Validate(m types.MitreMapping) error {
+	tactics := make(map[string]bool, len(m.Tactics))
+	for _, id := range m.Tactics {
+		if _, ok := tacticsByID[id]; !ok {
+			return fmt.Errorf("unknown tactic %s", id)
+		}
+		tactics[id] = true
+	}
+	for _, id := range m.Techniques {
+		t, ok := techniquesByID[id]
+		if !ok {
+			return fmt.Errorf("unknown technique %s", id)
+		}
+		if len(m.Tactics) == 0 {
+			continue
+		}
+		ofTactics := false
+		for _, tactic := range t.Tactics {
+			ofTactics = ofTactics || tactics[tactic]
+		}
+		if !ofTactics {
+			return fmt.Errorf("technique %s isn't of tactics %s", id, strings.Join(m.Tactics, ", "))
+		}
+	}
+	return nil
+}
+
+// Resolve returns the tactics and techniques of a mapping, with their names and URLs, or nil if the mapping is empty.
+// IDs that aren't in the dataset are skipped.
+func Resolve(m types.MitreMapping) *types.MitreAttack {
+	if len(m.Tactics) == 0 && len(m.Techniques) == 0 {
+		return nil
+	}
+	res := &types.MitreAttack{}
+	for _, id := range m.Tactics {
+		if t, ok := tacticsByID[id]; ok {
+			res.Tactics = append(res.Tactics, types.MitreItem{ID: t.ID, Name: t.Name, URL: t.URL()})
+		}
+	}
+	for _, id := range m.Techniques {
+		if t, ok := techniquesByID[id]; ok {
+			res.Techniques = append(res.Techniques, types.MitreItem{ID: t.ID, Name: techniqueName(t), URL: t.URL()})
+		}
+	}
+	return res
+}
+
+// techniqueName returns the name of a technique, where the name of a sub-technique is prefixed by the name of its
+// parent technique, e.g. Hijack Execution Flow: Dynamic Linker Hijacking
+func techniqueName(t Technique) string {
+	i := strings.IndexByte(t.ID, '.')
+	if i < 0 {
+		return t.Name
+	}
+	if parent, ok := techniquesByID[t.ID[:i]]; ok {
+		return parent.Name + ": " + t.Name
+	}
+	return t.Name
+}
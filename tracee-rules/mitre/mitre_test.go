@@ -0,0 +1,94 @@
+package mitre_test
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-rules/mitre"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataset(t *testing.T) {
+	tactics := mitre.Tactics()
+	require.Len(t, tactics, 14)
+	assert.Equal(t, mitre.Tactic{ID: "TA0043", Name: "Reconnaissance"}, tactics[0])
+
+	for _, tactic := range tactics {
+		_, ok := mitre.LookupTactic(tactic.ID)
+		assert.True(t, ok)
+	}
+	technique, ok := mitre.LookupTechnique("T1574.006")
+	require.True(t, ok)
+	assert.Equal(t, "https://attack.mitre.org/techniques/T1574/006/", technique.URL())
+	for _, id := range technique.Tactics {
+		_, ok := mitre.LookupTactic(id)
+		assert.True(t, ok, id)
+	}
+
+	tactic, ok := mitre.FindTactic("defense evasion")
+	require.True(t, ok)
+	assert.Equal(t, "TA0005", tactic.ID)
+	assert.Equal(t, "https://attack.mitre.org/tactics/TA0005/", tactic.URL())
+	_, ok = mitre.FindTactic("lunch")
+	assert.False(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mapping types.MitreMapping
+		wantErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "valid",
+			mapping: types.MitreMapping{Tactics: []string{"TA0003"}, Techniques: []string{"T1574.006"}},
+		},
+		{
+			name:    "techniques only",
+			mapping: types.MitreMapping{Techniques: []string{"T1036"}},
+		},
+		{
+			name:    "unknown tactic",
+			mapping: types.MitreMapping{Tactics: []string{"Defense Evasion"}},
+			wantErr: "unknown tactic Defense Evasion",
+		},
+		{
+			name:    "unknown technique",
+			mapping: types.MitreMapping{Tactics: []string{"TA0005"}, Techniques: []string{"T9999"}},
+			wantErr: "unknown technique T9999",
+		},
+		{
+			name:    "technique of another tactic",
+			mapping: types.MitreMapping{Tactics: []string{"TA0005", "TA0006"}, Techniques: []string{"T1611"}},
+			wantErr: "technique T1611 isn't of tactics TA0005, TA0006",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mitre.Validate(tc.mapping)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert.Nil(t, mitre.Resolve(types.MitreMapping{}))
+	assert.Equal(t, &types.MitreAttack{
+		Tactics: []types.MitreItem{
+			{ID: "TA0003", Name: "Persistence", URL: "https://attack.mitre.org/tactics/TA0003/"},
+		},
+		Techniques: []types.MitreItem{
+			{ID: "T1574.006", Name: "Hijack Execution Flow: Dynamic Linker Hijacking", URL: "https://attack.mitre.org/techniques/T1574/006/"},
+			{ID: "T1574", Name: "Hijack Execution Flow", URL: "https://attack.mitre.org/techniques/T1574/"},
+		},
+	}, mitre.Resolve(types.MitreMapping{Tactics: []string{"TA0003"}, Techniques: []string{"T1574.006", "T1574"}}))
+}
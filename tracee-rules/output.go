@@ -24,7 +24,12 @@ Signature: {{ .SigMetadata.Name }}
 Data: {{ .Data }}
 Command: {{ .Context.ProcessName }}
 Hostname: {{ .Context.HostName }}
-`
+{{ with .Mitre }}{{ range .Tactics }}MITRE ATT&CK Tactic: {{ .ID }} {{ .Name }} ({{ .URL }})
+{{ end }}{{ range .Techniques }}MITRE ATT&CK Technique: {{ .ID }} {{ .Name }} ({{ .URL }})
+{{ end }}{{ end }}{{ with .Incident }}Incident: {{ .ID }} (severity {{ .Severity }}, {{ .Findings }} findings)
+{{ range .Timeline }}  {{ .Timestamp }} {{ .SignatureID }} {{ .SignatureName }} (process: {{ .ProcessName }}, pid: {{ .HostProcessID }})
+{{ end }}{{ end }}{{ range .Artifacts }}Artifact: {{ .Path }} (sha256: {{ .SHA256 }}, {{ .Size }} bytes)
+{{ end }}`
 
 func setupTemplate(inputTemplateFile string) (*template.Template, error) {
 	switch {
@@ -39,24 +44,36 @@ func setupTemplate(inputTemplateFile string) (*template.Template, error) {
 	}
 }
 
-func setupOutput(w io.Writer, webhook string, webhookTemplate string, contentType string, outputTemplate string) (chan types.Finding, error) {
-	out := make(chan types.Finding)
-	var err error
+// setupOutput starts writing the findings of the returned channel to w, and sending them to the webhook, until the
+// channel is closed. The returned flushed channel is closed once all of the findings were written and sent
+func setupOutput(w io.Writer, artifacts *artifactResolver, webhook string, webhookTemplate string, contentType string, outputTemplate string) (out chan types.Finding, flushed <-chan struct{}, err error) {
+	out = make(chan types.Finding)
+	done := make(chan struct{})
 
 	var tWebhook *template.Template
 	tWebhook, err = setupTemplate(webhookTemplate)
 	if err != nil && webhookTemplate != "" {
-		return nil, fmt.Errorf("error preparing webhook template: %v", err)
+		return nil, nil, fmt.Errorf("error preparing webhook template: %v", err)
 	}
 
 	var tOutput *template.Template
 	tOutput, err = setupTemplate(outputTemplate)
 	if err != nil && outputTemplate != "" {
-		return nil, fmt.Errorf("error preparing output template: %v", err)
+		return nil, nil, fmt.Errorf("error preparing output template: %v", err)
+	}
+
+	var findings <-chan types.Finding = out
+	var evidenceWritten <-chan struct{}
+	if artifacts != nil {
+		findings, evidenceWritten = artifacts.attach(out)
 	}
 
 	go func(w io.Writer, tWebhook, tOutput *template.Template) {
-		for res := range out {
+		defer close(done)
+		if evidenceWritten != nil {
+			defer func() { <-evidenceWritten }()
+		}
+		for res := range findings {
 			switch res.Context.(type) {
 			case tracee.Event:
 				if err := tOutput.Execute(w, res); err != nil {
@@ -74,7 +91,7 @@ func setupOutput(w io.Writer, webhook string, webhookTemplate string, contentTyp
 			}
 		}
 	}(w, tWebhook, tOutput)
-	return out, nil
+	return out, done, nil
 }
 
 func sendToWebhook(t *template.Template, res types.Finding, webhook string, webhookTemplate string, contentType string) error {
@@ -60,6 +60,8 @@ func Test_setupOutput(t *testing.T) {
 		name           string
 		inputContext   interface{}
 		outputFormat   string
+		mitre          *types.MitreAttack
+		incident       *types.Incident
 		expectedOutput string
 	}{
 		{
@@ -91,6 +93,52 @@ HostName: foobar.local
 `,
 			outputFormat: "templates/simple.tmpl",
 		},
+		{
+			name: "happy path with tracee event and MITRE ATT&CK mapping",
+			inputContext: external.Event{
+				ProcessName: "foobar.exe",
+				HostName:    "foobar.local",
+			},
+			mitre: &types.MitreAttack{
+				Tactics:    []types.MitreItem{{ID: "TA0005", Name: "Defense Evasion", URL: "https://attack.mitre.org/tactics/TA0005/"}},
+				Techniques: []types.MitreItem{{ID: "T1036", Name: "Masquerading", URL: "https://attack.mitre.org/techniques/T1036/"}},
+			},
+			expectedOutput: `*** Detection ***
+Timestamp: 2021-02-23T01:54:57Z
+ProcessName: foobar.exe
+HostName: foobar.local
+MITRE ATT&CK Tactic: TA0005 Defense Evasion (https://attack.mitre.org/tactics/TA0005/)
+MITRE ATT&CK Technique: T1036 Masquerading (https://attack.mitre.org/techniques/T1036/)
+`,
+			outputFormat: "templates/simple.tmpl",
+		},
+		{
+			name: "happy path with tracee event and incident",
+			inputContext: external.Event{
+				ProcessName: "foobar.exe",
+				HostName:    "foobar.local",
+			},
+			incident: &types.Incident{
+				ID:       "INC-1",
+				Severity: 3,
+				Findings: 2,
+				Timeline: []types.IncidentEntry{
+					{Timestamp: 1, SignatureID: "TRC-2", SignatureName: "Anti-Debugging", ProcessName: "foobar.exe", HostProcessID: 42},
+					{Timestamp: 2, SignatureID: "TRC-3", SignatureName: "Code injection", ProcessName: "foobar.exe", HostProcessID: 42},
+				},
+			},
+			expectedOutput: `
+*** Detection ***
+Signature ID: FOO-666
+Signature: foo bar signature
+Data: map[foo1:bar1, baz1 foo2:[bar2 baz2]]
+Command: foobar.exe
+Hostname: foobar.local
+Incident: INC-1 (severity 3, 2 findings)
+  1 TRC-2 Anti-Debugging (process: foobar.exe, pid: 42)
+  2 TRC-3 Code injection (process: foobar.exe, pid: 42)
+`,
+		},
 		{
 			name: "sad path with unknown context",
 			inputContext: struct {
@@ -110,7 +158,7 @@ HostName: foobar.local
 
 	for _, tc := range testCases {
 		var actualOutput bytes.Buffer
-		findingCh, err := setupOutput(&actualOutput, "", "", "", tc.outputFormat)
+		findingCh, flushed, err := setupOutput(&actualOutput, nil, "", "", "", tc.outputFormat)
 		require.NoError(t, err, tc.name)
 
 		sm, _ := fakeSignature{}.GetMetadata()
@@ -121,9 +169,12 @@ HostName: foobar.local
 			},
 			Context:     tc.inputContext,
 			SigMetadata: sm,
+			Mitre:       tc.mitre,
+			Incident:    tc.incident,
 		}
 
-		time.Sleep(time.Millisecond)
+		close(findingCh)
+		<-flushed
 		checkOutput(t, tc.name, actualOutput, tc.expectedOutput)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 
+	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"log"
@@ -11,44 +12,118 @@ import (
 	"path/filepath"
 	"plugin"
 	"strings"
+	"time"
 
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
 	"github.com/aquasecurity/tracee/tracee-rules/signatures/rego/regosig"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/rpcplugin"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/wasm/wasmsig"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/open-policy-agent/opa/compile"
 )
 
 //go:embed signatures/rego/helpers.rego
 var regoHelpersCode string
 
-func getSignatures(target string, partialEval bool, rulesDir string, rules []string, aioEnabled bool) ([]types.Signature, error) {
-	if rulesDir == "" {
-		exePath, err := os.Executable()
-		if err != nil {
-			log.Printf("error getting executable path: %v", err)
-		}
-		rulesDir = filepath.Join(filepath.Dir(exePath), "rules")
-	}
+func getSignatures(target string, partialEval bool, rulesDir string, rules []string, aioEnabled bool, rulesData *regosig.RulesData, regoProfiler *regosig.Profiler, wasmLimits wasmsig.Limits) ([]types.Signature, error) {
+	rulesDir = defaultRulesDir(rulesDir)
 	gosigs, err := findGoSigs(rulesDir)
 	if err != nil {
 		return nil, err
 	}
-	opasigs, err := findRegoSigs(target, partialEval, rulesDir, aioEnabled)
+	pluginsigs, err := findPluginSigs(rulesDir)
+	if err != nil {
+		return nil, err
+	}
+	gosigs = append(gosigs, pluginsigs...)
+	wasmsigs, err := findWasmSigs(rulesDir, wasmLimits)
+	if err != nil {
+		return nil, err
+	}
+	gosigs = append(gosigs, wasmsigs...)
+	opasigs, err := findRegoSigs(target, partialEval, rulesDir, aioEnabled, rulesData, regoProfiler, wasmLimits)
 	if err != nil {
 		return nil, err
 	}
 	sigs := append(gosigs, opasigs...)
-	var res []types.Signature
 	if rules == nil {
-		res = sigs
-	} else {
-		for _, s := range sigs {
-			for _, r := range rules {
-				if m, err := s.GetMetadata(); err == nil && m.ID == r {
-					res = append(res, s)
-				}
+		return sigs, nil
+	}
+	return selectSignatures(sigs, rules), nil
+}
+
+// selectSignatures returns the signatures that are selected by their IDs. The signatures that aren't selected are
+// closed, e.g. so that plugins and wasm sandboxes of signatures that aren't loaded are stopped.
+func selectSignatures(sigs []types.Signature, rules []string) []types.Signature {
+	var res []types.Signature
+	for _, s := range sigs {
+		var selected bool
+		if group, ok := s.(types.SignatureGroup); ok {
+			selected = selectGroupSignatures(group, rules)
+		} else if m, err := s.GetMetadata(); err == nil {
+			selected = containsString(rules, m.ID)
+		}
+		if !selected {
+			s.Close()
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// defaultRulesDir returns rulesDir, or the rules directory next to the executable if it's empty
+func defaultRulesDir(rulesDir string) string {
+	if rulesDir != "" {
+		return rulesDir
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Printf("error getting executable path: %v", err)
+	}
+	return filepath.Join(filepath.Dir(exePath), "rules")
+}
+
+// selectGroupSignatures removes the signatures that aren't selected from a group, and returns whether any signature
+// is left in the group
+func selectGroupSignatures(group types.SignatureGroup, rules []string) bool {
+	metas, err := group.GetSignaturesMetadata()
+	if err != nil {
+		log.Printf("error getting metadata of signature group: %v", err)
+		return false
+	}
+	selected := 0
+	for _, m := range metas {
+		if !containsString(rules, m.ID) {
+			if err := group.RemoveSignature(m.ID); err != nil {
+				log.Printf("error unloading signature %s: %v", m.ID, err)
 			}
+			continue
 		}
+		selected++
 	}
-	return res, nil
+	return selected > 0
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// signaturesMetadata returns the metadata of a signature, or the metadata of the signatures of a group
+func signaturesMetadata(sig types.Signature) ([]types.SignatureMetadata, error) {
+	if group, ok := sig.(types.SignatureGroup); ok {
+		return group.GetSignaturesMetadata()
+	}
+	m, err := sig.GetMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return []types.SignatureMetadata{m}, nil
 }
 
 func findGoSigs(dir string) ([]types.Signature, error) {
@@ -79,7 +154,67 @@ func findGoSigs(dir string) ([]types.Signature, error) {
 	return res, nil
 }
 
-func findRegoSigs(target string, partialEval bool, dir string, aioEnabled bool) ([]types.Signature, error) {
+// findPluginSigs starts the plugin executables in dir, which run signatures out of process
+func findPluginSigs(dir string) ([]types.Signature, error) {
+	var res []types.Signature
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(d.Name()) != rpcplugin.PluginExt {
+			return nil
+		}
+
+		sigs, err := rpcplugin.Load(path)
+		if err != nil {
+			log.Printf("error loading plugin %s: %v", path, err)
+			return nil
+		}
+		res = append(res, sigs...)
+		return nil
+	})
+	return res, nil
+}
+
+// findWasmSigs loads the WebAssembly modules in dir, which implement the tracee signature ABI
+func findWasmSigs(dir string, limits wasmsig.Limits) ([]types.Signature, error) {
+	var res []types.Signature
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(d.Name()) != ".wasm" {
+			return nil
+		}
+
+		binary, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("error reading file %s: %v", path, err)
+			return nil
+		}
+		sig, err := wasmsig.NewSignature(limits, binary)
+		if err != nil {
+			log.Printf("error loading wasm signature %s: %v", path, err)
+			return nil
+		}
+		res = append(res, sig)
+		return nil
+	})
+	return res, nil
+}
+
+func findRegoSigs(target string, partialEval bool, dir string, aioEnabled bool, rulesData *regosig.RulesData, regoProfiler *regosig.Profiler, wasmLimits wasmsig.Limits) ([]types.Signature, error) {
+	if aioEnabled && target == compile.TargetWasm {
+		return nil, fmt.Errorf("--rego-aio isn't supported with the wasm runtime target")
+	}
+	if rulesData != nil && target == compile.TargetWasm {
+		return nil, fmt.Errorf("--rules-data isn't supported with the wasm runtime target")
+	}
+	if regoProfiler != nil && target == compile.TargetWasm {
+		return nil, fmt.Errorf("--rego-profile isn't supported with the wasm runtime target")
+	}
 	modules := make(map[string]string)
 	modules["helper.rego"] = regoHelpersCode
 
@@ -127,7 +262,16 @@ func findRegoSigs(target string, partialEval bool, dir string, aioEnabled bool)
 		if aioEnabled {
 			return nil
 		}
-		sig, err := regosig.NewRegoSignature(target, partialEval, append(regoHelpers, string(regoCode))...)
+		var sig types.Signature
+		if target == compile.TargetWasm {
+			sig, err = wasmsig.NewRegoSignature(wasmLimits, partialEval, append(regoHelpers, string(regoCode))...)
+		} else {
+			sig, err = regosig.NewRegoSignatureWithOptions(append(regoHelpers, string(regoCode)),
+				regosig.OPATarget(target),
+				regosig.OPAPartial(partialEval),
+				regosig.OPAData(rulesData),
+				regosig.OPAProfiler(regoProfiler))
+		}
 		if err != nil {
 			newlineOffset := bytes.Index(regoCode, []byte("\n"))
 			if newlineOffset == -1 {
@@ -147,7 +291,9 @@ func findRegoSigs(target string, partialEval bool, dir string, aioEnabled bool)
 	if aioEnabled {
 		aio, err := regosig.NewAIO(modules,
 			regosig.OPATarget(target),
-			regosig.OPAPartial(partialEval))
+			regosig.OPAPartial(partialEval),
+			regosig.OPAData(rulesData),
+			regosig.OPAProfiler(regoProfiler))
 		if err != nil {
 			return nil, err
 		}
@@ -156,6 +302,70 @@ func findRegoSigs(target string, partialEval bool, dir string, aioEnabled bool)
 	return res, nil
 }
 
+// regoModules returns the modification times of the rego modules in dir, as findRegoSigs loads them
+func regoModules(dir string) map[string]time.Time {
+	res := make(map[string]time.Time)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isRegoFile(d.Name()) || d.Name() == "helpers.rego" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		res[path] = info.ModTime()
+		return nil
+	})
+	return res
+}
+
+// watchRegoModules recompiles the modules of an AIO signature that changed in dir, and updates the events that the
+// engine selects for it
+func watchRegoModules(e *engine.Engine, aio *regosig.AIO, dir string, interval time.Duration) {
+	modules := regoModules(dir)
+	for range time.Tick(interval) {
+		current := regoModules(dir)
+		changed := false
+		for path, modTime := range current {
+			if prev, ok := modules[path]; ok && prev.Equal(modTime) {
+				continue
+			}
+			code, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Printf("error reading file %s: %v", path, err)
+				continue
+			}
+			if err := aio.UpdateModule(path, string(code)); err != nil {
+				log.Printf("error recompiling rego module %s: %v", path, err)
+				continue
+			}
+			log.Printf("recompiled rego module %s", path)
+			modules[path] = modTime
+			changed = true
+		}
+		for path := range modules {
+			if _, ok := current[path]; ok {
+				continue
+			}
+			if err := aio.RemoveModule(path); err != nil {
+				log.Printf("error removing rego module %s: %v", path, err)
+				continue
+			}
+			log.Printf("removed rego module %s", path)
+			delete(modules, path)
+			changed = true
+		}
+		if changed {
+			if err := e.ReindexSignature(aio); err != nil {
+				log.Printf("error updating selected events: %v", err)
+			}
+		}
+	}
+}
+
 func isRegoFile(name string) bool {
 	return filepath.Ext(name) == ".rego"
 }
@@ -11,13 +11,14 @@ import (
 
 	"github.com/open-policy-agent/opa/compile"
 
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/wasm/wasmsig"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func Test_getSignatures(t *testing.T) {
-	sigs, err := getSignatures(compile.TargetRego, false, "signatures/rego", []string{"TRC-2"}, false)
+	sigs, err := getSignatures(compile.TargetRego, false, "signatures/rego", []string{"TRC-2"}, false, nil, nil, wasmsig.DefaultLimits)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(sigs))
 
@@ -33,9 +34,25 @@ func Test_getSignatures(t *testing.T) {
 			"MITRE ATT&CK": "Defense Evasion: Execution Guardrails",
 			"Severity":     json.Number("3"),
 		},
+		Mitre: types.MitreMapping{
+			Tactics:    []string{"TA0005"},
+			Techniques: []string{"T1480"},
+		},
 	}, gotMetadata)
 }
 
+func Test_getSignatures_AIO(t *testing.T) {
+	sigs, err := getSignatures(compile.TargetRego, false, "signatures/rego", []string{"TRC-2", "TRC-3"}, true, nil, nil, wasmsig.DefaultLimits)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sigs))
+
+	metadata, err := signaturesMetadata(sigs[0])
+	require.NoError(t, err)
+	require.Equal(t, 2, len(metadata))
+	assert.Equal(t, "TRC-2", metadata[0].ID)
+	assert.Equal(t, "TRC-3", metadata[1].ID)
+}
+
 func Test_isHelper(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -78,25 +95,33 @@ func Test_findRegoSigs(t *testing.T) {
 	err = copyExampleSig("anti_debugging_ptraceme.rego", testDir)
 	require.NoError(t, err)
 
-	// find rego signatures
-	sigs, err := findRegoSigs(compile.TargetRego, false, testRoot, false)
-	require.NoError(t, err)
-
-	assert.Equal(t, len(sigs), 2)
-	for _, sig := range sigs {
-		gotMetadata, err := sig.GetMetadata()
-		require.NoError(t, err)
-		assert.Equal(t, types.SignatureMetadata{
-			ID:          "TRC-2",
-			Version:     "0.1.0",
-			Name:        "Anti-Debugging",
-			Description: "Process uses anti-debugging technique to block debugger",
-			Tags:        []string{"linux", "container"},
-			Properties: map[string]interface{}{
-				"MITRE ATT&CK": "Defense Evasion: Execution Guardrails",
-				"Severity":     json.Number("3"),
-			},
-		}, gotMetadata)
+	for _, target := range []string{compile.TargetRego, compile.TargetWasm} {
+		t.Run(target, func(t *testing.T) {
+			// find rego signatures
+			sigs, err := findRegoSigs(target, false, testRoot, false, nil, nil, wasmsig.DefaultLimits)
+			require.NoError(t, err)
+
+			assert.Equal(t, len(sigs), 2)
+			for _, sig := range sigs {
+				gotMetadata, err := sig.GetMetadata()
+				require.NoError(t, err)
+				assert.Equal(t, types.SignatureMetadata{
+					ID:          "TRC-2",
+					Version:     "0.1.0",
+					Name:        "Anti-Debugging",
+					Description: "Process uses anti-debugging technique to block debugger",
+					Tags:        []string{"linux", "container"},
+					Properties: map[string]interface{}{
+						"MITRE ATT&CK": "Defense Evasion: Execution Guardrails",
+						"Severity":     json.Number("3"),
+					},
+					Mitre: types.MitreMapping{
+						Tactics:    []string{"TA0005"},
+						Techniques: []string{"T1480"},
+					},
+				}, gotMetadata)
+			}
+		})
 	}
 }
 
@@ -149,3 +174,32 @@ func Test_isRegoFile(t *testing.T) {
 		})
 	}
 }
+
+type closedSignature struct {
+	fakeSignature
+	closed *bool
+}
+
+func (s closedSignature) Close() {
+	*s.closed = true
+}
+
+func Test_selectSignatures(t *testing.T) {
+	closed := make([]bool, 2)
+	sigs := []types.Signature{
+		closedSignature{fakeSignature: fakeSignature{getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-1"}, nil
+		}}, closed: &closed[0]},
+		closedSignature{fakeSignature: fakeSignature{getMetadata: func() (types.SignatureMetadata, error) {
+			return types.SignatureMetadata{ID: "TRC-2"}, nil
+		}}, closed: &closed[1]},
+	}
+
+	res := selectSignatures(sigs, []string{"TRC-2"})
+	require.Len(t, res, 1)
+	m, err := res[0].GetMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, "TRC-2", m.ID)
+	// the signatures that aren't selected are closed
+	assert.Equal(t, []bool{true, false}, closed)
+}
@@ -1,24 +1,20 @@
 package main
 
 import (
-	"fmt"
 	"strings"
 
-	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
-	"github.com/aquasecurity/tracee/tracee-rules/signatures/helpers"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/sdk"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 )
 
 type K8sApiConnection struct {
-	cb                    types.SignatureHandler
+	sdk.Base
 	apiAddressContainerId map[string]string
 }
 
 func (sig *K8sApiConnection) Init(cb types.SignatureHandler) error {
-	sig.cb = cb
 	sig.apiAddressContainerId = make(map[string]string)
-
-	return nil
+	return sig.Base.Init(cb)
 }
 
 func (sig *K8sApiConnection) GetMetadata() (types.SignatureMetadata, error) {
@@ -32,6 +28,10 @@ func (sig *K8sApiConnection) GetMetadata() (types.SignatureMetadata, error) {
 			"Severity":     1,
 			"MITRE ATT&CK": "Discovery: Cloud Service Discovery",
 		},
+		Mitre: types.MitreMapping{
+			Tactics:    []string{"TA0007"},
+			Techniques: []string{"T1526"},
+		},
 	}, nil
 }
 
@@ -43,9 +43,9 @@ func (sig *K8sApiConnection) GetSelectedEvents() ([]types.SignatureEventSelector
 }
 
 func (sig *K8sApiConnection) OnEvent(e types.Event) error {
-	eventObj, ok := e.(tracee.Event)
-	if !ok {
-		return fmt.Errorf("invalid event")
+	eventObj, err := sdk.ToTraceeEvent(e)
+	if err != nil {
+		return err
 	}
 
 	containerID := eventObj.ContainerID
@@ -59,11 +59,10 @@ func (sig *K8sApiConnection) OnEvent(e types.Event) error {
 		// the usage of 'envp' argument of the execve event is vulnerable to TOCTOU attack.
 		// in the future we plan to add 'envp' argument to sched_process_exec, and when it'll happen, we should start
 		// using sched_process_exec instead of execve in this signature.
-		envpArg, err := helpers.GetTraceeArgumentByName(eventObj, "envp")
+		envs, err := sdk.GetStringSliceArg(eventObj, "envp")
 		if err != nil {
 			return nil
 		}
-		envs := envpArg.Value.([]string)
 
 		apiIPAddress := getApiAddressFromEnvs(envs)
 		if apiIPAddress != "" {
@@ -77,35 +76,19 @@ func (sig *K8sApiConnection) OnEvent(e types.Event) error {
 			return nil
 		}
 
-		remoteAddrArg, err := helpers.GetTraceeArgumentByName(eventObj, "remote_addr")
-		if err != nil {
-			return err
-		}
-		ip, err := getIPFromAddr(remoteAddrArg)
-		if err != nil || ip == "" {
+		remoteAddr, err := sdk.GetSockaddrArg(eventObj, "remote_addr")
+		if err != nil || remoteAddr.IP == "" {
 			return err
 		}
 
-		if ip == apiAddress {
+		if remoteAddr.IP == apiAddress {
 			m, _ := sig.GetMetadata()
-			sig.cb(types.Finding{
-				SigMetadata: m,
-				Context:     eventObj,
-				Data: map[string]interface{}{
-					"ip": apiAddress,
-				},
-			})
+			sig.Report(sdk.NewFinding(m, eventObj).With("ip", apiAddress).Build())
 		}
 	}
 	return nil
 }
 
-func (sig *K8sApiConnection) OnSignal(s types.Signal) error {
-	return nil
-}
-
-func (sig *K8sApiConnection) Close() {}
-
 func getApiAddressFromEnvs(envs []string) string {
 	for _, env := range envs {
 		if strings.Contains(env, "KUBERNETES_SERVICE_HOST=") {
@@ -115,19 +98,3 @@ func getApiAddressFromEnvs(envs []string) string {
 	}
 	return ""
 }
-
-func getIPFromAddr(addrArg tracee.Argument) (string, error) {
-
-	addr, isOk := addrArg.Value.(map[string]string)
-	if !isOk {
-		return "", fmt.Errorf("couldn't convert arg to addr")
-	}
-
-	if addr["sa_family"] == "AF_INET" {
-		return addr["sin_addr"], nil
-	} else if addr["sa_family"] == "AF_INET6" {
-		return addr["sin6_addr"], nil
-	}
-
-	return "", nil
-}
@@ -85,6 +85,10 @@ func TestK8sApiConnection(t *testing.T) {
 							"Severity":     1,
 							"MITRE ATT&CK": "Discovery: Cloud Service Discovery",
 						},
+						Mitre: types.MitreMapping{
+							Tactics:    []string{"TA0007"},
+							Techniques: []string{"T1526"},
+						},
 					},
 				},
 			},
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"fmt"
-
 	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
-	"github.com/aquasecurity/tracee/tracee-rules/signatures/helpers"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/sdk"
 	"github.com/aquasecurity/tracee/tracee-rules/types"
 )
 
@@ -14,15 +12,13 @@ type connectedAddress struct {
 }
 
 type stdioOverSocket struct {
-	cb              types.SignatureHandler
-	pidFDAddressMap map[int]map[int]connectedAddress
+	sdk.Base
+	fdAddresses *sdk.ProcessState // map[int]connectedAddress of the connected sockets of every process, by fd
 }
 
 func (sig *stdioOverSocket) Init(cb types.SignatureHandler) error {
-	sig.cb = cb
-	sig.pidFDAddressMap = make(map[int]map[int]connectedAddress)
-
-	return nil
+	sig.fdAddresses = sdk.NewProcessState()
+	return sig.Base.Init(cb)
 }
 
 func (sig *stdioOverSocket) GetMetadata() (types.SignatureMetadata, error) {
@@ -36,6 +32,10 @@ func (sig *stdioOverSocket) GetMetadata() (types.SignatureMetadata, error) {
 			"Severity":     3,
 			"MITRE ATT&CK": "Persistence: Server Software Component",
 		},
+		Mitre: types.MitreMapping{
+			Tactics:    []string{"TA0003"},
+			Techniques: []string{"T1505"},
+		},
 	}, nil
 }
 
@@ -52,152 +52,112 @@ func (sig *stdioOverSocket) GetSelectedEvents() ([]types.SignatureEventSelector,
 
 func (sig *stdioOverSocket) OnEvent(e types.Event) error {
 
-	eventObj, ok := e.(tracee.Event)
-	if !ok {
-		return fmt.Errorf("invalid event")
+	eventObj, err := sdk.ToTraceeEvent(e)
+	if err != nil {
+		return err
 	}
 
-	pid := eventObj.ProcessID
+	var fdAddresses map[int]connectedAddress
+	if state, ok := sig.fdAddresses.Get(eventObj); ok {
+		fdAddresses = state.(map[int]connectedAddress)
+	}
 
 	switch eventObj.EventName {
 
 	case "security_socket_connect":
 
-		remoteAddrArg, err := helpers.GetTraceeArgumentByName(eventObj, "remote_addr")
+		remoteAddr, err := sdk.GetSockaddrArg(eventObj, "remote_addr")
 		if err != nil {
 			return err
 		}
+		address := connectedAddress{ip: remoteAddr.IP, port: remoteAddr.Port}
 
-		var address connectedAddress
-		address, err = getAddressfromAddrArg(remoteAddrArg)
+		sockfd, err := sdk.GetIntArg(eventObj, "sockfd")
 		if err != nil {
 			return err
 		}
 
-		sockfdArg, err := helpers.GetTraceeArgumentByName(eventObj, "sockfd")
-		if err != nil {
-			return err
-		}
-
-		sockfd := int(sockfdArg.Value.(int32))
-
-		err = isSocketOverStdio(sig, eventObj, address, sockfd)
-		if err != nil {
-			return err
-		}
+		sig.reportIfStdio(eventObj, address, sockfd)
 
-		_, pidExists := sig.pidFDAddressMap[pid]
-		if !pidExists {
-			sig.pidFDAddressMap[pid] = make(map[int]connectedAddress)
+		if fdAddresses == nil {
+			fdAddresses = make(map[int]connectedAddress)
+			sig.fdAddresses.Set(eventObj, fdAddresses)
 		}
 
 		if address.ip != "" && address.port != "" {
-			sig.pidFDAddressMap[pid][sockfd] = address
+			fdAddresses[sockfd] = address
 		}
 
 	case "dup":
 
-		pidSocketMap, pidExists := sig.pidFDAddressMap[pid]
-
-		if !pidExists {
+		if fdAddresses == nil {
 			return nil
 		}
 
-		oldFdArg, err := helpers.GetTraceeArgumentByName(eventObj, "oldfd")
+		srcFd, err := sdk.GetIntArg(eventObj, "oldfd")
 		if err != nil {
 			return err
 		}
 
-		srcFd := int(oldFdArg.Value.(int32))
-
-		dstFd := eventObj.ReturnValue
-
-		err = isSocketDuplicatedIntoStdio(sig, eventObj, pidSocketMap, srcFd, dstFd)
-		if err != nil {
-			return err
-		}
+		sig.reportIfDuplicatedIntoStdio(eventObj, fdAddresses, srcFd, eventObj.ReturnValue)
 
 	case "dup2", "dup3":
 
-		pidSocketMap, pidExists := sig.pidFDAddressMap[pid]
-
-		if !pidExists {
+		if fdAddresses == nil {
 			return nil
 		}
 
-		oldFdArg, err := helpers.GetTraceeArgumentByName(eventObj, "oldfd")
+		srcFd, err := sdk.GetIntArg(eventObj, "oldfd")
 		if err != nil {
 			return err
 		}
 
-		srcFd := int(oldFdArg.Value.(int32))
-
-		newFdArg, err := helpers.GetTraceeArgumentByName(eventObj, "newfd")
+		dstFd, err := sdk.GetIntArg(eventObj, "newfd")
 		if err != nil {
 			return err
 		}
 
-		dstFd := int(newFdArg.Value.(int32))
-
-		err = isSocketDuplicatedIntoStdio(sig, eventObj, pidSocketMap, srcFd, dstFd)
-		if err != nil {
-			return err
-		}
+		sig.reportIfDuplicatedIntoStdio(eventObj, fdAddresses, srcFd, dstFd)
 
 	case "close":
 
-		currentFdArg, err := helpers.GetTraceeArgumentByName(eventObj, "fd")
+		currentFd, err := sdk.GetIntArg(eventObj, "fd")
 		if err != nil {
 			return err
 		}
 
-		currentFd := int(currentFdArg.Value.(int32))
-
-		delete(sig.pidFDAddressMap[pid], currentFd)
+		delete(fdAddresses, currentFd)
 
 	case "sched_process_exit":
 
-		delete(sig.pidFDAddressMap, pid)
+		sig.fdAddresses.OnEvent(eventObj)
 
 	}
 
 	return nil
 }
 
-func (sig *stdioOverSocket) OnSignal(s types.Signal) error {
-	return nil
-}
-func (sig *stdioOverSocket) Close() {}
-
-func isSocketDuplicatedIntoStdio(sig *stdioOverSocket, eventObj tracee.Event, pidSocketMap map[int]connectedAddress, srcFd int, dstFd int) error {
-	address, socketfdExists := pidSocketMap[srcFd]
+func (sig *stdioOverSocket) reportIfDuplicatedIntoStdio(eventObj tracee.Event, fdAddresses map[int]connectedAddress, srcFd int, dstFd int) {
+	address, socketfdExists := fdAddresses[srcFd]
 
 	// this means that a socket FD is duplicated into one of the standard FDs
 	if socketfdExists {
-		isSocketOverStdio(sig, eventObj, address, dstFd)
+		sig.reportIfStdio(eventObj, address, dstFd)
 	}
-
-	return nil
 }
 
-func isSocketOverStdio(sig *stdioOverSocket, eventObj tracee.Event, address connectedAddress, fd int) error {
+func (sig *stdioOverSocket) reportIfStdio(eventObj tracee.Event, address connectedAddress, fd int) {
 
 	stdAll := []int{0, 1, 2}
 
 	if intInSlice(fd, stdAll) {
 		m, _ := sig.GetMetadata()
-		sig.cb(types.Finding{
-			SigMetadata: m,
-			Context:     eventObj,
-			Data: map[string]interface{}{
-				"ip":   address.ip,
-				"port": address.port,
-				"fd":   fd,
-			},
-		})
+		sig.Report(sdk.NewFinding(m, eventObj).
+			With("ip", address.ip).
+			With("port", address.port).
+			With("fd", fd).
+			Build())
 	}
-
-	return nil
 }
 
 func intInSlice(a int, list []int) bool {
@@ -208,19 +168,3 @@ func intInSlice(a int, list []int) bool {
 	}
 	return false
 }
-
-func getAddressfromAddrArg(arg tracee.Argument) (connectedAddress, error) {
-
-	addr, isOk := arg.Value.(map[string]string)
-	if !isOk {
-		return connectedAddress{}, fmt.Errorf("couldn't convert arg to addr")
-	}
-
-	if addr["sa_family"] == "AF_INET" {
-		return connectedAddress{ip: addr["sin_addr"], port: addr["sin_port"]}, nil
-	} else if addr["sa_family"] == "AF_INET6" {
-		return connectedAddress{ip: addr["sin6_addr"], port: addr["sin6_port"]}, nil
-	}
-
-	return connectedAddress{}, nil
-}
@@ -22,6 +22,10 @@ func TestStdioOverSocket(t *testing.T) {
 			"Severity":     3,
 			"MITRE ATT&CK": "Persistence: Server Software Component",
 		},
+		Mitre: types.MitreMapping{
+			Tactics:    []string{"TA0003"},
+			Techniques: []string{"T1505"},
+		},
 	}
 
 	testCases := []struct {
@@ -9,6 +9,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 3,
         "MITRE ATT&CK": "Defense Evasion: Execution Guardrails",
+    },
+    "mitre": {
+        "tactics": ["TA0005"],
+        "techniques": ["T1480"]
     }
 }
 
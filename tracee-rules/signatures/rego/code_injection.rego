@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 3,
         "MITRE ATT&CK": "Defense Evasion: Process Injection",
+    },
+    "mitre": {
+        "tactics": ["TA0005"],
+        "techniques": ["T1055"]
     }
 }
 
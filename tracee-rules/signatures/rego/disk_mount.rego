@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 3,
         "MITRE ATT&CK": "Privilege Escalation: Escape to Host"
+    },
+    "mitre": {
+        "tactics": ["TA0004"],
+        "techniques": ["T1611"]
     }
 }
 
@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 2,
         "MITRE ATT&CK": "Defense Evasion: Masquerading"
+    },
+    "mitre": {
+        "tactics": ["TA0005"],
+        "techniques": ["T1036"]
     }
 }
 
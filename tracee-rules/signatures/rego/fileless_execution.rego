@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 2,
         "MITRE ATT&CK": "Defense Evasion: Obfuscated Files or Information",
+    },
+    "mitre": {
+        "tactics": ["TA0005"],
+        "techniques": ["T1027"]
     }
 }
 
@@ -28,4 +28,9 @@ is_elf_file(string){
     decoded_string := base64.decode(string)
     sub_string := substring(decoded_string, 1, 3)
     lower(sub_string) == "elf"
-}
\ No newline at end of file
+}
+
+# the keys of the state of the process and the container of the event (see tracee.state functions)
+process_state_key(name) = [input.hostProcessId, name]
+
+container_state_key(name) = [input.containerId, name]
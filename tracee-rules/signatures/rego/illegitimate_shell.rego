@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 2,
         "MITRE ATT&CK": "Initial Access: Exploit Public-Facing Application"
+    },
+    "mitre": {
+        "tactics": ["TA0001"],
+        "techniques": ["T1190"]
     }
 }
 
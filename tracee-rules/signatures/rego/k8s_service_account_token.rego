@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 0,
         "MITRE ATT&CK": "Credential Access: Credentials from Password Stores"
+    },
+    "mitre": {
+        "tactics": ["TA0006"],
+        "techniques": ["T1555"]
     }
 }
 
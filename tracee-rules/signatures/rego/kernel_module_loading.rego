@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 3,
         "MITRE ATT&CK": "Persistence: Kernel Modules and Extensions",
+    },
+    "mitre": {
+        "tactics": ["TA0003"],
+        "techniques": ["T1547.006"]
     }
 }
 
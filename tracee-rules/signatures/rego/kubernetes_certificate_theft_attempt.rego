@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 3,
         "MITRE ATT&CK": "Credential Access: Steal Application Access Token"
+    },
+    "mitre": {
+        "tactics": ["TA0006"],
+        "techniques": ["T1528"]
     }
 }
 
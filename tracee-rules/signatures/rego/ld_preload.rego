@@ -11,6 +11,10 @@ __rego_metadoc__ := {
     "properties": {
         "Severity": 2,
         "MITRE ATT&CK": "Persistence: Hijack Execution Flow",
+    },
+    "mitre": {
+        "tactics": ["TA0003"],
+        "techniques": ["T1574.006"]
     }
 }
 
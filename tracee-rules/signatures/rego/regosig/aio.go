@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/aquasecurity/tracee/tracee-ebpf/external"
 	"github.com/aquasecurity/tracee/tracee-rules/engine"
@@ -26,9 +27,10 @@ const (
 	queryMetadataAll       = "data.main.__rego_metadoc_all__"
 	querySelectedEventsAll = "data.main.tracee_selected_events_all"
 	queryMatchAll          = "data.main.tracee_match_all"
+	queryPackageAll        = "data.main.__rego_package_all__"
 )
 
-// Options holds various Option items that can be passed to the NewAIO constructor.
+// Options holds various Option items that can be passed to the NewAIO and NewRegoSignatureWithOptions constructors.
 type Options struct {
 	// OPATarget optionally specifies which OPA target engine to use for
 	// evaluation. By default, the `rego` engine is used.
@@ -43,6 +45,14 @@ type Options struct {
 	//
 	// https://blog.openpolicyagent.org/partial-evaluation-162750eaf422
 	OPAPartial bool
+
+	// OPAData optionally specifies external data that the modules read as
+	// data.tracee.config. By default, there is no data.
+	OPAData *RulesData
+
+	// OPAProfiler optionally specifies a profiler of the evaluations of the
+	// modules. By default, the evaluations aren't profiled.
+	OPAProfiler *Profiler
 }
 
 type Option func(*Options)
@@ -59,6 +69,18 @@ func OPAPartial(partial bool) Option {
 	}
 }
 
+func OPAData(data *RulesData) Option {
+	return func(o *Options) {
+		o.OPAData = data
+	}
+}
+
+func OPAProfiler(p *Profiler) Option {
+	return func(o *Options) {
+		o.OPAProfiler = p
+	}
+}
+
 func newDefaultOptions() *Options {
 	return &Options{
 		OPATarget:  compile.TargetRego,
@@ -66,164 +88,511 @@ func newDefaultOptions() *Options {
 	}
 }
 
-type aio struct {
-	cb       types.SignatureHandler
-	metadata types.SignatureMetadata
+// AIO is a signature that holds the rego signatures of all modules. Each signature package is compiled and prepared
+// together with the helper modules (the modules of packages that aren't signatures), so that a change of a module
+// only compiles its signature again. It keeps the identity of each signature: its findings have the metadata of the
+// signature that matched, and the errors of evaluating a signature are attributed to it.
+type AIO struct {
+	cb      types.SignatureHandler
+	state   *signatureState
+	options *Options
+	profile *evalProfile
+
+	mu             sync.Mutex
+	modules        map[string]*ast.Module // the parsed modules, by path, which are reused when a single module changes
+	policies       map[string]*aioPolicy  // the compiled policies of the signature packages, by package path
+	packages       []string               // the paths of the signature packages, sorted
+	removed        map[string]bool        // the IDs of the removed signatures, which stay removed when their modules are updated
+	metadata       types.SignatureMetadata
+	selectedEvents []types.SignatureEventSelector
+}
 
-	preparedQuery   rego.PreparedEvalQuery
-	sigIDToMetadata map[string]types.SignatureMetadata
-	selectedEvents  []types.SignatureEventSelector
+// aioPolicy is the compiled policy of a signature package and the helper modules
+type aioPolicy struct {
+	compiler              *ast.Compiler
+	preparedQuery         rego.PreparedEvalQuery
+	dataVersion           uint64 // the version of the data that preparedQuery was partially evaluated with
+	sigIDToMetadata       map[string]types.SignatureMetadata
+	sigIDToSelectedEvents map[string][]types.SignatureEventSelector
+	sigIDToPackage        map[string]string
 }
 
 // NewAIO constructs a new types.Signature with the specified Rego modules and Option items.
 //
-// This implementation compiles all modules once and prepares the single,
-// aka all in one, query for evaluation.
-func NewAIO(modules map[string]string, opts ...Option) (types.Signature, error) {
+// This implementation compiles each signature package with the helper modules once, and prepares its query for
+// evaluation.
+func NewAIO(modules map[string]string, opts ...Option) (*AIO, error) {
 	options := newDefaultOptions()
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	modules[moduleMain] = mainRego
-	ctx := context.TODO()
-	compiler, err := ast.CompileModules(modules)
+	parsed := make(map[string]*ast.Module, len(modules)+1)
+	for path, code := range modules {
+		module, err := parseModule(path, code)
+		if err != nil {
+			return nil, fmt.Errorf("compiling modules: %w", err)
+		}
+		parsed[path] = module
+	}
+	module, err := parseModule(moduleMain, mainRego)
 	if err != nil {
 		return nil, fmt.Errorf("compiling modules: %w", err)
 	}
+	parsed[moduleMain] = module
+
+	a := &AIO{
+		// each signature has its own store, since the state functions are scoped by the module that calls them
+		state:    newSignatureState(),
+		options:  options,
+		profile:  options.OPAProfiler.newEvalProfile("TRC-AIO"),
+		modules:  make(map[string]*ast.Module),
+		policies: make(map[string]*aioPolicy),
+		removed:  make(map[string]bool),
+	}
+	if err := a.recompile(parsed); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
 
-	metadataRS, err := rego.New(
+func parseModule(path, code string) (*ast.Module, error) {
+	module, err := ast.ParseModule(path, code)
+	if err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, fmt.Errorf("%s: empty module", path)
+	}
+	return module, nil
+}
+
+// signaturePackages returns the paths of the packages that have signatures, i.e. that define __rego_metadoc__
+func signaturePackages(modules map[string]*ast.Module) map[string]bool {
+	packages := make(map[string]bool)
+	for _, module := range modules {
+		for _, rule := range module.Rules {
+			if rule.Head.Name.Equal(ast.Var("__rego_metadoc__")) {
+				packages[module.Package.Path.String()] = true
+				break
+			}
+		}
+	}
+	return packages
+}
+
+// compile compiles parsed modules to a policy
+func (a *AIO) compile(ctx context.Context, modules map[string]*ast.Module) (*aioPolicy, error) {
+	compiler := ast.NewCompiler()
+	// the compiler copies the modules, so they can be compiled again
+	compiler.Compile(modules)
+	if compiler.Failed() {
+		return nil, fmt.Errorf("compiling modules: %w", compiler.Errors)
+	}
+	p := &aioPolicy{
+		compiler: compiler,
+	}
+
+	metadataRS, err := rego.New(append(a.options.OPAData.options(),
 		rego.Compiler(compiler),
 		rego.Query(queryMetadataAll),
-	).Eval(ctx)
+	)...).Eval(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("evaluating %s query: %w", queryMetadataAll, err)
 	}
-	sigIDToMetadata, err := MapRS(metadataRS).ToSignatureMetadataAll()
+	p.sigIDToMetadata, err = MapRS(metadataRS).ToSignatureMetadataAll()
 	if err != nil {
 		return nil, fmt.Errorf("mapping output to metadata: %w", err)
 	}
 
-	selectedEventsRS, err := rego.New(
+	selectedEventsRS, err := rego.New(append(a.options.OPAData.options(),
 		rego.Compiler(compiler),
 		rego.Query(querySelectedEventsAll),
-	).Eval(ctx)
+	)...).Eval(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("evaluating %s query: %w", querySelectedEventsAll, err)
 	}
-	sigIDToSelectedEvents, err := MapRS(selectedEventsRS).ToSelectedEventsAll()
+	p.sigIDToSelectedEvents, err = MapRS(selectedEventsRS).ToSelectedEventsAll()
 	if err != nil {
 		return nil, fmt.Errorf("mapping output to selected events: %w", err)
 	}
 
-	var peq rego.PreparedEvalQuery
+	packageRS, err := rego.New(
+		rego.Compiler(compiler),
+		rego.Query(queryPackageAll),
+	).Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating %s query: %w", queryPackageAll, err)
+	}
+	p.sigIDToPackage, err = MapRS(packageRS).ToPackageAll()
+	if err != nil {
+		return nil, fmt.Errorf("mapping output to packages: %w", err)
+	}
+
+	if err := a.prepareQuery(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	if options.OPAPartial {
-		pr, err := rego.New(
-			rego.Compiler(compiler),
+// prepareQuery prepares the query of a policy. With partial evaluation, the data is evaluated ahead of time, so the
+// query is prepared again when the data changes.
+func (a *AIO) prepareQuery(ctx context.Context, p *aioPolicy) error {
+	var err error
+	if a.options.OPAPartial {
+		version := a.options.OPAData.currentVersion()
+		pr, err := rego.New(append(a.options.OPAData.options(),
+			rego.Compiler(p.compiler),
 			rego.Query(queryMatchAll),
-		).PartialResult(ctx)
+		)...).PartialResult(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("partially evaluating %s query: %w", queryMatchAll, err)
+			return fmt.Errorf("partially evaluating %s query: %w", queryMatchAll, err)
 		}
-		peq, err = pr.Rego(
-			rego.Target(options.OPATarget),
+		p.preparedQuery, err = pr.Rego(
+			rego.Target(a.options.OPATarget),
 		).PrepareForEval(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("preparing %s query: %w", queryMatch, err)
+			return fmt.Errorf("preparing %s query: %w", queryMatchAll, err)
 		}
-	} else {
-		peq, err = rego.New(
-			rego.Target(options.OPATarget),
-			rego.Compiler(compiler),
-			rego.Query(queryMatchAll),
-		).PrepareForEval(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("preparing %s query: %w", queryMetadataAll, err)
+		p.dataVersion = version
+		return nil
+	}
+	p.preparedQuery, err = rego.New(append(a.options.OPAData.options(),
+		rego.Target(a.options.OPATarget),
+		rego.Compiler(p.compiler),
+		rego.Query(queryMatchAll),
+	)...).PrepareForEval(ctx)
+	if err != nil {
+		return fmt.Errorf("preparing %s query: %w", queryMatchAll, err)
+	}
+	return nil
+}
+
+// UpdateModule adds a module, or replaces the module of path. Only the module is parsed, and only its signature is
+// compiled again, or all the signatures if it's a helper module. If the modules can't be compiled, the previous
+// modules are kept.
+func (a *AIO) UpdateModule(path, code string) error {
+	module, err := parseModule(path, code)
+	if err != nil {
+		return fmt.Errorf("compiling modules: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	modules := a.copyModules()
+	modules[path] = module
+	return a.recompile(modules, path)
+}
+
+// RemoveModule removes the module of path
+func (a *AIO) RemoveModule(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.modules[path]; !ok || path == moduleMain {
+		return fmt.Errorf("module %s isn't loaded", path)
+	}
+	modules := a.copyModules()
+	delete(modules, path)
+	return a.recompile(modules, path)
+}
+
+// RemoveSignature implements the SignatureGroup interface by removing the modules of a signature. Nothing is compiled
+// again, since the signature packages are compiled separately.
+func (a *AIO) RemoveSignature(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for pkgPath, p := range a.policies {
+		pkg, ok := p.sigIDToPackage[id]
+		if !ok {
+			continue
 		}
+		modules := a.copyModules()
+		removeSignatureModules(modules, pkg)
+		a.modules = modules
+		delete(a.policies, pkgPath)
+		a.removed[id] = true
+		a.update()
+		return nil
 	}
+	return fmt.Errorf("signature %s isn't loaded", id)
+}
 
-	var sigIDs []string
-	var selectedEvents []types.SignatureEventSelector
+func removeSignatureModules(modules map[string]*ast.Module, pkg string) {
+	pkgPath := signaturePackagePath(pkg)
+	for path, module := range modules {
+		if module.Package.Path.Equal(pkgPath) {
+			delete(modules, path)
+		}
+	}
+}
 
-	selectedEventsSet := make(map[types.SignatureEventSelector]bool)
+func (a *AIO) copyModules() map[string]*ast.Module {
+	modules := make(map[string]*ast.Module, len(a.modules))
+	for path, module := range a.modules {
+		modules[path] = module
+	}
+	return modules
+}
 
-	for sigID, sigEvents := range sigIDToSelectedEvents {
-		sigIDs = append(sigIDs, sigID)
+// recompile compiles the signature packages of the modules of the changed paths, or all the signature packages if a
+// helper module changed or if no path is given, and replaces the modules and the policies of the signature if they
+// compile. The modules of removed signatures are removed again, e.g. when a module of a removed signature is updated.
+// The lock must be held.
+func (a *AIO) recompile(modules map[string]*ast.Module, changedPaths ...string) error {
+	oldPackages := signaturePackages(a.modules)
+	newPackages := signaturePackages(modules)
+	changed := make(map[string]bool)
+	all := len(changedPaths) == 0
+	for _, path := range changedPaths {
+		// the other signatures may use a helper module, or a signature module that is now a helper module
+		if module := a.modules[path]; module != nil {
+			pkgPath := module.Package.Path.String()
+			if !oldPackages[pkgPath] || !newPackages[pkgPath] && hasPackage(modules, pkgPath) {
+				all = true
+			}
+			changed[pkgPath] = true
+		}
+		if module := modules[path]; module != nil {
+			pkgPath := module.Package.Path.String()
+			if !newPackages[pkgPath] {
+				all = true
+			}
+			changed[pkgPath] = true
+		}
+	}
+	if all {
+		for pkgPath := range oldPackages {
+			changed[pkgPath] = true
+		}
+		for pkgPath := range newPackages {
+			changed[pkgPath] = true
+		}
+	}
+
+	helpers := make(map[string]*ast.Module)
+	for path, module := range modules {
+		if !newPackages[module.Package.Path.String()] {
+			helpers[path] = module
+		}
+	}
+	policies := make(map[string]*aioPolicy, len(a.policies))
+	for pkgPath, p := range a.policies {
+		if !changed[pkgPath] {
+			policies[pkgPath] = p
+		}
+	}
+	type compiled struct {
+		modules map[string]*ast.Module
+		policy  *aioPolicy
+	}
+	var compiledPolicies []compiled
+	for pkgPath := range changed {
+		if !newPackages[pkgPath] {
+			continue
+		}
+		pkgModules := make(map[string]*ast.Module, len(helpers)+1)
+		for path, module := range helpers {
+			pkgModules[path] = module
+		}
+		for path, module := range modules {
+			if module.Package.Path.String() == pkgPath {
+				pkgModules[path] = module
+			}
+		}
+		p, err := a.compile(context.TODO(), pkgModules)
+		if err != nil {
+			return err
+		}
+		removed := false
+		for sigID, pkg := range p.sigIDToPackage {
+			if a.removed[sigID] {
+				removeSignatureModules(modules, pkg)
+				removed = true
+			}
+		}
+		if !removed {
+			policies[pkgPath] = p
+			compiledPolicies = append(compiledPolicies, compiled{pkgModules, p})
+		}
+	}
+	a.modules = modules
+	a.policies = policies
+	a.update()
+	for _, c := range compiledPolicies {
+		a.profileModules(c.modules, c.policy)
+	}
+	return nil
+}
 
-		for _, sigEvent := range sigEvents {
-			if _, value := selectedEventsSet[sigEvent]; !value {
-				selectedEventsSet[sigEvent] = true
-				selectedEvents = append(selectedEvents, sigEvent)
+// hasPackage reports whether any of the modules belongs to the package.
+func hasPackage(modules map[string]*ast.Module, pkgPath string) bool {
+	for _, module := range modules {
+		if module.Package.Path.String() == pkgPath {
+			return true
+		}
+	}
+	return false
+}
+
+// update aggregates the metadata and the selected events of the signatures. The lock must be held.
+func (a *AIO) update() {
+	a.packages = a.packages[:0]
+	for pkgPath := range a.policies {
+		a.packages = append(a.packages, pkgPath)
+	}
+	sort.Strings(a.packages)
+
+	var sigIDs []string
+	a.selectedEvents = nil
+	selectedEventsSet := make(map[types.SignatureEventSelector]bool)
+	for _, pkgPath := range a.packages {
+		for sigID, sigEvents := range a.policies[pkgPath].sigIDToSelectedEvents {
+			sigIDs = append(sigIDs, sigID)
+
+			for _, sigEvent := range sigEvents {
+				if _, value := selectedEventsSet[sigEvent]; !value {
+					selectedEventsSet[sigEvent] = true
+					a.selectedEvents = append(a.selectedEvents, sigEvent)
+				}
 			}
 		}
 	}
 
 	sort.Strings(sigIDs)
-	metadata := types.SignatureMetadata{
+	a.metadata = types.SignatureMetadata{
 		ID:      fmt.Sprintf("TRC-AIO (%s)", strings.Join(sigIDs, ",")),
 		Version: "1.0.0",
 		Name:    "AIO",
 	}
+}
 
-	return &aio{
-		metadata:        metadata,
-		preparedQuery:   peq,
-		sigIDToMetadata: sigIDToMetadata,
-		selectedEvents:  selectedEvents,
-	}, nil
+// profileModules attributes the expressions of the modules of each signature to the signature in the profile
+func (a *AIO) profileModules(modules map[string]*ast.Module, p *aioPolicy) {
+	if a.profile == nil {
+		return
+	}
+	for sigID, pkg := range p.sigIDToPackage {
+		pkgPath := signaturePackagePath(pkg)
+		for path, module := range modules {
+			if module.Package.Path.Equal(pkgPath) {
+				a.profile.setSignature(path, sigID)
+			}
+		}
+	}
 }
 
-func (a *aio) Init(cb types.SignatureHandler) error {
+func signaturePackagePath(pkg string) ast.Ref {
+	return ast.Ref{ast.DefaultRootDocument, ast.StringTerm("tracee"), ast.StringTerm(pkg)}
+}
+
+func (a *AIO) Init(cb types.SignatureHandler) error {
 	a.cb = cb
 	return nil
 }
 
-func (a *aio) GetMetadata() (types.SignatureMetadata, error) {
+func (a *AIO) GetMetadata() (types.SignatureMetadata, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.metadata, nil
 }
 
-func (a *aio) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+// GetSignaturesMetadata implements the SignatureGroup interface by returning the metadata of the signatures, sorted
+// by ID
+func (a *AIO) GetSignaturesMetadata() ([]types.SignatureMetadata, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var res []types.SignatureMetadata
+	for _, p := range a.policies {
+		for _, metadata := range p.sigIDToMetadata {
+			res = append(res, metadata)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (a *AIO) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.selectedEvents, nil
 }
 
-func (a *aio) OnEvent(ee types.Event) error {
+// OnEvent evaluates the query of each signature package. The errors are attributed to the signatures that failed, and
+// the other signatures still report their findings.
+func (a *AIO) OnEvent(ee types.Event) error {
 	input, event, err := toInputOption(ee)
 	if err != nil {
 		return err
 	}
+	a.state.advance(event.Timestamp)
 
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	ctx := context.TODO()
-	rs, err := a.preparedQuery.Eval(ctx, input)
-	if err != nil {
-		return err
-	}
-	data, err := MapRS(rs).ToDataAll()
-	if err != nil {
-		return err
-	}
-	for sigID, value := range data {
-		switch v := value.(type) {
-		case bool:
-			if v {
+	var errs types.SignatureErrors
+	for _, pkgPath := range a.packages {
+		p := a.policies[pkgPath]
+		data, err := a.eval(ctx, p, input)
+		if err != nil {
+			for sigID := range p.sigIDToMetadata {
+				errs = append(errs, types.SignatureError{ID: sigID, Err: err})
+			}
+			continue
+		}
+		for sigID, value := range data {
+			switch v := value.(type) {
+			case bool:
+				if v {
+					a.cb(types.Finding{
+						Data:        nil,
+						Context:     event,
+						SigMetadata: p.sigIDToMetadata[sigID],
+					})
+				}
+			case map[string]interface{}:
 				a.cb(types.Finding{
-					Data:        nil,
+					Data:        v,
 					Context:     event,
-					SigMetadata: a.sigIDToMetadata[sigID],
+					SigMetadata: p.sigIDToMetadata[sigID],
 				})
+			default:
+				errs = append(errs, types.SignatureError{ID: sigID, Err: fmt.Errorf("unrecognized value: %T", v)})
 			}
-		case map[string]interface{}:
-			a.cb(types.Finding{
-				Data:        v,
-				Context:     event,
-				SigMetadata: a.sigIDToMetadata[sigID],
-			})
-		default:
-			return fmt.Errorf("unrecognized value: %T", v)
 		}
 	}
-	return nil
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].ID < errs[j].ID
+		})
+		return errs
+	}
+}
+
+// eval evaluates the query of a policy. The state writes of the evaluation are committed only if it succeeds.
+func (a *AIO) eval(ctx context.Context, p *aioPolicy, input rego.EvalOption) (map[string]interface{}, error) {
+	if a.options.OPAPartial && a.options.OPAData.currentVersion() != p.dataVersion {
+		if err := a.prepareQuery(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	evalCtx, tx := a.state.begin(ctx)
+	rs, err := a.profile.eval(evalCtx, p.preparedQuery, input)
+	if err != nil {
+		return nil, err
+	}
+	data, err := MapRS(rs).ToDataAll()
+	if err != nil {
+		return nil, err
+	}
+	tx.commit()
+	return data, nil
 }
 
 func toInputOption(ee types.Event) (rego.EvalOption, external.Event, error) {
@@ -244,10 +613,26 @@ func toInputOption(ee types.Event) (rego.EvalOption, external.Event, error) {
 	return input, event, nil
 }
 
-func (a *aio) Close() {
+func (a *AIO) Close() {
 	// noop
 }
 
-func (a aio) OnSignal(signal types.Signal) error {
-	return fmt.Errorf("unsupported operation")
+// OnSignal implements the Signature interface by handling lifecycle events of the signatures
+// the state of the signatures is deleted when their source completes
+func (a *AIO) OnSignal(signal types.Signal) error {
+	switch v := signal.(type) {
+	case types.SignalSourceComplete:
+		a.state.reset()
+		return nil
+	case types.SignalSourceStart, types.SignalShutdown:
+		// findings are reported as events are evaluated, so there's nothing to do
+		return nil
+	case types.SignalTick:
+		a.state.advance(v.Timestamp)
+		return nil
+	case types.SignalWatermark:
+		a.state.advance(v.Timestamp)
+		return nil
+	}
+	return fmt.Errorf("unsupported signal: %v", signal)
 }
@@ -21,4 +21,11 @@ tracee_match_all[id] = resp {
 		resp := data.tracee[i].tracee_match
 		metadata := data.tracee[i].__rego_metadoc__
 		id := metadata.id
-}
\ No newline at end of file
+}
+
+# Returns the map of signature identifiers to the packages of the signatures.
+__rego_package_all__[id] = i {
+	some i
+		metadata := data.tracee[i].__rego_metadoc__
+		id := metadata.id
+}
@@ -0,0 +1,78 @@
+package regosig
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSignatureModule(id, helper string) string {
+	return fmt.Sprintf(`package tracee.%s
+
+import data.tracee.helpers
+
+__rego_metadoc__ := {
+	"id": "%s",
+	"version": "0.1.0",
+	"name": "test name"
+}
+
+tracee_selected_events[{"source": "tracee", "name": "execve"}]
+
+tracee_match {
+	helpers.%s(input.args[0].value)
+}
+`, id, id, helper)
+}
+
+const testHelpersModule = `package tracee.helpers
+
+is_yo(value) {
+	value == "yo"
+}
+
+is_hey(value) {
+	value == "hey"
+}
+`
+
+func TestAIO_recompile(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			a, err := NewAIO(map[string]string{
+				"helpers.rego": testHelpersModule,
+				"a.rego":       testSignatureModule("A", "is_yo"),
+				"b.rego":       testSignatureModule("B", "is_yo"),
+			}, OPAPartial(partial))
+			require.NoError(t, err)
+			require.Len(t, a.policies, 2)
+			policyA := a.policies["data.tracee.A"]
+			policyB := a.policies["data.tracee.B"]
+
+			// only the signature of the module is compiled again
+			require.NoError(t, a.UpdateModule("b.rego", testSignatureModule("B", "is_hey")))
+			assert.Same(t, policyA, a.policies["data.tracee.A"])
+			assert.NotSame(t, policyB, a.policies["data.tracee.B"])
+
+			// a new signature is compiled alone
+			policyB = a.policies["data.tracee.B"]
+			require.NoError(t, a.UpdateModule("c.rego", testSignatureModule("C", "is_hey")))
+			assert.Same(t, policyA, a.policies["data.tracee.A"])
+			assert.Same(t, policyB, a.policies["data.tracee.B"])
+			assert.Equal(t, []string{"data.tracee.A", "data.tracee.B", "data.tracee.C"}, a.packages)
+
+			// the removed signatures are dropped without compiling the others
+			require.NoError(t, a.RemoveModule("c.rego"))
+			require.NoError(t, a.RemoveSignature("B"))
+			assert.Same(t, policyA, a.policies["data.tracee.A"])
+			assert.Equal(t, []string{"data.tracee.A"}, a.packages)
+
+			// all the signatures are compiled again when a helper module changes
+			require.NoError(t, a.UpdateModule("helpers.rego", testHelpersModule+"\nis_hello(value) {\n\tvalue == \"hello\"\n}\n"))
+			assert.NotSame(t, policyA, a.policies["data.tracee.A"])
+			assert.Equal(t, []string{"data.tracee.A"}, a.packages)
+		})
+	}
+}
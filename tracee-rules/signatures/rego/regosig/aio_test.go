@@ -2,8 +2,10 @@ package regosig_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
@@ -259,7 +261,7 @@ func AioOnEventSpec(t *testing.T, target string, partial bool) {
 					},
 				},
 			},
-			wantError: "unrecognized value: string",
+			wantError: "signature TRC-INVALID: unrecognized value: string",
 		},
 	}
 
@@ -286,9 +288,164 @@ func AioOnEventSpec(t *testing.T, target string, partial bool) {
 	}
 }
 
+func TestAio_State(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			// the same rule in another package must not share the state of the first one
+			sig, err := regosig.NewAIO(map[string]string{
+				"test_state.rego":       testRegoCodeState,
+				"test_state_other.rego": strings.NewReplacer("TRC_STATE", "TRC_STATE_OTHER", "TRC-STATE", "TRC-STATE-OTHER").Replace(testRegoCodeState),
+			}, regosig.OPAPartial(partial))
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a"}))
+			}
+			findings := holder.GroupBySigID()
+			require.Len(t, findings, 2)
+			assert.Equal(t, map[string]interface{}{"container": "a", "count": json.Number("3")}, findings["TRC-STATE"].Data)
+			assert.Equal(t, map[string]interface{}{"container": "a", "count": json.Number("3")}, findings["TRC-STATE-OTHER"].Data)
+		})
+	}
+}
+
 func TestAio_OnSignal(t *testing.T) {
 	sig, err := regosig.NewAIO(map[string]string{})
 	require.NoError(t, err)
 	err = sig.OnSignal(os.Kill)
-	assert.EqualError(t, err, "unsupported operation")
+	assert.EqualError(t, err, "unsupported signal: killed")
+}
+
+func TestAio_GetSignaturesMetadata(t *testing.T) {
+	sig, err := regosig.NewAIO(map[string]string{
+		"test_boolean.rego": testRegoCodeBoolean,
+		"test_object.rego":  testRegoCodeObject,
+	})
+	require.NoError(t, err)
+
+	metadata, err := sig.GetSignaturesMetadata()
+	require.NoError(t, err)
+	require.Len(t, metadata, 2)
+	assert.Equal(t, "TRC-BOOL", metadata[0].ID)
+	assert.Equal(t, "TRC-OBJECT", metadata[1].ID)
+}
+
+func TestAio_RemoveSignature(t *testing.T) {
+	sig, err := regosig.NewAIO(map[string]string{
+		"test_boolean.rego": testRegoCodeBoolean,
+		"test_object.rego":  testRegoCodeObject,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sig.RemoveSignature("TRC-OBJECT"))
+	metadata, err := sig.GetMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, "TRC-AIO (TRC-BOOL)", metadata.ID)
+	events, err := sig.GetSelectedEvents()
+	require.NoError(t, err)
+	assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, events)
+
+	assert.EqualError(t, sig.RemoveSignature("TRC-OBJECT"), "signature TRC-OBJECT isn't loaded")
+
+	// the signature stays removed when its module is updated
+	require.NoError(t, sig.UpdateModule("test_object.rego", testRegoCodeObject))
+	metadata, err = sig.GetMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, "TRC-AIO (TRC-BOOL)", metadata.ID)
+}
+
+func TestAio_UpdateModule(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			sig, err := regosig.NewAIO(map[string]string{
+				"test_boolean.rego": testRegoCodeBoolean,
+			}, regosig.OPAPartial(partial))
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+			event := tracee.Event{
+				Args: []tracee.Argument{
+					{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: "ends with yo"},
+					{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: 1337},
+				},
+			}
+
+			// the signature matches other events after its module changes
+			require.NoError(t, sig.UpdateModule("test_boolean.rego", strings.Replace(testRegoCodeBoolean, `"yo"`, `"hey"`, 1)))
+			require.NoError(t, sig.OnEvent(event))
+			assert.Empty(t, holder.Values)
+
+			// a new module
+			require.NoError(t, sig.UpdateModule("test_object.rego", testRegoCodeObject))
+			require.NoError(t, sig.OnEvent(event))
+			assert.Contains(t, holder.GroupBySigID(), "TRC-OBJECT")
+
+			// the modules are kept if the module doesn't compile
+			err = sig.UpdateModule("test_object.rego", "package tracee.TRC_OBJECT\n\ntracee_match = undefined_var")
+			require.Error(t, err)
+			metadata, err := sig.GetMetadata()
+			require.NoError(t, err)
+			assert.Equal(t, "TRC-AIO (TRC-BOOL,TRC-OBJECT)", metadata.ID)
+
+			require.NoError(t, sig.RemoveModule("test_object.rego"))
+			metadata, err = sig.GetMetadata()
+			require.NoError(t, err)
+			assert.Equal(t, "TRC-AIO (TRC-BOOL)", metadata.ID)
+			assert.EqualError(t, sig.RemoveModule("test_object.rego"), "module test_object.rego isn't loaded")
+		})
+	}
+}
+
+func TestAio_SignatureErrors(t *testing.T) {
+	conflict := `package tracee.TRC_CONFLICT
+
+__rego_metadoc__ := {
+	"id": "TRC-CONFLICT",
+	"version": "0.1.0",
+	"name": "test name"
+}
+
+tracee_selected_events[{"source": "tracee", "name": "ptrace"}]
+
+tracee_match = {"a": input.args[0].value}
+
+tracee_match = {"b": input.args[0].value}
+`
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			sig, err := regosig.NewAIO(map[string]string{
+				"test_conflict.rego": conflict,
+				"test_object.rego":   testRegoCodeObject,
+				"test_state.rego":    strings.Replace(testRegoCodeState, `"execve"`, `"ptrace"`, 1),
+			}, regosig.OPAPartial(partial))
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+
+			event := tracee.Event{
+				EventName:   "ptrace",
+				ContainerID: "a",
+				Args: []tracee.Argument{
+					{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: "ends with yo"},
+					{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: 1337},
+				},
+			}
+			for i := 0; i < 2; i++ {
+				require.Error(t, sig.OnEvent(event))
+			}
+			// the state is updated once per event, although the signatures are evaluated again after the failure
+			assert.NotContains(t, holder.GroupBySigID(), "TRC-STATE")
+			err = sig.OnEvent(event)
+			assert.Contains(t, holder.GroupBySigID(), "TRC-STATE")
+			var sigErr types.SignatureError
+			require.True(t, errors.As(err, &sigErr), "%v", err)
+			assert.Equal(t, "TRC-CONFLICT", sigErr.ID)
+			// partial evaluation reports the conflict of the inlined rules differently
+			assert.Contains(t, sigErr.Err.Error(), "eval_conflict_error")
+			// the other signatures still report their findings
+			assert.Contains(t, holder.GroupBySigID(), "TRC-OBJECT")
+		})
+	}
 }
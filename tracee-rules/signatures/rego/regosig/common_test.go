@@ -84,5 +84,57 @@ tracee_match = res {
 	endswith(input.args[0].value, "invalid")
 	res := "foo bar string"
 }
+`
+	testRegoCodeState = `package tracee.TRC_STATE
+
+__rego_metadoc__ := {
+	"id": "TRC-STATE",
+	"version": "0.1.0",
+	"name": "test name",
+	"description": "test description"
+}
+
+tracee_selected_events[eventSelector] {
+	eventSelector := {
+		"source": "tracee",
+		"name": "execve"
+	}
+}
+
+tracee_match = res {
+	count := tracee.state.incr([input.containerId, "execs"], 60)
+	count == 3
+	res := {
+		"container": input.containerId,
+		"count": count
+	}
+}
+`
+	testRegoCodeRulesData = `package tracee.TRC_DATA
+
+__rego_metadoc__ := {
+	"id": "TRC-DATA",
+	"version": "0.1.0",
+	"name": "test name",
+	"description": "test description"
+}
+
+tracee_selected_events[eventSelector] {
+	eventSelector := {
+		"source": "tracee",
+		"name": "execve"
+	}
+}
+
+trusted[name] {
+	name := data.tracee.config.trusted_binaries[_]
+}
+
+tracee_match = res {
+	not trusted[input.processName]
+	res := {
+		"process": input.processName
+	}
+}
 `
 )
@@ -67,6 +67,25 @@ func (m Mapper) ToDataAll() (map[string]interface{}, error) {
 	return values, nil
 }
 
+func (m Mapper) ToPackageAll() (map[string]string, error) {
+	if m.isEmpty() {
+		return nil, errors.New("empty result set")
+	}
+	values, ok := m.ResultSet[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unrecognized value: %T", m.ResultSet[0].Expressions[0].Value)
+	}
+	res := make(map[string]string, len(values))
+	for id, value := range values {
+		pkg, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unrecognized package: %T", value)
+		}
+		res[id] = pkg
+	}
+	return res, nil
+}
+
 func (m Mapper) isEmpty() bool {
 	rs := m.ResultSet
 	return len(rs) == 0 || len(rs[0].Expressions) == 0 || rs[0].Expressions[0].Value == nil
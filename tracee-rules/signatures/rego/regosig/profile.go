@@ -0,0 +1,232 @@
+package regosig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/profiler"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Profiler profiles the evaluation of rego signatures: the time and the number of evaluations of each signature and
+// of each expression. The RegoSignatures and the AIOs that are created with the OPAProfiler option share a Profiler,
+// and each of them has its own profile, so they don't contend with each other.
+type Profiler struct {
+	mu       sync.Mutex
+	profiles []*evalProfile
+}
+
+// NewProfiler creates a new Profiler
+func NewProfiler() *Profiler {
+	return &Profiler{}
+}
+
+// evalProfile is the profile of the evaluations of a RegoSignature or an AIO
+type evalProfile struct {
+	name string
+
+	mu          sync.Mutex
+	evals       int
+	evalTime    time.Duration
+	exprs       map[string]map[int]profiler.ExprStats // by file and row
+	fileToSigID map[string]string
+}
+
+func (p *Profiler) newEvalProfile(name string) *evalProfile {
+	if p == nil {
+		return nil
+	}
+	ep := &evalProfile{
+		name:        name,
+		exprs:       make(map[string]map[int]profiler.ExprStats),
+		fileToSigID: make(map[string]string),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profiles = append(p.profiles, ep)
+	return ep
+}
+
+// setSignature attributes the expressions of a file to a signature
+func (ep *evalProfile) setSignature(file, sigID string) {
+	if ep == nil {
+		return
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.fileToSigID[file] = sigID
+}
+
+// eval evaluates a prepared query, and adds the time of the evaluation and of its expressions to the profile
+func (ep *evalProfile) eval(ctx context.Context, pq rego.PreparedEvalQuery, opts ...rego.EvalOption) (rego.ResultSet, error) {
+	if ep == nil {
+		return pq.Eval(ctx, opts...)
+	}
+	// the OPA profiler times the expressions of a single evaluation, otherwise the time between two evaluations
+	// would be added to the last expression of the first one
+	prof := profiler.New()
+	start := time.Now()
+	rs, err := pq.Eval(ctx, append(opts, rego.EvalQueryTracer(prof))...)
+	elapsed := time.Since(start)
+	report := prof.ReportByFile()
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.evals++
+	ep.evalTime += elapsed
+	for file, fr := range report.Files {
+		if file == "" {
+			// the expressions of the query itself
+			continue
+		}
+		rows, ok := ep.exprs[file]
+		if !ok {
+			rows = make(map[int]profiler.ExprStats)
+			ep.exprs[file] = rows
+		}
+		for _, stats := range fr.Result {
+			total := rows[stats.Location.Row]
+			total.Location = stats.Location
+			total.ExprTimeNs += stats.ExprTimeNs
+			total.NumEval += stats.NumEval
+			total.NumRedo += stats.NumRedo
+			rows[stats.Location.Row] = total
+		}
+	}
+	return rs, err
+}
+
+// ProfileReport is the report of a Profiler. Each list is sorted by time, in descending order.
+type ProfileReport struct {
+	Queries     []QueryCost     `json:"queries"`
+	Signatures  []SignatureCost `json:"signatures"`
+	Expressions []ExprCost      `json:"expressions"`
+}
+
+// QueryCost is the cost of the queries of a RegoSignature or an AIO. An AIO evaluates a query per signature.
+type QueryCost struct {
+	Name  string        `json:"name"`
+	Evals int           `json:"evals"`
+	Time  time.Duration `json:"time"`
+}
+
+// SignatureCost is the cost of the expressions of a signature. The expressions of modules that don't belong to a
+// single signature, e.g. helpers shared by the signatures of an AIO, are reported by the file of the module.
+type SignatureCost struct {
+	ID    string        `json:"id"`
+	Evals int           `json:"evals"`
+	Time  time.Duration `json:"time"`
+}
+
+// ExprCost is the cost of an expression
+type ExprCost struct {
+	Signature  string        `json:"signature"`
+	Location   string        `json:"location"`
+	Expression string        `json:"expression"`
+	Evals      int           `json:"evals"`
+	Redos      int           `json:"redos"`
+	Time       time.Duration `json:"time"`
+}
+
+// Report returns the report of the profiles, with the top n expressions, or all of them if n <= 0
+func (p *Profiler) Report(n int) ProfileReport {
+	p.mu.Lock()
+	profiles := append([]*evalProfile(nil), p.profiles...)
+	p.mu.Unlock()
+
+	var report ProfileReport
+	signatures := make(map[string]*SignatureCost)
+	for _, ep := range profiles {
+		ep.mu.Lock()
+		if ep.evals > 0 {
+			report.Queries = append(report.Queries, QueryCost{Name: ep.name, Evals: ep.evals, Time: ep.evalTime})
+		}
+		for file, rows := range ep.exprs {
+			sigID, ok := ep.fileToSigID[file]
+			if !ok {
+				sigID = file
+			}
+			sc, ok := signatures[sigID]
+			if !ok {
+				sc = &SignatureCost{ID: sigID}
+				signatures[sigID] = sc
+			}
+			for _, stats := range rows {
+				sc.Evals += stats.NumEval
+				sc.Time += time.Duration(stats.ExprTimeNs)
+				report.Expressions = append(report.Expressions, ExprCost{
+					Signature:  sigID,
+					Location:   fmt.Sprintf("%s:%d", file, stats.Location.Row),
+					Expression: exprText(stats.Location),
+					Evals:      stats.NumEval,
+					Redos:      stats.NumRedo,
+					Time:       time.Duration(stats.ExprTimeNs),
+				})
+			}
+		}
+		ep.mu.Unlock()
+	}
+	for _, sc := range signatures {
+		report.Signatures = append(report.Signatures, *sc)
+	}
+
+	sort.Slice(report.Queries, func(i, j int) bool {
+		return lessCost(report.Queries[i].Time, report.Queries[j].Time, report.Queries[i].Name, report.Queries[j].Name)
+	})
+	sort.Slice(report.Signatures, func(i, j int) bool {
+		return lessCost(report.Signatures[i].Time, report.Signatures[j].Time, report.Signatures[i].ID, report.Signatures[j].ID)
+	})
+	sort.Slice(report.Expressions, func(i, j int) bool {
+		return lessCost(report.Expressions[i].Time, report.Expressions[j].Time, report.Expressions[i].Location, report.Expressions[j].Location)
+	})
+	if n > 0 && len(report.Expressions) > n {
+		report.Expressions = report.Expressions[:n]
+	}
+	return report
+}
+
+// lessCost orders costs by time in descending order, and then by name
+func lessCost(t1, t2 time.Duration, name1, name2 string) bool {
+	if t1 != t2 {
+		return t1 > t2
+	}
+	return name1 < name2
+}
+
+// exprText returns the first line of the text of an expression
+func exprText(loc *ast.Location) string {
+	text := string(loc.Text)
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i] + " ..."
+	}
+	return text
+}
+
+// WriteReport writes the report of the profiles as text, with the top n expressions, or all of them if n <= 0
+func (p *Profiler) WriteReport(w io.Writer, n int) error {
+	report := p.Report(n)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "QUERY\tEVALS\tTIME\tAVG")
+	for _, q := range report.Queries {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\n", q.Name, q.Evals, q.Time, q.Time/time.Duration(q.Evals))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "SIGNATURE\tEXPR EVALS\tTIME")
+	for _, s := range report.Signatures {
+		fmt.Fprintf(tw, "%s\t%d\t%v\n", s.ID, s.Evals, s.Time)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "SIGNATURE\tLOCATION\tEVALS\tREDOS\tTIME\tEXPRESSION")
+	for _, e := range report.Expressions {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%s\n", e.Signature, e.Location, e.Evals, e.Redos, e.Time, e.Expression)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,82 @@
+package regosig_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/rego/regosig"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			profiler := regosig.NewProfiler()
+			sig, err := regosig.NewRegoSignatureWithOptions([]string{testRegoCodeBoolean},
+				regosig.OPAPartial(partial),
+				regosig.OPAProfiler(profiler))
+			require.NoError(t, err)
+			aio, err := regosig.NewAIO(map[string]string{
+				"test_boolean.rego": testRegoCodeBoolean,
+				"test_object.rego":  testRegoCodeObject,
+			},
+				regosig.OPAPartial(partial),
+				regosig.OPAProfiler(profiler))
+			require.NoError(t, err)
+
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+			require.NoError(t, aio.Init(holder.OnFinding))
+			for _, value := range []string{"yo", "hello"} {
+				event := tracee.Event{
+					Args: []tracee.Argument{
+						{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: value},
+						{ArgMeta: tracee.ArgMeta{Name: "doesn't matter"}, Value: 1337},
+					},
+				}
+				require.NoError(t, sig.OnEvent(event))
+				require.NoError(t, aio.OnEvent(event))
+			}
+			assert.Len(t, holder.Values, 3)
+
+			report := profiler.Report(0)
+			require.Len(t, report.Queries, 2)
+			queries := make(map[string]int)
+			for _, q := range report.Queries {
+				queries[q.Name] = q.Evals
+			}
+			// the AIO evaluates the query of each of its 2 signatures
+			assert.Equal(t, map[string]int{"TRC-BOOL": 2, "TRC-AIO": 4}, queries)
+
+			var sigIDs []string
+			for i, s := range report.Signatures {
+				sigIDs = append(sigIDs, s.ID)
+				if i > 0 {
+					assert.GreaterOrEqual(t, report.Signatures[i-1].Time, s.Time)
+				}
+			}
+			assert.Contains(t, sigIDs, "TRC-BOOL")
+			assert.Contains(t, sigIDs, "TRC-OBJECT")
+
+			var found bool
+			for _, e := range report.Expressions {
+				if e.Signature == "TRC-OBJECT" && e.Location == "test_object.rego:24" {
+					found = true
+					assert.Contains(t, e.Expression, "input.args[0].value")
+					assert.Positive(t, e.Evals)
+				}
+			}
+			assert.True(t, found, "the expression of TRC-OBJECT isn't reported: %v", report.Expressions)
+			assert.Len(t, profiler.Report(1).Expressions, 1)
+
+			out := bytes.Buffer{}
+			require.NoError(t, profiler.WriteReport(&out, 0))
+			assert.Contains(t, out.String(), "TRC-AIO")
+			assert.Contains(t, out.String(), "test_boolean.rego:24")
+		})
+	}
+}
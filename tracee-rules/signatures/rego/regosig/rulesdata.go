@@ -0,0 +1,194 @@
+package regosig
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// rulesDataPath is the path of the rules data in the data document, i.e. data.tracee.config
+var rulesDataPath = storage.MustParsePath("/tracee/config")
+
+// RulesData is external data, e.g. allow-lists, that rego signatures read as data.tracee.config.
+// It is loaded from JSON or YAML files, and from the JSON or YAML files in directories, where each file is an object
+// that is merged into data.tracee.config, in the order of the paths. Signatures that share RulesData read the same
+// store, so they see the data that Reload loads with no need to recompile them.
+type RulesData struct {
+	paths   []string
+	store   storage.Store
+	version uint64 // incremented by every reload that changes the data
+
+	mu    sync.Mutex
+	files map[string]fileInfo // the files that the data was loaded from
+}
+
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewRulesData creates a new RulesData, and loads it from paths
+func NewRulesData(paths ...string) (*RulesData, error) {
+	files, err := rulesDataFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadRulesData(files)
+	if err != nil {
+		return nil, err
+	}
+	return &RulesData{
+		paths: paths,
+		store: inmem.NewFromObject(map[string]interface{}{"tracee": map[string]interface{}{"config": config}}),
+		files: files,
+	}, nil
+}
+
+// Reload loads the data again if its files changed, were added or were removed, and returns whether it did.
+// If the files can't be loaded, the signatures keep reading the data that was previously loaded.
+func (d *RulesData) Reload() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	files, err := rulesDataFiles(d.paths)
+	if err != nil {
+		return false, err
+	}
+	if sameFiles(files, d.files) {
+		return false, nil
+	}
+	config, err := loadRulesData(files)
+	if err != nil {
+		return false, err
+	}
+	if err := storage.WriteOne(context.Background(), d.store, storage.ReplaceOp, rulesDataPath, config); err != nil {
+		return false, fmt.Errorf("writing rules data: %w", err)
+	}
+	d.files = files
+	atomic.AddUint64(&d.version, 1)
+	return true, nil
+}
+
+// currentVersion returns the version of the data, which signatures that evaluated the data ahead of time compare to
+// the version that they evaluated
+func (d *RulesData) currentVersion() uint64 {
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&d.version)
+}
+
+// options returns the rego options of queries that read the data
+func (d *RulesData) options() []func(*rego.Rego) {
+	if d == nil {
+		return nil
+	}
+	return []func(*rego.Rego){rego.Store(d.store)}
+}
+
+// rulesDataFiles returns the files of paths, where a directory is its JSON and YAML files, sorted by name
+func rulesDataFiles(paths []string) (map[string]fileInfo, error) {
+	files := make(map[string]fileInfo)
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading rules data: %w", err)
+		}
+		if !fi.IsDir() {
+			files[path] = fileInfo{modTime: fi.ModTime(), size: fi.Size()}
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading rules data: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isRulesDataFile(entry.Name()) {
+				continue
+			}
+			files[filepath.Join(path, entry.Name())] = fileInfo{modTime: entry.ModTime(), size: entry.Size()}
+		}
+	}
+	return files, nil
+}
+
+func isRulesDataFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func sameFiles(a, b map[string]fileInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, fi := range a {
+		other, ok := b[path]
+		if !ok || !fi.modTime.Equal(other.modTime) || fi.size != other.size {
+			return false
+		}
+	}
+	return true
+}
+
+// loadRulesData reads files, sorted by path, and merges their objects
+func loadRulesData(files map[string]fileInfo) (map[string]interface{}, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	config := make(map[string]interface{})
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading rules data: %w", err)
+		}
+		var doc interface{}
+		// YAML is a superset of JSON
+		if err := util.Unmarshal(bs, &doc); err != nil {
+			return nil, fmt.Errorf("parsing rules data %s: %w", path, err)
+		}
+		if doc == nil {
+			continue
+		}
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parsing rules data %s: expected an object, got %T", path, doc)
+		}
+		mergeRulesData(config, obj)
+	}
+	return config, nil
+}
+
+// mergeRulesData merges src into dst. Objects are merged recursively, and any other value of src replaces the value
+// of dst.
+func mergeRulesData(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcObj, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstObj, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dst[k] = srcObj
+			continue
+		}
+		mergeRulesData(dstObj, srcObj)
+	}
+}
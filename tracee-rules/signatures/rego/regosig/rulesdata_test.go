@@ -0,0 +1,144 @@
+package regosig_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/rego/regosig"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRulesData writes a file with a modification time that is later than the previous one, so it is reloaded
+// even if the file system has a coarse time granularity
+func writeRulesData(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestRulesData(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1000, 0)
+	writeRulesData(t, filepath.Join(dir, "a.json"), `{"trusted_binaries": ["ls"], "limits": {"execs": 1, "opens": 2}}`, modTime)
+	writeRulesData(t, filepath.Join(dir, "b.yaml"), "limits:\n  execs: 3\n", modTime)
+	writeRulesData(t, filepath.Join(dir, "c.txt"), "not rules data", modTime)
+
+	testCases := []struct {
+		name    string
+		paths   []string
+		wantErr string
+	}{
+		{
+			name:  "directory",
+			paths: []string{dir},
+		},
+		{
+			name:  "files",
+			paths: []string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.yaml")},
+		},
+		{
+			name:    "missing file",
+			paths:   []string{filepath.Join(dir, "missing.json")},
+			wantErr: "reading rules data: stat " + filepath.Join(dir, "missing.json") + ": no such file or directory",
+		},
+		{
+			name:    "not an object",
+			paths:   []string{filepath.Join(dir, "c.txt")},
+			wantErr: "parsing rules data " + filepath.Join(dir, "c.txt") + ": expected an object, got string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := regosig.NewRulesData(tc.paths...)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			sig, err := regosig.NewRegoSignatureWithOptions([]string{`package tracee.TRC_CONFIG
+
+__rego_metadoc__ := {"id": "TRC-CONFIG"}
+
+tracee_selected_events[{"source": "tracee", "name": "execve"}]
+
+tracee_match = data.tracee.config
+`}, regosig.OPAData(data))
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+			require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve"}))
+			require.Len(t, holder.Values, 1)
+			assert.Equal(t, map[string]interface{}{
+				"trusted_binaries": []interface{}{"ls"},
+				"limits":           map[string]interface{}{"execs": json.Number("3"), "opens": json.Number("2")},
+			}, holder.Values[0].Data)
+		})
+	}
+}
+
+func TestRulesData_Reload(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			modTime := time.Unix(1000, 0)
+			writeRulesData(t, path, "trusted_binaries: [ls]\n", modTime)
+			data, err := regosig.NewRulesData(path)
+			require.NoError(t, err)
+
+			sig, err := regosig.NewRegoSignatureWithOptions([]string{testRegoCodeRulesData}, regosig.OPAPartial(partial), regosig.OPAData(data))
+			require.NoError(t, err)
+			aio, err := regosig.NewAIO(map[string]string{"test_data.rego": testRegoCodeRulesData},
+				regosig.OPAPartial(partial),
+				regosig.OPAData(data))
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+			aioHolder := signaturestest.FindingsHolder{}
+			require.NoError(t, aio.Init(aioHolder.OnFinding))
+
+			onEvent := func(processName string) {
+				event := tracee.Event{EventName: "execve", ProcessName: processName}
+				require.NoError(t, sig.OnEvent(event))
+				require.NoError(t, aio.OnEvent(event))
+			}
+
+			onEvent("ls")
+			onEvent("sh")
+			require.Len(t, holder.Values, 1)
+			assert.Equal(t, map[string]interface{}{"process": "sh"}, holder.Values[0].Data)
+			require.Len(t, aioHolder.Values, 1)
+
+			changed, err := data.Reload()
+			require.NoError(t, err)
+			assert.False(t, changed)
+
+			// sh is trusted after the data is reloaded
+			modTime = modTime.Add(time.Second)
+			writeRulesData(t, path, "trusted_binaries: [ls, sh]\n", modTime)
+			changed, err = data.Reload()
+			require.NoError(t, err)
+			assert.True(t, changed)
+			onEvent("sh")
+			assert.Len(t, holder.Values, 1)
+			assert.Len(t, aioHolder.Values, 1)
+
+			// the previous data is kept if the data can't be loaded
+			modTime = modTime.Add(time.Second)
+			writeRulesData(t, path, "[]", modTime)
+			_, err = data.Reload()
+			assert.EqualError(t, err, "parsing rules data "+path+": expected an object, got []interface {}")
+			onEvent("sh")
+			assert.Len(t, holder.Values, 1)
+			assert.Len(t, aioHolder.Values, 1)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package regosig
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/types"
+)
+
+// stateMaxEntries is the max number of entries in the state of a signature. The least recently used entries are
+// evicted when it's full.
+const stateMaxEntries = 10000
+
+// stateFunctions are the builtins that rego signatures use to keep state between events:
+// tracee.state.get(key): the value of key, undefined if it isn't set or expired
+// tracee.state.set(key, value, ttl): sets the value of key for ttl seconds (0 for no expiration), returns true
+// tracee.state.incr(key, ttl): increments the number of key, and sets its expiration to ttl seconds, returns the new number
+// tracee.state.delete(key): deletes key, returns true
+// Keys are any value, e.g. [input.containerId, "shells"].
+var stateFunctions = []struct {
+	builtin *ast.Builtin
+	impl    func(tx *stateTx, bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error)
+}{
+	{
+		builtin: &ast.Builtin{Name: "tracee.state.get", Decl: types.NewFunction(types.Args(types.A), types.A)},
+		impl: func(tx *stateTx, bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			return tx.get(bctx, operands[0])
+		},
+	},
+	{
+		builtin: &ast.Builtin{Name: "tracee.state.set", Decl: types.NewFunction(types.Args(types.A, types.A, types.N), types.B)},
+		impl: func(tx *stateTx, bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			return tx.set(bctx, operands[0], operands[1], operands[2])
+		},
+	},
+	{
+		builtin: &ast.Builtin{Name: "tracee.state.incr", Decl: types.NewFunction(types.Args(types.A, types.N), types.N)},
+		impl: func(tx *stateTx, bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			return tx.incr(bctx, operands[0], operands[1])
+		},
+	},
+	{
+		builtin: &ast.Builtin{Name: "tracee.state.delete", Decl: types.NewFunction(types.Args(types.A), types.B)},
+		impl: func(tx *stateTx, bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			return tx.delete(bctx, operands[0])
+		},
+	},
+}
+
+// stateContextKey is the key of the state transaction of the evaluating signature in the context of the evaluation
+type stateContextKey struct{}
+
+func init() {
+	// the functions are registered globally, and find the state of the signature in the context of the evaluation
+	for _, f := range stateFunctions {
+		f := f
+		ast.RegisterBuiltin(f.builtin)
+		// the functions have side effects, so partial evaluation must not evaluate them ahead of time
+		ast.IgnoreDuringPartialEval = append(ast.IgnoreDuringPartialEval, f.builtin)
+		topdown.RegisterBuiltinFunc(f.builtin.Name, func(bctx topdown.BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+			tx, ok := bctx.Context.Value(stateContextKey{}).(*stateTx)
+			if !ok {
+				return fmt.Errorf("%s: state isn't available to this signature", f.builtin.Name)
+			}
+			result, err := f.impl(tx, bctx, operands)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.builtin.Name, err)
+			}
+			if result == nil {
+				return nil
+			}
+			return iter(result)
+		})
+	}
+}
+
+type stateEntry struct {
+	key     string
+	value   *ast.Term
+	expires time.Time // zero if the entry doesn't expire
+}
+
+// stateStore is a bounded key-value store with expiration
+type stateStore struct {
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // *stateEntry, the most recently used first
+}
+
+func newStateStore(maxEntries int) *stateStore {
+	return &stateStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *stateStore) get(key string, now time.Time) (*stateEntry, bool) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*stateEntry)
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (s *stateStore) set(key string, value *ast.Term, expires time.Time) {
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*stateEntry)
+		entry.value = value
+		entry.expires = expires
+		s.lru.MoveToFront(elem)
+		return
+	}
+	if s.lru.Len() >= s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*stateEntry).key)
+	}
+	s.entries[key] = s.lru.PushFront(&stateEntry{key: key, value: value, expires: expires})
+}
+
+func (s *stateStore) delete(key string) {
+	if elem, ok := s.entries[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+	}
+}
+
+// signatureState binds the state functions to the state of a signature. Each rego module that calls the functions
+// has its own store, so the signatures of an AIO don't share their state.
+// Entries expire by the time of the events, rather than the wall clock, so replayed events behave the same as live
+// ones.
+type signatureState struct {
+	mu     sync.Mutex
+	stores map[string]*stateStore // by the file of the calling module
+	clock  int                    // the latest timestamp of the events
+}
+
+func newSignatureState() *signatureState {
+	return &signatureState{
+		stores: make(map[string]*stateStore),
+	}
+}
+
+// advance advances the clock to the timestamp of an event. Events that are older than the clock don't move it.
+func (st *signatureState) advance(timestamp int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if timestamp > st.clock {
+		st.clock = timestamp
+	}
+}
+
+// now returns the time of the clock. The lock must be held.
+func (st *signatureState) now() time.Time {
+	return time.Unix(0, int64(st.clock))
+}
+
+// begin returns a context of an evaluation, in which the state functions use the state through a transaction. The
+// writes of the evaluation are applied to the state when the transaction is committed, so that an evaluation that
+// failed, and is evaluated again, doesn't apply them twice.
+func (st *signatureState) begin(ctx context.Context) (context.Context, *stateTx) {
+	tx := &stateTx{st: st, writes: make(map[string]map[string]stateWrite)}
+	return context.WithValue(ctx, stateContextKey{}, tx), tx
+}
+
+// reset deletes the state of all modules
+func (st *signatureState) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.stores = make(map[string]*stateStore)
+}
+
+// store returns the store of the file of a module. The lock must be held.
+func (st *signatureState) store(file string) *stateStore {
+	s, ok := st.stores[file]
+	if !ok {
+		s = newStateStore(stateMaxEntries)
+		st.stores[file] = s
+	}
+	return s
+}
+
+// expires returns the expiration of an entry with a ttl. The lock must be held.
+func (st *signatureState) expires(ttl *ast.Term) (time.Time, error) {
+	seconds, err := ttlSeconds(ttl)
+	if err != nil || seconds == 0 {
+		return time.Time{}, err
+	}
+	return st.now().Add(time.Duration(seconds * float64(time.Second))), nil
+}
+
+func ttlSeconds(ttl *ast.Term) (float64, error) {
+	n, ok := ttl.Value.(ast.Number)
+	if !ok {
+		return 0, fmt.Errorf("ttl must be a number, got %v", ttl)
+	}
+	seconds, ok := n.Float64()
+	if !ok || seconds < 0 {
+		return 0, fmt.Errorf("ttl must be a non negative number of seconds, got %v", ttl)
+	}
+	return seconds, nil
+}
+
+// stateWrite is a pending write of a transaction, where a nil value deletes the key
+type stateWrite struct {
+	value   *ast.Term
+	expires time.Time
+}
+
+// stateTx is the transaction of an evaluation. Its reads see its own writes.
+type stateTx struct {
+	st     *signatureState
+	writes map[string]map[string]stateWrite // by the file of the calling module, then by key
+}
+
+// moduleFile returns the file of the module that called a state function
+func moduleFile(bctx topdown.BuiltinContext) string {
+	if bctx.Location != nil {
+		return bctx.Location.File
+	}
+	return ""
+}
+
+// read returns the value of a key, with the pending writes. The lock must be held.
+func (tx *stateTx) read(file, key string) (*ast.Term, bool) {
+	if w, ok := tx.writes[file][key]; ok {
+		if w.value == nil || (!w.expires.IsZero() && !tx.st.now().Before(w.expires)) {
+			return nil, false
+		}
+		return w.value, true
+	}
+	entry, ok := tx.st.store(file).get(key, tx.st.now())
+	if !ok {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (tx *stateTx) write(file, key string, w stateWrite) {
+	if tx.writes[file] == nil {
+		tx.writes[file] = make(map[string]stateWrite)
+	}
+	tx.writes[file][key] = w
+}
+
+// commit applies the writes of the transaction to the state
+func (tx *stateTx) commit() {
+	tx.st.mu.Lock()
+	defer tx.st.mu.Unlock()
+	for file, writes := range tx.writes {
+		s := tx.st.store(file)
+		for key, w := range writes {
+			if w.value == nil {
+				s.delete(key)
+				continue
+			}
+			s.set(key, w.value, w.expires)
+		}
+	}
+	tx.writes = nil
+}
+
+func (tx *stateTx) get(bctx topdown.BuiltinContext, key *ast.Term) (*ast.Term, error) {
+	tx.st.mu.Lock()
+	defer tx.st.mu.Unlock()
+	value, ok := tx.read(moduleFile(bctx), key.String())
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (tx *stateTx) set(bctx topdown.BuiltinContext, key, value, ttl *ast.Term) (*ast.Term, error) {
+	tx.st.mu.Lock()
+	defer tx.st.mu.Unlock()
+	expires, err := tx.st.expires(ttl)
+	if err != nil {
+		return nil, err
+	}
+	tx.write(moduleFile(bctx), key.String(), stateWrite{value: value, expires: expires})
+	return ast.BooleanTerm(true), nil
+}
+
+func (tx *stateTx) incr(bctx topdown.BuiltinContext, key, ttl *ast.Term) (*ast.Term, error) {
+	tx.st.mu.Lock()
+	defer tx.st.mu.Unlock()
+	expires, err := tx.st.expires(ttl)
+	if err != nil {
+		return nil, err
+	}
+	file := moduleFile(bctx)
+	count := 1
+	if value, ok := tx.read(file, key.String()); ok {
+		if n, ok := value.Value.(ast.Number); ok {
+			if i, ok := n.Int(); ok {
+				count = i + 1
+			}
+		}
+	}
+	value := ast.IntNumberTerm(count)
+	tx.write(file, key.String(), stateWrite{value: value, expires: expires})
+	return value, nil
+}
+
+func (tx *stateTx) delete(bctx topdown.BuiltinContext, key *ast.Term) (*ast.Term, error) {
+	tx.st.mu.Lock()
+	defer tx.st.mu.Unlock()
+	tx.write(moduleFile(bctx), key.String(), stateWrite{})
+	return ast.BooleanTerm(true), nil
+}
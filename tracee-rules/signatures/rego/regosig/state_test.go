@@ -0,0 +1,97 @@
+package regosig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := newStateStore(2)
+
+	s.set("a", ast.IntNumberTerm(1), time.Time{})
+	s.set("b", ast.IntNumberTerm(2), now.Add(time.Second))
+	entry, ok := s.get("b", now)
+	require.True(t, ok)
+	assert.Equal(t, ast.IntNumberTerm(2), entry.value)
+
+	// b expired
+	_, ok = s.get("b", now.Add(time.Second))
+	assert.False(t, ok)
+
+	// a is evicted, since it is the least recently used entry
+	s.set("b", ast.IntNumberTerm(2), time.Time{})
+	s.set("c", ast.IntNumberTerm(3), time.Time{})
+	_, ok = s.get("a", now)
+	assert.False(t, ok)
+	_, ok = s.get("b", now)
+	assert.True(t, ok)
+	_, ok = s.get("c", now)
+	assert.True(t, ok)
+
+	s.delete("c")
+	_, ok = s.get("c", now)
+	assert.False(t, ok)
+}
+
+func TestSignatureState(t *testing.T) {
+	st := newSignatureState()
+	st.advance(int(1000 * time.Second))
+	bctx := topdown.BuiltinContext{Location: &ast.Location{File: "a.rego"}}
+	otherBctx := topdown.BuiltinContext{Location: &ast.Location{File: "b.rego"}}
+	key := ast.ArrayTerm(ast.StringTerm("container"), ast.StringTerm("execs"))
+	_, tx := st.begin(context.Background())
+
+	count, err := tx.incr(bctx, key, ast.IntNumberTerm(10))
+	require.NoError(t, err)
+	assert.Equal(t, ast.IntNumberTerm(1), count)
+	count, err = tx.incr(bctx, key, ast.IntNumberTerm(10))
+	require.NoError(t, err)
+	assert.Equal(t, ast.IntNumberTerm(2), count)
+	tx.commit()
+
+	// the writes of a transaction that isn't committed are discarded
+	_, tx = st.begin(context.Background())
+	count, err = tx.incr(bctx, key, ast.IntNumberTerm(10))
+	require.NoError(t, err)
+	assert.Equal(t, ast.IntNumberTerm(3), count)
+	_, tx = st.begin(context.Background())
+	count, err = tx.incr(bctx, key, ast.IntNumberTerm(10))
+	require.NoError(t, err)
+	assert.Equal(t, ast.IntNumberTerm(3), count)
+
+	// the state of another module
+	value, err := tx.get(otherBctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	// the count expires 10 seconds after it was last incremented
+	st.advance(int(1010 * time.Second))
+	value, err = tx.get(bctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	_, err = tx.set(bctx, key, ast.StringTerm("value"), ast.IntNumberTerm(0))
+	require.NoError(t, err)
+	st.advance(int(1010*time.Second + time.Hour))
+	// older events don't move the clock back
+	st.advance(int(1000 * time.Second))
+	assert.Equal(t, int(1010*time.Second+time.Hour), st.clock)
+	value, err = tx.get(bctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, ast.StringTerm("value"), value)
+	_, err = tx.delete(bctx, key)
+	require.NoError(t, err)
+	value, err = tx.get(bctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	_, err = tx.set(bctx, key, ast.StringTerm("value"), ast.IntNumberTerm(-1))
+	assert.EqualError(t, err, "ttl must be a non negative number of seconds, got -1")
+}
@@ -21,8 +21,15 @@ import (
 // __rego_metadoc__: a *document* rule that defines the rule's metadata (see GetMetadata())
 // tracee_selected_events: a *set* rule that defines the event selectors (see GetSelectedEvent())
 // tracee_match: a *boolean*, or a *document* rule that defines the logic of the signature (see OnEvent())
+// the rules can keep state between events with the tracee.state functions (see stateFunctions)
+// the rules can read external data as data.tracee.config (see RulesData)
 type RegoSignature struct {
 	cb             types.SignatureHandler
+	state          *signatureState
+	options        *Options
+	dataVersion    uint64 // the version of data that matchPQ was partially evaluated with
+	profile        *evalProfile
+	pkgName        string
 	compiledRego   *ast.Compiler
 	matchPQ        rego.PreparedEvalQuery
 	metadata       types.SignatureMetadata
@@ -36,8 +43,21 @@ const packageNameRegex string = `package\s.*`
 
 // NewRegoSignature creates a new RegoSignature with the provided rego code string
 func NewRegoSignature(target string, partialEval bool, regoCodes ...string) (types.Signature, error) {
+	return NewRegoSignatureWithOptions(regoCodes, OPATarget(target), OPAPartial(partialEval))
+}
+
+// NewRegoSignatureWithOptions creates a new RegoSignature with the provided rego code strings and Option items
+func NewRegoSignatureWithOptions(regoCodes []string, opts ...Option) (types.Signature, error) {
+	options := newDefaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	var err error
-	res := RegoSignature{}
+	res := RegoSignature{
+		state:   newSignatureState(),
+		options: options,
+	}
 	regoMap := make(map[string]string)
 
 	re := regexp.MustCompile(packageNameRegex)
@@ -62,30 +82,9 @@ func NewRegoSignature(target string, partialEval bool, regoCodes ...string) (typ
 		return nil, err
 	}
 
-	ctx := context.Background()
-	if partialEval {
-		pr, err := rego.New(
-
-			rego.Compiler(res.compiledRego),
-			rego.Query(fmt.Sprintf(queryMatch, pkgName)),
-		).PartialResult(ctx)
-		if err != nil {
-			return nil, err
-		}
-
-		res.matchPQ, err = pr.Rego(rego.Target(target)).PrepareForEval(ctx)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		res.matchPQ, err = rego.New(
-			rego.Target(target),
-			rego.Compiler(res.compiledRego),
-			rego.Query(fmt.Sprintf(queryMatch, pkgName)),
-		).PrepareForEval(ctx)
-		if err != nil {
-			return nil, err
-		}
+	res.pkgName = pkgName
+	if err := res.prepareMatch(); err != nil {
+		return nil, err
 	}
 
 	res.metadata, err = res.getMetadata(pkgName)
@@ -96,9 +95,45 @@ func NewRegoSignature(target string, partialEval bool, regoCodes ...string) (typ
 	if err != nil {
 		return nil, err
 	}
+	res.profile = options.OPAProfiler.newEvalProfile(res.metadata.ID)
+	for regoModuleName := range regoMap {
+		// the helpers are attributed to the signature too, since it has its own profile
+		res.profile.setSignature(regoModuleName, res.metadata.ID)
+	}
 	return &res, nil
 }
 
+// prepareMatch prepares the tracee_match query. With partial evaluation, the data is evaluated ahead of time, so the
+// query is prepared again when the data changes.
+func (sig *RegoSignature) prepareMatch() error {
+	var err error
+	ctx := context.Background()
+	query := fmt.Sprintf(queryMatch, sig.pkgName)
+	if sig.options.OPAPartial {
+		version := sig.options.OPAData.currentVersion()
+		pr, err := rego.New(append(sig.options.OPAData.options(),
+			rego.Compiler(sig.compiledRego),
+			rego.Query(query),
+		)...).PartialResult(ctx)
+		if err != nil {
+			return err
+		}
+
+		sig.matchPQ, err = pr.Rego(rego.Target(sig.options.OPATarget)).PrepareForEval(ctx)
+		if err != nil {
+			return err
+		}
+		sig.dataVersion = version
+		return nil
+	}
+	sig.matchPQ, err = rego.New(append(sig.options.OPAData.options(),
+		rego.Target(sig.options.OPATarget),
+		rego.Compiler(sig.compiledRego),
+		rego.Query(query),
+	)...).PrepareForEval(ctx)
+	return err
+}
+
 // Init implements the Signature interface by resetting internal state
 func (sig *RegoSignature) Init(cb types.SignatureHandler) error {
 	sig.cb = cb
@@ -175,10 +210,18 @@ func (sig *RegoSignature) OnEvent(e types.Event) error {
 	default:
 		return fmt.Errorf("unrecognized event type: %T", v)
 	}
-	results, err := sig.matchPQ.Eval(context.TODO(), input)
+	sig.state.advance(ee.Timestamp)
+	if sig.options.OPAPartial && sig.options.OPAData.currentVersion() != sig.dataVersion {
+		if err := sig.prepareMatch(); err != nil {
+			return fmt.Errorf("preparing rego with reloaded data: %w", err)
+		}
+	}
+	ctx, tx := sig.state.begin(context.TODO())
+	results, err := sig.profile.eval(ctx, sig.matchPQ, input)
 	if err != nil {
 		return fmt.Errorf("evaluating rego: %w", err)
 	}
+	tx.commit()
 
 	if len(results) > 0 && len(results[0].Expressions) > 0 && results[0].Expressions[0].Value != nil {
 		switch v := results[0].Expressions[0].Value.(type) {
@@ -202,17 +245,32 @@ func (sig *RegoSignature) OnEvent(e types.Event) error {
 }
 
 // OnSignal implements the Signature interface by handling lifecycle events of the signature
+// the state of the signature is deleted when its source completes
 func (sig *RegoSignature) OnSignal(signal types.Signal) error {
-	return fmt.Errorf("function OnSignal is not implemented")
+	switch v := signal.(type) {
+	case types.SignalSourceComplete:
+		sig.state.reset()
+		return nil
+	case types.SignalSourceStart, types.SignalShutdown:
+		// findings are reported as events are evaluated, so there's nothing to do
+		return nil
+	case types.SignalTick:
+		sig.state.advance(v.Timestamp)
+		return nil
+	case types.SignalWatermark:
+		sig.state.advance(v.Timestamp)
+		return nil
+	}
+	return fmt.Errorf("unsupported signal: %v", signal)
 }
 
 func (sig *RegoSignature) Close() {}
 
 func (sig *RegoSignature) evalQuery(query string) (interface{}, error) {
-	pq, err := rego.New(
+	pq, err := rego.New(append(sig.options.OPAData.options(),
 		rego.Compiler(sig.compiledRego),
 		rego.Query(query),
-	).PrepareForEval(context.TODO())
+	)...).PrepareForEval(context.TODO())
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
 	"github.com/aquasecurity/tracee/tracee-rules/engine"
@@ -369,5 +370,53 @@ func TestRegoSignature_OnSignal(t *testing.T) {
 	sig, err := regosig.NewRegoSignature(compile.TargetRego, false, testRegoCodeBoolean)
 	require.NoError(t, err)
 	err = sig.OnSignal(os.Kill)
-	assert.EqualError(t, err, "function OnSignal is not implemented")
+	assert.EqualError(t, err, "unsupported signal: killed")
+	err = sig.OnSignal(types.SignalSourceComplete("tracee"))
+	assert.NoError(t, err)
+	err = sig.OnSignal(types.SignalWatermark{Timestamp: 1})
+	assert.NoError(t, err)
+}
+
+func TestRegoSignature_State(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%t", partial), func(t *testing.T) {
+			sig, err := regosig.NewRegoSignature(compile.TargetRego, partial, testRegoCodeState)
+			require.NoError(t, err)
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a"}))
+				require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "b"}))
+			}
+			require.Len(t, holder.Values, 2)
+			assert.Equal(t, map[string]interface{}{"container": "a", "count": json.Number("3")}, holder.Values[0].Data)
+			assert.Equal(t, map[string]interface{}{"container": "b", "count": json.Number("3")}, holder.Values[1].Data)
+
+			// the state is deleted when the source completes
+			require.NoError(t, sig.OnSignal(types.SignalSourceComplete("tracee")))
+			require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a"}))
+			assert.Len(t, holder.Values, 2)
+		})
+	}
+}
+
+func TestRegoSignature_StateClock(t *testing.T) {
+	sig, err := regosig.NewRegoSignature(compile.TargetRego, false, testRegoCodeState)
+	require.NoError(t, err)
+	holder := signaturestest.FindingsHolder{}
+	require.NoError(t, sig.Init(holder.OnFinding))
+
+	// the count expires 60 seconds after it was incremented, by the timestamps of the events
+	second := int(time.Second)
+	require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a", Timestamp: 0}))
+	require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a", Timestamp: 50 * second}))
+	require.NoError(t, sig.OnSignal(types.SignalTick{Timestamp: 120 * second}))
+	require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a", Timestamp: 100 * second}))
+	assert.Empty(t, holder.Values)
+
+	require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a", Timestamp: 130 * second}))
+	require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve", ContainerID: "a", Timestamp: 140 * second}))
+	require.Len(t, holder.Values, 1)
+	assert.Equal(t, map[string]interface{}{"container": "a", "count": json.Number("3")}, holder.Values[0].Data)
 }
@@ -0,0 +1,321 @@
+package rpcplugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+const (
+	healthCheckInterval = 10 * time.Second
+	callTimeout         = 30 * time.Second // a plugin that doesn't reply in time is considered hung, and restarted
+	maxRestarts         = 5
+)
+
+var errPluginDown = errors.New("plugin is down")
+
+// pluginProcess is a running plugin executable, which is restarted if it crashes
+type pluginProcess struct {
+	name     string
+	newCmd   func() *exec.Cmd
+	infos    []SignatureInfo
+	sigs     []*remoteSignature
+	mu       sync.Mutex // guards the fields below
+	cmd      *exec.Cmd
+	client   *rpc.Client
+	restarts int
+	live     int // signatures that weren't closed yet, whether they were initialized or not
+	done     chan struct{}
+}
+
+// Load starts a plugin executable and returns its signatures
+func Load(path string) ([]types.Signature, error) {
+	return load(filepath.Base(path), func() *exec.Cmd { return exec.Command(path) })
+}
+
+func load(name string, newCmd func() *exec.Cmd) ([]types.Signature, error) {
+	p := &pluginProcess{name: name, newCmd: newCmd, done: make(chan struct{})}
+	infos, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	p.infos = infos
+	p.live = len(infos)
+	var sigs []types.Signature
+	for i := range infos {
+		sig := &remoteSignature{plugin: p, index: i}
+		p.sigs = append(p.sigs, sig)
+		sigs = append(sigs, sig)
+	}
+	if len(sigs) == 0 {
+		p.kill()
+		return nil, nil
+	}
+	go p.healthCheck()
+	return sigs, nil
+}
+
+// start starts the plugin executable and returns the signatures that it serves. p.mu must be held, or p must not
+// be shared yet.
+func (p *pluginProcess) start() ([]SignatureInfo, error) {
+	cmd := p.newCmd()
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, magicCookieKey+"="+magicCookieValue)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting plugin %s: %v", p.name, err)
+	}
+	p.cmd = cmd
+	p.client = rpc.NewClient(pipeConn{ReadCloser: stdout, WriteCloser: stdin})
+
+	var reply HandshakeReply
+	if err := p.call(p.client, "Plugin.Handshake", HandshakeArgs{}, &reply); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("error in handshake with plugin %s: %v", p.name, err)
+	}
+	if reply.ProtocolVersion != ProtocolVersion {
+		p.kill()
+		return nil, fmt.Errorf("plugin %s uses protocol version %d, but version %d is required", p.name, reply.ProtocolVersion, ProtocolVersion)
+	}
+	return reply.Signatures, nil
+}
+
+type pipeConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (c pipeConn) Close() error {
+	c.WriteCloser.Close()
+	return c.ReadCloser.Close()
+}
+
+// kill stops the plugin executable. p.mu must be held, or p must not be shared yet.
+func (p *pluginProcess) kill() {
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+	if p.cmd != nil {
+		p.cmd.Process.Kill()
+		p.cmd.Wait()
+		p.cmd = nil
+	}
+}
+
+// call calls an RPC method of the plugin, with a timeout
+func (p *pluginProcess) call(client *rpc.Client, method string, args interface{}, reply interface{}) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(callTimeout):
+		return fmt.Errorf("%s timed out", method)
+	}
+}
+
+// isPluginError returns true if the error was returned by the plugin, rather than by a failure to call it
+func isPluginError(err error) bool {
+	_, ok := err.(rpc.ServerError)
+	return ok
+}
+
+// callSignature calls an RPC method of a signature, and restarts the plugin if the call failed because the plugin
+// crashed or hung
+func (p *pluginProcess) callSignature(method string, args interface{}, reply *Reply) error {
+	p.mu.Lock()
+	client := p.client
+	p.mu.Unlock()
+	if client == nil {
+		return errPluginDown
+	}
+	err := p.call(client, method, args, reply)
+	if err == nil || isPluginError(err) {
+		return err
+	}
+	if restartErr := p.restart(client); restartErr != nil {
+		return fmt.Errorf("%v, and plugin %s couldn't be restarted: %v", err, p.name, restartErr)
+	}
+	return fmt.Errorf("%v, plugin %s was restarted", err, p.name)
+}
+
+// restart restarts the plugin, unless it was already restarted since the failed client was used, and initializes
+// its open signatures
+func (p *pluginProcess) restart(failed *rpc.Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != failed {
+		return nil
+	}
+	p.kill()
+	if p.restarts >= maxRestarts {
+		return fmt.Errorf("restarted %d times already", p.restarts)
+	}
+	p.restarts++
+	log.Printf("restarting plugin %s", p.name)
+	infos, err := p.start()
+	if err != nil {
+		return err
+	}
+	if len(infos) != len(p.infos) {
+		p.kill()
+		return fmt.Errorf("plugin serves %d signatures instead of %d", len(infos), len(p.infos))
+	}
+	for i, info := range infos {
+		if info.Metadata.ID != p.infos[i].Metadata.ID {
+			p.kill()
+			return fmt.Errorf("plugin serves signature %s instead of %s", info.Metadata.ID, p.infos[i].Metadata.ID)
+		}
+	}
+	for _, sig := range p.sigs {
+		if !sig.isOpen() {
+			continue
+		}
+		var reply Reply
+		if err := p.call(p.client, "Plugin.Init", SignatureArgs{Signature: sig.index}, &reply); err != nil {
+			return fmt.Errorf("error initializing signature %s: %v", p.infos[sig.index].Metadata.Name, err)
+		}
+		sig.deliver(reply)
+	}
+	return nil
+}
+
+// healthCheck periodically pings the plugin, and restarts it if it crashed or hung
+func (p *pluginProcess) healthCheck() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			client := p.client
+			p.mu.Unlock()
+			if client == nil {
+				continue
+			}
+			if err := p.call(client, "Plugin.Ping", struct{}{}, &struct{}{}); err != nil {
+				log.Printf("health check of plugin %s failed: %v", p.name, err)
+				if err := p.restart(client); err != nil {
+					log.Printf("error restarting plugin %s: %v", p.name, err)
+				}
+			}
+		}
+	}
+}
+
+// remoteSignature is a signature that runs in a plugin
+type remoteSignature struct {
+	plugin *pluginProcess
+	index  int
+	mu     sync.Mutex
+	cb     types.SignatureHandler
+	open   bool
+	closed bool
+}
+
+func (sig *remoteSignature) info() SignatureInfo {
+	return sig.plugin.infos[sig.index]
+}
+
+func (sig *remoteSignature) isOpen() bool {
+	sig.mu.Lock()
+	defer sig.mu.Unlock()
+	return sig.open
+}
+
+// deliver reports the findings that were returned by the plugin
+func (sig *remoteSignature) deliver(reply Reply) {
+	sig.mu.Lock()
+	cb := sig.cb
+	sig.mu.Unlock()
+	for _, finding := range reply.Findings {
+		cb(finding)
+	}
+}
+
+func (sig *remoteSignature) GetMetadata() (types.SignatureMetadata, error) {
+	return sig.info().Metadata, nil
+}
+
+func (sig *remoteSignature) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	return sig.info().SelectedEvents, nil
+}
+
+func (sig *remoteSignature) Init(cb types.SignatureHandler) error {
+	sig.mu.Lock()
+	sig.cb = cb
+	sig.open = true
+	sig.mu.Unlock()
+	var reply Reply
+	err := sig.plugin.callSignature("Plugin.Init", SignatureArgs{Signature: sig.index}, &reply)
+	sig.deliver(reply)
+	return err
+}
+
+func (sig *remoteSignature) OnEvent(event types.Event) error {
+	var reply Reply
+	err := sig.plugin.callSignature("Plugin.OnEvent", EventArgs{Signature: sig.index, Event: event}, &reply)
+	sig.deliver(reply)
+	return err
+}
+
+func (sig *remoteSignature) OnSignal(signal types.Signal) error {
+	var reply Reply
+	err := sig.plugin.callSignature("Plugin.OnSignal", SignalArgs{Signature: sig.index, Signal: signal}, &reply)
+	sig.deliver(reply)
+	return err
+}
+
+// Close closes the signature, and stops the plugin once all of its signatures were closed, including the ones that
+// were never initialized
+func (sig *remoteSignature) Close() {
+	sig.mu.Lock()
+	if sig.closed {
+		sig.mu.Unlock()
+		return
+	}
+	sig.closed = true
+	wasOpen := sig.open
+	sig.open = false
+	sig.mu.Unlock()
+	p := sig.plugin
+	if wasOpen {
+		var reply Reply
+		if err := p.callSignature("Plugin.Close", SignatureArgs{Signature: sig.index}, &reply); err != nil {
+			log.Printf("error closing signature %s: %v", sig.info().Metadata.Name, err)
+		}
+		sig.deliver(reply)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.live--
+	if p.live == 0 {
+		p.kill()
+		select {
+		case <-p.done:
+		default:
+			close(p.done)
+		}
+	}
+}
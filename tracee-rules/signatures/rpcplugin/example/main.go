@@ -0,0 +1,53 @@
+// Command example is an example plugin executable, which serves a signature to tracee-rules out of process.
+// Build it with `go build -o example.plugin` and place it in the rules directory.
+package main
+
+import (
+	"strings"
+
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/rpcplugin"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/sdk"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// curlPipeShell detects a shell that runs a script that is downloaded by curl or wget, e.g. `curl ... | sh`
+type curlPipeShell struct {
+	sdk.Base
+}
+
+func (sig *curlPipeShell) GetMetadata() (types.SignatureMetadata, error) {
+	return types.SignatureMetadata{
+		ID:          "EXAMPLE-1",
+		Version:     "0.1.0",
+		Name:        "Downloaded script piped to a shell",
+		Description: "A shell ran a script that was downloaded by curl or wget",
+		Properties: map[string]interface{}{
+			"Severity": 2,
+		},
+	}, nil
+}
+
+func (sig *curlPipeShell) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+}
+
+func (sig *curlPipeShell) OnEvent(e types.Event) error {
+	event, err := sdk.ToTraceeEvent(e)
+	if err != nil {
+		return err
+	}
+	argv, err := sdk.GetStringSliceArg(event, "argv")
+	if err != nil || len(argv) < 3 || argv[1] != "-c" {
+		return nil
+	}
+	script := argv[2]
+	if (strings.Contains(script, "curl ") || strings.Contains(script, "wget ")) && strings.Contains(script, "| sh") {
+		m, _ := sig.GetMetadata()
+		sig.Report(sdk.NewFinding(m, event).With("script", script).Build())
+	}
+	return nil
+}
+
+func main() {
+	rpcplugin.Serve([]types.Signature{&curlPipeShell{}})
+}
@@ -0,0 +1,69 @@
+// Package rpcplugin runs signatures in plugin executables, out of the tracee-rules process, over net/rpc on the
+// plugin's stdin and stdout. Plugins can be built with any Go toolchain and versions of their dependencies, and a
+// plugin that crashes is restarted without affecting tracee-rules or other plugins.
+package rpcplugin
+
+import (
+	"encoding/gob"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// ProtocolVersion is incremented on incompatible changes of the protocol between tracee-rules and plugins
+const ProtocolVersion = 1
+
+// magicCookie is set in the environment of plugins, so a plugin executable that is run directly by a user exits
+// with an explanation rather than waiting for RPC requests
+const (
+	magicCookieKey   = "TRACEE_RULES_PLUGIN"
+	magicCookieValue = "3d2b4c8e5f1a4e7b9c6d0a1e7f52b8c4"
+)
+
+// PluginExt is the extension of plugin executables in the rules directory
+const PluginExt = ".plugin"
+
+func init() {
+	// types that are sent in interface values of events, signals and findings
+	gob.Register(tracee.Event{})
+	gob.Register(tracee.SlimCred{})
+	gob.Register(make(map[string]string))
+	gob.Register(types.SignalSourceStart(""))
+	gob.Register(types.SignalSourceComplete(""))
+	gob.Register(types.SignalTick{})
+	gob.Register(types.SignalWatermark{})
+	gob.Register(types.SignalShutdown{})
+}
+
+type HandshakeArgs struct{}
+
+type HandshakeReply struct {
+	ProtocolVersion int
+	Signatures      []SignatureInfo
+}
+
+// SignatureInfo describes a signature of a plugin
+type SignatureInfo struct {
+	Metadata       types.SignatureMetadata
+	SelectedEvents []types.SignatureEventSelector
+}
+
+type SignatureArgs struct {
+	Signature int // index of the signature in HandshakeReply.Signatures
+}
+
+type EventArgs struct {
+	Signature int
+	Event     types.Event
+}
+
+type SignalArgs struct {
+	Signature int
+	Signal    types.Signal
+}
+
+// Reply returns the findings that the signature reported since the previous reply, since findings can't be
+// reported to tracee-rules by the plugin directly
+type Reply struct {
+	Findings []types.Finding
+}
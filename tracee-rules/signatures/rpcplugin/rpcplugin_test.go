@@ -0,0 +1,145 @@
+package rpcplugin
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/sdk"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSignature reports the events it got, and crashes the plugin on a "crash" event
+type testSignature struct {
+	sdk.Base
+	id     string
+	events int
+}
+
+func (sig *testSignature) GetMetadata() (types.SignatureMetadata, error) {
+	return types.SignatureMetadata{ID: sig.id, Name: "test " + sig.id}, nil
+}
+
+func (sig *testSignature) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	return []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, nil
+}
+
+func (sig *testSignature) OnEvent(e types.Event) error {
+	event, err := sdk.ToTraceeEvent(e)
+	if err != nil {
+		return err
+	}
+	switch event.ProcessName {
+	case "crash":
+		os.Exit(2)
+	case "fail":
+		return errors.New("failed")
+	}
+	sig.events++
+	m, _ := sig.GetMetadata()
+	sig.Report(sdk.NewFinding(m, event).With("events", sig.events).Build())
+	return nil
+}
+
+func (sig *testSignature) OnSignal(signal types.Signal) error {
+	m, _ := sig.GetMetadata()
+	sig.Report(sdk.NewFinding(m, nil).With("signal", signal).Build())
+	return nil
+}
+
+// TestHelperPlugin is the plugin executable of the tests
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("TRACEE_RULES_TEST_PLUGIN") != "1" {
+		return
+	}
+	Serve([]types.Signature{&testSignature{id: "TRC-A"}, &testSignature{id: "TRC-B"}})
+	os.Exit(0)
+}
+
+func newTestPluginCmd() *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperPlugin")
+	cmd.Env = append(os.Environ(), "TRACEE_RULES_TEST_PLUGIN=1")
+	return cmd
+}
+
+func TestLoad(t *testing.T) {
+	sigs, err := load("test.plugin", newTestPluginCmd)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	sig := sigs[0]
+	m, err := sig.GetMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, types.SignatureMetadata{ID: "TRC-A", Name: "test TRC-A"}, m)
+	selectedEvents, err := sig.GetSelectedEvents()
+	require.NoError(t, err)
+	assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, selectedEvents)
+
+	holder := signaturestest.FindingsHolder{}
+	require.NoError(t, sig.Init(holder.OnFinding))
+	event := tracee.Event{
+		ProcessName: "sh",
+		EventName:   "execve",
+		Args:        []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "argv", Type: "const char**"}, Value: []string{"sh", "-c", "id"}}},
+	}
+	require.NoError(t, sig.OnEvent(event))
+	require.NoError(t, sig.OnEvent(event))
+	require.Len(t, holder.Values, 2)
+	assert.Equal(t, types.Finding{Data: map[string]interface{}{"events": 2}, Context: event, SigMetadata: m}, holder.Values[1])
+
+	// errors of the signature are returned as is
+	assert.EqualError(t, sig.OnEvent(tracee.Event{ProcessName: "fail"}), "failed")
+
+	// the plugin is restarted after a crash, and its signatures are initialized again
+	err = sig.OnEvent(tracee.Event{ProcessName: "crash"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "plugin test.plugin was restarted")
+	require.NoError(t, sig.OnEvent(event))
+	assert.Equal(t, 1, holder.Values[2].Data["events"])
+
+	require.NoError(t, sig.OnSignal(types.SignalSourceComplete("tracee")))
+	assert.Equal(t, types.SignalSourceComplete("tracee"), holder.Values[3].Data["signal"])
+
+	// closing a signature that was never initialized doesn't stop the plugin while other signatures are open
+	sigs[1].Close()
+	require.NoError(t, sig.OnEvent(event))
+
+	// the plugin is stopped once all its signatures are closed
+	sig.Close()
+	assert.Equal(t, errPluginDown, sig.OnEvent(event))
+	assertPluginStopped(t, sig)
+}
+
+func TestLoad_closeWithoutInit(t *testing.T) {
+	sigs, err := load("test.plugin", newTestPluginCmd)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+
+	// signatures that weren't selected are closed without being initialized
+	sigs[0].Close()
+	p := sigs[0].(*remoteSignature).plugin
+	p.mu.Lock()
+	assert.NotNil(t, p.cmd, "the plugin must run until all of its signatures are closed")
+	p.mu.Unlock()
+	sigs[1].Close()
+	assertPluginStopped(t, sigs[1])
+}
+
+// assertPluginStopped asserts that the process of the plugin of the signature was killed, and that its health
+// check was stopped
+func assertPluginStopped(t *testing.T, sig types.Signature) {
+	p := sig.(*remoteSignature).plugin
+	p.mu.Lock()
+	assert.Nil(t, p.cmd)
+	assert.Nil(t, p.client)
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+	default:
+		t.Error("the health check of the plugin wasn't stopped")
+	}
+}
@@ -0,0 +1,148 @@
+package rpcplugin
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+	"os"
+	"sync"
+
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// pluginSignature is a signature in a plugin, with the findings it reported that weren't returned yet
+type pluginSignature struct {
+	mu       sync.Mutex // calls to the signature are serialized, as they are by the engine
+	sig      types.Signature
+	findings []types.Finding
+	findMu   sync.Mutex
+}
+
+func (s *pluginSignature) report(finding types.Finding) {
+	s.findMu.Lock()
+	defer s.findMu.Unlock()
+	s.findings = append(s.findings, finding)
+}
+
+func (s *pluginSignature) reply(reply *Reply) {
+	s.findMu.Lock()
+	defer s.findMu.Unlock()
+	reply.Findings = s.findings
+	s.findings = nil
+}
+
+// Plugin is the RPC service of a plugin
+type Plugin struct {
+	sigs []*pluginSignature
+}
+
+func (p *Plugin) signature(i int) (*pluginSignature, error) {
+	if i < 0 || i >= len(p.sigs) {
+		return nil, fmt.Errorf("no signature %d in plugin", i)
+	}
+	return p.sigs[i], nil
+}
+
+func (p *Plugin) Handshake(args HandshakeArgs, reply *HandshakeReply) error {
+	reply.ProtocolVersion = ProtocolVersion
+	for _, s := range p.sigs {
+		metadata, err := s.sig.GetMetadata()
+		if err != nil {
+			return err
+		}
+		selectedEvents, err := s.sig.GetSelectedEvents()
+		if err != nil {
+			return fmt.Errorf("signature %s: %v", metadata.Name, err)
+		}
+		reply.Signatures = append(reply.Signatures, SignatureInfo{Metadata: metadata, SelectedEvents: selectedEvents})
+	}
+	return nil
+}
+
+// Ping is the health check of the plugin
+func (p *Plugin) Ping(args struct{}, reply *struct{}) error {
+	return nil
+}
+
+func (p *Plugin) Init(args SignatureArgs, reply *Reply) error {
+	s, err := p.signature(args.Signature)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.sig.Init(s.report)
+	s.reply(reply)
+	return err
+}
+
+func (p *Plugin) OnEvent(args EventArgs, reply *Reply) error {
+	s, err := p.signature(args.Signature)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.sig.OnEvent(args.Event)
+	s.reply(reply)
+	return err
+}
+
+func (p *Plugin) OnSignal(args SignalArgs, reply *Reply) error {
+	s, err := p.signature(args.Signature)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.sig.OnSignal(args.Signal)
+	s.reply(reply)
+	return err
+}
+
+func (p *Plugin) Close(args SignatureArgs, reply *Reply) error {
+	s, err := p.signature(args.Signature)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sig.Close()
+	s.reply(reply)
+	return nil
+}
+
+type stdioConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c stdioConn) Close() error {
+	return nil
+}
+
+// Serve serves the given signatures to tracee-rules over stdin and stdout. It is called by the main function of a
+// plugin executable, and returns when tracee-rules closes the connection.
+func Serve(sigs []types.Signature) {
+	if os.Getenv(magicCookieKey) != magicCookieValue {
+		fmt.Fprintf(os.Stderr, "This is a tracee-rules plugin, which is run by tracee-rules. Place it in the rules directory with the %s extension.\n", PluginExt)
+		os.Exit(1)
+	}
+	// stdout is reserved for RPC, so anything the signatures print goes to stderr
+	rpcOut := os.Stdout
+	os.Stdout = os.Stderr
+	serve(sigs, stdioConn{Reader: os.Stdin, Writer: rpcOut})
+}
+
+func serve(sigs []types.Signature, conn io.ReadWriteCloser) {
+	plugin := &Plugin{}
+	for _, sig := range sigs {
+		plugin.sigs = append(plugin.sigs, &pluginSignature{sig: sig})
+	}
+	server := rpc.NewServer()
+	if err := server.Register(plugin); err != nil {
+		fmt.Fprintf(os.Stderr, "error registering plugin: %v\n", err)
+		os.Exit(1)
+	}
+	server.ServeConn(conn)
+}
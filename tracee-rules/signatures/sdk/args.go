@@ -0,0 +1,156 @@
+// Package sdk provides the building blocks of Go signatures: typed accessors of event arguments, a base
+// implementation of the signature lifecycle, a findings builder and per process state.
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/helpers"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+)
+
+// ToTraceeEvent returns the given event as a tracee event
+func ToTraceeEvent(event types.Event) (tracee.Event, error) {
+	ee, ok := event.(tracee.Event)
+	if !ok {
+		return tracee.Event{}, fmt.Errorf("invalid event: %T is not a tracee event", event)
+	}
+	return ee, nil
+}
+
+// GetArg returns the argument of the event with the given name
+func GetArg(event tracee.Event, name string) (tracee.Argument, error) {
+	arg, err := helpers.GetTraceeArgumentByName(event, name)
+	if err != nil {
+		return tracee.Argument{}, fmt.Errorf("event %s: %v", event.EventName, err)
+	}
+	return arg, nil
+}
+
+func argTypeError(event tracee.Event, arg tracee.Argument, expected string) error {
+	return fmt.Errorf("event %s: argument %s is %T, not %s", event.EventName, arg.Name, arg.Value, expected)
+}
+
+// GetIntArg returns the value of a numeric argument, which may have been decoded from gob or json
+func GetIntArg(event tracee.Event, name string) (int, error) {
+	arg, err := GetArg(event, name)
+	if err != nil {
+		return 0, err
+	}
+	switch v := arg.Value.(type) {
+	case int:
+		return v, nil
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("event %s: argument %s is %v, not an integer", event.EventName, name, v)
+		}
+		return int(v), nil
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		if err != nil {
+			return 0, fmt.Errorf("event %s: argument %s is %v, not an integer", event.EventName, name, v)
+		}
+		return n, nil
+	}
+	return 0, argTypeError(event, arg, "an integer")
+}
+
+// GetStringArg returns the value of a string argument
+func GetStringArg(event tracee.Event, name string) (string, error) {
+	arg, err := GetArg(event, name)
+	if err != nil {
+		return "", err
+	}
+	s, ok := arg.Value.(string)
+	if !ok {
+		return "", argTypeError(event, arg, "a string")
+	}
+	return s, nil
+}
+
+// GetStringSliceArg returns the value of a string array argument, e.g. argv, which may have been decoded from gob or
+// json
+func GetStringSliceArg(event tracee.Event, name string) ([]string, error) {
+	arg, err := GetArg(event, name)
+	if err != nil {
+		return nil, err
+	}
+	switch v := arg.Value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		ss := make([]string, len(v))
+		for i, elem := range v {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("event %s: element %d of argument %s is %T, not a string", event.EventName, i, name, elem)
+			}
+			ss[i] = s
+		}
+		return ss, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, argTypeError(event, arg, "a string array")
+}
+
+// Sockaddr is a socket address, as in the struct sockaddr* arguments of tracee events
+type Sockaddr struct {
+	Family string // e.g. AF_INET, AF_INET6 or AF_UNIX
+	IP     string // of AF_INET and AF_INET6 addresses
+	Port   string // of AF_INET and AF_INET6 addresses
+	Path   string // of AF_UNIX addresses
+}
+
+// GetSockaddrArg returns the value of a socket address argument, which may have been decoded from gob or json
+func GetSockaddrArg(event tracee.Event, name string) (Sockaddr, error) {
+	arg, err := GetArg(event, name)
+	if err != nil {
+		return Sockaddr{}, err
+	}
+	fields := make(map[string]string)
+	switch v := arg.Value.(type) {
+	case map[string]string:
+		fields = v
+	case map[string]interface{}:
+		for key, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				return Sockaddr{}, fmt.Errorf("event %s: field %s of argument %s is %T, not a string", event.EventName, key, name, value)
+			}
+			fields[key] = s
+		}
+	default:
+		return Sockaddr{}, argTypeError(event, arg, "a socket address")
+	}
+	addr := Sockaddr{Family: fields["sa_family"]}
+	switch addr.Family {
+	case "AF_INET":
+		addr.IP, addr.Port = fields["sin_addr"], fields["sin_port"]
+	case "AF_INET6":
+		addr.IP, addr.Port = fields["sin6_addr"], fields["sin6_port"]
+	case "AF_UNIX":
+		addr.Path = fields["sun_path"]
+	}
+	return addr, nil
+}
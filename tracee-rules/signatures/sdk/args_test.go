@@ -0,0 +1,136 @@
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(args ...tracee.Argument) tracee.Event {
+	return tracee.Event{EventName: "security_socket_connect", Args: args}
+}
+
+func arg(name string, value interface{}) tracee.Argument {
+	return tracee.Argument{ArgMeta: tracee.ArgMeta{Name: name}, Value: value}
+}
+
+func TestToTraceeEvent(t *testing.T) {
+	ee, err := ToTraceeEvent(testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, "security_socket_connect", ee.EventName)
+
+	_, err = ToTraceeEvent("not an event")
+	assert.EqualError(t, err, "invalid event: string is not a tracee event")
+}
+
+func TestGetIntArg(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         interface{}
+		expected      int
+		expectedError string
+	}{
+		{name: "int32 from gob", value: int32(-1), expected: -1},
+		{name: "uint64 from gob", value: uint64(42), expected: 42},
+		{name: "float64 from json", value: float64(3), expected: 3},
+		{name: "json number", value: json.Number("7"), expected: 7},
+		{name: "fraction", value: 1.5, expectedError: "event security_socket_connect: argument fd is 1.5, not an integer"},
+		{name: "string", value: "3", expectedError: "event security_socket_connect: argument fd is string, not an integer"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := GetIntArg(testEvent(arg("fd", tc.value)), "fd")
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, n)
+		})
+	}
+
+	_, err := GetIntArg(testEvent(), "fd")
+	assert.EqualError(t, err, "event security_socket_connect: argument fd not found")
+}
+
+func TestGetStringArg(t *testing.T) {
+	s, err := GetStringArg(testEvent(arg("pathname", "/etc/passwd")), "pathname")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/passwd", s)
+
+	_, err = GetStringArg(testEvent(arg("pathname", 1)), "pathname")
+	assert.EqualError(t, err, "event security_socket_connect: argument pathname is int, not a string")
+}
+
+func TestGetStringSliceArg(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         interface{}
+		expected      []string
+		expectedError string
+	}{
+		{name: "from gob", value: []string{"ls", "-l"}, expected: []string{"ls", "-l"}},
+		{name: "from json", value: []interface{}{"ls", "-l"}, expected: []string{"ls", "-l"}},
+		{name: "null", value: nil},
+		{name: "not strings", value: []interface{}{"ls", 1}, expectedError: "event security_socket_connect: element 1 of argument argv is int, not a string"},
+		{name: "string", value: "ls", expectedError: "event security_socket_connect: argument argv is string, not a string array"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ss, err := GetStringSliceArg(testEvent(arg("argv", tc.value)), "argv")
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ss)
+		})
+	}
+}
+
+func TestGetSockaddrArg(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         interface{}
+		expected      Sockaddr
+		expectedError string
+	}{
+		{
+			name:     "inet from gob",
+			value:    map[string]string{"sa_family": "AF_INET", "sin_addr": "10.0.0.1", "sin_port": "443"},
+			expected: Sockaddr{Family: "AF_INET", IP: "10.0.0.1", Port: "443"},
+		},
+		{
+			name:     "inet6 from json",
+			value:    map[string]interface{}{"sa_family": "AF_INET6", "sin6_addr": "::1", "sin6_port": "80", "sin6_flowinfo": "0"},
+			expected: Sockaddr{Family: "AF_INET6", IP: "::1", Port: "80"},
+		},
+		{
+			name:     "unix",
+			value:    map[string]string{"sa_family": "AF_UNIX", "sun_path": "/var/run/docker.sock"},
+			expected: Sockaddr{Family: "AF_UNIX", Path: "/var/run/docker.sock"},
+		},
+		{
+			name:          "not an address",
+			value:         "10.0.0.1:443",
+			expectedError: "event security_socket_connect: argument remote_addr is string, not a socket address",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := GetSockaddrArg(testEvent(arg("remote_addr", tc.value)), "remote_addr")
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, addr)
+		})
+	}
+}
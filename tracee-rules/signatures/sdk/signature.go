@@ -0,0 +1,59 @@
+package sdk
+
+import "github.com/aquasecurity/tracee/tracee-rules/types"
+
+// Base implements the lifecycle methods of a signature, and is meant to be embedded in signatures.
+// A signature that overrides Init should call Base.Init.
+type Base struct {
+	cb types.SignatureHandler
+}
+
+// Init implements the Signature interface by keeping the findings callback
+func (b *Base) Init(cb types.SignatureHandler) error {
+	b.cb = cb
+	return nil
+}
+
+// Close implements the Signature interface
+func (b *Base) Close() {}
+
+// OnSignal implements the Signature interface by ignoring signals
+func (b *Base) OnSignal(signal types.Signal) error {
+	return nil
+}
+
+// Report reports a finding to the callback that was given to Init
+func (b *Base) Report(finding types.Finding) {
+	b.cb(finding)
+}
+
+// FindingBuilder builds a finding
+type FindingBuilder struct {
+	finding types.Finding
+}
+
+// NewFinding starts building a finding of a signature, in the context of the event that triggered it
+func NewFinding(metadata types.SignatureMetadata, event types.Event) *FindingBuilder {
+	return &FindingBuilder{finding: types.Finding{
+		SigMetadata: metadata,
+		Context:     event,
+		Data:        make(map[string]interface{}),
+	}}
+}
+
+// With adds data to the finding
+func (b *FindingBuilder) With(key string, value interface{}) *FindingBuilder {
+	b.finding.Data[key] = value
+	return b
+}
+
+// WithArtifact adds a captured file that is related to the finding
+func (b *FindingBuilder) WithArtifact(artifact types.Artifact) *FindingBuilder {
+	b.finding.Artifacts = append(b.finding.Artifacts, artifact)
+	return b
+}
+
+// Build returns the finding
+func (b *FindingBuilder) Build() types.Finding {
+	return b.finding
+}
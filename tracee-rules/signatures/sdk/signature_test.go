@@ -0,0 +1,30 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase(t *testing.T) {
+	holder := signaturestest.FindingsHolder{}
+	b := Base{}
+	require.NoError(t, b.Init(holder.OnFinding))
+	assert.NoError(t, b.OnSignal(types.SignalSourceComplete("tracee")))
+
+	m := types.SignatureMetadata{ID: "TRC-1"}
+	event := testEvent()
+	artifact := types.Artifact{Path: "/tmp/tracee/out/container/abc/write.dev-1.inode-2"}
+	b.Report(NewFinding(m, event).With("ip", "10.0.0.1").With("fd", 1).WithArtifact(artifact).Build())
+	b.Close()
+
+	assert.Equal(t, []types.Finding{{
+		Data:        map[string]interface{}{"ip": "10.0.0.1", "fd": 1},
+		Context:     event,
+		SigMetadata: m,
+		Artifacts:   []types.Artifact{artifact},
+	}}, holder.Values)
+}
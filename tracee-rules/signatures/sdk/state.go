@@ -0,0 +1,51 @@
+package sdk
+
+import tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+
+// ProcessState keeps state per process, by its pid namespace and process id, since process ids in different
+// containers may collide. The state of a process is deleted when its sched_process_exit event is passed to OnEvent, so signatures that keep
+// state per process should select sched_process_exit.
+type ProcessState struct {
+	states map[processKey]interface{}
+}
+
+type processKey struct {
+	pidNS int
+	pid   int
+}
+
+func NewProcessState() *ProcessState {
+	return &ProcessState{states: make(map[processKey]interface{})}
+}
+
+func keyOf(event tracee.Event) processKey {
+	return processKey{pidNS: event.PIDNS, pid: event.ProcessID}
+}
+
+// Get returns the state of the process of the event
+func (s *ProcessState) Get(event tracee.Event) (interface{}, bool) {
+	state, ok := s.states[keyOf(event)]
+	return state, ok
+}
+
+// Set sets the state of the process of the event
+func (s *ProcessState) Set(event tracee.Event, state interface{}) {
+	s.states[keyOf(event)] = state
+}
+
+// Delete deletes the state of the process of the event
+func (s *ProcessState) Delete(event tracee.Event) {
+	delete(s.states, keyOf(event))
+}
+
+// Len returns the number of processes that have state
+func (s *ProcessState) Len() int {
+	return len(s.states)
+}
+
+// OnEvent deletes the state of a process once it exited, i.e. when its main thread exited
+func (s *ProcessState) OnEvent(event tracee.Event) {
+	if event.EventName == "sched_process_exit" && event.ThreadID == event.ProcessID {
+		s.Delete(event)
+	}
+}
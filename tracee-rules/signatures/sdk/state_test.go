@@ -0,0 +1,36 @@
+package sdk
+
+import (
+	"testing"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessState(t *testing.T) {
+	s := NewProcessState()
+	main := tracee.Event{PIDNS: 1, ProcessID: 10, ThreadID: 10, EventName: "openat"}
+	thread := tracee.Event{PIDNS: 1, ProcessID: 10, ThreadID: 11, EventName: "openat"}
+	otherContainer := tracee.Event{PIDNS: 2, ProcessID: 10, ThreadID: 10, EventName: "openat"}
+
+	s.Set(main, "a")
+	s.Set(otherContainer, "b")
+	state, ok := s.Get(thread)
+	assert.True(t, ok)
+	assert.Equal(t, "a", state)
+	assert.Equal(t, 2, s.Len())
+
+	// the state is kept until the main thread exits
+	thread.EventName = "sched_process_exit"
+	s.OnEvent(thread)
+	assert.Equal(t, 2, s.Len())
+	main.EventName = "sched_process_exit"
+	s.OnEvent(main)
+	_, ok = s.Get(main)
+	assert.False(t, ok)
+	state, _ = s.Get(otherContainer)
+	assert.Equal(t, "b", state)
+
+	s.Delete(otherContainer)
+	assert.Equal(t, 0, s.Len())
+}
@@ -0,0 +1,213 @@
+package wasmsig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// the exports of the tracee signature ABI
+const (
+	exportAlloc          = "tracee_alloc"
+	exportMetadata       = "tracee_metadata"
+	exportSelectedEvents = "tracee_selected_events"
+	exportOnEvent        = "tracee_on_event"
+)
+
+// Signature is a signature that is implemented by a wasm module, which exports the tracee signature ABI:
+// memory: the memory of the module
+// tracee_alloc(size i32) i32: returns the address of size bytes, which the host writes an event to
+// tracee_metadata() i64: returns the signature's metadata, as a JSON object (see types.SignatureMetadata)
+// tracee_selected_events() i64: returns the signature's event selectors, as a JSON array (see types.SignatureEventSelector)
+// tracee_on_event(ptr i32, len i32) i64: handles the JSON tracee event at ptr, and returns its findings as a JSON array,
+// where true is a finding with no data and an object is a finding with the object as its data
+//
+// Strings that are returned as i64 are the address of the string in the upper 32 bits, and its length in the lower
+// 32 bits. 0 is an empty string, e.g. no findings.
+// Modules that import WASI, e.g. those that are built by TinyGo with -target=wasi, can use it with no access to the
+// file system, the network or the environment. Their stdout and stderr are written to tracee-rules' stderr.
+type Signature struct {
+	cb             types.SignatureHandler
+	limits         Limits
+	binary         []byte
+	runtime        wazero.Runtime
+	module         api.Module // nil after the sandbox was stopped, until it is recreated by the next event
+	metadata       types.SignatureMetadata
+	selectedEvents []types.SignatureEventSelector
+}
+
+// NewSignature creates a new Signature from the binary of a wasm module
+func NewSignature(limits Limits, binary []byte) (*Signature, error) {
+	sig := Signature{limits: limits, binary: binary}
+	if err := sig.start(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := callContext(limits)
+	defer cancel()
+	metadata, err := sig.callString(ctx, exportMetadata)
+	if err != nil {
+		sig.Close()
+		return nil, err
+	}
+	if err := decodeJSON(metadata, &sig.metadata); err != nil {
+		sig.Close()
+		return nil, fmt.Errorf("decoding %s: %w", exportMetadata, err)
+	}
+	selectedEvents, err := sig.callString(ctx, exportSelectedEvents)
+	if err != nil {
+		sig.Close()
+		return nil, err
+	}
+	if err := decodeJSON(selectedEvents, &sig.selectedEvents); err != nil {
+		sig.Close()
+		return nil, fmt.Errorf("decoding %s: %w", exportSelectedEvents, err)
+	}
+	return &sig, nil
+}
+
+// start creates the sandbox of the signature, and instantiates the module in it. The initialization function of a
+// WASI reactor runs within the time limit.
+func (sig *Signature) start() error {
+	ctx := context.Background()
+	sig.runtime = newRuntime(ctx, sig.limits)
+	compiled, err := sig.runtime.CompileModule(ctx, sig.binary)
+	if err != nil {
+		sig.stop()
+		return fmt.Errorf("compiling wasm module: %w", err)
+	}
+	for _, f := range compiled.ImportedFunctions() {
+		if moduleName, _, _ := f.Import(); moduleName == wasi_snapshot_preview1.ModuleName {
+			if _, err := wasi_snapshot_preview1.Instantiate(ctx, sig.runtime); err != nil {
+				sig.stop()
+				return err
+			}
+			break
+		}
+	}
+
+	callCtx, cancel := callContext(sig.limits)
+	defer cancel()
+	sig.module, err = sig.runtime.InstantiateModule(callCtx, compiled, wazero.NewModuleConfig().
+		WithStartFunctions("_initialize").
+		WithStdout(os.Stderr).
+		WithStderr(os.Stderr))
+	if err != nil {
+		sig.stop()
+		return fmt.Errorf("instantiating wasm module: %w", err)
+	}
+	if sig.module.Memory() == nil {
+		sig.stop()
+		return fmt.Errorf("invalid wasm module: memory isn't exported")
+	}
+	return nil
+}
+
+// stop stops the sandbox of the signature, e.g. after a call into the module was stopped at the time limit
+func (sig *Signature) stop() {
+	if sig.runtime != nil {
+		sig.runtime.Close(context.Background())
+	}
+	sig.runtime = nil
+	sig.module = nil
+}
+
+// callString calls an exported function of the module that returns a string
+func (sig *Signature) callString(ctx context.Context, name string, params ...uint64) ([]byte, error) {
+	results, err := call(ctx, sig.module, name, params...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("function %s returned %d results, expected 1", name, len(results))
+	}
+	if results[0] == 0 {
+		return nil, nil
+	}
+	return read(sig.module.Memory(), uint32(results[0]>>32), uint32(results[0]))
+}
+
+// Init implements the Signature interface by storing the handler of the findings
+func (sig *Signature) Init(cb types.SignatureHandler) error {
+	sig.cb = cb
+	return nil
+}
+
+// GetMetadata implements the Signature interface by returning the result of the module's tracee_metadata function
+func (sig *Signature) GetMetadata() (types.SignatureMetadata, error) {
+	return sig.metadata, nil
+}
+
+// GetSelectedEvents implements the Signature interface by returning the result of the module's
+// tracee_selected_events function
+func (sig *Signature) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	return sig.selectedEvents, nil
+}
+
+// OnEvent implements the Signature interface by calling the module's tracee_on_event function
+func (sig *Signature) OnEvent(e types.Event) error {
+	ee, err := toTraceeEvent(e)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(ee)
+	if err != nil {
+		return err
+	}
+
+	if sig.module == nil {
+		if err := sig.start(); err != nil {
+			return fmt.Errorf("restarting wasm sandbox: %w", err)
+		}
+	}
+	ctx, cancel := callContext(sig.limits)
+	defer cancel()
+	output, err := sig.onEvent(ctx, input)
+	if err != nil {
+		// the state of the module is unknown, e.g. if it was stopped in the middle of handling the event
+		sig.stop()
+		return err
+	}
+	if len(output) == 0 {
+		return nil
+	}
+
+	var results []interface{}
+	if err := decodeJSON(output, &results); err != nil {
+		return fmt.Errorf("decoding %s: %w", exportOnEvent, err)
+	}
+	for _, result := range results {
+		if finding, ok := newFinding(result, ee, sig.metadata); ok {
+			sig.cb(finding)
+		}
+	}
+	return nil
+}
+
+func (sig *Signature) onEvent(ctx context.Context, input []byte) ([]byte, error) {
+	ptr, err := call32(ctx, sig.module, exportAlloc, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	if err := write(sig.module.Memory(), ptr, input); err != nil {
+		return nil, err
+	}
+	return sig.callString(ctx, exportOnEvent, uint64(ptr), uint64(len(input)))
+}
+
+// OnSignal implements the Signature interface by handling lifecycle events of the signature
+func (sig *Signature) OnSignal(_ types.Signal) error {
+	// noop
+	return nil
+}
+
+// Close implements the Signature interface by stopping the sandbox of the signature
+func (sig *Signature) Close() {
+	sig.stop()
+}
@@ -0,0 +1,154 @@
+package wasmsig
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testMetadata       = `{"id": "TRC-WASM-ABI", "version": "0.1.0", "name": "test name", "properties": {"p1": 1}}`
+	testSelectedEvents = `[{"source": "tracee", "name": "execve"}]`
+	testFindings       = `[true, {"ip": "10.0.0.1"}, false, "not a finding"]`
+	testLargeEvent     = 1000 // events larger than this make the test module loop forever
+)
+
+// testModule returns a module that implements the tracee signature ABI, and returns the same findings for every
+// event. Its memory is memoryMin pages.
+func testModule(memoryMin uint32) []byte {
+	packed := func(ptr int64, s string) []byte {
+		return appendS64([]byte{0x42}, ptr<<32|int64(len(s))) // i64.const
+	}
+
+	onEvent := []byte{
+		0x20, 0x01, // local.get 1 (len)
+		0x41, // i32.const
+	}
+	onEvent = appendS64(onEvent, testLargeEvent)
+	onEvent = append(onEvent,
+		0x4b,       // i32.gt_u
+		0x04, 0x40, // if
+		0x03, 0x40, // loop
+		0x0c, 0x00, // br 0
+		0x0b, // end
+		0x0b, // end
+	)
+	onEvent = append(onEvent, packed(512, testFindings)...)
+
+	m := moduleEncoder{
+		types: []funcType{
+			{results: []byte{valueTypeI64}},
+			{params: []byte{valueTypeI32}, results: []byte{valueTypeI32}},
+			{params: []byte{valueTypeI32, valueTypeI32}, results: []byte{valueTypeI64}},
+		},
+		funcs: []uint32{1, 0, 0, 2},
+		code: [][]byte{
+			appendS64([]byte{0x41}, 4096), // i32.const 4096
+			packed(0, testMetadata),
+			packed(256, testSelectedEvents),
+			onEvent,
+		},
+		exports: []funcExport{
+			{name: exportAlloc, index: 0},
+			{name: exportMetadata, index: 1},
+			{name: exportSelectedEvents, index: 2},
+			{name: exportOnEvent, index: 3},
+		},
+		memoryMin: memoryMin,
+		data: []dataSegment{
+			{offset: 0, data: []byte(testMetadata)},
+			{offset: 256, data: []byte(testSelectedEvents)},
+			{offset: 512, data: []byte(testFindings)},
+		},
+	}
+	return m.encode()
+}
+
+func TestSignature(t *testing.T) {
+	sig, err := NewSignature(Limits{MemoryPages: 16, Timeout: 100 * time.Millisecond}, testModule(1))
+	require.NoError(t, err)
+	defer sig.Close()
+
+	metadata, err := sig.GetMetadata()
+	require.NoError(t, err)
+	expectedMetadata := types.SignatureMetadata{
+		ID:         "TRC-WASM-ABI",
+		Version:    "0.1.0",
+		Name:       "test name",
+		Properties: map[string]interface{}{"p1": json.Number("1")},
+	}
+	assert.Equal(t, expectedMetadata, metadata)
+	selectedEvents, err := sig.GetSelectedEvents()
+	require.NoError(t, err)
+	assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, selectedEvents)
+
+	event := tracee.Event{EventName: "execve", Args: []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/ls"}}}
+	parsedEvent, err := engine.ToParsedEvent(event)
+	require.NoError(t, err)
+	largeEvent := tracee.Event{EventName: "execve", Args: []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: strings.Repeat("a", testLargeEvent)}}}
+	expectedFindings := []types.Finding{
+		{Data: nil, Context: event, SigMetadata: expectedMetadata},
+		{Data: map[string]interface{}{"ip": "10.0.0.1"}, Context: event, SigMetadata: expectedMetadata},
+	}
+
+	testCases := []struct {
+		name     string
+		event    types.Event
+		findings []types.Finding
+		err      string
+	}{
+		{
+			name:     "event",
+			event:    event,
+			findings: expectedFindings,
+		},
+		{
+			name:     "parsed event",
+			event:    parsedEvent,
+			findings: expectedFindings,
+		},
+		{
+			name:  "time limit exceeded",
+			event: largeEvent,
+			err:   "calling tracee_on_event: time limit exceeded",
+		},
+		{
+			name:     "event after the time limit was exceeded",
+			event:    event,
+			findings: expectedFindings,
+		},
+		{
+			name:  "unknown event",
+			event: "not an event",
+			err:   "unrecognized event type: string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			holder := signaturestest.FindingsHolder{}
+			require.NoError(t, sig.Init(holder.OnFinding))
+			err := sig.OnEvent(tc.event)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.findings, holder.Values)
+		})
+	}
+}
+
+func TestSignature_MemoryLimit(t *testing.T) {
+	_, err := NewSignature(Limits{MemoryPages: 16, Timeout: time.Second}, testModule(17))
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package wasmsig
+
+import "encoding/binary"
+
+// wasm binary format constants, see https://webassembly.github.io/spec/core/binary/index.html
+const (
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionMemory   = 5
+	sectionExport   = 7
+	sectionCode     = 10
+	sectionData     = 11
+
+	valueTypeI32 = 0x7f
+	valueTypeI64 = 0x7e
+
+	externFunc   = 0x00
+	externMemory = 0x02
+)
+
+// funcType is the signature of a wasm function
+type funcType struct {
+	params  []byte
+	results []byte
+}
+
+// funcImport is a function that a module imports from another module
+type funcImport struct {
+	module string
+	name   string
+	typ    uint32
+}
+
+// funcExport is a function that a module exports, by its index in the function index space (imports first)
+type funcExport struct {
+	name  string
+	index uint32
+}
+
+// dataSegment is data that is written to the memory of a module when it is instantiated
+type dataSegment struct {
+	offset int32
+	data   []byte
+}
+
+// moduleEncoder encodes a minimal wasm module, with a single memory that is exported as "memory"
+type moduleEncoder struct {
+	types     []funcType
+	imports   []funcImport
+	funcs     []uint32 // the type of each function that is defined in the module
+	code      [][]byte // the body of each function that is defined in the module, without the end opcode
+	exports   []funcExport
+	memoryMin uint32
+	memoryMax uint32 // no maximum if 0
+	data      []dataSegment
+}
+
+func (m *moduleEncoder) encode() []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	var types []byte
+	types = appendU32(types, uint32(len(m.types)))
+	for _, t := range m.types {
+		types = append(types, 0x60)
+		types = appendU32(types, uint32(len(t.params)))
+		types = append(types, t.params...)
+		types = appendU32(types, uint32(len(t.results)))
+		types = append(types, t.results...)
+	}
+	module = appendSection(module, sectionType, types)
+
+	if len(m.imports) > 0 {
+		var imports []byte
+		imports = appendU32(imports, uint32(len(m.imports)))
+		for _, i := range m.imports {
+			imports = appendName(imports, i.module)
+			imports = appendName(imports, i.name)
+			imports = append(imports, externFunc)
+			imports = appendU32(imports, i.typ)
+		}
+		module = appendSection(module, sectionImport, imports)
+	}
+
+	if len(m.funcs) > 0 {
+		var funcs []byte
+		funcs = appendU32(funcs, uint32(len(m.funcs)))
+		for _, typ := range m.funcs {
+			funcs = appendU32(funcs, typ)
+		}
+		module = appendSection(module, sectionFunction, funcs)
+	}
+
+	memory := []byte{1}
+	if m.memoryMax > 0 {
+		memory = append(memory, 0x01)
+		memory = appendU32(memory, m.memoryMin)
+		memory = appendU32(memory, m.memoryMax)
+	} else {
+		memory = append(memory, 0x00)
+		memory = appendU32(memory, m.memoryMin)
+	}
+	module = appendSection(module, sectionMemory, memory)
+
+	var exports []byte
+	exports = appendU32(exports, uint32(len(m.exports)+1))
+	exports = appendName(exports, "memory")
+	exports = append(exports, externMemory, 0)
+	for _, e := range m.exports {
+		exports = appendName(exports, e.name)
+		exports = append(exports, externFunc)
+		exports = appendU32(exports, e.index)
+	}
+	module = appendSection(module, sectionExport, exports)
+
+	if len(m.code) > 0 {
+		var code []byte
+		code = appendU32(code, uint32(len(m.code)))
+		for _, body := range m.code {
+			// no locals, the body and the end opcode
+			code = appendU32(code, uint32(len(body)+2))
+			code = append(code, 0)
+			code = append(code, body...)
+			code = append(code, 0x0b)
+		}
+		module = appendSection(module, sectionCode, code)
+	}
+
+	if len(m.data) > 0 {
+		var data []byte
+		data = appendU32(data, uint32(len(m.data)))
+		for _, d := range m.data {
+			// active segment of memory 0, at an i32.const offset
+			data = append(data, 0x00, 0x41)
+			data = appendS64(data, int64(d.offset))
+			data = append(data, 0x0b)
+			data = appendU32(data, uint32(len(d.data)))
+			data = append(data, d.data...)
+		}
+		module = appendSection(module, sectionData, data)
+	}
+
+	return module
+}
+
+func appendSection(b []byte, id byte, content []byte) []byte {
+	b = append(b, id)
+	b = appendU32(b, uint32(len(content)))
+	return append(b, content...)
+}
+
+func appendName(b []byte, name string) []byte {
+	b = appendU32(b, uint32(len(name)))
+	return append(b, name...)
+}
+
+func appendU32(b []byte, v uint32) []byte {
+	var buf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(buf[:], uint64(v))
+	return append(b, buf[:n]...)
+}
+
+// appendS64 appends a signed LEB128 integer, as used by the const instructions
+func appendS64(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,516 @@
+package wasmsig
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/compile"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	ruleMatch          = "tracee_match"
+	ruleSelectedEvents = "tracee_selected_events"
+	ruleMetadata       = "__rego_metadoc__"
+	packageNameRegex   = `package\s.*`
+
+	// opaHostModule exports the host functions of the OPA wasm ABI to the env module
+	opaHostModule = "tracee_opa"
+)
+
+// opaImports are the functions that a policy imports from the env module, in the order of their indices
+var opaImports = []struct {
+	name string
+	typ  uint32
+}{
+	{"opa_abort", 0},
+	{"opa_builtin0", 1},
+	{"opa_builtin1", 2},
+	{"opa_builtin2", 3},
+	{"opa_builtin3", 4},
+	{"opa_builtin4", 5},
+	{"opa_println", 0},
+}
+
+// RegoSignature is a rego signature (see regosig.RegoSignature) that is compiled to wasm, and evaluated with the
+// OPA wasm ABI: https://www.openpolicyagent.org/docs/latest/wasm/
+type RegoSignature struct {
+	cb             types.SignatureHandler
+	limits         Limits
+	policy         []byte
+	runtime        wazero.Runtime
+	vm             *opaVM // nil after the sandbox was stopped, until it is recreated by the next event
+	metadata       types.SignatureMetadata
+	selectedEvents []types.SignatureEventSelector
+	matchEntry     string
+}
+
+// NewRegoSignature compiles the tracee_match rule of the provided rego code string to wasm, and creates a new
+// RegoSignature from it. If optimize is set, the rule is partially evaluated before it is compiled.
+func NewRegoSignature(limits Limits, optimize bool, regoCodes ...string) (*RegoSignature, error) {
+	re := regexp.MustCompile(packageNameRegex)
+
+	b := &bundle.Bundle{}
+	b.Manifest.Init()
+	regoMap := make(map[string]string)
+	var pkgName string
+	for _, regoCode := range regoCodes {
+		splittedName := strings.Split(re.FindString(regoCode), " ")
+		if len(splittedName) < 2 {
+			return nil, fmt.Errorf("invalid rego code received")
+		}
+		regoModuleName := splittedName[1]
+		if !strings.Contains(regoCode, "package tracee.helpers") {
+			pkgName = regoModuleName
+		}
+		regoMap[regoModuleName] = regoCode
+		parsed, err := ast.ParseModule(regoModuleName, regoCode)
+		if err != nil {
+			return nil, err
+		}
+		b.Modules = append(b.Modules, bundle.ModuleFile{
+			URL:    regoModuleName,
+			Path:   regoModuleName,
+			Raw:    []byte(regoCode),
+			Parsed: parsed,
+		})
+	}
+
+	res := RegoSignature{
+		limits:     limits,
+		matchEntry: strings.ReplaceAll(pkgName, ".", "/") + "/" + ruleMatch,
+	}
+
+	// the metadata and the selected events don't depend on the input, so they are evaluated once when loading
+	compiledRego, err := ast.CompileModules(regoMap)
+	if err != nil {
+		return nil, err
+	}
+	if err := evalQuery(compiledRego, fmt.Sprintf("data.%s.%s", pkgName, ruleMetadata), &res.metadata); err != nil {
+		return nil, err
+	}
+	if err := evalQuery(compiledRego, fmt.Sprintf("data.%s.%s", pkgName, ruleSelectedEvents), &res.selectedEvents); err != nil {
+		return nil, err
+	}
+
+	c := compile.New().
+		WithTarget(compile.TargetWasm).
+		WithEntrypoints(res.matchEntry).
+		WithBundle(b)
+	if optimize {
+		c = c.WithOptimizationLevel(1)
+	}
+	if err := c.Build(context.Background()); err != nil {
+		return nil, fmt.Errorf("compiling rego to wasm: %w", err)
+	}
+	if len(c.Bundle().WasmModules) == 0 {
+		return nil, fmt.Errorf("compiling rego to wasm: no wasm module was created")
+	}
+	res.policy = c.Bundle().WasmModules[0].Raw
+
+	if err := res.start(); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// evalQuery evaluates a query with the rego interpreter, and decodes its result into v
+func evalQuery(compiledRego *ast.Compiler, query string, v interface{}) error {
+	evalRes, err := rego.New(
+		rego.Compiler(compiledRego),
+		rego.Query(query),
+	).Eval(context.TODO())
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if len(evalRes) > 0 && len(evalRes[0].Expressions) > 0 {
+		value = evalRes[0].Expressions[0].Value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := decodeJSON(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", query, err)
+	}
+	return nil
+}
+
+// start creates the sandbox of the signature, and instantiates the policy in it. Instantiating a policy doesn't run
+// its rules, so it isn't limited in time.
+func (sig *RegoSignature) start() error {
+	ctx := context.Background()
+	sig.runtime = newRuntime(ctx, sig.limits)
+	vm, err := newOPAVM(ctx, sig.runtime, sig.policy, sig.limits)
+	if err != nil {
+		sig.stop()
+		return err
+	}
+	sig.vm = vm
+	return nil
+}
+
+// stop stops the sandbox of the signature, e.g. after a call into the policy was stopped at the time limit
+func (sig *RegoSignature) stop() {
+	if sig.runtime != nil {
+		sig.runtime.Close(context.Background())
+	}
+	sig.runtime = nil
+	sig.vm = nil
+}
+
+// Init implements the Signature interface by storing the handler of the findings
+func (sig *RegoSignature) Init(cb types.SignatureHandler) error {
+	sig.cb = cb
+	return nil
+}
+
+// GetMetadata implements the Signature interface by returning the result of the policy's __rego_metadoc__ rule
+func (sig *RegoSignature) GetMetadata() (types.SignatureMetadata, error) {
+	return sig.metadata, nil
+}
+
+// GetSelectedEvents implements the Signature interface by returning the result of the policy's
+// tracee_selected_events rule
+func (sig *RegoSignature) GetSelectedEvents() ([]types.SignatureEventSelector, error) {
+	return sig.selectedEvents, nil
+}
+
+// OnEvent implements the Signature interface by evaluating the policy's tracee_match rule, like
+// regosig.RegoSignature does
+func (sig *RegoSignature) OnEvent(e types.Event) error {
+	var input []byte
+	ee, err := toTraceeEvent(e)
+	if err != nil {
+		return err
+	}
+	if pe, ok := e.(engine.ParsedEvent); ok {
+		input = []byte(pe.Value.String())
+	} else {
+		input, err = json.Marshal(ee)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sig.vm == nil {
+		if err := sig.start(); err != nil {
+			return fmt.Errorf("restarting wasm sandbox: %w", err)
+		}
+	}
+	ctx, cancel := callContext(sig.limits)
+	defer cancel()
+	result, err := sig.vm.eval(ctx, sig.matchEntry, input)
+	if err != nil {
+		// the state of the policy is unknown, e.g. if it was stopped in the middle of the evaluation
+		sig.stop()
+		return fmt.Errorf("evaluating rego: %w", err)
+	}
+	if finding, ok := newFinding(result, ee, sig.metadata); ok {
+		sig.cb(finding)
+	}
+	return nil
+}
+
+// OnSignal implements the Signature interface by handling lifecycle events of the signature
+func (sig *RegoSignature) OnSignal(_ types.Signal) error {
+	// noop
+	return nil
+}
+
+// Close implements the Signature interface by stopping the sandbox of the signature
+func (sig *RegoSignature) Close() {
+	sig.stop()
+}
+
+// opaVM is an instance of a policy that was compiled to wasm
+type opaVM struct {
+	policy      api.Module
+	memory      api.Memory
+	heapPtr     uint64 // the heap pointer after the policy was instantiated, which is restored before each evaluation
+	entrypoints map[string]int32
+	builtins    map[int32]topdown.BuiltinFunc
+	bctx        topdown.BuiltinContext
+}
+
+// newOPAVM instantiates a policy. The memory of the policy is imported from an env module, which is generated to
+// define a memory within the limits and to re-export the host functions of the ABI.
+func newOPAVM(ctx context.Context, r wazero.Runtime, policy []byte, limits Limits) (*opaVM, error) {
+	compiled, err := r.CompileModule(ctx, policy)
+	if err != nil {
+		return nil, fmt.Errorf("compiling wasm policy: %w", err)
+	}
+	memories := compiled.ImportedMemories()
+	if len(memories) != 1 {
+		return nil, fmt.Errorf("invalid wasm policy: expected 1 imported memory, found %d", len(memories))
+	}
+	memoryMin := memories[0].Min()
+	memoryMax := limits.MemoryPages
+	if max, ok := memories[0].Max(); ok && max < memoryMax {
+		memoryMax = max
+	}
+	if memoryMin > memoryMax {
+		return nil, fmt.Errorf("wasm policy requires %d pages of memory, more than the limit of %d pages", memoryMin, memoryMax)
+	}
+
+	vm := &opaVM{}
+	i32 := api.ValueTypeI32
+	host := r.NewHostModuleBuilder(opaHostModule)
+	host.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(vm.abort), []api.ValueType{i32}, nil).Export("opa_abort")
+	host.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(vm.println), []api.ValueType{i32}, nil).Export("opa_println")
+	for arity := 0; arity <= 4; arity++ {
+		params := make([]api.ValueType, arity+2) // the builtin id, the opa context and the operands
+		for i := range params {
+			params[i] = i32
+		}
+		host.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(vm.builtin), params, []api.ValueType{i32}).Export(fmt.Sprintf("opa_builtin%d", arity))
+	}
+	if _, err := host.Instantiate(ctx); err != nil {
+		return nil, err
+	}
+
+	// type 0 is of opa_abort and opa_println, and type N+1 is of opa_builtinN
+	env := moduleEncoder{memoryMin: memoryMin, memoryMax: memoryMax}
+	env.types = append(env.types, funcType{params: []byte{valueTypeI32}})
+	for arity := 0; arity <= 4; arity++ {
+		params := make([]byte, arity+2)
+		for i := range params {
+			params[i] = valueTypeI32
+		}
+		env.types = append(env.types, funcType{params: params, results: []byte{valueTypeI32}})
+	}
+	for i, imp := range opaImports {
+		env.imports = append(env.imports, funcImport{module: opaHostModule, name: imp.name, typ: imp.typ})
+		env.exports = append(env.exports, funcExport{name: imp.name, index: uint32(i)})
+	}
+	envModule, err := r.InstantiateWithConfig(ctx, env.encode(), wazero.NewModuleConfig().WithName("env"))
+	if err != nil {
+		return nil, fmt.Errorf("instantiating env module: %w", err)
+	}
+	vm.memory = envModule.Memory()
+
+	vm.policy, err = r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("policy"))
+	if err != nil {
+		return nil, fmt.Errorf("instantiating wasm policy: %w", err)
+	}
+
+	var builtinIDs map[string]json.Number
+	if err := vm.exportedJSON(ctx, "builtins", &builtinIDs); err != nil {
+		return nil, err
+	}
+	vm.builtins = make(map[int32]topdown.BuiltinFunc, len(builtinIDs))
+	for name, id := range builtinIDs {
+		f := topdown.GetBuiltin(name)
+		if f == nil {
+			return nil, fmt.Errorf("wasm policy requires unknown builtin %s", name)
+		}
+		n, err := id.Int64()
+		if err != nil {
+			return nil, err
+		}
+		vm.builtins[int32(n)] = f
+	}
+
+	var entrypoints map[string]json.Number
+	if err := vm.exportedJSON(ctx, "entrypoints", &entrypoints); err != nil {
+		return nil, err
+	}
+	vm.entrypoints = make(map[string]int32, len(entrypoints))
+	for name, id := range entrypoints {
+		n, err := id.Int64()
+		if err != nil {
+			return nil, err
+		}
+		vm.entrypoints[name] = int32(n)
+	}
+
+	heapPtr, err := call32(ctx, vm.policy, "opa_heap_ptr_get")
+	if err != nil {
+		return nil, err
+	}
+	vm.heapPtr = uint64(heapPtr)
+	return vm, nil
+}
+
+// exportedJSON decodes the value that is returned by an exported function of the policy
+func (vm *opaVM) exportedJSON(ctx context.Context, name string, v interface{}) error {
+	addr, err := call32(ctx, vm.policy, name)
+	if err != nil {
+		return err
+	}
+	data, err := vm.dumpJSON(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if err := decodeJSON(data, v); err != nil {
+		return fmt.Errorf("decoding %s of wasm policy: %w", name, err)
+	}
+	return nil
+}
+
+// dumpJSON returns the JSON of a value in the memory of the policy
+func (vm *opaVM) dumpJSON(ctx context.Context, addr uint32) ([]byte, error) {
+	str, err := call32(ctx, vm.policy, "opa_json_dump", uint64(addr))
+	if err != nil {
+		return nil, err
+	}
+	return readCString(vm.memory, str)
+}
+
+// parseValue parses a JSON or rego value into the memory of the policy, and returns its address
+func (vm *opaVM) parseValue(ctx context.Context, value []byte) (uint32, error) {
+	ptr, err := call32(ctx, vm.policy, "opa_malloc", uint64(len(value)))
+	if err != nil {
+		return 0, err
+	}
+	if err := write(vm.memory, ptr, value); err != nil {
+		return 0, err
+	}
+	addr, err := call32(ctx, vm.policy, "opa_value_parse", uint64(ptr), uint64(len(value)))
+	if err != nil {
+		return 0, err
+	}
+	if addr == 0 {
+		return 0, fmt.Errorf("wasm policy failed to parse value")
+	}
+	return addr, nil
+}
+
+// eval evaluates an entrypoint of the policy with the given input, and returns its result, or nil if it is undefined
+func (vm *opaVM) eval(ctx context.Context, entrypoint string, input []byte) (interface{}, error) {
+	id, ok := vm.entrypoints[entrypoint]
+	if !ok {
+		return nil, fmt.Errorf("wasm policy has no entrypoint %s", entrypoint)
+	}
+	vm.bctx = topdown.BuiltinContext{
+		Context: ctx,
+		Metrics: metrics.New(),
+		Seed:    rand.Reader,
+		Time:    ast.NumberTerm(json.Number(strconv.FormatInt(time.Now().UnixNano(), 10))),
+		Cancel:  topdown.NewCancel(),
+		Cache:   make(builtins.Cache),
+	}
+
+	// the heap of the previous evaluation is released at once
+	if _, err := call(ctx, vm.policy, "opa_heap_ptr_set", vm.heapPtr); err != nil {
+		return nil, err
+	}
+	evalCtx, err := call32(ctx, vm.policy, "opa_eval_ctx_new")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := call(ctx, vm.policy, "opa_eval_ctx_set_entrypoint", uint64(evalCtx), uint64(id)); err != nil {
+		return nil, err
+	}
+	if input != nil {
+		addr, err := vm.parseValue(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := call(ctx, vm.policy, "opa_eval_ctx_set_input", uint64(evalCtx), uint64(addr)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := call(ctx, vm.policy, "eval", uint64(evalCtx)); err != nil {
+		return nil, err
+	}
+	resultAddr, err := call32(ctx, vm.policy, "opa_eval_ctx_get_result", uint64(evalCtx))
+	if err != nil {
+		return nil, err
+	}
+	data, err := vm.dumpJSON(ctx, resultAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the result set of an entrypoint is [{"result": value}], or empty if it is undefined
+	var resultSet []map[string]interface{}
+	if err := decodeJSON(data, &resultSet); err != nil {
+		return nil, fmt.Errorf("decoding result of %s: %w", entrypoint, err)
+	}
+	if len(resultSet) == 0 {
+		return nil, nil
+	}
+	return resultSet[0]["result"], nil
+}
+
+// abort implements opa_abort(addr), which the policy calls on unrecoverable errors
+func (vm *opaVM) abort(_ context.Context, _ api.Module, stack []uint64) {
+	msg, err := readCString(vm.memory, uint32(stack[0]))
+	if err != nil {
+		panic(fmt.Errorf("opa_abort: %v", err))
+	}
+	panic(fmt.Errorf("opa_abort: %s", msg))
+}
+
+// println implements opa_println(addr), which prints the debug messages of the policy
+func (vm *opaVM) println(_ context.Context, _ api.Module, stack []uint64) {
+	msg, err := readCString(vm.memory, uint32(stack[0]))
+	if err != nil {
+		panic(fmt.Errorf("opa_println: %v", err))
+	}
+	fmt.Fprintln(os.Stderr, string(msg))
+}
+
+// builtin implements opa_builtin<N>(id, ctx, operands...), which calls the builtins that aren't implemented in wasm
+func (vm *opaVM) builtin(ctx context.Context, _ api.Module, stack []uint64) {
+	f, ok := vm.builtins[int32(stack[0])]
+	if !ok {
+		panic(fmt.Errorf("opa_builtin: unknown builtin %d", int32(stack[0])))
+	}
+	var operands []*ast.Term
+	for _, addr := range stack[2:] {
+		str, err := call32(ctx, vm.policy, "opa_value_dump", addr)
+		if err != nil {
+			panic(err)
+		}
+		value, err := readCString(vm.memory, str)
+		if err != nil {
+			panic(err)
+		}
+		term, err := ast.ParseTerm(string(value))
+		if err != nil {
+			panic(fmt.Errorf("opa_builtin: parsing operand: %v", err))
+		}
+		operands = append(operands, term)
+	}
+
+	var output *ast.Term
+	err := f(vm.bctx, operands, func(t *ast.Term) error {
+		output = t
+		return nil
+	})
+	if err != nil {
+		if errors.As(err, &topdown.Halt{}) {
+			panic(err)
+		}
+		// as in OPA's wasm runtime, other errors make the result undefined
+	}
+	if output == nil {
+		stack[0] = 0
+		return
+	}
+	addr, err := vm.parseValue(ctx, []byte(output.String()))
+	if err != nil {
+		panic(err)
+	}
+	stack[0] = uint64(addr)
+}
@@ -0,0 +1,182 @@
+package wasmsig_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/signaturestest"
+	"github.com/aquasecurity/tracee/tracee-rules/signatures/wasm/wasmsig"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegoCode = `package tracee.TRC_WASM
+
+import data.tracee.helpers
+
+__rego_metadoc__ := {
+	"id": "TRC-WASM",
+	"version": "0.1.0",
+	"name": "test name",
+	"description": "test description",
+	"tags": [ "tag1" ],
+	"properties": {
+		"p1": "test",
+		"p2": 1
+	}
+}
+
+tracee_selected_events[eventSelector] {
+	eventSelector := {
+		"source": "tracee",
+		"name": "execve"
+	}
+}
+
+tracee_match = res {
+	pathname := helpers.get_tracee_argument("pathname")
+	endswith(pathname, "yo")
+	res := {
+		"pathname": pathname,
+		"upper": upper(pathname),
+		"matched": regex.match("^/bin/.*yo$", pathname)
+	}
+}
+`
+
+func testRegoHelpers(t *testing.T) string {
+	helpers, err := ioutil.ReadFile("../../rego/helpers.rego")
+	require.NoError(t, err)
+	return string(helpers)
+}
+
+func TestRegoSignature(t *testing.T) {
+	testMetadata := types.SignatureMetadata{
+		ID:          "TRC-WASM",
+		Version:     "0.1.0",
+		Name:        "test name",
+		Description: "test description",
+		Tags:        []string{"tag1"},
+		Properties: map[string]interface{}{
+			"p1": "test",
+			"p2": json.Number("1"),
+		},
+	}
+	matching := tracee.Event{
+		EventName: "execve",
+		Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/yo"}},
+	}
+
+	testCases := []struct {
+		name     string
+		event    tracee.Event
+		parse    bool
+		findings []types.Finding
+	}{
+		{
+			name:  "matching event",
+			event: matching,
+			findings: []types.Finding{{
+				Data:        map[string]interface{}{"pathname": "/bin/yo", "upper": "/BIN/YO", "matched": true},
+				Context:     matching,
+				SigMetadata: testMetadata,
+			}},
+		},
+		{
+			name:  "matching parsed event",
+			event: matching,
+			parse: true,
+			findings: []types.Finding{{
+				Data:        map[string]interface{}{"pathname": "/bin/yo", "upper": "/BIN/YO", "matched": true},
+				Context:     matching,
+				SigMetadata: testMetadata,
+			}},
+		},
+		{
+			name: "not matching event",
+			event: tracee.Event{
+				EventName: "execve",
+				Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/ls"}},
+			},
+		},
+	}
+
+	for _, optimize := range []bool{false, true} {
+		sig, err := wasmsig.NewRegoSignature(wasmsig.DefaultLimits, optimize, testRegoCode, testRegoHelpers(t))
+		require.NoError(t, err)
+		defer sig.Close()
+
+		metadata, err := sig.GetMetadata()
+		require.NoError(t, err)
+		assert.Equal(t, testMetadata, metadata)
+		selectedEvents, err := sig.GetSelectedEvents()
+		require.NoError(t, err)
+		assert.Equal(t, []types.SignatureEventSelector{{Source: "tracee", Name: "execve"}}, selectedEvents)
+
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s,optimize=%t", tc.name, optimize), func(t *testing.T) {
+				holder := signaturestest.FindingsHolder{}
+				require.NoError(t, sig.Init(holder.OnFinding))
+				var event types.Event = tc.event
+				if tc.parse {
+					event, err = engine.ToParsedEvent(tc.event)
+					require.NoError(t, err)
+				}
+				require.NoError(t, sig.OnEvent(event))
+				assert.Equal(t, tc.findings, holder.Values)
+			})
+		}
+	}
+}
+
+func TestRegoSignature_Limits(t *testing.T) {
+	loop := strings.Replace(testRegoCode, `endswith(pathname, "yo")`, `count([x | numbers.range(1, 10000000)[x]]) > 0`, 1)
+	sig, err := wasmsig.NewRegoSignature(wasmsig.Limits{MemoryPages: 16384, Timeout: 100 * time.Millisecond}, false, loop, testRegoHelpers(t))
+	require.NoError(t, err)
+	defer sig.Close()
+	holder := signaturestest.FindingsHolder{}
+	require.NoError(t, sig.Init(holder.OnFinding))
+
+	event := tracee.Event{
+		EventName: "execve",
+		Args:      []tracee.Argument{{ArgMeta: tracee.ArgMeta{Name: "pathname"}, Value: "/bin/yo"}},
+	}
+	start := time.Now()
+	err = sig.OnEvent(event)
+	require.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	_, err = wasmsig.NewRegoSignature(wasmsig.Limits{MemoryPages: 1, Timeout: time.Second}, false, testRegoCode, testRegoHelpers(t))
+	assert.Error(t, err)
+}
+
+func TestRegoSignature_Signatures(t *testing.T) {
+	helpers := testRegoHelpers(t)
+	paths, err := filepath.Glob("../../rego/*.rego")
+	require.NoError(t, err)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "helpers.rego") || strings.HasSuffix(path, "_test.rego") {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			code, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			sig, err := wasmsig.NewRegoSignature(wasmsig.DefaultLimits, false, string(code), helpers)
+			require.NoError(t, err)
+			defer sig.Close()
+			metadata, err := sig.GetMetadata()
+			require.NoError(t, err)
+			assert.NotEmpty(t, metadata.ID)
+			require.NoError(t, sig.Init(func(types.Finding) {}))
+			require.NoError(t, sig.OnEvent(tracee.Event{EventName: "execve"}))
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package wasmsig runs signatures that are compiled to WebAssembly: rego signatures that are compiled to wasm and
+// evaluated with the OPA wasm ABI, and arbitrary wasm modules that implement the tracee signature ABI.
+// Modules run in a pure Go runtime, each in its own sandbox with no access to the host other than the ABI, and
+// with limits on the memory of the module and the duration of each call into it.
+package wasmsig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	tracee "github.com/aquasecurity/tracee/tracee-ebpf/external"
+	"github.com/aquasecurity/tracee/tracee-rules/engine"
+	"github.com/aquasecurity/tracee/tracee-rules/types"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// wasmPageSize is the size of a page of wasm memory
+const wasmPageSize = 65536
+
+// Limits are the resources that a wasm signature can use
+type Limits struct {
+	MemoryPages uint32        // max size of the module's memory, in 64KiB pages
+	Timeout     time.Duration // max duration of handling a single event
+}
+
+// DefaultLimits are 32MiB of memory and 1 second per event
+var DefaultLimits = Limits{MemoryPages: 512, Timeout: time.Second}
+
+// MemoryLimitMiB returns the limits of a memory of the given size
+func (l Limits) MemoryLimitMiB(mib uint32) Limits {
+	l.MemoryPages = mib * (1024 * 1024 / wasmPageSize)
+	return l
+}
+
+// compilationCache is shared by the runtimes of all signatures, so modules aren't compiled again when a sandbox is
+// recreated after it was stopped
+var compilationCache = wazero.NewCompilationCache()
+
+// newRuntime creates the runtime of a single signature. Calls into its modules are stopped when their context is done.
+func newRuntime(ctx context.Context, limits Limits) wazero.Runtime {
+	return wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(limits.MemoryPages).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(compilationCache))
+}
+
+// callContext returns the context of calls into a module, which ends at the time limit
+func callContext(limits Limits) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), limits.Timeout)
+}
+
+// callError wraps an error of a call into a module, which may have been stopped at the time limit
+func callError(ctx context.Context, name string, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("calling %s: time limit exceeded: %w", name, err)
+	}
+	return fmt.Errorf("calling %s: %w", name, err)
+}
+
+// call calls an exported function of a module
+func call(ctx context.Context, mod api.Module, name string, params ...uint64) ([]uint64, error) {
+	fn := mod.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("module doesn't export function %s", name)
+	}
+	results, err := fn.Call(ctx, params...)
+	if err != nil {
+		return nil, callError(ctx, name, err)
+	}
+	return results, nil
+}
+
+// call32 calls an exported function of a module that returns a single i32
+func call32(ctx context.Context, mod api.Module, name string, params ...uint64) (uint32, error) {
+	results, err := call(ctx, mod, name, params...)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) != 1 {
+		return 0, fmt.Errorf("function %s returned %d results, expected 1", name, len(results))
+	}
+	return uint32(results[0]), nil
+}
+
+// read copies length bytes from the memory of a module
+func read(mem api.Memory, ptr, length uint32) ([]byte, error) {
+	data, ok := mem.Read(ptr, length)
+	if !ok {
+		return nil, fmt.Errorf("reading %d bytes at %#x: out of memory range", length, ptr)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// readCString copies a NUL terminated string from the memory of a module
+func readCString(mem api.Memory, ptr uint32) ([]byte, error) {
+	if ptr >= mem.Size() {
+		return nil, fmt.Errorf("reading string at %#x: out of memory range", ptr)
+	}
+	data, _ := mem.Read(ptr, mem.Size()-ptr)
+	n := bytes.IndexByte(data, 0)
+	if n < 0 {
+		return nil, fmt.Errorf("reading string at %#x: missing terminating NUL", ptr)
+	}
+	return append([]byte(nil), data[:n]...), nil
+}
+
+// write copies data to the memory of a module
+func write(mem api.Memory, ptr uint32, data []byte) error {
+	if !mem.Write(ptr, data) {
+		return fmt.Errorf("writing %d bytes at %#x: out of memory range", len(data), ptr)
+	}
+	return nil
+}
+
+// decodeJSON decodes JSON that was returned by a module, keeping numbers as json.Number like the rego signatures do
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// toTraceeEvent returns the tracee event of an event that a signature received
+func toTraceeEvent(e types.Event) (tracee.Event, error) {
+	switch v := e.(type) {
+	case tracee.Event:
+		return v, nil
+	case engine.ParsedEvent:
+		return v.Event, nil
+	default:
+		return tracee.Event{}, fmt.Errorf("unrecognized event type: %T", v)
+	}
+}
+
+// newFinding creates the finding of a value that a signature returned, like rego signatures do:
+// true creates a finding with no data, an object creates a finding with the object as its data and anything else
+// doesn't create a finding
+func newFinding(value interface{}, event tracee.Event, metadata types.SignatureMetadata) (types.Finding, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return types.Finding{Data: nil, Context: event, SigMetadata: metadata}, true
+		}
+	case map[string]interface{}:
+		return types.Finding{Data: v, Context: event, SigMetadata: metadata}, true
+	}
+	return types.Finding{}, false
+}
@@ -1,6 +1,12 @@
 // Package types includes the "API" of the rule-engine and includes public facing types that consumers of the rule engine should work with
 package types
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Signature is the basic unit of business logic for the rule-engine
 type Signature interface {
 	//GetMetadata allows the signature to declare information about itself
@@ -17,6 +23,17 @@ type Signature interface {
 	OnSignal(signal Signal) error
 }
 
+//SignatureGroup is a signature that evaluates a group of signatures together, e.g. rego signatures that are compiled
+//together. Its findings have the metadata of the signatures of the group, and its errors are SignatureError(s) of
+//the signatures of the group.
+type SignatureGroup interface {
+	Signature
+	//GetSignaturesMetadata returns the metadata of the signatures of the group
+	GetSignaturesMetadata() ([]SignatureMetadata, error)
+	//RemoveSignature removes a signature from the group, by its ID
+	RemoveSignature(id string) error
+}
+
 //SignatureMetadata represents information about the signature
 type SignatureMetadata struct {
 	ID          string
@@ -25,6 +42,17 @@ type SignatureMetadata struct {
 	Description string
 	Tags        []string
 	Properties  map[string]interface{}
+	Mitre       MitreMapping
+	//TickInterval is the interval of the SignalTick signals of the signature, by the time of the events. No ticks are
+	//sent if it's 0
+	TickInterval time.Duration
+}
+
+//MitreMapping declares the MITRE ATT&CK tactics and techniques that a signature detects, by their IDs, e.g. TA0005
+//and T1036
+type MitreMapping struct {
+	Tactics    []string
+	Techniques []string
 }
 
 //SignatureEventSelector represents events the signature is subscribed to
@@ -43,12 +71,105 @@ type Event interface{}
 //Signal is a generic lifecycle event for a signature
 type Signal interface{}
 
+//SignalSourceStart signals that an input source the signature is subscribed to has started, before its first event
+type SignalSourceStart string
+
 //SignalSourceComplete signals that an input source the signature was subscribed to has ended
 type SignalSourceComplete string
 
+//SignalTick is sent every TickInterval of the signature, by a clock that the timestamps of the events advance, so
+//replayed events are signaled the same as live ones. Ticks that are due together, when no event arrived for a while,
+//are sent as a single tick. When the engine reorders events, the timestamp of a tick is a watermark: the signature
+//already received all of the events before it, and won't receive older events
+type SignalTick struct {
+	Timestamp int //the time of the tick, like the timestamps of events
+}
+
+//SignalWatermark is sent to all signatures when the engine reorders events, as the watermark advances: the signature
+//already received all of the events before its timestamp, and won't receive older events
+type SignalWatermark struct {
+	Timestamp int //the watermark, like the timestamps of events
+}
+
+//SignalShutdown signals that the engine is shutting down, after the signature handled all of its events. Signatures
+//that keep state should report their pending findings
+type SignalShutdown struct{}
+
 //Finding is the main output of a signature. It represents a match result for the signature business logic
 type Finding struct {
 	Data        map[string]interface{}
 	Context     Event
 	SigMetadata SignatureMetadata
+	Artifacts   []Artifact
+	Mitre       *MitreAttack
+	Incident    *Incident
+}
+
+//MitreAttack is the MITRE ATT&CK tactics and techniques of the signature of a finding
+type MitreAttack struct {
+	Tactics    []MitreItem
+	Techniques []MitreItem
+}
+
+//MitreItem is a MITRE ATT&CK tactic or technique
+type MitreItem struct {
+	ID   string
+	Name string
+	URL  string
+}
+
+//Incident is a group of related findings: of the same container, or of the same process lineage, within a time
+//window. It is reported as the finding of an incident signature every time that a finding joins it.
+type Incident struct {
+	ID          string
+	ContainerID string
+	Start       int //the timestamp of the event of the first finding
+	End         int //the timestamp of the event of the last finding
+	Severity    int //the highest severity of the findings
+	Tactics     []MitreItem
+	Findings    int             //the number of findings
+	Timeline    []IncidentEntry //the findings of the latest events, up to 100, ordered by the timestamps of their events
+}
+
+//IncidentEntry is a finding of an incident
+type IncidentEntry struct {
+	Timestamp     int
+	SignatureID   string
+	SignatureName string
+	Severity      int
+	ProcessName   string
+	HostProcessID int
+	Data          map[string]interface{}
+}
+
+//Artifact is a file captured by tracee-ebpf which is related to a finding, e.g. the executable that was dropped
+type Artifact struct {
+	Path   string
+	SHA256 string
+	Size   int64
+}
+
+//SignatureError is an error of a single signature of a SignatureGroup
+type SignatureError struct {
+	ID  string
+	Err error
+}
+
+func (e SignatureError) Error() string {
+	return fmt.Sprintf("signature %s: %v", e.ID, e.Err)
+}
+
+func (e SignatureError) Unwrap() error {
+	return e.Err
+}
+
+//SignatureErrors are the errors of more than one signature of a SignatureGroup
+type SignatureErrors []SignatureError
+
+func (e SignatureErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
 }